@@ -435,6 +435,30 @@ func (wm *WalletManager) RestoreWalletFlow() error {
 
 }
 
+//CreateWalletWithMnemonicFlow 创建钱包并生成助记词流程
+func (wm *WalletManager) CreateWalletWithMnemonicFlow() error {
+
+	//先加载是否有配置文件
+	err := wm.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	return console.CreateWalletWithMnemonicFlow(false, wm.createWalletWithMnemonic)
+}
+
+//RestoreWalletWithMnemonicFlow 通过助记词恢复钱包
+func (wm *WalletManager) RestoreWalletWithMnemonicFlow() error {
+
+	//先加载是否有配置文件
+	err := wm.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	return console.RestoreWalletWithMnemonicFlow(false, wm.createWalletWithMnemonic)
+}
+
 //SetConfigFlow 初始化配置流程
 func (wm *WalletManager) SetConfigFlow(subCmd string) error {
 	file := wm.config.configFilePath + wm.config.configFileName
@@ -461,6 +461,29 @@ func (wm *WalletManager) CreateBatchAddress(name, password string, count uint64)
 //CreateNewWallet 创建钱包
 func (wm *WalletManager) CreateNewWallet(name, password string) (*openwallet.Wallet, string, error) {
 
+	seed, err := hdkeychain.GenerateSeed(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return wm.createNewWalletWithSeed(name, password, seed)
+}
+
+//createWalletWithMnemonic 通过助记词创建钱包，相同的助记词和密码短语恢复相同的钱包，返回密钥文件路径
+func (wm *WalletManager) createWalletWithMnemonic(name, password, mnemonic, passphrase string) (string, error) {
+
+	seed, err := hdkeystore.MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	_, keyFile, err := wm.createNewWalletWithSeed(name, password, seed)
+	return keyFile, err
+}
+
+//createNewWalletWithSeed 通过种子创建钱包
+func (wm *WalletManager) createNewWalletWithSeed(name, password string, seed []byte) (*openwallet.Wallet, string, error) {
+
 	var (
 		err     error
 		wallets []*openwallet.Wallet
@@ -485,15 +508,21 @@ func (wm *WalletManager) CreateNewWallet(name, password string) (*openwallet.Wal
 
 	fmt.Printf("Create new wallet hdkeystore...\n")
 
-	seed, err := hdkeychain.GenerateSeed(32)
+	extSeed, err := hdkeystore.GetExtendSeed(seed, wm.config.masterKey)
 	if err != nil {
 		return nil, "", err
 	}
 
-	extSeed, err := hdkeystore.GetExtendSeed(seed, wm.config.masterKey)
+	//相同的种子得到相同的钱包，已存在则不覆盖
+	newKey, err := hdkeystore.NewHDKey(extSeed, name, hdkeystore.OpenwCoinTypePath)
 	if err != nil {
 		return nil, "", err
 	}
+	for _, w := range wallets {
+		if w.WalletID == newKey.KeyID {
+			return nil, "", errors.New("The wallet already exists! ")
+		}
+	}
 
 	key, keyFile, err := hdkeystore.StoreHDKeyWithSeed(wm.config.keyDir, name, password, extSeed, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
 	if err != nil {
@@ -527,3 +527,27 @@ func (w *WalletManager) RestoreWalletFlow() error {
 
 	return nil
 }
+
+//CreateWalletWithMnemonicFlow 创建钱包并生成助记词流程
+func (wm *WalletManager) CreateWalletWithMnemonicFlow() error {
+
+	//先加载是否有配置文件
+	err := wm.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	return console.CreateWalletWithMnemonicFlow(true, wm.createWalletWithMnemonic)
+}
+
+//RestoreWalletWithMnemonicFlow 通过助记词恢复钱包
+func (wm *WalletManager) RestoreWalletWithMnemonicFlow() error {
+
+	//先加载是否有配置文件
+	err := wm.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	return console.RestoreWalletWithMnemonicFlow(true, wm.createWalletWithMnemonic)
+}
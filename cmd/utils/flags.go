@@ -107,6 +107,11 @@ var (
 		Usage: "Init operate",
 	}
 
+	MnemonicFlag = cli.BoolFlag{
+		Name: "mnemonic",
+		Usage: "Create or restore wallet with BIP39 mnemonic",
+	}
+
 	LogDirFlag = cli.StringFlag{
 		Name: "logdir",
 		Usage: "log files directory",
@@ -73,11 +73,14 @@ This command will init the wallet node.
 				Category:  "WALLET COMMANDS",
 				Flags: []cli.Flag{
 					utils.SymbolFlag,
+					utils.MnemonicFlag,
 				},
 				Description: `
-	wmd wallet new -s <symbol>
+	wmd wallet new -s <symbol> [--mnemonic]
 
 This command will start the wallet node, and create new wallet.
+With --mnemonic, the wallet key is created from a new BIP39 mnemonic,
+please write down the mnemonic as the backup.
 
 	`,
 			},
@@ -158,7 +161,15 @@ This command will Backup wallet key in filePath: ./data/<symbol>/key/.
 				Category: "WALLET COMMANDS",
 				Flags: []cli.Flag{
 					utils.SymbolFlag,
+					utils.MnemonicFlag,
 				},
+				Description: `
+	wmd wallet restore -s <symbol> [--mnemonic]
+
+This command will restore a wallet by backup key file and db file.
+With --mnemonic, the wallet key is restored from a BIP39 mnemonic.
+
+	`,
 			},
 		},
 	}
@@ -199,7 +210,17 @@ func createNewWallet(c *cli.Context) error {
 		return nil
 	}
 
-	err := m.CreateWalletFlow()
+	var err error
+	if c.Bool("mnemonic") {
+		mm, ok := m.(wmd.MnemonicWalletManagerInterface)
+		if !ok {
+			log.Error(symbol, " wallet manager does not support mnemonic!")
+			return nil
+		}
+		err = mm.CreateWalletWithMnemonicFlow()
+	} else {
+		err = m.CreateWalletFlow()
+	}
 	if err != nil {
 		log.Error("unexpected error: ", err)
 	}
@@ -317,7 +338,17 @@ func restoreWallet(c *cli.Context) error {
 		log.Error(symbol, " wallet manager is not registered!")
 		return nil
 	}
-	err := m.RestoreWalletFlow()
+	var err error
+	if c.Bool("mnemonic") {
+		mm, ok := m.(wmd.MnemonicWalletManagerInterface)
+		if !ok {
+			log.Error(symbol, " wallet manager does not support mnemonic!")
+			return nil
+		}
+		err = mm.RestoreWalletWithMnemonicFlow()
+	} else {
+		err = m.RestoreWalletFlow()
+	}
 	if err != nil {
 		log.Error("unexpected error: ", err)
 	}
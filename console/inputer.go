@@ -18,6 +18,7 @@ package console
 import (
 	"fmt"
 	"github.com/blocktree/openwallet/v2/common"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
 	"github.com/blocktree/openwallet/v2/log"
 )
 
@@ -175,3 +176,57 @@ func InputStartNumber(prompt string, zero bool) (uint64, error) {
 
 	return num, nil
 }
+
+//InputMnemonic 输入助记词，单词数，词库或校验和不正确时提示重新输入
+func InputMnemonic(prompt string) (string, error) {
+
+	var (
+		mnemonic string
+	)
+
+	for {
+		// 等待用户输入助记词
+		line, err := Stdin.PromptInput(prompt)
+		if err != nil {
+			log.Errorf("unexpected error: %v\n", err)
+			return "", err
+		}
+
+		err = hdkeystore.ValidateMnemonic(line)
+		if err != nil {
+			fmt.Printf("The mnemonic is invalid: %v. Please re-enter it.\n", err)
+			continue
+		}
+
+		mnemonic = hdkeystore.NormalizeMnemonic(line)
+
+		break
+	}
+
+	return mnemonic, nil
+}
+
+//InputMnemonicWords 输入助记词的单词数，默认12个
+func InputMnemonicWords(prompt string) (int, error) {
+
+	for {
+		// 等待用户输入参数
+		line, err := Stdin.PromptInput(prompt)
+		if err != nil {
+			log.Errorf("unexpected error: %v\n", err)
+			return 0, err
+		}
+
+		if len(line) == 0 {
+			return hdkeystore.DefaultMnemonicWords, nil
+		}
+
+		words := int(common.NewString(line).UInt64())
+		if words < 12 || words > 24 || words%3 != 0 {
+			fmt.Printf("The number of words must be 12, 15, 18, 21 or 24. Please re-enter it.\n")
+			continue
+		}
+
+		return words, nil
+	}
+}
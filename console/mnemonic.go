@@ -0,0 +1,111 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package console
+
+import (
+	"fmt"
+
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+)
+
+//MnemonicWalletCreator 通过助记词创建钱包，返回密钥文件路径
+type MnemonicWalletCreator func(name, password, mnemonic, passphrase string) (string, error)
+
+//CreateWalletWithMnemonicFlow 创建钱包并生成助记词流程
+//@param confirmPassword 是否二次确认密码
+func CreateWalletWithMnemonicFlow(confirmPassword bool, create MnemonicWalletCreator) error {
+
+	// 等待用户输入钱包名字
+	name, err := InputText("Enter wallet's name: ", true)
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入助记词单词数
+	words, err := InputMnemonicWords("Enter the number of mnemonic words [12, 15, 18, 21, 24] (default 12): ")
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入助记词的密码短语，可为空
+	passphrase, err := Stdin.PromptPassword("Enter mnemonic passphrase (optional): ")
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入密码
+	password, err := InputPassword(confirmPassword, 3)
+	if err != nil {
+		return err
+	}
+
+	mnemonic, err := hdkeystore.NewMnemonic(words)
+	if err != nil {
+		return err
+	}
+
+	keyFile, err := create(name, password, mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n")
+	fmt.Printf("Wallet create successfully, key path: %s\n", keyFile)
+	fmt.Printf("Please write down the mnemonic and keep it safe, it can restore the wallet with the passphrase:\n\n")
+	fmt.Printf("%s\n\n", mnemonic)
+
+	return nil
+}
+
+//RestoreWalletWithMnemonicFlow 通过助记词恢复钱包流程
+//@param confirmPassword 是否二次确认密码
+func RestoreWalletWithMnemonicFlow(confirmPassword bool, create MnemonicWalletCreator) error {
+
+	// 等待用户输入助记词，校验不通过重新输入
+	mnemonic, err := InputMnemonic("Enter mnemonic: ")
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入助记词的密码短语，可为空
+	passphrase, err := Stdin.PromptPassword("Enter mnemonic passphrase (optional): ")
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入钱包名字
+	name, err := InputText("Enter wallet's name: ", true)
+	if err != nil {
+		return err
+	}
+
+	// 等待用户输入密码
+	password, err := InputPassword(confirmPassword, 3)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wallet restoring, please wait a moment...\n")
+	keyFile, err := create(name, password, mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n")
+	fmt.Printf("Restore wallet successfully, key path: %s\n", keyFile)
+
+	return nil
+}
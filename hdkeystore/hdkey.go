@@ -35,15 +35,19 @@ import (
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/v2/crypto"
 	"github.com/blocktree/openwallet/v2/crypto/sha3"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/scrypt"
 )
 
 const (
 
-	// HDKey的规范版本号
+	// HDKey的规范版本号，v1：aes-128-ctr加密，MAC校验
 	version = 1
 
+	// v2：aes-256-gcm加密，密钥派生算法可以是scrypt或argon2id
+	versionAEAD = 2
+
 	// maxCoinType is the maximum allowed coin type used when structuring
 	// the BIP0044 multi-account hierarchy.  This value is based on the
 	// limitation of the underlying hierarchical deterministic key
@@ -98,6 +102,8 @@ type HDKey struct {
 	KeyID string
 	//种子，加密保存
 	seed []byte
+	//助记词，只在通过助记词创建时有效，不保存到密钥文件
+	mnemonic string
 }
 
 // 加密后的HDKey的JSON结构
@@ -249,11 +255,10 @@ func (k *HDKey) DerivedKeyWithPath(path string, curveType uint32) (*owkeychain.E
 //	return derivedKey, err
 //}
 
-//Mnemonic 密钥助记词
-//func (k *HDKey) Mnemonic() string {
-//	mnemonic, _ := bip39.NewMnemonic(k.seed)
-//	return mnemonic
-//}
+//Mnemonic 密钥助记词，种子由助记词计算不可逆，只在通过助记词创建时返回，解密密钥文件得到的HDKey为空
+func (k *HDKey) Mnemonic() string {
+	return k.mnemonic
+}
 
 //FileName 文件名
 func (k *HDKey) FileName() string {
@@ -268,49 +273,93 @@ func (k *HDKey) Seed() []byte {
 // EncryptKey encrypts a key using the specified scrypt parameters into a json
 // blob that can be decrypted later on.
 func EncryptKey(hdkey *HDKey, auth string, scryptN, scryptP int) ([]byte, error) {
+	return EncryptKeyWithParams(hdkey, auth, ScryptCryptoParams(scryptN, scryptP))
+}
 
-	authArray := []byte(auth)
+// EncryptKeyWithParams 按指定的密钥派生算法和加密算法加密HDKey，
+// aes-128-ctr写入v1版本，aes-256-gcm写入v2版本
+func EncryptKeyWithParams(hdkey *HDKey, auth string, params CryptoParams) ([]byte, error) {
 
 	salt := make([]byte, 32)
 	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
 		panic("reading from crypto/rand failed: " + err.Error())
 	}
-	derivedKey, err := scrypt.Key(authArray, salt, scryptN, scryptR, scryptP, scryptDKLen)
-	if err != nil {
-		return nil, err
+
+	kdf := params.KDF
+	if len(kdf) == 0 {
+		kdf = keyHeaderKDF
 	}
-	encryptKey := derivedKey[:16]
 
-	keyBytes := hdkey.seed
+	kdfParamsJSON := make(map[string]interface{}, 5)
+	kdfParamsJSON["salt"] = hex.EncodeToString(salt)
 
-	iv := make([]byte, aes.BlockSize) // 16
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		panic("reading from crypto/rand failed: " + err.Error())
+	switch kdf {
+	case keyHeaderKDF:
+		kdfParamsJSON["n"] = params.ScryptN
+		kdfParamsJSON["r"] = scryptR
+		kdfParamsJSON["p"] = params.ScryptP
+		kdfParamsJSON["dklen"] = scryptDKLen
+	case keyHeaderKDFArgon2id:
+		if !validArgon2Params(int(params.Argon2Time), int(params.Argon2Memory), int(params.Argon2Threads)) {
+			return nil, fmt.Errorf("invalid argon2id params")
+		}
+		kdfParamsJSON["t"] = int(params.Argon2Time)
+		kdfParamsJSON["m"] = int(params.Argon2Memory)
+		kdfParamsJSON["p"] = int(params.Argon2Threads)
+		kdfParamsJSON["dklen"] = argon2DKLen
+	default:
+		return nil, fmt.Errorf("Unsupported KDF: %s", kdf)
+	}
+
+	cryptoStruct := cryptoJSON{
+		KDF:       kdf,
+		KDFParams: kdfParamsJSON,
 	}
-	cipherText, err := aesCTRXOR(encryptKey, keyBytes, iv)
+
+	derivedKey, err := getKDFKey(cryptoStruct, auth)
 	if err != nil {
 		return nil, err
 	}
-	mac := crypto.Keccak256(derivedKey[16:32], cipherText)
 
-	scryptParamsJSON := make(map[string]interface{}, 5)
-	scryptParamsJSON["n"] = scryptN
-	scryptParamsJSON["r"] = scryptR
-	scryptParamsJSON["p"] = scryptP
-	scryptParamsJSON["dklen"] = scryptDKLen
-	scryptParamsJSON["salt"] = hex.EncodeToString(salt)
+	keyBytes := hdkey.seed
+	keyVersion := version
 
-	cipherParamsJSON := cipherparamsJSON{
-		IV: hex.EncodeToString(iv),
-	}
+	switch params.Cipher {
+	case "", CipherAES128CTR:
+		encryptKey := derivedKey[:16]
 
-	cryptoStruct := cryptoJSON{
-		Cipher:       "aes-128-ctr",
-		CipherText:   hex.EncodeToString(cipherText),
-		CipherParams: cipherParamsJSON,
-		KDF:          keyHeaderKDF,
-		KDFParams:    scryptParamsJSON,
-		MAC:          hex.EncodeToString(mac),
+		iv := make([]byte, aes.BlockSize) // 16
+		if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+			panic("reading from crypto/rand failed: " + err.Error())
+		}
+		cipherText, err := aesCTRXOR(encryptKey, keyBytes, iv)
+		if err != nil {
+			return nil, err
+		}
+		mac := crypto.Keccak256(derivedKey[16:32], cipherText)
+
+		cryptoStruct.Cipher = CipherAES128CTR
+		cryptoStruct.CipherText = hex.EncodeToString(cipherText)
+		cryptoStruct.CipherParams = cipherparamsJSON{IV: hex.EncodeToString(iv)}
+		cryptoStruct.MAC = hex.EncodeToString(mac)
+	case CipherAES256GCM:
+		gcm, err := newAESGCM(derivedKey)
+		if err != nil {
+			return nil, err
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			panic("reading from crypto/rand failed: " + err.Error())
+		}
+		cipherText := gcm.Seal(nil, nonce, keyBytes, nil)
+
+		cryptoStruct.Cipher = CipherAES256GCM
+		cryptoStruct.CipherText = hex.EncodeToString(cipherText)
+		cryptoStruct.CipherParams = cipherparamsJSON{IV: hex.EncodeToString(nonce)}
+		keyVersion = versionAEAD
+	default:
+		return nil, fmt.Errorf("Cipher not supported: %v", params.Cipher)
 	}
 
 	encryptedHDKeyJSON := encryptedHDKeyJSON{
@@ -318,7 +367,7 @@ func EncryptKey(hdkey *HDKey, auth string, scryptN, scryptP int) ([]byte, error)
 		KeyID:    hdkey.KeyID,
 		Crypto:   cryptoStruct,
 		RootPath: hdkey.RootPath,
-		Version:  version,
+		Version:  keyVersion,
 	}
 	return json.MarshalIndent(encryptedHDKeyJSON, "", "\t")
 }
@@ -340,6 +389,10 @@ func DecryptHDKey(keyjson []byte, auth string) (*HDKey, error) {
 		return nil, err
 	}
 
+	if k.Version > versionAEAD {
+		return nil, fmt.Errorf("HDKey version not supported: %d", k.Version)
+	}
+
 	seed, err = decryptHDKey(k, auth)
 	// Handle any decryption errors and return the key
 	if err != nil {
@@ -359,7 +412,11 @@ func DecryptHDKey(keyjson []byte, auth string) (*HDKey, error) {
 // decryptHDKey 解密HDKey的文件内容
 func decryptHDKey(keyProtected *encryptedHDKeyJSON, auth string) (keyBytes []byte, err error) {
 
-	if keyProtected.Crypto.Cipher != "aes-128-ctr" {
+	if keyProtected.Crypto.Cipher == CipherAES256GCM {
+		return decryptHDKeyAEAD(keyProtected, auth)
+	}
+
+	if keyProtected.Crypto.Cipher != CipherAES128CTR {
 		return nil, fmt.Errorf("Cipher not supported: %v", keyProtected.Crypto.Cipher)
 	}
 
@@ -396,6 +453,41 @@ func decryptHDKey(keyProtected *encryptedHDKeyJSON, auth string) (keyBytes []byt
 	return plainText, err
 }
 
+// decryptHDKeyAEAD 解密aes-256-gcm加密的HDKey，密码错误时认证失败
+func decryptHDKeyAEAD(keyProtected *encryptedHDKeyJSON, auth string) ([]byte, error) {
+
+	nonce, err := hex.DecodeString(keyProtected.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherText, err := hex.DecodeString(keyProtected.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := getKDFKey(keyProtected.Crypto, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newAESGCM(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid aes-256-gcm nonce length: %d", len(nonce))
+	}
+
+	plainText, err := gcm.Open(nil, nonce, cipherText, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plainText, nil
+}
+
 // getKDFKey
 func getKDFKey(cryptoJSON cryptoJSON, auth string) ([]byte, error) {
 	authArray := []byte(auth)
@@ -419,11 +511,25 @@ func getKDFKey(cryptoJSON cryptoJSON, auth string) ([]byte, error) {
 		}
 		key := pbkdf2.Key(authArray, salt, c, dkLen, sha256.New)
 		return key, nil
+
+	} else if cryptoJSON.KDF == keyHeaderKDFArgon2id {
+		t := ensureInt(cryptoJSON.KDFParams["t"])
+		m := ensureInt(cryptoJSON.KDFParams["m"])
+		p := ensureInt(cryptoJSON.KDFParams["p"])
+		if !validArgon2Params(t, m, p) || dkLen != argon2DKLen {
+			return nil, fmt.Errorf("invalid argon2id params")
+		}
+		return argon2.IDKey(authArray, salt, uint32(t), uint32(m), uint8(p), uint32(dkLen)), nil
 	}
 
 	return nil, fmt.Errorf("Unsupported KDF: %s", cryptoJSON.KDF)
 }
 
+//validArgon2Params argon2id参数是否在允许范围内，m以KiB为单位
+func validArgon2Params(t, m, p int) bool {
+	return t > 0 && t <= maxArgon2Time && m > 0 && m <= maxArgon2Memory && p > 0 && p <= maxArgon2Threads
+}
+
 // TODO: can we do without this when unmarshalling dynamic JSON?
 // why do integers in KDF params end up as float64 and not int after
 // unmarshal?
@@ -520,6 +626,18 @@ func KeyFileName(alias, rootId string) string {
 	return fmt.Sprintf("%s-%s", alias, rootId)
 }
 
+// newAESGCM 派生密钥作为AES-256的密钥
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("aes-256-gcm requires 32 bytes key")
+	}
+	aesBlock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(aesBlock)
+}
+
 func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
 	// AES-128 is selected due to size of encryptKey.
 	aesBlock, err := aes.NewCipher(key)
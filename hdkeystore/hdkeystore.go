@@ -26,7 +26,8 @@ import (
 )
 
 const (
-	keyHeaderKDF = "scrypt"
+	keyHeaderKDF         = "scrypt"
+	keyHeaderKDFArgon2id = "argon2id"
 
 	// StandardScryptN is the N parameter of Scrypt encryption algorithm, using 256MB
 	// memory and taking approximately 1s CPU time on a modern processor.
@@ -47,6 +48,29 @@ const (
 	scryptR     = 8
 	scryptDKLen = 32
 
+	// StandardArgon2Time, StandardArgon2Memory(KiB), StandardArgon2Threads are the
+	// parameters of Argon2id, using 256MB memory.
+	StandardArgon2Time    = 3
+	StandardArgon2Memory  = 256 * 1024
+	StandardArgon2Threads = 4
+
+	// LightArgon2Time, LightArgon2Memory(KiB), LightArgon2Threads are the
+	// parameters of Argon2id, using 4MB memory.
+	LightArgon2Time    = 1
+	LightArgon2Memory  = 4 * 1024
+	LightArgon2Threads = 4
+
+	argon2DKLen = 32
+
+	//解密时接受的argon2id参数上限，避免密钥文件的参数耗尽内存和CPU
+	maxArgon2Time    = 16
+	maxArgon2Memory  = 4 * 1024 * 1024 //KiB，即4GiB
+	maxArgon2Threads = 255
+
+	//密钥文件的加密算法
+	CipherAES128CTR = "aes-128-ctr" //v1，密钥文件的默认加密算法
+	CipherAES256GCM = "aes-256-gcm" //v2，AEAD加密，不再需要单独的MAC
+
 	//种子长度
 	SeedLen = 32
 )
@@ -58,18 +82,47 @@ var (
 	ErrDecrypt = errors.New("could not decrypt key with given passphrase")
 )
 
+//CryptoParams 密钥文件的加密参数，密钥派生算法的参数记录在kdfparams中
+type CryptoParams struct {
+	KDF           string //密钥派生算法：scrypt，argon2id
+	Cipher        string //加密算法：aes-128-ctr（默认），aes-256-gcm
+	ScryptN       int
+	ScryptP       int
+	Argon2Time    uint32
+	Argon2Memory  uint32 //KiB
+	Argon2Threads uint8
+}
+
+//ScryptCryptoParams scrypt派生密钥，aes-128-ctr加密，与旧版本的密钥文件一致
+func ScryptCryptoParams(scryptN, scryptP int) CryptoParams {
+	return CryptoParams{KDF: keyHeaderKDF, Cipher: CipherAES128CTR, ScryptN: scryptN, ScryptP: scryptP}
+}
+
+//Argon2idCryptoParams argon2id派生密钥，aes-256-gcm加密
+func Argon2idCryptoParams(time, memory uint32, threads uint8) CryptoParams {
+	return CryptoParams{KDF: keyHeaderKDFArgon2id, Cipher: CipherAES256GCM, Argon2Time: time, Argon2Memory: memory, Argon2Threads: threads}
+}
+
 //HDKeystore HDKey的存粗工具类
 type HDKeystore struct {
 	keysDirPath string
 	//MasterKey   string
 	scryptN int
 	scryptP int
+	params  *CryptoParams //加密参数，为空时使用scryptN，scryptP
 }
 
 // NewHDKeystore 实例化HDKeystore
 func NewHDKeystore(keydir string, scryptN, scryptP int) *HDKeystore {
 	keydir, _ = filepath.Abs(keydir)
-	ks := &HDKeystore{keydir, scryptN, scryptP}
+	ks := &HDKeystore{keysDirPath: keydir, scryptN: scryptN, scryptP: scryptP}
+	return ks
+}
+
+// NewHDKeystoreWithParams 实例化HDKeystore，按指定的加密参数保存密钥文件
+func NewHDKeystoreWithParams(keydir string, params CryptoParams) *HDKeystore {
+	keydir, _ = filepath.Abs(keydir)
+	ks := &HDKeystore{keysDirPath: keydir, scryptN: params.ScryptN, scryptP: params.ScryptP, params: &params}
 	return ks
 }
 
@@ -91,7 +144,7 @@ func StoreHDKey(dir, alias, auth string, scryptN, scryptP int) (*HDKey, string,
 
 // StoreHDKey 创建HDKey
 func StoreHDKeyWithSeed(dir, alias, auth string, seed []byte, scryptN, scryptP int) (*HDKey, string, error) {
-	key, filePath, err := storeNewKey(&HDKeystore{dir, scryptN, scryptP}, alias, auth, seed)
+	key, filePath, err := storeNewKey(&HDKeystore{keysDirPath: dir, scryptN: scryptN, scryptP: scryptP}, alias, auth, seed)
 	return key, filePath, err
 }
 
@@ -132,13 +185,36 @@ func (ks HDKeystore) GetKey(rootId, filename, auth string) (*HDKey, error) {
 
 //StoreKey 把HDKey重写加密写入到文件中
 func (ks *HDKeystore) StoreKey(filename string, key *HDKey, auth string) error {
-	keyjson, err := EncryptKey(key, auth, ks.scryptN, ks.scryptP)
+	keyjson, err := EncryptKeyWithParams(key, auth, ks.cryptoParams())
 	if err != nil {
 		return err
 	}
 	return writeKeyFile(filename, keyjson)
 }
 
+//ReKey 使用旧密码解密密钥文件，按新密码和keystore的加密参数重新加密，原子替换原文件。
+//可用于修改密码，或把密钥文件升级为StandardScryptN，argon2id等更强的加密参数
+func (ks *HDKeystore) ReKey(filename, oldAuth, newAuth string) (*HDKey, error) {
+	keyPath := ks.JoinPath(filename)
+	key, err := ks.GetKey("", keyPath, oldAuth)
+	if err != nil {
+		return nil, err
+	}
+	err = ks.StoreKey(keyPath, key, newAuth)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+//cryptoParams keystore使用的加密参数
+func (ks *HDKeystore) cryptoParams() CryptoParams {
+	if ks.params != nil {
+		return *ks.params
+	}
+	return ScryptCryptoParams(ks.scryptN, ks.scryptP)
+}
+
 //JoinPath 文件路径组合
 func (ks *HDKeystore) JoinPath(filename string) string {
 	if filepath.IsAbs(filename) {
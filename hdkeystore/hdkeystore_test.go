@@ -16,8 +16,12 @@
 package hdkeystore
 
 import (
-	"testing"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"testing"
 )
 
 
@@ -33,7 +37,7 @@ func TestStoreHDKey(t *testing.T) {
 
 func TestGetKey(t *testing.T) {
 	path := filepath.Join(".", "keys")
-	ks := &HDKeystore{path, StandardScryptN, StandardScryptP}
+	ks := &HDKeystore{keysDirPath: path, scryptN: StandardScryptN, scryptP: StandardScryptP}
 
 	key, err := ks.GetKey("WAeAP5ggYYZ1euSJqURNEoGBRP6ucfPq2g",
 		"sogosdfo-WAeAP5ggYYZ1euSJqURNEoGBRP6ucfPq2g.key",
@@ -44,4 +48,94 @@ func TestGetKey(t *testing.T) {
 	} else {
 		t.Logf("GetKey root id = %s", key.KeyID)
 	}
-}
\ No newline at end of file
+}
+func TestHDKeystore_ReKey(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "hdkeystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seed, _ := GenerateSeed(SeedLen)
+	key, filePath, err := StoreHDKeyWithSeed(dir, "rekey", "old", seed, LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatalf("StoreHDKeyWithSeed unexpected error: %v", err)
+	}
+
+	readCrypto := func() encryptedHDKeyJSON {
+		keyjson, _ := ioutil.ReadFile(filePath)
+		var k encryptedHDKeyJSON
+		json.Unmarshal(keyjson, &k)
+		return k
+	}
+
+	checkKey := func(name, auth string) {
+		ks := NewHDKeystore(dir, LightScryptN, LightScryptP)
+		got, err := ks.GetKey(key.KeyID, filePath, auth)
+		if err != nil || !bytes.Equal(got.Seed(), seed) || got.Alias != key.Alias || got.RootPath != key.RootPath {
+			t.Fatalf("%s: GetKey = %v, err = %v", name, got, err)
+		}
+	}
+
+	//修改密码
+	ks := NewHDKeystore(dir, LightScryptN, LightScryptP)
+	if _, err := ks.ReKey(filePath, "wrong", "new"); err != ErrDecrypt {
+		t.Errorf("ReKey with wrong password error = %v", err)
+	}
+	if _, err := ks.ReKey(filePath, "old", "new"); err != nil {
+		t.Fatalf("ReKey unexpected error: %v", err)
+	}
+	if _, err := ks.GetKey(key.KeyID, filePath, "old"); err != ErrDecrypt {
+		t.Errorf("GetKey with old password error = %v", err)
+	}
+	checkKey("change password", "new")
+
+	//升级为StandardScryptN
+	ks = NewHDKeystore(dir, StandardScryptN, StandardScryptP)
+	if _, err := ks.ReKey(filePath, "new", "new"); err != nil {
+		t.Fatalf("ReKey unexpected error: %v", err)
+	}
+	if k := readCrypto(); k.Crypto.KDF != "scrypt" || ensureInt(k.Crypto.KDFParams["n"]) != StandardScryptN || k.Version != version {
+		t.Errorf("standard scrypt key = %+v", k)
+	}
+	checkKey("standard scrypt", "new")
+
+	//升级为argon2id
+	ks = NewHDKeystoreWithParams(dir, Argon2idCryptoParams(LightArgon2Time, LightArgon2Memory, LightArgon2Threads))
+	if _, err := ks.ReKey(filepath.Base(filePath), "new", "argon2"); err != nil {
+		t.Fatalf("ReKey unexpected error: %v", err)
+	}
+	k := readCrypto()
+	if k.Crypto.KDF != "argon2id" || k.Crypto.Cipher != CipherAES256GCM || ensureInt(k.Crypto.KDFParams["m"]) != LightArgon2Memory || k.Version != versionAEAD {
+		t.Errorf("argon2id key = %+v", k)
+	}
+	checkKey("argon2id", "argon2")
+	if _, err := ks.GetKey(key.KeyID, filePath, "new"); err != ErrDecrypt {
+		t.Errorf("GetKey with wrong password error = %v", err)
+	}
+
+	//argon2id参数超出范围
+	for _, params := range []map[string]interface{}{
+		{"t": maxArgon2Time + 1, "m": LightArgon2Memory, "p": LightArgon2Threads},
+		{"t": LightArgon2Time, "m": maxArgon2Memory + 1, "p": LightArgon2Threads},
+		{"t": LightArgon2Time, "m": float64(1 << 32), "p": LightArgon2Threads},
+	} {
+		tampered := k
+		tampered.Crypto.KDFParams = map[string]interface{}{"dklen": argon2DKLen, "salt": k.Crypto.KDFParams["salt"]}
+		for name, v := range params {
+			tampered.Crypto.KDFParams[name] = v
+		}
+		keyjson, _ := json.Marshal(tampered)
+		if _, err := DecryptHDKey(keyjson, "argon2"); err == nil || err == ErrDecrypt {
+			t.Errorf("DecryptHDKey with argon2id params %v error = %v", params, err)
+		}
+	}
+
+	//未知版本
+	k.Version = versionAEAD + 1
+	keyjson, _ := json.Marshal(k)
+	if _, err := DecryptHDKey(keyjson, "argon2"); err == nil {
+		t.Errorf("DecryptHDKey unknown version should fail")
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package hdkeystore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	//默认的助记词单词数
+	DefaultMnemonicWords = 12
+)
+
+var (
+	//ErrInvalidMnemonicLength 助记词单词数不正确
+	ErrInvalidMnemonicLength = errors.New("mnemonic must be 12, 15, 18, 21 or 24 words")
+	//ErrInvalidMnemonicWord 助记词包含不在词库中的单词
+	ErrInvalidMnemonicWord = errors.New("invalid mnemonic word")
+	//ErrMnemonicChecksum 助记词校验和不正确
+	ErrMnemonicChecksum = errors.New("mnemonic checksum incorrect")
+)
+
+//NewMnemonic 生成BIP39助记词，words为单词数：12，15，18，21，24
+func NewMnemonic(words int) (string, error) {
+
+	//每3个单词对应32位熵
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", ErrInvalidMnemonicLength
+	}
+
+	entropy, err := bip39.NewEntropy(words / 3 * 32)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+//NormalizeMnemonic 规范助记词格式，单词转为小写并以单个空格分隔
+func NormalizeMnemonic(mnemonic string) string {
+	return strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+}
+
+//ValidateMnemonic 检查助记词的单词数，词库和校验和
+func ValidateMnemonic(mnemonic string) error {
+
+	words := strings.Fields(NormalizeMnemonic(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return ErrInvalidMnemonicLength
+	}
+
+	for i, word := range words {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			return fmt.Errorf("%w: word #%d '%s' is not in the wordlist", ErrInvalidMnemonicWord, i+1, word)
+		}
+	}
+
+	if _, err := bip39.EntropyFromMnemonic(strings.Join(words, " ")); err != nil {
+		if err == bip39.ErrChecksumIncorrect {
+			return ErrMnemonicChecksum
+		}
+		return err
+	}
+
+	return nil
+}
+
+//MnemonicToSeed 通过助记词和密码短语计算BIP39种子，64字节
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	return bip39.NewSeed(NormalizeMnemonic(mnemonic), passphrase), nil
+}
+
+//NewHDKeyWithMnemonic 通过助记词恢复HDKey，相同的助记词和密码短语得到相同的KeyID
+func NewHDKeyWithMnemonic(mnemonic, passphrase, alias string) (*HDKey, error) {
+
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := NewHDKey(seed, alias, OpenwCoinTypePath)
+	if err != nil {
+		return nil, err
+	}
+	key.mnemonic = NormalizeMnemonic(mnemonic)
+
+	return key, nil
+}
+
+//StoreHDKeyWithMnemonic 通过助记词创建HDKey并加密保存
+func StoreHDKeyWithMnemonic(dir, alias, auth, mnemonic, passphrase string, scryptN, scryptP int) (*HDKey, string, error) {
+
+	key, err := NewHDKeyWithMnemonic(mnemonic, passphrase, alias)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ks := &HDKeystore{keysDirPath: dir, scryptN: scryptN, scryptP: scryptP}
+	filePath := ks.JoinPath(KeyFileName(key.Alias, key.KeyID) + ".key")
+	err = ks.StoreKey(filePath, key, auth)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, filePath, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package hdkeystore
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestNewMnemonic(t *testing.T) {
+
+	for _, words := range []int{12, 15, 18, 21, 24} {
+		mnemonic, err := NewMnemonic(words)
+		if err != nil {
+			t.Fatalf("NewMnemonic(%d) unexpected error: %v", words, err)
+		}
+		if n := len(strings.Fields(mnemonic)); n != words {
+			t.Errorf("NewMnemonic(%d) words = %d", words, n)
+		}
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			t.Errorf("ValidateMnemonic unexpected error: %v", err)
+		}
+	}
+
+	for _, words := range []int{0, 11, 13, 27} {
+		if _, err := NewMnemonic(words); err != ErrInvalidMnemonicLength {
+			t.Errorf("NewMnemonic(%d) error = %v", words, err)
+		}
+	}
+}
+
+func TestValidateMnemonic(t *testing.T) {
+
+	//大小写和多余空格
+	if err := ValidateMnemonic("  Abandon abandon abandon abandon abandon abandon\tabandon abandon abandon abandon abandon ABOUT "); err != nil {
+		t.Errorf("ValidateMnemonic unexpected error: %v", err)
+	}
+
+	err := ValidateMnemonic(strings.Replace(testMnemonic, "about", "abuot", 1))
+	if !errors.Is(err, ErrInvalidMnemonicWord) || !strings.Contains(err.Error(), "#12 'abuot'") {
+		t.Errorf("bad word error = %v", err)
+	}
+
+	if err := ValidateMnemonic(strings.Replace(testMnemonic, "about", "abandon", 1)); err != ErrMnemonicChecksum {
+		t.Errorf("checksum error = %v", err)
+	}
+
+	if err := ValidateMnemonic("abandon about"); err != ErrInvalidMnemonicLength {
+		t.Errorf("length error = %v", err)
+	}
+}
+
+func TestStoreHDKeyWithMnemonic(t *testing.T) {
+
+	//BIP39测试向量
+	seed, err := MnemonicToSeed(testMnemonic, "TREZOR")
+	if err != nil {
+		t.Fatalf("MnemonicToSeed unexpected error: %v", err)
+	}
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if hex.EncodeToString(seed) != want {
+		t.Fatalf("MnemonicToSeed = %x", seed)
+	}
+
+	dir, err := ioutil.TempDir("", "hdkeystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, filePath, err := StoreHDKeyWithMnemonic(dir, "mnemonic", "1234qwer", testMnemonic, "TREZOR", LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatalf("StoreHDKeyWithMnemonic unexpected error: %v", err)
+	}
+	if key.Mnemonic() != testMnemonic {
+		t.Errorf("key mnemonic = %s", key.Mnemonic())
+	}
+
+	//恢复得到相同的密钥
+	restored, err := NewHDKeyWithMnemonic(strings.ToUpper(testMnemonic), "TREZOR", "restored")
+	if err != nil || restored.KeyID != key.KeyID {
+		t.Errorf("restored key = %v, err = %v, want %s", restored, err, key.KeyID)
+	}
+
+	//不同的密码短语得到不同的密钥
+	other, _ := NewHDKeyWithMnemonic(testMnemonic, "", "other")
+	if other.KeyID == key.KeyID {
+		t.Errorf("key with different passphrase should not be equal")
+	}
+
+	ks := NewHDKeystore(dir, LightScryptN, LightScryptP)
+	stored, err := ks.GetKey(key.KeyID, filePath, "1234qwer")
+	if err != nil || stored.KeyID != key.KeyID || stored.Mnemonic() != "" {
+		t.Errorf("stored key = %v, err = %v", stored, err)
+	}
+}
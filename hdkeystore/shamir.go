@@ -0,0 +1,311 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package hdkeystore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	//分片文本的前缀和版本
+	seedSharePrefix  = "owshare"
+	seedShareVersion = "v1"
+
+	//分片的最大数量，GF(256)的非零元素
+	MaxSeedShares = 255
+)
+
+var (
+	//ErrInvalidSeedShare 分片格式或校验和不正确
+	ErrInvalidSeedShare = errors.New("invalid seed share")
+	//ErrNotEnoughSeedShares 分片数量少于门限
+	ErrNotEnoughSeedShares = errors.New("not enough seed shares")
+)
+
+//SeedShare 种子的Shamir分片
+//文本格式：owshare:v1:<KeyID>:<根路径>:<门限>:<总数>:<序号>:<分片数据hex>:<校验和>，
+//校验和为前面内容sha256的前4字节hex
+type SeedShare struct {
+	KeyID     string //分片恢复的HDKey的KeyID
+	RootPath  string //分片恢复的HDKey的根路径
+	Threshold int    //恢复需要的分片数
+	Total     int    //分片总数
+	Index     int    //分片序号，从1开始
+	Data      []byte //分片数据，长度与种子相同
+}
+
+//String 分片的文本格式
+func (s *SeedShare) String() string {
+	body := strings.Join([]string{
+		seedSharePrefix,
+		seedShareVersion,
+		s.KeyID,
+		s.RootPath,
+		strconv.Itoa(s.Threshold),
+		strconv.Itoa(s.Total),
+		strconv.Itoa(s.Index),
+		hex.EncodeToString(s.Data),
+	}, ":")
+	return body + ":" + seedShareChecksum(body)
+}
+
+//seedShareChecksum 分片文本的校验和
+func seedShareChecksum(body string) string {
+	hash := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(hash[:4])
+}
+
+//ParseSeedShare 解析分片文本，检查格式和校验和
+func ParseSeedShare(text string) (*SeedShare, error) {
+
+	text = strings.TrimSpace(text)
+	fields := strings.Split(text, ":")
+	if len(fields) != 9 || fields[0] != seedSharePrefix {
+		return nil, ErrInvalidSeedShare
+	}
+	if fields[1] != seedShareVersion {
+		return nil, fmt.Errorf("%w: version %s not supported", ErrInvalidSeedShare, fields[1])
+	}
+
+	body := strings.Join(fields[:8], ":")
+	if seedShareChecksum(body) != strings.ToLower(fields[8]) {
+		return nil, fmt.Errorf("%w: checksum incorrect", ErrInvalidSeedShare)
+	}
+
+	threshold, err1 := strconv.Atoi(fields[4])
+	total, err2 := strconv.Atoi(fields[5])
+	index, err3 := strconv.Atoi(fields[6])
+	data, err4 := hex.DecodeString(fields[7])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return nil, ErrInvalidSeedShare
+	}
+
+	if threshold < 2 || threshold > total || total > MaxSeedShares || index < 1 || index > total ||
+		len(data) < MinSeedBytes || len(data) > MaxSeedBytes || len(fields[2]) == 0 || len(fields[3]) == 0 {
+		return nil, ErrInvalidSeedShare
+	}
+
+	return &SeedShare{
+		KeyID:     fields[2],
+		RootPath:  fields[3],
+		Threshold: threshold,
+		Total:     total,
+		Index:     index,
+		Data:      data,
+	}, nil
+}
+
+//SplitSeedShares 把HDKey的种子分为total个分片，任意threshold个分片可恢复种子
+func (k *HDKey) SplitSeedShares(threshold, total int) ([]string, error) {
+
+	if threshold < 2 || threshold > total || total > MaxSeedShares {
+		return nil, fmt.Errorf("seed shares must be 2 <= threshold <= total <= %d", MaxSeedShares)
+	}
+
+	if len(k.seed) < MinSeedBytes || len(k.seed) > MaxSeedBytes {
+		return nil, ErrInvalidSeedLen
+	}
+
+	shares := make([]*SeedShare, total)
+	for i := range shares {
+		shares[i] = &SeedShare{
+			KeyID:     k.KeyID,
+			RootPath:  k.RootPath,
+			Threshold: threshold,
+			Total:     total,
+			Index:     i + 1,
+			Data:      make([]byte, len(k.seed)),
+		}
+	}
+
+	//种子的每个字节作为常数项，随机生成threshold-1次多项式，分片为多项式在x=序号的值
+	coefficients := make([]byte, threshold)
+	for i, secret := range k.seed {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = secret
+		for _, share := range shares {
+			share.Data[i] = gfEvaluate(coefficients, byte(share.Index))
+		}
+	}
+
+	texts := make([]string, total)
+	for i, share := range shares {
+		texts[i] = share.String()
+	}
+	return texts, nil
+}
+
+//CombineSeedShares 通过分片恢复种子，恢复的种子必须与分片记录的KeyID一致
+func CombineSeedShares(texts []string) (string, []byte, error) {
+
+	first, seed, err := combineSeedShares(texts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return first.KeyID, seed, nil
+}
+
+//combineSeedShares 通过分片恢复种子，返回分片组的第一个分片
+func combineSeedShares(texts []string) (*SeedShare, []byte, error) {
+
+	var (
+		first  *SeedShare
+		shares = make(map[int]*SeedShare)
+	)
+
+	for _, text := range texts {
+		share, err := ParseSeedShare(text)
+		if err != nil {
+			return nil, nil, err
+		}
+		if first == nil {
+			first = share
+		}
+		if share.KeyID != first.KeyID || share.RootPath != first.RootPath || share.Threshold != first.Threshold ||
+			share.Total != first.Total || len(share.Data) != len(first.Data) {
+			return nil, nil, fmt.Errorf("%w: share #%d is not in the same group", ErrInvalidSeedShare, share.Index)
+		}
+		//重复的分片忽略，序号相同但数据不同的分片不能覆盖已有分片
+		if exist, ok := shares[share.Index]; ok {
+			if !bytes.Equal(exist.Data, share.Data) {
+				return nil, nil, fmt.Errorf("%w: share #%d is conflicting", ErrInvalidSeedShare, share.Index)
+			}
+			continue
+		}
+		shares[share.Index] = share
+	}
+
+	if first == nil || len(shares) < first.Threshold {
+		return nil, nil, ErrNotEnoughSeedShares
+	}
+
+	//拉格朗日插值计算x=0的值
+	xs := make([]byte, 0, first.Threshold)
+	ys := make([][]byte, 0, first.Threshold)
+	for index, share := range shares {
+		if len(xs) == first.Threshold {
+			break
+		}
+		xs = append(xs, byte(index))
+		ys = append(ys, share.Data)
+	}
+
+	seed := make([]byte, len(first.Data))
+	for i := range xs {
+		//l_i(0) = ∏ x_j / (x_j - x_i)，GF(256)的减法为异或
+		basis := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			basis = gfMul(basis, gfDiv(xs[j], xs[j]^xs[i]))
+		}
+		for n := range seed {
+			seed[n] ^= gfMul(ys[i][n], basis)
+		}
+	}
+
+	if computeKeyID(seed) != first.KeyID {
+		return nil, nil, fmt.Errorf("%w: shares do not reconstruct key %s", ErrInvalidSeedShare, first.KeyID)
+	}
+
+	return first, seed, nil
+}
+
+//NewHDKeyWithSeedShares 通过分片恢复HDKey，根路径与分片记录的一致
+func NewHDKeyWithSeedShares(texts []string, alias string) (*HDKey, error) {
+
+	first, seed, err := combineSeedShares(texts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHDKey(seed, alias, first.RootPath)
+}
+
+//StoreHDKeyWithSeedShares 通过分片恢复HDKey，按keystore的加密参数重新生成密钥文件
+func StoreHDKeyWithSeedShares(ks *HDKeystore, alias, auth string, texts []string) (*HDKey, string, error) {
+
+	key, err := NewHDKeyWithSeedShares(texts, alias)
+	if err != nil {
+		return nil, "", err
+	}
+
+	filePath := ks.JoinPath(KeyFileName(key.Alias, key.KeyID) + ".key")
+	err = ks.StoreKey(filePath, key, auth)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, filePath, nil
+}
+
+//GF(256)的对数表和指数表，不可约多项式x^8+x^4+x^3+x+1，生成元3
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = byte(i)
+		//x = x * 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+//gfMul GF(256)乘法
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+//gfDiv GF(256)除法，b不能为0
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+//gfEvaluate 秦九韶算法计算多项式在x的值，coefficients[0]为常数项
+func gfEvaluate(coefficients []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package hdkeystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHDKey_SplitSeedShares(t *testing.T) {
+
+	key, err := NewHDKeyWithMnemonic(testMnemonic, "TREZOR", "shamir")
+	if err != nil {
+		t.Fatalf("NewHDKeyWithMnemonic unexpected error: %v", err)
+	}
+
+	shares, err := key.SplitSeedShares(3, 5)
+	if err != nil {
+		t.Fatalf("SplitSeedShares unexpected error: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("shares count = %d", len(shares))
+	}
+
+	for i, text := range shares {
+		share, err := ParseSeedShare(text)
+		if err != nil {
+			t.Fatalf("ParseSeedShare unexpected error: %v", err)
+		}
+		if share.KeyID != key.KeyID || share.RootPath != key.RootPath || share.Threshold != 3 || share.Total != 5 || share.Index != i+1 {
+			t.Errorf("share = %+v", share)
+		}
+	}
+
+	//任意3个分片都能恢复种子
+	groups := [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}}
+	for _, group := range groups {
+		var texts []string
+		for _, i := range group {
+			texts = append(texts, shares[i])
+		}
+		keyID, seed, err := CombineSeedShares(texts)
+		if err != nil {
+			t.Fatalf("CombineSeedShares(%v) unexpected error: %v", group, err)
+		}
+		if keyID != key.KeyID || !bytes.Equal(seed, key.seed) {
+			t.Errorf("CombineSeedShares(%v) keyID = %s", group, keyID)
+		}
+	}
+
+	//分片不足，重复的分片不计数
+	if _, _, err := CombineSeedShares([]string{shares[0], shares[1], shares[1]}); err != ErrNotEnoughSeedShares {
+		t.Errorf("not enough shares error = %v", err)
+	}
+
+	//序号相同但数据不同的分片
+	conflict, _ := ParseSeedShare(shares[1])
+	conflict.Data[0] ^= 0xff
+	if _, _, err := CombineSeedShares([]string{shares[0], shares[1], conflict.String(), shares[2]}); !errors.Is(err, ErrInvalidSeedShare) {
+		t.Errorf("conflicting share error = %v", err)
+	}
+
+	//校验和错误
+	broken := []byte(shares[2])
+	idx := strings.LastIndex(shares[2], ":") - 1
+	if broken[idx] == '0' {
+		broken[idx] = '1'
+	} else {
+		broken[idx] = '0'
+	}
+	if _, _, err := CombineSeedShares([]string{shares[0], shares[1], string(broken)}); !errors.Is(err, ErrInvalidSeedShare) {
+		t.Errorf("broken share error = %v", err)
+	}
+
+	//不同密钥的分片不能混用
+	other, _ := NewHDKeyWithMnemonic(testMnemonic, "", "other")
+	otherShares, _ := other.SplitSeedShares(3, 5)
+	if _, _, err := CombineSeedShares([]string{shares[0], shares[1], otherShares[2]}); !errors.Is(err, ErrInvalidSeedShare) {
+		t.Errorf("mixed shares error = %v", err)
+	}
+
+	for _, args := range [][2]int{{1, 3}, {4, 3}, {2, 256}} {
+		if _, err := key.SplitSeedShares(args[0], args[1]); err == nil {
+			t.Errorf("SplitSeedShares(%d, %d) should fail", args[0], args[1])
+		}
+	}
+}
+
+func TestStoreHDKeyWithSeedShares(t *testing.T) {
+
+	key, err := NewHDKeyWithMnemonic(testMnemonic, "", "shamir")
+	if err != nil {
+		t.Fatalf("NewHDKeyWithMnemonic unexpected error: %v", err)
+	}
+	key.RootPath = "m/44'/60'"
+
+	shares, err := key.SplitSeedShares(2, 3)
+	if err != nil {
+		t.Fatalf("SplitSeedShares unexpected error: %v", err)
+	}
+
+	restoreDir, err := ioutil.TempDir("", "hdkeystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(restoreDir)
+
+	ks := NewHDKeystoreWithParams(restoreDir, Argon2idCryptoParams(LightArgon2Time, LightArgon2Memory, LightArgon2Threads))
+	restored, filePath, err := StoreHDKeyWithSeedShares(ks, "shamir", "qwer1234", []string{shares[2], shares[0]})
+	if err != nil {
+		t.Fatalf("StoreHDKeyWithSeedShares unexpected error: %v", err)
+	}
+	if restored.KeyID != key.KeyID || restored.RootPath != key.RootPath {
+		t.Errorf("restored key = %s %s, want %s %s", restored.KeyID, restored.RootPath, key.KeyID, key.RootPath)
+	}
+
+	stored, err := ks.GetKey(key.KeyID, filePath, "qwer1234")
+	if err != nil || stored.KeyID != key.KeyID || stored.RootPath != key.RootPath || !bytes.Equal(stored.seed, key.seed) {
+		t.Errorf("stored key = %v, err = %v", stored, err)
+	}
+
+	//按keystore的加密参数保存
+	keyjson, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var k encryptedHDKeyJSON
+	if err := json.Unmarshal(keyjson, &k); err != nil || k.Crypto.KDF != "argon2id" || k.Crypto.Cipher != CipherAES256GCM {
+		t.Errorf("stored key crypto = %+v, err = %v", k.Crypto, err)
+	}
+}
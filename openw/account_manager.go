@@ -20,6 +20,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/blocktree/go-owcdrivers/owkeychain"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 )
@@ -32,11 +33,11 @@ func (wm *WalletManager) CreateAssetsAccount(appID, walletID, password string, a
 	)
 
 	if len(account.Alias) == 0 {
-		return nil, nil, fmt.Errorf("account alias is empty")
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account alias is empty")
 	}
 
 	if len(account.Symbol) == 0 {
-		return nil, nil, fmt.Errorf("account symbol is empty")
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account symbol is empty")
 	}
 
 	if account.Required == 0 {
@@ -45,7 +46,7 @@ func (wm *WalletManager) CreateAssetsAccount(appID, walletID, password string, a
 
 	symbolInfo, err := GetSymbolInfo(account.Symbol)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	wrapper, err := wm.NewWalletWrapper(appID, walletID)
@@ -56,14 +57,14 @@ func (wm *WalletManager) CreateAssetsAccount(appID, walletID, password string, a
 	if account.IsTrust {
 
 		if wallet == nil {
-			return nil, nil, fmt.Errorf("wallet not exist")
+			return nil, nil, openwallet.Errorf(openwallet.ErrWalletNotFound, "wallet not exist")
 		}
 
 		log.Debugf("wallet[%v] is trusted", wallet.WalletID)
 		//使用私钥创建子账户
 		key, err := wrapper.HDKey(password)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, openwallet.ConvertError(err)
 		}
 
 		newAccIndex := wallet.AccountIndex + 1
@@ -73,7 +74,7 @@ func (wm *WalletManager) CreateAssetsAccount(appID, walletID, password string, a
 
 		childKey, err := key.DerivedKeyWithPath(account.HDPath, symbolInfo.CurveType())
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, openwallet.ConvertError(err)
 		}
 		account.PublicKey = childKey.GetPublicKey().OWEncode()
 		account.Index = uint64(newAccIndex)
@@ -91,7 +92,7 @@ func (wm *WalletManager) CreateAssetsAccount(appID, walletID, password string, a
 				IsTrust:  false,
 			})
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, openwallet.ConvertError(err)
 			}
 		}
 
@@ -112,18 +113,18 @@ func (wm *WalletManager) CreateAssetsAccount(appID, walletID, password string, a
 	}
 
 	if len(account.PublicKey) == 0 {
-		return nil, nil, fmt.Errorf("account publicKey is empty")
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account publicKey is empty")
 	}
 
 	//保存钱包到本地应用数据库
 	db, err := wm.OpenDB(appID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	tx, err := db.Begin(true)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	defer tx.Rollback()
@@ -131,17 +132,17 @@ func (wm *WalletManager) CreateAssetsAccount(appID, walletID, password string, a
 	err = tx.Save(wallet)
 	if err != nil {
 
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	err = tx.Save(account)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("new account create success:", account.AccountID)
@@ -165,12 +166,12 @@ func (wm *WalletManager) GetAssetsAccountInfo(appID, walletID, accountID string)
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return account, nil
@@ -249,12 +250,12 @@ func (wm *WalletManager) GetAssetsAccountList(appID, walletID string, offset, li
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	accounts, err := wrapper.GetAssetsAccountList(offset, limit, "WalletID", walletID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return accounts, nil
@@ -262,41 +263,56 @@ func (wm *WalletManager) GetAssetsAccountList(appID, walletID string, offset, li
 
 // CreateAddress
 func (wm *WalletManager) CreateAddress(appID, walletID string, accountID string, count uint64) ([]*openwallet.Address, error) {
+	return wm.createAddress(appID, accountID, count, false)
+}
+
+//CreateChangeAddress 创建找零地址
+func (wm *WalletManager) CreateChangeAddress(appID, walletID string, accountID string, count uint64) ([]*openwallet.Address, error) {
+	return wm.createAddress(appID, accountID, count, true)
+}
+
+//createAddress 通过账户公钥批量衍生地址，并导入到区块扫描器
+func (wm *WalletManager) createAddress(appID, accountID string, count uint64, isChange bool) ([]*openwallet.Address, error) {
 
 	if count == 0 {
-		return nil, fmt.Errorf("create address count is zero")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "create address count is zero")
 	}
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
-	addrs, err := openwallet.BatchCreateAddressByAccount(account, assetsMgr, int64(count), 20)
+	var addrs []*openwallet.Address
+	if isChange {
+		addrs, err = openwallet.BatchCreateChangeAddressByAccount(account, assetsMgr, int64(count), 20)
+	} else {
+		addrs, err = openwallet.BatchCreateAddressByAccount(account, assetsMgr, int64(count), 20)
+	}
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	tx, err := db.Begin(true)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	defer tx.Rollback()
@@ -304,20 +320,24 @@ func (wm *WalletManager) CreateAddress(appID, walletID string, accountID string,
 	for _, addr := range addrs {
 		err = tx.Save(addr)
 		if err != nil {
-			return nil, err
+			return nil, openwallet.ConvertError(err)
 		}
 	}
 
-	account.AddressIndex = account.AddressIndex + int(count)
+	if isChange {
+		account.ChangeCount = account.ChangeCount + int(count)
+	} else {
+		account.AddressIndex = account.AddressIndex + int(count)
+	}
 
 	err = tx.Save(account)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	//addrs, err := wrapper.CreateAddress(accountID, count, assetsMgr.GetAddressDecode(), false, false)
@@ -351,12 +371,12 @@ func (wm *WalletManager) GetAddressList(appID, walletID, accountID string, offse
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	addrs, err := wrapper.GetAddressList(offset, limit, "AccountID", accountID, "WatchOnly", watchOnly)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	//var addrs []*openwallet.Address
@@ -373,12 +393,12 @@ func (wm *WalletManager) GetAddress(appID, walletID, accountID, address string)
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	addr, err := wrapper.GetAddress(address)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	//var addrs []*openwallet.Address
@@ -395,7 +415,7 @@ func (wm *WalletManager) ImportWatchOnlyAddress(appID, walletID, accountID strin
 
 	account, err := wm.GetAssetsAccountInfo(appID, walletID, accountID)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	//wrapper, err := wm.NewWalletWrapper(appID, "")
@@ -425,12 +445,12 @@ func (wm *WalletManager) ImportWatchOnlyAddress(appID, walletID, accountID strin
 	//保存钱包到本地应用数据库
 	db, err := wm.OpenDB(appID)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	tx, err := db.Begin(true)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	defer tx.Rollback()
@@ -444,7 +464,7 @@ func (wm *WalletManager) ImportWatchOnlyAddress(appID, walletID, accountID strin
 		a.CreatedTime = createdAt.Unix()
 		err = tx.Save(a)
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 
 		key := wm.encodeSourceKey(appID, a.AccountID)
@@ -457,13 +477,13 @@ func (wm *WalletManager) ImportWatchOnlyAddress(appID, walletID, accountID strin
 
 		err = tx.Save(&imported)
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	log.Debug("import addresses success count:", len(addresses))
@@ -565,3 +585,103 @@ func (wm *WalletManager) ImportWatchOnlyAddress(appID, walletID, accountID strin
 //
 //	return
 //}
+
+//ImportWatchOnlyAccount 通过账户扩展公钥导入观察账户。
+//account需要填写Alias、Symbol、PublicKey（owkeychain编码的公钥）、HDPath，
+//无需种子即可衍生收款与找零地址，衍生的地址会导入到区块扫描器。
+//@param addressCount 导入后衍生的收款地址数量，为0不衍生
+func (wm *WalletManager) ImportWatchOnlyAccount(appID, walletID string, account *openwallet.AssetsAccount, addressCount uint64) (*openwallet.AssetsAccount, []*openwallet.Address, error) {
+
+	var (
+		wallet *openwallet.Wallet
+	)
+
+	if account == nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account is nil")
+	}
+
+	if len(account.Alias) == 0 {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account alias is empty")
+	}
+
+	if len(account.Symbol) == 0 {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account symbol is empty")
+	}
+
+	if len(account.HDPath) == 0 {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account hdPath is empty")
+	}
+
+	//只接受公钥，不接受私钥
+	if !strings.HasPrefix(account.PublicKey, "owpub") {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account publicKey is not an extended public key")
+	}
+	if _, err := owkeychain.OWDecode(account.PublicKey); err != nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "account publicKey is invalid: %v", err)
+	}
+
+	if _, err := GetAssetsAdapter(account.Symbol); err != nil {
+		return nil, nil, openwallet.ConvertError(err)
+	}
+
+	account.AccountID = ""
+	account.AccountID = account.GetAccountID()
+	account.WalletID = walletID
+	account.OwnerKeys = []string{account.PublicKey}
+	account.IsTrust = false
+	account.AddressIndex = -1
+	if account.Required == 0 {
+		account.Required = 1
+	}
+
+	db, err := wm.OpenDB(appID)
+	if err != nil {
+		return nil, nil, openwallet.ConvertError(err)
+	}
+
+	//账户ID由公钥计算，已导入到任意钱包都不能重复导入
+	var exist openwallet.AssetsAccount
+	if err = db.One("AccountID", account.AccountID, &exist); err == nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrAccountExist, "account: %s already exist in wallet: %s", account.AccountID, exist.WalletID)
+	}
+
+	wrapper, err := wm.NewWalletWrapper(appID, walletID)
+	if err == nil {
+		wallet = wrapper.GetWallet()
+	}
+
+	if wallet == nil {
+		//创建观察钱包，没有密钥文件
+		wallet, _, err = wm.CreateWallet(appID, &openwallet.Wallet{
+			Alias:     "watchonly",
+			WalletID:  walletID,
+			WatchOnly: true,
+			IsTrust:   false,
+		})
+		if err != nil {
+			return nil, nil, openwallet.ConvertError(err)
+		}
+	} else if wallet.IsTrust {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "wallet: %s is trusted, can not import watch-only account", walletID)
+	}
+
+	//保存账户到本地应用数据库
+	err = db.Save(account)
+	if err != nil {
+		return nil, nil, openwallet.ConvertError(err)
+	}
+
+	log.Debug("watch-only account import success:", account.AccountID)
+
+	if addressCount == 0 {
+		return account, nil, nil
+	}
+
+	addresses, err := wm.CreateAddress(appID, walletID, account.AccountID, addressCount)
+	if err != nil {
+		return account, nil, openwallet.ConvertError(err)
+	}
+	account.AddressIndex += int(addressCount)
+
+	return account, addresses, nil
+}
@@ -52,14 +52,14 @@ func (wrapper *AppWrapper) GetWalletInfo(walletID string) (*openwallet.Wallet, e
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	var wallet openwallet.Wallet
 	err = db.One("WalletID", walletID, &wallet)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return &wallet, nil
@@ -71,14 +71,14 @@ func (wrapper *AppWrapper) GetWalletList(offset, limit int) ([]*openwallet.Walle
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	var wallets []*openwallet.Wallet
 	err = db.All(&wallets, storm.Limit(limit), storm.Skip(offset))
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return wallets, nil
@@ -16,7 +16,6 @@
 package openw
 
 import (
-	"fmt"
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
@@ -89,12 +88,12 @@ func GetAssets(symbol string) interface{} {
 func GetSymbolInfo(symbol string) (openwallet.SymbolInfo, error) {
 	adapter := GetAssets(symbol)
 	if adapter == nil {
-		return nil, fmt.Errorf("assets: %s is not support", symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "assets: %s is not support", symbol)
 	}
 
 	manager, ok := adapter.(openwallet.SymbolInfo)
 	if !ok {
-		return nil, fmt.Errorf("assets: %s is not support", symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "assets: %s is not support", symbol)
 	}
 
 	return manager, nil
@@ -105,12 +104,12 @@ func GetAssetsAdapter(symbol string) (openwallet.AssetsAdapter, error) {
 
 	adapter := GetAssets(symbol)
 	if adapter == nil {
-		return nil, fmt.Errorf("assets: %s is not support", symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "assets: %s is not support", symbol)
 	}
 
 	manager, ok := adapter.(openwallet.AssetsAdapter)
 	if !ok {
-		return nil, fmt.Errorf("assets: %s is not support", symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "assets: %s is not support", symbol)
 	}
 
 	return manager, nil
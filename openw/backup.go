@@ -0,0 +1,827 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/v2/common/file"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/timer"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	//备份文件的版本
+	BackupVersion = 1
+	//备份文件的扩展名
+	BackupFileExt = ".owbackup"
+
+	//备份包内的文件
+	backupManifestName = "manifest.json"
+	backupKeysDir      = "keys/"
+	backupDBName       = "app.db"
+
+	backupKDF    = "scrypt"
+	backupCipher = "aes-256-gcm"
+	backupDKLen  = 32
+	backupScrypR = 8
+
+	//恢复时接受的scrypt参数上限，避免备份文件的参数耗尽内存和CPU
+	backupMaxScryptN   = 1 << 20
+	backupMaxScryptR   = 32
+	backupMaxScryptP   = 16
+	backupMaxScryptMem = 1 << 30 //128*N*r字节
+)
+
+//BackupManifest 备份清单，记录备份包内的文件及哈希
+type BackupManifest struct {
+	Version   int           `json:"version"`
+	AppID     string        `json:"appID"`
+	WalletID  string        `json:"walletID,omitempty"` //钱包备份的钱包ID，为空是应用备份
+	CreatedAt int64         `json:"createdAt"`
+	Keys      []*BackupKey  `json:"keys"`
+	Files     []*BackupFile `json:"files"`
+}
+
+//BackupKey 备份的密钥文件
+type BackupKey struct {
+	WalletID string `json:"walletID"`
+	KeyID    string `json:"keyID"`
+	FileName string `json:"fileName"`
+}
+
+//BackupFile 备份包内的文件
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+//encryptedBackupJSON 加密的备份文件
+type encryptedBackupJSON struct {
+	Version    int                    `json:"version"`
+	AppID      string                 `json:"appID"`
+	WalletID   string                 `json:"walletID,omitempty"`
+	CreatedAt  int64                  `json:"createdAt"`
+	KDF        string                 `json:"kdf"`
+	KDFParams  map[string]interface{} `json:"kdfparams"`
+	Cipher     string                 `json:"cipher"`
+	Nonce      string                 `json:"nonce"`
+	CipherText []byte                 `json:"ciphertext"`
+}
+
+//additionalData 加密的附加数据，头部字段被篡改时解密失败
+func (e *encryptedBackupJSON) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%s:%d", e.Version, e.AppID, e.WalletID, e.CreatedAt))
+}
+
+//BackupApp 备份应用，包括全部钱包的密钥文件和应用数据库，返回备份文件路径
+func (wm *WalletManager) BackupApp(appID, password string) (string, error) {
+	return wm.backup(appID, "", password)
+}
+
+//BackupWallet 备份钱包，包括钱包的密钥文件，以及钱包、账户和地址记录，返回备份文件路径。
+//交易记录不备份，恢复后可通过重扫区块获取
+func (wm *WalletManager) BackupWallet(appID, walletID, password string) (string, error) {
+	if len(walletID) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrInvalidParameter, "walletID is empty")
+	}
+	return wm.backup(appID, walletID, password)
+}
+
+//backup 生成加密的备份文件
+func (wm *WalletManager) backup(appID, walletID, password string) (string, error) {
+
+	if len(password) == 0 {
+		return "", openwallet.Errorf(openwallet.ErrInvalidParameter, "password is empty")
+	}
+
+	db, err := wm.OpenDB(appID)
+	if err != nil {
+		return "", openwallet.ConvertError(err)
+	}
+
+	var (
+		wallets  []*openwallet.Wallet
+		dbBytes  []byte
+		manifest = &BackupManifest{
+			Version:   BackupVersion,
+			AppID:     appID,
+			WalletID:  walletID,
+			CreatedAt: time.Now().Unix(),
+		}
+	)
+
+	if len(walletID) > 0 {
+		var wallet openwallet.Wallet
+		if err = db.One("WalletID", walletID, &wallet); err != nil {
+			return "", openwallet.Errorf(openwallet.ErrWalletNotFound, "wallet: %s is not found", walletID)
+		}
+		wallets = append(wallets, &wallet)
+		dbBytes, err = snapshotWalletDB(db, &wallet)
+	} else {
+		if err = db.All(&wallets); err != nil {
+			return "", openwallet.ConvertError(err)
+		}
+		dbBytes, err = snapshotAppDB(db)
+	}
+	if err != nil {
+		return "", openwallet.Errorf(openwallet.ErrSystemException, "snapshot app: %s database failed, %v", appID, err)
+	}
+
+	files := make(map[string][]byte)
+	files[backupDBName] = dbBytes
+
+	//托管密钥的钱包，KeyID与钱包ID一致
+	for _, w := range wallets {
+		if w.WatchOnly || len(w.KeyFile) == 0 {
+			continue
+		}
+		keyFile := w.KeyFile
+		if !file.Exists(keyFile) {
+			keyFile = filepath.Join(wm.cfg.KeyDir, filepath.Base(w.KeyFile))
+		}
+		keyjson, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return "", openwallet.Errorf(openwallet.ErrSystemException, "read wallet: %s key file failed, %v", w.WalletID, err)
+		}
+		keyID := readKeyID(keyjson)
+		if keyID != w.WalletID {
+			return "", openwallet.Errorf(openwallet.ErrSystemException, "wallet: %s key file has mismatched keyID: %s", w.WalletID, keyID)
+		}
+		fileName := filepath.Base(keyFile)
+		files[backupKeysDir+fileName] = keyjson
+		manifest.Keys = append(manifest.Keys, &BackupKey{WalletID: w.WalletID, KeyID: keyID, FileName: fileName})
+	}
+
+	content, err := packBackup(manifest, files)
+	if err != nil {
+		return "", openwallet.Errorf(openwallet.ErrSystemException, "pack backup failed, %v", err)
+	}
+
+	encrypted, err := encryptBackup(manifest, content, password)
+	if err != nil {
+		return "", openwallet.Errorf(openwallet.ErrSystemException, "encrypt backup failed, %v", err)
+	}
+
+	name := appID
+	if len(walletID) > 0 {
+		name = name + "-" + walletID
+	}
+	name = fmt.Sprintf("%s-%s%s", name, time.Unix(manifest.CreatedAt, 0).Format("20060102150405"), BackupFileExt)
+
+	file.MkdirAll(wm.cfg.BackupDir)
+	backupFile := filepath.Join(wm.cfg.BackupDir, name)
+	if err = writeFileAtomic(backupFile, encrypted); err != nil {
+		return "", openwallet.Errorf(openwallet.ErrSystemException, "write backup file failed, %v", err)
+	}
+
+	log.Info("backup app:", appID, "wallet:", walletID, "to file:", backupFile)
+
+	return backupFile, nil
+}
+
+//RestoreBackup 恢复备份文件，校验完整性和密钥文件的KeyID后，写入密钥文件并重建应用数据库。
+//应用备份替换应用数据库，原数据库保留为.bak文件；钱包备份合并到应用数据库
+func (wm *WalletManager) RestoreBackup(backupFile, password string) (*BackupManifest, error) {
+
+	encrypted, err := ioutil.ReadFile(backupFile)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	content, err := decryptBackup(encrypted, password)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, files, err := unpackBackup(content)
+	if err != nil {
+		return nil, err
+	}
+
+	dbBytes := files[backupDBName]
+
+	//打开备份的数据库，检查钱包与密钥文件一致
+	tmpDB, err := ioutil.TempFile("", "owbackup")
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	tmpFile := tmpDB.Name()
+	tmpDB.Close()
+	defer os.Remove(tmpFile)
+
+	if err = ioutil.WriteFile(tmpFile, dbBytes, 0600); err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	snapshot, err := storm.Open(tmpFile)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup database is invalid, %v", err)
+	}
+	defer snapshot.Close()
+
+	for _, key := range manifest.Keys {
+
+		keyjson := files[backupKeysDir+key.FileName]
+		keyID := readKeyID(keyjson)
+		if keyID != key.KeyID || key.WalletID != key.KeyID ||
+			!strings.HasSuffix(key.FileName, "-"+key.KeyID+".key") {
+			return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "key file: %s has mismatched keyID: %s", key.FileName, keyID)
+		}
+
+		var wallet openwallet.Wallet
+		if err = snapshot.One("WalletID", key.WalletID, &wallet); err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "wallet: %s of key file: %s is not in backup database", key.WalletID, key.FileName)
+		}
+
+		//已存在的同名密钥文件必须是同一个密钥
+		existFile := filepath.Join(wm.cfg.KeyDir, key.FileName)
+		if file.Exists(existFile) {
+			exist, err := ioutil.ReadFile(existFile)
+			if err != nil {
+				return nil, openwallet.ConvertError(err)
+			}
+			if existID := readKeyID(exist); existID != key.KeyID {
+				return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "key file: %s already exists with keyID: %s", key.FileName, existID)
+			}
+		}
+	}
+
+	//写入密钥文件，数据库恢复失败时删除新写入的文件
+	file.MkdirAll(wm.cfg.KeyDir)
+	written := make([]string, 0, len(manifest.Keys))
+	rollbackKeys := func() {
+		for _, f := range written {
+			os.Remove(f)
+		}
+	}
+	for _, key := range manifest.Keys {
+		keyFile := filepath.Join(wm.cfg.KeyDir, key.FileName)
+		exist := file.Exists(keyFile)
+		err = writeFileAtomic(keyFile, files[backupKeysDir+key.FileName])
+		if err != nil {
+			rollbackKeys()
+			return nil, openwallet.ConvertError(err)
+		}
+		if !exist {
+			written = append(written, keyFile)
+		}
+	}
+
+	//重建应用数据库
+	if len(manifest.WalletID) == 0 {
+		err = wm.replaceAppDB(manifest.AppID, snapshot)
+	} else {
+		err = wm.mergeWalletDB(manifest.AppID, snapshot)
+	}
+	if err != nil {
+		rollbackKeys()
+		return nil, err
+	}
+
+	//钱包的密钥文件和数据库路径改为本机路径
+	db, err := wm.OpenDB(manifest.AppID)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	for _, key := range manifest.Keys {
+		var wallet openwallet.Wallet
+		if err = db.One("WalletID", key.WalletID, &wallet); err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+		wallet.KeyFile = filepath.Join(wm.cfg.KeyDir, key.FileName)
+		wallet.DBFile = db.FileName
+		if err = db.Save(&wallet); err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+	}
+
+	log.Info("restore app:", manifest.AppID, "wallet:", manifest.WalletID, "from file:", backupFile)
+
+	return manifest, nil
+}
+
+//StartBackupTask 启动定时备份，每隔period备份一次应用，备份文件保存在BackupDir
+func (wm *WalletManager) StartBackupTask(appID, password string, period time.Duration) error {
+
+	if len(password) == 0 {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "password is empty")
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	if wm.backupTasks == nil {
+		wm.backupTasks = make(map[string]*timer.TaskTimer)
+	}
+
+	if task, exist := wm.backupTasks[appID]; exist {
+		task.Stop()
+	}
+
+	task := timer.NewTask(period, func() {
+		if _, err := wm.BackupApp(appID, password); err != nil {
+			log.Error("scheduled backup app:", appID, "failed, unexpected error:", err)
+		}
+	})
+	wm.backupTasks[appID] = task
+	task.Start()
+
+	return nil
+}
+
+//StopBackupTask 停止应用的定时备份
+func (wm *WalletManager) StopBackupTask(appID string) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	if task, exist := wm.backupTasks[appID]; exist {
+		task.Stop()
+		delete(wm.backupTasks, appID)
+	}
+}
+
+//replaceAppDB 用备份的数据库替换应用数据库，原数据库复制为.bak。
+//在已打开的数据库中以一个事务替换全部bucket，不关闭其他协程正在使用的数据库
+func (wm *WalletManager) replaceAppDB(appID string, snapshot *storm.DB) error {
+
+	file.MkdirAll(wm.cfg.DBPath)
+	dbFile := wm.DBFile(appID)
+	exist := file.Exists(dbFile)
+
+	db, err := wm.OpenDB(appID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	if exist {
+		err = db.Bolt.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(dbFile+".bak", 0600)
+		})
+		if err != nil {
+			return openwallet.ConvertError(err)
+		}
+	}
+
+	return snapshot.Bolt.View(func(src *bolt.Tx) error {
+		return db.Bolt.Update(func(dst *bolt.Tx) error {
+			return replaceBoltBuckets(dst, src)
+		})
+	})
+}
+
+//replaceBoltBuckets 删除dst的全部bucket，再复制src的全部bucket
+func replaceBoltBuckets(dst, src *bolt.Tx) error {
+
+	names := make([][]byte, 0)
+	err := dst.ForEach(func(name []byte, b *bolt.Bucket) error {
+		names = append(names, append([]byte{}, name...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = dst.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+
+	return src.ForEach(func(name []byte, b *bolt.Bucket) error {
+		bucket, err := dst.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		return copyBoltBucket(bucket, b)
+	})
+}
+
+//copyBoltBucket 复制bucket的键值、子bucket和序号
+func copyBoltBucket(dst, src *bolt.Bucket) error {
+	err := src.ForEach(func(k, v []byte) error {
+		//值为nil的是子bucket
+		if v == nil {
+			child, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBoltBucket(child, src.Bucket(k))
+		}
+		return dst.Put(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	return dst.SetSequence(src.Sequence())
+}
+
+//mergeWalletDB 把备份的钱包、账户和地址记录合并到应用数据库
+func (wm *WalletManager) mergeWalletDB(appID string, snapshot *storm.DB) error {
+
+	db, err := wm.OpenDB(appID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	var (
+		wallets   []*openwallet.Wallet
+		accounts  []*openwallet.AssetsAccount
+		addresses []*openwallet.Address
+	)
+
+	if err = snapshot.All(&wallets); err != nil {
+		return openwallet.ConvertError(err)
+	}
+	if err = snapshot.All(&accounts); err != nil && err != storm.ErrNotFound {
+		return openwallet.ConvertError(err)
+	}
+	if err = snapshot.All(&addresses); err != nil && err != storm.ErrNotFound {
+		return openwallet.ConvertError(err)
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+	defer tx.Rollback()
+
+	for _, w := range wallets {
+		if err = tx.Save(w); err != nil {
+			return openwallet.ConvertError(err)
+		}
+	}
+	for _, a := range accounts {
+		if err = tx.Save(a); err != nil {
+			return openwallet.ConvertError(err)
+		}
+	}
+	for _, a := range addresses {
+		if err = tx.Save(a); err != nil {
+			return openwallet.ConvertError(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	return nil
+}
+
+//snapshotAppDB 导出应用数据库的一致性快照
+func snapshotAppDB(db *StormDB) ([]byte, error) {
+	var buf bytes.Buffer
+	err := db.Bolt.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(&buf)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//snapshotWalletDB 导出只包含钱包、账户和地址记录的数据库
+func snapshotWalletDB(db *StormDB, wallet *openwallet.Wallet) ([]byte, error) {
+
+	var (
+		accounts []*openwallet.AssetsAccount
+	)
+
+	err := db.Find("WalletID", wallet.WalletID, &accounts)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile("", "owbackup")
+	if err != nil {
+		return nil, err
+	}
+	tmpFile := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpFile)
+
+	snapshot, err := storm.Open(tmpFile)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Close()
+
+	if err = snapshot.Save(wallet); err != nil {
+		return nil, err
+	}
+
+	for _, account := range accounts {
+		if err = snapshot.Save(account); err != nil {
+			return nil, err
+		}
+		var addresses []*openwallet.Address
+		err = db.Find("AccountID", account.AccountID, &addresses)
+		if err != nil && err != storm.ErrNotFound {
+			return nil, err
+		}
+		for _, address := range addresses {
+			if err = snapshot.Save(address); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return snapshotAppDB(&StormDB{DB: snapshot})
+}
+
+//packBackup 打包清单和文件，tar.gz格式，清单为第一个文件
+func packBackup(manifest *BackupManifest, files map[string][]byte) ([]byte, error) {
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifest.Files = nil
+	for _, name := range names {
+		hash := sha256.Sum256(files[name])
+		manifest.Files = append(manifest.Files, &BackupFile{
+			Name:   name,
+			Size:   int64(len(files[name])),
+			SHA256: hex.EncodeToString(hash[:]),
+		})
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	writeEntry := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: time.Unix(manifest.CreatedAt, 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err = writeEntry(backupManifestName, manifestJSON); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err = writeEntry(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	if err = gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+//unpackBackup 解包并按清单校验每个文件的大小和哈希
+func unpackBackup(content []byte) (*BackupManifest, map[string][]byte, error) {
+
+	gr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup content is invalid, %v", err)
+	}
+	tr := tar.NewReader(gr)
+
+	var (
+		manifest *BackupManifest
+		files    = make(map[string][]byte)
+	)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup content is invalid, %v", err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup content is invalid, %v", err)
+		}
+		if hdr.Name == backupManifestName {
+			manifest = &BackupManifest{}
+			if err = json.Unmarshal(data, manifest); err != nil {
+				return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup manifest is invalid, %v", err)
+			}
+			continue
+		}
+		files[hdr.Name] = data
+	}
+
+	if manifest == nil {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup manifest is not found")
+	}
+	if manifest.Version > BackupVersion {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup version: %d is not supported", manifest.Version)
+	}
+
+	//文件与清单一一对应
+	if len(files) != len(manifest.Files) {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup files do not match the manifest")
+	}
+	for _, f := range manifest.Files {
+		data, ok := files[f.Name]
+		hash := sha256.Sum256(data)
+		if !ok || int64(len(data)) != f.Size || hex.EncodeToString(hash[:]) != f.SHA256 {
+			return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup file: %s is corrupted", f.Name)
+		}
+	}
+	if _, ok := files[backupDBName]; !ok {
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup database is not found")
+	}
+	for _, key := range manifest.Keys {
+		//密钥文件名不能带路径，避免恢复时写到密钥目录以外
+		if len(key.FileName) == 0 || key.FileName == "." || key.FileName == ".." ||
+			filepath.Base(key.FileName) != key.FileName {
+			return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup key file name: %s is invalid", key.FileName)
+		}
+		if _, ok := files[backupKeysDir+key.FileName]; !ok {
+			return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup key file: %s is not found", key.FileName)
+		}
+	}
+
+	return manifest, files, nil
+}
+
+//encryptBackup 以密码加密备份内容，scrypt派生AES-256-GCM的密钥
+func encryptBackup(manifest *BackupManifest, content []byte, password string) ([]byte, error) {
+
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := scrypt.Key([]byte(password), salt, hdkeystore.StandardScryptN, backupScrypR, hdkeystore.StandardScryptP, backupDKLen)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newBackupAEAD(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	encrypted := &encryptedBackupJSON{
+		Version:   manifest.Version,
+		AppID:     manifest.AppID,
+		WalletID:  manifest.WalletID,
+		CreatedAt: manifest.CreatedAt,
+		KDF:       backupKDF,
+		KDFParams: map[string]interface{}{
+			"n":     hdkeystore.StandardScryptN,
+			"r":     backupScrypR,
+			"p":     hdkeystore.StandardScryptP,
+			"dklen": backupDKLen,
+			"salt":  hex.EncodeToString(salt),
+		},
+		Cipher: backupCipher,
+		Nonce:  hex.EncodeToString(nonce),
+	}
+	encrypted.CipherText = aead.Seal(nil, nonce, content, encrypted.additionalData())
+
+	return json.Marshal(encrypted)
+}
+
+//decryptBackup 解密备份内容，密码错误或内容被篡改返回错误
+func decryptBackup(data []byte, password string) ([]byte, error) {
+
+	var encrypted encryptedBackupJSON
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup file is invalid, %v", err)
+	}
+
+	if encrypted.Version < 1 || encrypted.Version > BackupVersion {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup version: %d is not supported", encrypted.Version)
+	}
+	if encrypted.KDF != backupKDF || encrypted.Cipher != backupCipher {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup kdf: %s, cipher: %s is not supported", encrypted.KDF, encrypted.Cipher)
+	}
+
+	salt, err := hex.DecodeString(fmt.Sprint(encrypted.KDFParams["salt"]))
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup kdf salt is invalid")
+	}
+	nonce, err := hex.DecodeString(encrypted.Nonce)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup nonce is invalid")
+	}
+
+	n, _ := encrypted.KDFParams["n"].(float64)
+	r, _ := encrypted.KDFParams["r"].(float64)
+	p, _ := encrypted.KDFParams["p"].(float64)
+	dkLen, _ := encrypted.KDFParams["dklen"].(float64)
+	if n < 2 || n > backupMaxScryptN || r < 1 || r > backupMaxScryptR || p < 1 || p > backupMaxScryptP ||
+		128*n*r > backupMaxScryptMem || dkLen != backupDKLen {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup kdf params are out of range")
+	}
+	derivedKey, err := scrypt.Key([]byte(password), salt, int(n), int(r), int(p), int(dkLen))
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup kdf params are invalid, %v", err)
+	}
+
+	aead, err := newBackupAEAD(derivedKey)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "backup cipher params are invalid")
+	}
+
+	content, err := aead.Open(nil, nonce, encrypted.CipherText, encrypted.additionalData())
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "could not decrypt backup with given password")
+	}
+
+	return content, nil
+}
+
+//newBackupAEAD 派生密钥作为AES-256的密钥
+func newBackupAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//readKeyID 读取密钥文件的KeyID
+func readKeyID(keyjson []byte) string {
+	var key struct {
+		KeyID string `json:"keyid"`
+	}
+	if err := json.Unmarshal(keyjson, &key); err != nil {
+		return ""
+	}
+	return key.KeyID
+}
+
+//writeFileAtomic 先写临时文件再重命名，避免写入中断损坏原文件
+func writeFileAtomic(filename string, content []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), filename)
+}
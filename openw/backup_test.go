@@ -0,0 +1,222 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/common/file"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+func TestWalletManager_BackupRestore(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	w1, _, err := wm.CreateWallet(testApp, &openwallet.Wallet{Alias: "w1", IsTrust: true, Password: "12345678"})
+	if err != nil {
+		t.Fatalf("CreateWallet err: %v", err)
+	}
+	w2, _, err := wm.CreateWallet(testApp, &openwallet.Wallet{Alias: "w2", IsTrust: true, Password: "87654321"})
+	if err != nil {
+		t.Fatalf("CreateWallet err: %v", err)
+	}
+
+	db, err := wm.OpenDB(testApp)
+	if err != nil {
+		t.Fatalf("OpenDB err: %v", err)
+	}
+	db.Save(&openwallet.AssetsAccount{AccountID: "account1", WalletID: w1.WalletID, Symbol: "BTC"})
+	db.Save(&openwallet.Address{AccountID: "account1", Address: "address1", Symbol: "BTC"})
+	db.Save(&openwallet.AssetsAccount{AccountID: "account2", WalletID: w2.WalletID, Symbol: "BTC"})
+
+	appBackup, err := wm.BackupApp(testApp, "backup-pw")
+	if err != nil {
+		t.Fatalf("BackupApp err: %v", err)
+	}
+	walletBackup, err := wm.BackupWallet(testApp, w1.WalletID, "backup-pw")
+	if err != nil {
+		t.Fatalf("BackupWallet err: %v", err)
+	}
+
+	//恢复应用备份到新的目录
+	wm2, cleanup2 := testTempWalletManager(t)
+	defer cleanup2()
+
+	if _, err = wm2.RestoreBackup(appBackup, "wrong"); err == nil {
+		t.Fatalf("restore with wrong password should fail")
+	}
+
+	manifest, err := wm2.RestoreBackup(appBackup, "backup-pw")
+	if err != nil {
+		t.Fatalf("RestoreBackup err: %v", err)
+	}
+	if manifest.AppID != testApp || len(manifest.Keys) != 2 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+
+	restored, err := wm2.GetWalletInfo(testApp, w1.WalletID)
+	if err != nil {
+		t.Fatalf("GetWalletInfo err: %v", err)
+	}
+	if filepath.Dir(restored.KeyFile) != wm2.cfg.KeyDir {
+		t.Errorf("restored key file = %s", restored.KeyFile)
+	}
+	key, err := restored.HDKey("12345678")
+	if err != nil || key.KeyID != w1.WalletID {
+		t.Fatalf("restored HDKey = %v, err: %v", key, err)
+	}
+	if _, err = wm2.GetAssetsAccountInfo(testApp, "", "account2"); err != nil {
+		t.Errorf("account2 is not restored: %v", err)
+	}
+
+	//应用数据库使用中再次恢复，已打开的数据库仍然可用
+	inUse, err := wm2.OpenDB(testApp)
+	if err != nil {
+		t.Fatalf("OpenDB err: %v", err)
+	}
+	inUse.Save(&openwallet.AssetsAccount{AccountID: "account3", WalletID: w2.WalletID, Symbol: "BTC"})
+	if _, err = wm2.RestoreBackup(appBackup, "backup-pw"); err != nil {
+		t.Fatalf("RestoreBackup again err: %v", err)
+	}
+	var account openwallet.AssetsAccount
+	if err = inUse.One("AccountID", "account2", &account); err != nil {
+		t.Fatalf("opened db after restore err: %v", err)
+	}
+	if err = inUse.One("AccountID", "account3", &account); err == nil {
+		t.Fatalf("account3 should be replaced by backup")
+	}
+	if !file.Exists(wm2.DBFile(testApp) + ".bak") {
+		t.Fatalf("app db should be copied to .bak before restore")
+	}
+
+	//钱包备份只包含钱包的记录
+	wm3, cleanup3 := testTempWalletManager(t)
+	defer cleanup3()
+
+	manifest, err = wm3.RestoreBackup(walletBackup, "backup-pw")
+	if err != nil {
+		t.Fatalf("RestoreBackup wallet err: %v", err)
+	}
+	if manifest.WalletID != w1.WalletID || len(manifest.Keys) != 1 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+	if _, err = wm3.GetAssetsAccountInfo(testApp, "", "account1"); err != nil {
+		t.Errorf("account1 is not restored: %v", err)
+	}
+	if _, err = wm3.GetAssetsAccountInfo(testApp, "", "account2"); err == nil {
+		t.Errorf("account2 should not be in wallet backup")
+	}
+
+	//已存在同名但KeyID不一致的密钥文件
+	wm4, cleanup4 := testTempWalletManager(t)
+	defer cleanup4()
+	fake, _ := json.Marshal(map[string]string{"keyid": "other"})
+	ioutil.WriteFile(filepath.Join(wm4.cfg.KeyDir, manifest.Keys[0].FileName), fake, 0600)
+	if _, err = wm4.RestoreBackup(walletBackup, "backup-pw"); err == nil {
+		t.Fatalf("restore with mismatched keyID should fail")
+	}
+
+	//数据库恢复失败，删除已写入的密钥文件
+	wm5, cleanup5 := testTempWalletManager(t)
+	defer cleanup5()
+	os.MkdirAll(wm5.DBFile(testApp), 0700)
+	if _, err = wm5.RestoreBackup(walletBackup, "backup-pw"); err == nil {
+		t.Fatalf("restore to invalid app db should fail")
+	}
+	if file.Exists(filepath.Join(wm5.cfg.KeyDir, manifest.Keys[0].FileName)) {
+		t.Fatalf("key file should be removed when restoring db failed")
+	}
+
+	//备份文件被篡改
+	data, _ := ioutil.ReadFile(walletBackup)
+	var encrypted encryptedBackupJSON
+	json.Unmarshal(data, &encrypted)
+	encrypted.CipherText[len(encrypted.CipherText)/2] ^= 0xff
+	data, _ = json.Marshal(encrypted)
+	tampered := filepath.Join(wm.cfg.BackupDir, "tampered"+BackupFileExt)
+	ioutil.WriteFile(tampered, data, 0600)
+	if _, err = wm2.RestoreBackup(tampered, "backup-pw"); err == nil {
+		t.Fatalf("restore tampered backup should fail")
+	}
+}
+
+func TestWalletManager_BackupTask(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	if _, _, err := wm.CreateWallet(testApp, &openwallet.Wallet{Alias: "w1", IsTrust: true, Password: "12345678"}); err != nil {
+		t.Fatalf("CreateWallet err: %v", err)
+	}
+
+	if err := wm.StartBackupTask(testApp, "backup-pw", 200*time.Millisecond); err != nil {
+		t.Fatalf("StartBackupTask err: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		files, _ := filepath.Glob(filepath.Join(wm.cfg.BackupDir, "*"+BackupFileExt))
+		if len(files) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scheduled backup is not created")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	wm.StopBackupTask(testApp)
+}
+
+func TestBackup_RejectInvalidContent(t *testing.T) {
+
+	//密钥文件名带路径
+	manifest := &BackupManifest{
+		Version: BackupVersion,
+		AppID:   testApp,
+		Keys:    []*BackupKey{{WalletID: "W1", KeyID: "K1", FileName: "../w1-K1.key"}},
+	}
+	content, err := packBackup(manifest, map[string][]byte{
+		backupDBName:                   []byte("db"),
+		backupKeysDir + "../w1-K1.key": []byte("key"),
+	})
+	if err != nil {
+		t.Fatalf("packBackup err: %v", err)
+	}
+	if _, _, err = unpackBackup(content); err == nil {
+		t.Fatalf("unpackBackup should reject key file name with path")
+	}
+
+	//超出范围的scrypt参数
+	data, err := json.Marshal(&encryptedBackupJSON{
+		Version:   BackupVersion,
+		AppID:     testApp,
+		KDF:       backupKDF,
+		KDFParams: map[string]interface{}{"n": 1 << 30, "r": 8, "p": 1, "dklen": 32, "salt": "00"},
+		Cipher:    backupCipher,
+		Nonce:     "00",
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal err: %v", err)
+	}
+	if _, err = decryptBackup(data, "12345678"); err == nil {
+		t.Fatalf("decryptBackup should reject out of range kdf params")
+	}
+}
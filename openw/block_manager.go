@@ -16,7 +16,7 @@
 package openw
 
 import (
-	"fmt"
+	"github.com/blocktree/openwallet/v2/openwallet"
 )
 
 //AddAddressForBlockScan 添加订阅地址
@@ -60,31 +60,50 @@ func (wm *WalletManager) GetSourceKeyByAddressForBlockScan(address string) (stri
 	return sourceKey, ok
 }
 
+//RescanBlockHeight 重扫区块高度范围，并等待完成，失败的高度会保存为UnscanRecord并返回错误
 func (wm *WalletManager) RescanBlockHeight(symbol string, startHeight uint64, endHeight uint64) error {
 
+	job, err := wm.StartRescanJob(symbol, startHeight, endHeight, 0)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	err = wm.WaitRescanJob(job.JobID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	progress, err := wm.GetRescanJobProgress(job.JobID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	if progress.Failed > 0 {
+		return openwallet.Errorf(openwallet.ErrSystemException, "rescan block heights failed: %v", progress.FailedHeights)
+	}
+
+	return nil
+}
+
+//ScanMemPool 扫描交易内存池，未确认的交易通过BlockExtractMemPoolDataNotify保存
+func (wm *WalletManager) ScanMemPool(symbol string) error {
+
 	assetsMgr, err := GetAssetsAdapter(symbol)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	scanner := assetsMgr.GetBlockScanner()
 
 	if scanner == nil {
-		return fmt.Errorf("%s is not support block scan", symbol)
+		return openwallet.Errorf(openwallet.ErrAssetsNotSupport, "%s is not support block scan", symbol)
 	}
 
-	if startHeight <= endHeight {
-		for i := startHeight; i <= endHeight; i++ {
-			err := scanner.ScanBlock(i)
-			if err != nil {
-				continue
-			}
-		}
-	} else {
-		return fmt.Errorf("start block height: %d is greater than end block height: %d", startHeight, endHeight)
+	if !scanner.SupportScanMemPool() {
+		return openwallet.Errorf(openwallet.ErrAssetsNotSupport, "%s is not support scan mempool", symbol)
 	}
 
-	return nil
+	return scanner.ScanMemPool()
 }
 
 //SetRescanBlockHeight 重置区块高度起扫描
@@ -92,18 +111,18 @@ func (wm *WalletManager) SetRescanBlockHeight(symbol string, height uint64) erro
 
 	assetsMgr, err := GetAssetsAdapter(symbol)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	scanner := assetsMgr.GetBlockScanner()
 
 	if scanner == nil {
-		return fmt.Errorf("%s is not support block scan", symbol)
+		return openwallet.Errorf(openwallet.ErrAssetsNotSupport, "%s is not support block scan", symbol)
 	}
 
 	err = scanner.SetRescanBlockHeight(height)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	return nil
@@ -114,18 +133,18 @@ func (wm *WalletManager) GetNewBlockHeight(symbol string) (uint64, uint64, error
 
 	assetsMgr, err := GetAssetsAdapter(symbol)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, openwallet.ConvertError(err)
 	}
 
 	scanner := assetsMgr.GetBlockScanner()
 
 	if scanner == nil {
-		return 0, 0, fmt.Errorf("%s is not support block scan", symbol)
+		return 0, 0, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "%s is not support block scan", symbol)
 	}
 
 	header, err := scanner.GetCurrentBlockHeader()
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, openwallet.ConvertError(err)
 	}
 
 	scannedHeight := scanner.GetScannedBlockHeight()
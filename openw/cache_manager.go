@@ -0,0 +1,187 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+const (
+	//默认内存缓存容量
+	defaultCacheCapacity = 10000
+)
+
+//feeRateCache 缓存的推荐手续费
+type feeRateCache struct {
+	FeeRate string `json:"feeRate"`
+	Unit    string `json:"unit"`
+}
+
+//SetCacheManager 设置缓存管理器，默认使用内存缓存
+func (wm *WalletManager) SetCacheManager(cache openwallet.ICacheManager) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.cache = cache
+}
+
+//getCacheManager 获取缓存管理器
+func (wm *WalletManager) getCacheManager() openwallet.ICacheManager {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if wm.cache == nil {
+		wm.cache = openwallet.NewMemoryCache(defaultCacheCapacity, 0)
+	}
+	return wm.cache
+}
+
+//SetCachePolicy 设置资产的缓存策略，nil表示不缓存
+func (wm *WalletManager) SetCachePolicy(symbol string, policy *openwallet.CachePolicy) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if wm.cfg.CachePolicies == nil {
+		wm.cfg.CachePolicies = make(map[string]*openwallet.CachePolicy)
+	}
+	wm.cfg.CachePolicies[strings.ToUpper(symbol)] = policy
+}
+
+//GetCachePolicy 获取资产的缓存策略，未设置返回空策略
+func (wm *WalletManager) GetCachePolicy(symbol string) openwallet.CachePolicy {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	policy := wm.cfg.CachePolicies[strings.ToUpper(symbol)]
+	if policy == nil {
+		return openwallet.CachePolicy{}
+	}
+	return *policy
+}
+
+func feeRateCacheKey(symbol string) string {
+	return fmt.Sprintf("feeRate:%s", strings.ToUpper(symbol))
+}
+
+func balanceCacheKey(symbol, address string) string {
+	return fmt.Sprintf("balance:%s:%s", strings.ToUpper(symbol), address)
+}
+
+func abiCacheKey(symbol, address string) string {
+	return fmt.Sprintf("abi:%s:%s", strings.ToUpper(symbol), address)
+}
+
+//getRawTransactionFeeRate 获取推荐手续费，按缓存策略缓存结果
+func (wm *WalletManager) getRawTransactionFeeRate(symbol string, txDecoder openwallet.TransactionDecoder) (string, string, error) {
+
+	expiration := wm.GetCachePolicy(symbol).FeeRateExpiration
+	if expiration <= 0 {
+		return txDecoder.GetRawTransactionFeeRate()
+	}
+
+	cache := wm.getCacheManager()
+	key := feeRateCacheKey(symbol)
+
+	var cached feeRateCache
+	if openwallet.GetCacheObject(cache, key, &cached) {
+		return cached.FeeRate, cached.Unit, nil
+	}
+
+	feeRate, unit, err := txDecoder.GetRawTransactionFeeRate()
+	if err != nil {
+		return "", "", openwallet.ConvertError(err)
+	}
+	cache.Add(key, &feeRateCache{FeeRate: feeRate, Unit: unit}, expiration)
+	return feeRate, unit, nil
+}
+
+//getBalanceByAddress 查询地址余额，按缓存策略缓存每个地址的余额，只向节点查询未命中的地址
+func (wm *WalletManager) getBalanceByAddress(symbol string, scanner openwallet.BlockScanner, address ...string) ([]*openwallet.Balance, error) {
+
+	expiration := wm.GetCachePolicy(symbol).BalanceExpiration
+	if expiration <= 0 {
+		return scanner.GetBalanceByAddress(address...)
+	}
+
+	cache := wm.getCacheManager()
+	balances := make([]*openwallet.Balance, 0, len(address))
+	missAddrs := make([]string, 0)
+
+	for _, addr := range address {
+		var b openwallet.Balance
+		if openwallet.GetCacheObject(cache, balanceCacheKey(symbol, addr), &b) {
+			balances = append(balances, &b)
+		} else {
+			missAddrs = append(missAddrs, addr)
+		}
+	}
+
+	if len(missAddrs) == 0 {
+		return balances, nil
+	}
+
+	missBalances, err := scanner.GetBalanceByAddress(missAddrs...)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	for _, b := range missBalances {
+		cache.Add(balanceCacheKey(symbol, b.Address), b, expiration)
+	}
+
+	return append(balances, missBalances...), nil
+}
+
+//removeBalanceCache 地址产生新交易后，删除其余额缓存
+func (wm *WalletManager) removeBalanceCache(data *openwallet.TxExtractData) {
+	if data == nil || data.Transaction == nil {
+		return
+	}
+	symbol := data.Transaction.Coin.Symbol
+	if wm.GetCachePolicy(symbol).BalanceExpiration <= 0 {
+		return
+	}
+	cache := wm.getCacheManager()
+	for _, input := range data.TxInputs {
+		cache.Remove(balanceCacheKey(symbol, input.Address))
+	}
+	for _, output := range data.TxOutputs {
+		cache.Remove(balanceCacheKey(symbol, output.Address))
+	}
+}
+
+//getABIInfo 获取合约ABI，按缓存策略缓存结果
+func (wm *WalletManager) getABIInfo(symbol string, decoder openwallet.SmartContractDecoder, address string) (*openwallet.ABIInfo, error) {
+
+	expiration := wm.GetCachePolicy(symbol).ABIExpiration
+	if expiration <= 0 {
+		return decoder.GetABIInfo(address)
+	}
+
+	cache := wm.getCacheManager()
+	key := abiCacheKey(symbol, address)
+
+	var abi openwallet.ABIInfo
+	if openwallet.GetCacheObject(cache, key, &abi) {
+		return &abi, nil
+	}
+
+	info, err := decoder.GetABIInfo(address)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	cache.Add(key, info, expiration)
+	return info, nil
+}
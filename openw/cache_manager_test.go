@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+type testCacheDecoder struct {
+	openwallet.TransactionDecoderBase
+	feeRateCalls int
+}
+
+func (d *testCacheDecoder) GetRawTransactionFeeRate() (string, string, error) {
+	d.feeRateCalls++
+	return "0.0001", "K", nil
+}
+
+type testCacheScanner struct {
+	*openwallet.BlockScannerBase
+	queried []string
+}
+
+func (s *testCacheScanner) GetBalanceByAddress(address ...string) ([]*openwallet.Balance, error) {
+	balances := make([]*openwallet.Balance, 0)
+	for _, addr := range address {
+		s.queried = append(s.queried, addr)
+		balances = append(balances, &openwallet.Balance{Address: addr, Balance: "1"})
+	}
+	return balances, nil
+}
+
+func TestWalletManager_CachedFeeRate(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	decoder := &testCacheDecoder{}
+
+	//未设置缓存策略，每次都查询节点
+	wm.getRawTransactionFeeRate("CACHE1", decoder)
+	wm.getRawTransactionFeeRate("CACHE1", decoder)
+	if decoder.feeRateCalls != 2 {
+		t.Fatalf("feeRateCalls = %d, want 2", decoder.feeRateCalls)
+	}
+
+	wm.SetCachePolicy("cache1", &openwallet.CachePolicy{FeeRateExpiration: 50 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		feeRate, unit, err := wm.getRawTransactionFeeRate("CACHE1", decoder)
+		if err != nil || feeRate != "0.0001" || unit != "K" {
+			t.Fatalf("getRawTransactionFeeRate = %s, %s, %v", feeRate, unit, err)
+		}
+	}
+	if decoder.feeRateCalls != 3 {
+		t.Fatalf("feeRateCalls = %d, want 3", decoder.feeRateCalls)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	wm.getRawTransactionFeeRate("CACHE1", decoder)
+	if decoder.feeRateCalls != 4 {
+		t.Fatalf("feeRateCalls = %d after expiration, want 4", decoder.feeRateCalls)
+	}
+}
+
+func TestWalletManager_CachedBalance(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	scanner := &testCacheScanner{BlockScannerBase: openwallet.NewBlockScannerBase()}
+	wm.SetCachePolicy("CACHE2", &openwallet.CachePolicy{BalanceExpiration: time.Minute})
+
+	wm.getBalanceByAddress("CACHE2", scanner, "a1", "a2")
+	balances, err := wm.getBalanceByAddress("CACHE2", scanner, "a1", "a2", "a3")
+	if err != nil || len(balances) != 3 {
+		t.Fatalf("getBalanceByAddress = %v, %v", balances, err)
+	}
+	//第二次只查询未命中的a3
+	if len(scanner.queried) != 3 || scanner.queried[2] != "a3" {
+		t.Fatalf("queried = %v", scanner.queried)
+	}
+
+	//地址产生新交易，删除余额缓存
+	data := &openwallet.TxExtractData{
+		Transaction: &openwallet.Transaction{Coin: openwallet.Coin{Symbol: "CACHE2"}},
+		TxOutputs:   []*openwallet.TxOutPut{{Recharge: openwallet.Recharge{Address: "a1"}}},
+	}
+	wm.removeBalanceCache(data)
+	wm.getBalanceByAddress("CACHE2", scanner, "a1", "a2")
+	if len(scanner.queried) != 4 || scanner.queried[3] != "a1" {
+		t.Fatalf("queried = %v", scanner.queried)
+	}
+}
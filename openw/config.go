@@ -15,7 +15,11 @@
 
 package openw
 
-import "path/filepath"
+import (
+	"path/filepath"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
 
 var (
 	defaultDataDir = filepath.Join(".", "openw_data")
@@ -28,6 +32,10 @@ type Config struct {
 	SupportAssets   []string //支持的资产类型
 	EnableBlockScan bool
 	ConfigDir       string
+	//交易确认数阈值，key为symbol，为0不跟踪确认数
+	ConfirmThresholds map[string]uint64
+	//缓存策略，key为symbol，未设置不缓存
+	CachePolicies map[string]*openwallet.CachePolicy
 }
 
 func NewConfig() *Config {
@@ -44,6 +52,10 @@ func NewConfig() *Config {
 	c.SupportAssets = []string{"BTC", "ETH", "QTUM", "NAS", "TRX"}
 	//开启区块扫描
 	c.EnableBlockScan = true
+	//交易确认数阈值
+	c.ConfirmThresholds = make(map[string]uint64)
+	//缓存策略
+	c.CachePolicies = make(map[string]*openwallet.CachePolicy)
 
 	return &c
 }
@@ -17,7 +17,6 @@ package openw
 
 import (
 	"encoding/hex"
-	"fmt"
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
@@ -32,22 +31,22 @@ func (wm *WalletManager) CallSmartContractABI(appID, walletID, accountID string,
 	)
 
 	if contract == nil {
-		return nil, fmt.Errorf("contract is nil")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "contract is nil")
 	}
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	//fmt.Println("contract:", contract)
 
@@ -66,7 +65,7 @@ func (wm *WalletManager) CallSmartContractABI(appID, walletID, accountID string,
 
 	scDecoder := assetsMgr.GetSmartContractDecoder()
 	if scDecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support smart contract transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support smart contract transaction. ", account.Symbol)
 	}
 
 	result, callErr := scDecoder.CallSmartContractABI(wrapper, &rawTx)
@@ -252,3 +251,19 @@ func (wm *WalletManager) SignSmartContractTransaction(appID, walletID, accountID
 
 	return rawTx, nil
 }
+
+//GetABIInfo 获取合约ABI，按资产的缓存策略缓存
+func (wm *WalletManager) GetABIInfo(symbol, address string) (*openwallet.ABIInfo, error) {
+
+	assetsMgr, err := GetAssetsAdapter(symbol)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	scDecoder := assetsMgr.GetSmartContractDecoder()
+	if scDecoder == nil {
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support smart contract. ", symbol)
+	}
+
+	return wm.getABIInfo(symbol, scDecoder, address)
+}
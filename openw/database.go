@@ -17,7 +17,7 @@ package openw
 
 import (
 	"github.com/asdine/storm"
-	"fmt"
+	"github.com/blocktree/openwallet/v2/openwallet"
 )
 
 type StormDB struct {
@@ -32,7 +32,7 @@ func OpenStormDB(filename string, stormOptions ...func(*storm.Options) error) (*
 	db, err := storm.Open(filename, stormOptions...)
 	//fmt.Println("open app db")
 	if err != nil {
-		return nil, fmt.Errorf("can not open dbfile: '%s', unexpected error: %v", filename, err)
+		return nil, openwallet.Errorf(openwallet.ErrSystemException, "can not open dbfile: '%s', unexpected error: %v", filename, err)
 	}
 
 	// Check the metadata.
@@ -49,7 +49,7 @@ func OpenStormDB(filename string, stormOptions ...func(*storm.Options) error) (*
 func (db *StormDB) Close() error {
 	err := db.DB.Close()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	db.Opened = false
 	return nil
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"testing"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+func assertErrorCode(t *testing.T, err error, code uint64) {
+	t.Helper()
+	owErr, ok := err.(*openwallet.Error)
+	if !ok {
+		t.Fatalf("error %v is not *openwallet.Error", err)
+	}
+	if owErr.Code() != code {
+		t.Fatalf("error code = %d, want %d, err: %v", owErr.Code(), code, err)
+	}
+}
+
+func TestWalletManager_ErrorCode(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	_, err := wm.GetAssetsAccountInfo("errApp", "", "notExistAccount")
+	assertErrorCode(t, err, openwallet.ErrAccountNotFound)
+
+	_, err = wm.CreateAddress("errApp", "", "notExistAccount", 0)
+	assertErrorCode(t, err, openwallet.ErrInvalidParameter)
+
+	_, _, err = wm.GetEstimateFeeRate(openwallet.Coin{Symbol: "NOT_EXIST_COIN"})
+	assertErrorCode(t, err, openwallet.ErrAssetsNotSupport)
+
+	_, _, err = wm.CreateAssetsAccount("errApp", "", "", &openwallet.AssetsAccount{}, nil)
+	assertErrorCode(t, err, openwallet.ErrInvalidParameter)
+}
@@ -16,7 +16,6 @@
 package openw
 
 import (
-	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
@@ -47,6 +46,22 @@ type NotificationObject interface {
 	BlockTxExtractDataNotify(account *openwallet.AssetsAccount, data *openwallet.TxExtractData) error
 }
 
+//TxMemPoolNotificationObject 内存池交易通知对象，观察者可选实现。
+//区块扫描器发现内存池中与账户相关的未确认交易时，通知实现了该接口的观察者。
+type TxMemPoolNotificationObject interface {
+
+	//BlockTxMemPoolNotify 内存池未确认交易通知，data.MemPool = true
+	BlockTxMemPoolNotify(account *openwallet.AssetsAccount, data *openwallet.TxExtractData) error
+}
+
+//TxConfirmedNotificationObject 交易确认通知对象，观察者可选实现。
+//交易单确认数达到Config.ConfirmThresholds设置的阈值时，通知实现了该接口的观察者。
+type TxConfirmedNotificationObject interface {
+
+	//BlockTxConfirmedNotify 交易单达到确认数通知
+	BlockTxConfirmedNotify(account *openwallet.AssetsAccount, tx *openwallet.Transaction) error
+}
+
 //WalletManager OpenWallet钱包管理器
 type WalletManager struct {
 	appDB             map[string]*StormDB
@@ -55,7 +70,14 @@ type WalletManager struct {
 	mu                sync.RWMutex
 	observers         map[NotificationObject]bool //观察者
 	importAddressTask *timer.TaskTimer
-	AddressInScanning map[string]string //加入扫描的地址
+	AddressInScanning map[string]string                   //加入扫描的地址
+	blockchainDAI     map[string]openwallet.BlockchainDAI //区块链数据访问接口，key为symbol
+	rescanMu          sync.Mutex                          //重扫任务锁
+	rescanDB          *StormDB                            //重扫任务数据库
+	rescanRunners     map[string]*rescanJobRunner         //运行中的重扫任务
+	cache             openwallet.ICacheManager            //节点查询结果缓存
+	signerFactory     SignerFactory                       //签名器，未设置时由资产适配器使用钱包HDKey签名
+	backupTasks       map[string]*timer.TaskTimer         //定时备份任务，key为appID
 }
 
 // NewWalletManager
@@ -99,6 +121,37 @@ func (wm *WalletManager) Init() {
 	log.Info("openwallet Manager has been initialized!")
 }
 
+//Close 关闭钱包管理器，停止定时备份和重扫任务，关闭打开的数据库文件
+func (wm *WalletManager) Close() error {
+
+	wm.closeRescanJobs()
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	for appID, task := range wm.backupTasks {
+		task.Stop()
+		delete(wm.backupTasks, appID)
+	}
+
+	for appID, db := range wm.appDB {
+		if db.Opened {
+			db.Close()
+		}
+		delete(wm.appDB, appID)
+	}
+
+	return nil
+}
+
+//SetSignerFactory 设置交易单的签名器，例如RemoteSignerFactory通过签名服务签名，
+//设置nil恢复由资产适配器使用钱包HDKey签名
+func (wm *WalletManager) SetSignerFactory(factory SignerFactory) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.signerFactory = factory
+}
+
 //AddObserver 添加观测者
 func (wm *WalletManager) AddObserver(obj NotificationObject) {
 	wm.mu.Lock()
@@ -163,7 +216,7 @@ func (wm *WalletManager) OpenDB(appID string) (*StormDB, error) {
 	)
 	log.Debug("open storm db appID:", appID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	//return opendb, nil
@@ -195,7 +248,7 @@ func (wm *WalletManager) loadAllAppIDs() ([]string, error) {
 	//扫描key目录的所有钱包
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	for _, fi := range files {
@@ -221,7 +274,7 @@ func (wm *WalletManager) initSupportAssetsAdapter() error {
 	//加载已存在所有app
 	appIDs, err := wm.loadAllAppIDs()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	wm.ClearAddressForBlockScan()
@@ -298,7 +351,7 @@ func (wm *WalletManager) NewWalletWrapper(appID, walletID string) (*WalletWrappe
 	//打开数据库
 	db, err := wm.OpenDB(appID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	dbFile := WalletDBFile(wm.DBFile(appID))
@@ -309,7 +362,7 @@ func (wm *WalletManager) NewWalletWrapper(appID, walletID string) (*WalletWrappe
 
 		wallet, err := wrapper.GetWalletInfo(walletID)
 		if err != nil {
-			return nil, fmt.Errorf("wallet not exist")
+			return nil, openwallet.Errorf(openwallet.ErrWalletNotFound, "wallet not exist")
 		}
 
 		keyFile := WalletKeyFile(wallet.KeyFile)
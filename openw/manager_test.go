@@ -16,7 +16,9 @@
 package openw
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -73,6 +75,53 @@ func TestWalletManager_CreateWallet(t *testing.T) {
 
 }
 
+func TestWalletManager_CreateWalletWithMnemonic(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	//生成新助记词
+	w := &openwallet.Wallet{Alias: "mnemonic", IsTrust: true, Password: "12345678"}
+	nw, key, err := wm.CreateWallet(testApp, w, &CreateWalletOptions{MnemonicWords: 24, MnemonicPassphrase: "hello"})
+	if err != nil {
+		t.Fatalf("CreateWallet unexpected error: %v", err)
+	}
+	mnemonic := key.Mnemonic()
+	if len(strings.Fields(mnemonic)) != 24 {
+		t.Fatalf("key mnemonic = %s", mnemonic)
+	}
+	raw, err := json.Marshal(nw)
+	if err != nil {
+		t.Fatalf("json.Marshal unexpected error: %v", err)
+	}
+	if strings.Contains(string(raw), mnemonic) || strings.Contains(string(raw), "hello") {
+		t.Errorf("mnemonic should not be saved: %s", raw)
+	}
+
+	//同一应用已存在相同的钱包，不覆盖
+	opts := &CreateWalletOptions{Mnemonic: mnemonic, MnemonicPassphrase: "hello"}
+	_, _, err = wm.CreateWallet(testApp, &openwallet.Wallet{Alias: "restored", IsTrust: true, Password: "87654321"}, opts)
+	if err == nil || openwallet.ConvertError(err).Code() != openwallet.ErrWalletExist {
+		t.Fatalf("CreateWallet existing wallet error = %v", err)
+	}
+
+	//通过助记词在另一个应用恢复相同的钱包
+	restored, _, err := wm.CreateWallet(testApp+"_restore", &openwallet.Wallet{Alias: "restored", IsTrust: true, Password: "87654321"}, opts)
+	if err != nil {
+		t.Fatalf("CreateWallet unexpected error: %v", err)
+	}
+	if restored.WalletID != nw.WalletID {
+		t.Errorf("restored walletID = %s, want %s", restored.WalletID, nw.WalletID)
+	}
+
+	//错误的单词
+	words := strings.Fields(mnemonic)
+	words[3] = "walletx"
+	_, _, err = wm.CreateWallet(testApp, &openwallet.Wallet{Alias: "bad", IsTrust: true, Password: "12345678"}, &CreateWalletOptions{Mnemonic: strings.Join(words, " ")})
+	if err == nil || !strings.Contains(err.Error(), "#4 'walletx'") {
+		t.Errorf("CreateWallet with bad word error = %v", err)
+	}
+}
+
 func TestWalletManager_ConcurrentCreateWallet(t *testing.T) {
 
 	//w := &Wallet{Alias: "bitbank", IsTrust: true, Password: "12345678"}
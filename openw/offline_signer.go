@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+//SignTransactionPackage 离线签名交易包，返回签名后的交易包。
+//只使用钱包的HDKey，不访问数据库与网络，可在离线签名机上运行。
+func (wm *WalletManager) SignTransactionPackage(key *hdkeystore.HDKey, pkg string) (string, error) {
+
+	pkgType, _, err := openwallet.DecodeTxPackage(pkg)
+	if err != nil {
+		return "", openwallet.ConvertError(err)
+	}
+
+	switch pkgType {
+	case openwallet.TxPackageTypeRawTransaction:
+		rawTx, err := openwallet.ImportRawTransaction(pkg)
+		if err != nil {
+			return "", openwallet.ConvertError(err)
+		}
+		err = wm.SignRawTransactionWithHDKey(key, rawTx)
+		if err != nil {
+			return "", openwallet.ConvertError(err)
+		}
+		return openwallet.ExportRawTransaction(rawTx)
+	case openwallet.TxPackageTypeSmartContractRawTransaction:
+		rawTx, err := openwallet.ImportSmartContractRawTransaction(pkg)
+		if err != nil {
+			return "", openwallet.ConvertError(err)
+		}
+		err = wm.SignSmartContractRawTransactionWithHDKey(key, rawTx)
+		if err != nil {
+			return "", openwallet.ConvertError(err)
+		}
+		return openwallet.ExportSmartContractRawTransaction(rawTx)
+	default:
+		return "", openwallet.Errorf(openwallet.ErrAssetsNotSupport, "tx package type: %d is not supported", pkgType)
+	}
+}
+
+//SignRawTransactionWithHDKey 使用HDKey签名交易单中属于该钥匙的签名
+func (wm *WalletManager) SignRawTransactionWithHDKey(key *hdkeystore.HDKey, rawTx *openwallet.RawTransaction) error {
+
+	if rawTx == nil {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "raw transaction is nil")
+	}
+
+	err := signKeySignaturesWithHDKey(key, rawTx.Signatures)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	//多签交易单，按有效签名数更新IsCompleted
+	if rawTx.Account != nil && rawTx.Account.IsMultiSig() {
+		rawTx.CheckSignatures()
+	}
+
+	log.Debug("transaction has been signed offline successfully")
+
+	return nil
+}
+
+//SignSmartContractRawTransactionWithHDKey 使用HDKey签名智能合约交易单中属于该钥匙的签名
+func (wm *WalletManager) SignSmartContractRawTransactionWithHDKey(key *hdkeystore.HDKey, rawTx *openwallet.SmartContractRawTransaction) error {
+
+	if rawTx == nil {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "smart contract raw transaction is nil")
+	}
+
+	err := signKeySignaturesWithHDKey(key, rawTx.Signatures)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	log.Debug("smart contract transaction has been signed offline successfully")
+
+	return nil
+}
+
+//signKeySignaturesWithHDKey 签名属于HDKey的待签消息
+func signKeySignaturesWithHDKey(key *hdkeystore.HDKey, signatures map[string][]*openwallet.KeySignature) error {
+
+	if key == nil {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "hdkey is nil")
+	}
+
+	return openwallet.SignKeySignatures(openwallet.NewHDKeySigner(key), signatures)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/crypto"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+func TestWalletManager_SignTransactionPackage(t *testing.T) {
+
+	key, err := hdkeystore.NewHDKey(crypto.SHA256([]byte("cold wallet seed")), "cold", "m/44'/88'")
+	if err != nil {
+		t.Fatalf("NewHDKey err: %v", err)
+	}
+
+	accountPath := "m/44'/88'/1'"
+	accountKey, err := key.DerivedKeyWithPath(accountPath, owcrypt.ECC_CURVE_SECP256K1)
+	if err != nil {
+		t.Fatalf("DerivedKeyWithPath err: %v", err)
+	}
+	accountPub := accountKey.GetPublicKey().OWEncode()
+	account := &openwallet.AssetsAccount{PublicKey: accountPub, OwnerKeys: []string{accountPub}, Symbol: "BTC"}
+	accountID := account.GetAccountID()
+
+	msg := hex.EncodeToString(crypto.SHA256([]byte("input0")))
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: "BTC"},
+		RawHex:  "0100000001abcdef",
+		Account: account,
+		Signatures: map[string][]*openwallet.KeySignature{
+			accountID: {{
+				EccType: owcrypt.ECC_CURVE_SECP256K1,
+				Message: msg,
+				Address: &openwallet.Address{Address: "addr", HDPath: accountPath + "/0/1", Index: 1},
+			}},
+			//其他钥匙的签名
+			"otherAccount": {{
+				EccType: owcrypt.ECC_CURVE_SECP256K1,
+				Message: msg,
+				Address: &openwallet.Address{Address: "other", HDPath: "m/44'/88'/2'/0/1", Index: 1},
+			}},
+		},
+	}
+
+	pkg, err := openwallet.ExportRawTransaction(rawTx)
+	if err != nil {
+		t.Fatalf("ExportRawTransaction err: %v", err)
+	}
+
+	//离线签名机没有数据库与网络
+	wm := &WalletManager{}
+	signedPkg, err := wm.SignTransactionPackage(key, pkg)
+	if err != nil {
+		t.Fatalf("SignTransactionPackage err: %v", err)
+	}
+
+	signedTx, err := openwallet.ImportRawTransaction(signedPkg)
+	if err != nil {
+		t.Fatalf("ImportRawTransaction err: %v", err)
+	}
+
+	sigs := signedTx.Signatures[accountID]
+	if len(sigs[0].Signature) == 0 {
+		t.Fatalf("signature of the hdkey is not signed")
+	}
+	owner := &openwallet.OwnerKey{AccountID: accountID, PublicKey: accountPub}
+	if err = owner.VerifyKeySignatures(sigs); err != nil {
+		t.Fatalf("VerifyKeySignatures err: %v", err)
+	}
+	if len(signedTx.Signatures["otherAccount"][0].Signature) != 0 {
+		t.Fatalf("signature of other key should not be signed")
+	}
+
+	//钥匙不匹配
+	otherKey, _ := hdkeystore.NewHDKey(crypto.SHA256([]byte("other seed")), "other", "m/44'/88'")
+	if _, err = wm.SignTransactionPackage(otherKey, pkg); err == nil {
+		t.Fatalf("sign with other hdkey should return error")
+	}
+}
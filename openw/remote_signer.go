@@ -0,0 +1,284 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/owtp"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	//签名服务的OWTP方法
+	signerMethodDerivedPublicKey = "getDerivedPublicKey"
+	signerMethodSignMessage      = "signMessage"
+
+	//signerKeyIDAlphabet keyID的base58字符集
+	signerKeyIDAlphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+	//签名服务解锁密钥的默认时长
+	DefaultSignerUnlockTime = 5 * time.Second
+)
+
+//SignerFactory 按钱包创建签名器，password为钱包密码
+type SignerFactory func(wallet *openwallet.Wallet, password string) (openwallet.Signer, error)
+
+//HDKeySignerFactory 进程内签名，解密钱包的密钥文件得到HDKey
+func HDKeySignerFactory(wallet *openwallet.Wallet, password string) (openwallet.Signer, error) {
+	key, err := wallet.HDKey(password)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrWalletLocked, "wallet: %s unlock failed, %v", wallet.WalletID, err)
+	}
+	return openwallet.NewHDKeySigner(key), nil
+}
+
+//RemoteSignerFactory 远程签名，通过node向节点pid的签名服务请求签名，钱包进程不解密密钥文件
+func RemoteSignerFactory(node *owtp.OWTPNode, pid string) SignerFactory {
+	return func(wallet *openwallet.Wallet, password string) (openwallet.Signer, error) {
+		return NewRemoteSigner(node, pid, wallet.WalletID, password), nil
+	}
+}
+
+//RemoteSigner 远程签名器，私钥在签名服务中使用，不进入本进程。
+//请求带有钱包密码，连接必须开启协商密码（EnableKeyAgreement），否则不发送请求
+type RemoteSigner struct {
+	node     *owtp.OWTPNode
+	pid      string
+	keyID    string
+	password string
+}
+
+//NewRemoteSigner 创建远程签名器，keyID为签名服务中密钥文件的KeyID
+func NewRemoteSigner(node *owtp.OWTPNode, pid, keyID, password string) *RemoteSigner {
+	return &RemoteSigner{
+		node:     node,
+		pid:      pid,
+		keyID:    keyID,
+		password: password,
+	}
+}
+
+//KeyID 签名服务中密钥文件的KeyID
+func (s *RemoteSigner) KeyID() string {
+	return s.keyID
+}
+
+//DerivedPublicKey 按HDPath衍生扩展公钥，返回OW编码
+func (s *RemoteSigner) DerivedPublicKey(hdPath string, eccType uint32) (string, error) {
+	result, err := s.call(signerMethodDerivedPublicKey, hdPath, eccType, nil)
+	if err != nil {
+		return "", err
+	}
+	return result.Get("publicKey").String(), nil
+}
+
+//SignMessage 用HDPath衍生的私钥签名消息摘要
+func (s *RemoteSigner) SignMessage(hdPath string, eccType uint32, msg []byte) ([]byte, byte, error) {
+	result, err := s.call(signerMethodSignMessage, hdPath, eccType, msg)
+	if err != nil {
+		return nil, 0, err
+	}
+	signature, err := hex.DecodeString(result.Get("signature").String())
+	if err != nil || len(signature) == 0 {
+		return nil, 0, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, "signer: %s returns invalid signature", s.pid)
+	}
+	return signature, byte(result.Get("v").Uint()), nil
+}
+
+//call 请求签名服务
+func (s *RemoteSigner) call(method, hdPath string, eccType uint32, msg []byte) (gjson.Result, error) {
+
+	//请求带有钱包密码，连接未开启协商密码时拒绝发送
+	peer := s.node.GetOnlinePeer(s.pid)
+	if peer == nil {
+		return gjson.Result{}, openwallet.Errorf(openwallet.ErrNetworkRequestFailed, "signer: %s is not connected", s.pid)
+	}
+	if !peer.EnableKeyAgreement() {
+		return gjson.Result{}, openwallet.Errorf(openwallet.ErrNetworkRequestFailed, "signer: %s connection has not enabled key agreement", s.pid)
+	}
+
+	params := map[string]interface{}{
+		"keyID":    s.keyID,
+		"password": s.password,
+		"hdPath":   hdPath,
+		"eccType":  eccType,
+	}
+	if msg != nil {
+		params["msg"] = hex.EncodeToString(msg)
+	}
+
+	resp, err := s.node.CallSync(s.pid, method, params)
+	if err != nil {
+		return gjson.Result{}, openwallet.Errorf(openwallet.ErrNetworkRequestFailed, "call signer: %s failed, %v", s.pid, err)
+	}
+	if err = resp.Err(); err != nil {
+		return gjson.Result{}, openwallet.ConvertError(err)
+	}
+
+	return resp.JsonData(), nil
+}
+
+//SignerServer 签名服务，持有密钥文件，响应远程签名器的请求。
+//应运行在独立的进程中，节点开启证书签名与协商密码，并用ACL中间件限制可访问的节点
+type SignerServer struct {
+	keystore   *hdkeystore.HDKeystore
+	unlockTime time.Duration
+	mu         sync.Mutex
+	unlocked   map[string]*unlockedSignerKey //KeyID: 已解锁的密钥
+}
+
+//unlockedSignerKey 签名服务已解锁的密钥
+type unlockedSignerKey struct {
+	key    *hdkeystore.HDKey
+	auth   [sha256.Size]byte //解锁密码的哈希
+	expire time.Time
+}
+
+//NewSignerServer 创建签名服务，keyDir为密钥文件目录，
+//解锁的密钥在unlockTime内可重复使用，不必每个签名都解密密钥文件
+func NewSignerServer(keyDir string, unlockTime time.Duration) *SignerServer {
+	return &SignerServer{
+		keystore:   hdkeystore.NewHDKeystore(keyDir, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP),
+		unlockTime: unlockTime,
+		unlocked:   make(map[string]*unlockedSignerKey),
+	}
+}
+
+//Serve 在节点上注册签名服务的方法
+func (s *SignerServer) Serve(node *owtp.OWTPNode, middlewares ...owtp.Middleware) {
+	node.HandleFunc(signerMethodDerivedPublicKey, s.derivedPublicKey, middlewares...)
+	node.HandleFunc(signerMethodSignMessage, s.signMessage, middlewares...)
+}
+
+//signer 按请求的keyID和密码获取签名器
+func (s *SignerServer) signer(params gjson.Result) (openwallet.Signer, error) {
+
+	keyID := params.Get("keyID").String()
+	password := params.Get("password").String()
+	if len(keyID) == 0 || len(password) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "keyID or password is empty")
+	}
+
+	//keyID用于匹配密钥文件名，只允许base58字符，防止路径穿越和通配符匹配其他密钥
+	if !isSignerKeyID(keyID) {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "keyID is invalid")
+	}
+
+	auth := sha256.Sum256([]byte(password))
+
+	s.mu.Lock()
+	if unlocked, ok := s.unlocked[keyID]; ok {
+		if time.Now().Before(unlocked.expire) && subtle.ConstantTimeCompare(unlocked.auth[:], auth[:]) == 1 {
+			s.mu.Unlock()
+			return openwallet.NewHDKeySigner(unlocked.key), nil
+		}
+		delete(s.unlocked, keyID)
+	}
+	s.mu.Unlock()
+
+	//密钥文件命名为alias-keyID.key，解密耗时较长，不持有锁
+	files, _ := filepath.Glob(s.keystore.JoinPath("*-" + keyID + ".key"))
+	if len(files) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrWalletNotFound, "key: %s is not found", keyID)
+	}
+
+	key, err := s.keystore.GetKey(keyID, files[0], password)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrWalletLocked, "key: %s unlock failed, %v", keyID, err)
+	}
+
+	if s.unlockTime > 0 {
+		unlocked := &unlockedSignerKey{key: key, auth: auth, expire: time.Now().Add(s.unlockTime)}
+		s.mu.Lock()
+		s.unlocked[keyID] = unlocked
+		s.mu.Unlock()
+
+		//过期后从内存移除，不等待同一个keyID再次请求
+		time.AfterFunc(s.unlockTime, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.unlocked[keyID] == unlocked {
+				delete(s.unlocked, keyID)
+			}
+		})
+	}
+
+	return openwallet.NewHDKeySigner(key), nil
+}
+
+//isSignerKeyID keyID是否只包含base58字符
+func isSignerKeyID(keyID string) bool {
+	for _, c := range keyID {
+		if !strings.ContainsRune(signerKeyIDAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+//derivedPublicKey 衍生扩展公钥
+func (s *SignerServer) derivedPublicKey(ctx *owtp.Context) {
+
+	signer, err := s.signer(ctx.Params())
+	if err != nil {
+		ctx.ResponseError(nil, err)
+		return
+	}
+
+	publicKey, err := signer.DerivedPublicKey(ctx.Params().Get("hdPath").String(), uint32(ctx.Params().Get("eccType").Uint()))
+	if err != nil {
+		ctx.ResponseError(nil, openwallet.ConvertError(err))
+		return
+	}
+
+	ctx.Response(map[string]interface{}{"publicKey": publicKey}, owtp.StatusSuccess, "success")
+}
+
+//signMessage 签名消息摘要
+func (s *SignerServer) signMessage(ctx *owtp.Context) {
+
+	signer, err := s.signer(ctx.Params())
+	if err != nil {
+		ctx.ResponseError(nil, err)
+		return
+	}
+
+	msg, err := hex.DecodeString(ctx.Params().Get("msg").String())
+	if err != nil || len(msg) == 0 {
+		ctx.ResponseError(nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "msg is not hex"))
+		return
+	}
+
+	signature, v, err := signer.SignMessage(ctx.Params().Get("hdPath").String(), uint32(ctx.Params().Get("eccType").Uint()), msg)
+	if err != nil {
+		ctx.ResponseError(nil, openwallet.ConvertError(err))
+		return
+	}
+
+	ctx.Response(map[string]interface{}{
+		"signature": hex.EncodeToString(signature),
+		"v":         v,
+	}, owtp.StatusSuccess, "success")
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/crypto"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/owtp"
+	"github.com/tidwall/gjson"
+)
+
+func TestRemoteSigner(t *testing.T) {
+
+	keyDir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(keyDir)
+
+	key, _, err := hdkeystore.StoreHDKeyWithSeed(keyDir, "signer", "1234qwer", crypto.SHA256([]byte("signer seed")),
+		hdkeystore.LightScryptN, hdkeystore.LightScryptP)
+	if err != nil {
+		t.Fatalf("StoreHDKeyWithSeed err: %v", err)
+	}
+
+	//签名服务节点
+	const addr = "remote-signer"
+	daemon := owtp.RandomOWTPNode()
+	NewSignerServer(keyDir, DefaultSignerUnlockTime).Serve(daemon)
+	if err = daemon.Listen(owtp.ConnectConfig{Address: addr, ConnectType: owtp.Loopback, EnableSignature: true}); err != nil {
+		t.Fatalf("Listen err: %v", err)
+	}
+	defer daemon.Close()
+
+	//钱包节点
+	node := owtp.RandomOWTPNode()
+	defer node.Close()
+	_, err = node.Connect(daemon.NodeID(), owtp.ConnectConfig{Address: addr, ConnectType: owtp.Loopback,
+		EnableSignature: true, EnableKeyAgreement: true})
+	if err != nil {
+		t.Fatalf("Connect err: %v", err)
+	}
+
+	accountPath := "m/44'/88'/1'"
+	accountPub, err := openwallet.NewHDKeySigner(key).DerivedPublicKey(accountPath, owcrypt.ECC_CURVE_SECP256K1)
+	if err != nil {
+		t.Fatalf("DerivedPublicKey err: %v", err)
+	}
+	accountID := openwallet.GenAccountID(accountPub)
+
+	newSignatures := func() map[string][]*openwallet.KeySignature {
+		msg := hex.EncodeToString(crypto.SHA256([]byte("input0")))
+		return map[string][]*openwallet.KeySignature{
+			accountID: {{
+				EccType: owcrypt.ECC_CURVE_SECP256K1,
+				Message: msg,
+				RSV:     true,
+				Address: &openwallet.Address{Address: "addr", HDPath: accountPath + "/0/1", Index: 1},
+			}},
+			"otherAccount": {{
+				EccType: owcrypt.ECC_CURVE_SECP256K1,
+				Message: msg,
+				Address: &openwallet.Address{Address: "other", HDPath: "m/44'/88'/2'/0/1", Index: 1},
+			}},
+		}
+	}
+
+	//远程签名
+	remote := newSignatures()
+	signer, err := RemoteSignerFactory(node, daemon.NodeID())(&openwallet.Wallet{WalletID: key.KeyID}, "1234qwer")
+	if err != nil {
+		t.Fatalf("RemoteSignerFactory err: %v", err)
+	}
+	if err = openwallet.SignKeySignatures(signer, remote); err != nil {
+		t.Fatalf("remote SignKeySignatures err: %v", err)
+	}
+	if len(remote["otherAccount"][0].Signature) != 0 {
+		t.Fatalf("signature of other key should not be signed")
+	}
+
+	owner := &openwallet.OwnerKey{AccountID: accountID, PublicKey: accountPub}
+	if err = owner.VerifyKeySignatures(remote[accountID]); err != nil {
+		t.Fatalf("VerifyKeySignatures err: %v", err)
+	}
+
+	//密码错误，错误编号通过OWTP传回
+	wrong := NewRemoteSigner(node, daemon.NodeID(), key.KeyID, "wrong")
+	err = openwallet.SignKeySignatures(wrong, newSignatures())
+	if openwallet.ConvertError(err).Code() != openwallet.ErrWalletLocked {
+		t.Fatalf("wrong password err: %v", err)
+	}
+
+	//密钥不存在
+	missing := NewRemoteSigner(node, daemon.NodeID(), "missing", "1234qwer")
+	err = openwallet.SignKeySignatures(missing, newSignatures())
+	if openwallet.ConvertError(err).Code() != openwallet.ErrWalletNotFound {
+		t.Fatalf("missing key err: %v", err)
+	}
+
+	//keyID不能包含路径和通配符
+	for _, keyID := range []string{"*", "../" + key.KeyID, "[a-z]*"} {
+		err = openwallet.SignKeySignatures(NewRemoteSigner(node, daemon.NodeID(), keyID, "1234qwer"), newSignatures())
+		if openwallet.ConvertError(err).Code() != openwallet.ErrInvalidParameter {
+			t.Fatalf("keyID %s err: %v", keyID, err)
+		}
+	}
+
+	//连接未开启协商密码，不发送钱包密码
+	plain := owtp.RandomOWTPNode()
+	defer plain.Close()
+	_, err = plain.Connect(daemon.NodeID(), owtp.ConnectConfig{Address: addr, ConnectType: owtp.Loopback, EnableSignature: true})
+	if err != nil {
+		t.Fatalf("Connect err: %v", err)
+	}
+	err = openwallet.SignKeySignatures(NewRemoteSigner(plain, daemon.NodeID(), key.KeyID, "1234qwer"), newSignatures())
+	if openwallet.ConvertError(err).Code() != openwallet.ErrNetworkRequestFailed {
+		t.Fatalf("connection without key agreement err: %v", err)
+	}
+
+	//解锁的密钥过期后从内存移除
+	server := NewSignerServer(keyDir, 100*time.Millisecond)
+	params := gjson.Parse(fmt.Sprintf(`{"keyID":"%s","password":"1234qwer"}`, key.KeyID))
+	if _, err = server.signer(params); err != nil {
+		t.Fatalf("signer err: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	server.mu.Lock()
+	remain := len(server.unlocked)
+	server.mu.Unlock()
+	if remain != 0 {
+		t.Fatalf("expired key should be removed, remain %d", remain)
+	}
+}
@@ -0,0 +1,584 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/v2/common"
+	"github.com/blocktree/openwallet/v2/common/file"
+	"github.com/blocktree/openwallet/v2/crypto"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/openwallet"
+	bolt "go.etcd.io/bbolt"
+)
+
+//重扫任务状态
+const (
+	RescanJobStatusRunning   = "running"   //运行中
+	RescanJobStatusPaused    = "paused"    //已暂停
+	RescanJobStatusCancelled = "cancelled" //已取消
+	RescanJobStatusFinished  = "finished"  //已完成
+)
+
+const (
+	defaultRescanWorkers = 4
+	rescanJobDBFile      = "rescan_job.db"
+)
+
+// RescanJob 区块重扫任务，持久化保存，进程重启后可以继续
+type RescanJob struct {
+	JobID       string `json:"jobID" storm:"id"`
+	Symbol      string `json:"symbol"`
+	StartHeight uint64 `json:"startHeight"`
+	EndHeight   uint64 `json:"endHeight"`
+	Workers     int    `json:"workers"` //并发扫描数
+	Status      string `json:"status"`
+	CreateAt    int64  `json:"createdAt"`
+	UpdateAt    int64  `json:"updatedAt"`
+}
+
+// RescanHeightResult 重扫任务中每个高度的扫描结果
+type RescanHeightResult struct {
+	ID      string `json:"id" storm:"id"` //jobID_height
+	JobID   string `json:"jobID" storm:"index"`
+	Height  uint64 `json:"height"`
+	Success bool   `json:"success"`
+	Reason  string `json:"reason"` //失败原因
+}
+
+// RescanJobProgress 重扫任务进度
+type RescanJobProgress struct {
+	JobID         string   `json:"jobID"`
+	Status        string   `json:"status"`
+	Total         uint64   `json:"total"`
+	Done          uint64   `json:"done"`
+	Failed        uint64   `json:"failed"`
+	Remaining     uint64   `json:"remaining"`
+	FailedHeights []uint64 `json:"failedHeights"`
+}
+
+//rescanJobRunner 运行中的重扫任务
+type rescanJobRunner struct {
+	job      *RescanJob
+	mu       sync.Mutex
+	pause    chan struct{} //关闭后暂停派发新高度
+	quit     chan struct{} //关闭后结束任务
+	finished chan struct{} //任务结束后关闭
+	err      error
+}
+
+//isPaused 是否已暂停
+func (runner *rescanJobRunner) isPaused() bool {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	select {
+	case <-runner.pause:
+		return true
+	default:
+		return false
+	}
+}
+
+//newRescanHeightResultID 生成高度结果ID
+func newRescanHeightResultID(jobID string, height uint64) string {
+	return fmt.Sprintf("%s_%d", jobID, height)
+}
+
+//openRescanJobDB 打开重扫任务数据库，放在DBPath的子目录，避免被当作应用数据库加载
+func (wm *WalletManager) openRescanJobDB() (*StormDB, error) {
+	wm.rescanMu.Lock()
+	defer wm.rescanMu.Unlock()
+
+	if wm.rescanDB != nil && wm.rescanDB.Opened {
+		return wm.rescanDB, nil
+	}
+
+	dir := filepath.Join(wm.cfg.DBPath, "jobs")
+	file.MkdirAll(dir)
+	db, err := OpenStormDB(
+		filepath.Join(dir, rescanJobDBFile),
+		storm.Batch(),
+		storm.BoltOptions(0600, &bolt.Options{Timeout: 3 * time.Second}),
+	)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	wm.rescanDB = db
+	return db, nil
+}
+
+//SetBlockchainDAI 设置资产的区块链数据访问接口，重扫失败的高度会保存为UnscanRecord
+func (wm *WalletManager) SetBlockchainDAI(symbol string, dai openwallet.BlockchainDAI) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if wm.blockchainDAI == nil {
+		wm.blockchainDAI = make(map[string]openwallet.BlockchainDAI)
+	}
+	wm.blockchainDAI[strings.ToUpper(symbol)] = dai
+}
+
+//getBlockchainDAI 获取资产的区块链数据访问接口
+func (wm *WalletManager) getBlockchainDAI(symbol string) openwallet.BlockchainDAI {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	return wm.blockchainDAI[strings.ToUpper(symbol)]
+}
+
+//StartRescanJob 创建并启动区块重扫任务
+//@param workers 并发扫描数，小于等于0使用默认值
+func (wm *WalletManager) StartRescanJob(symbol string, startHeight, endHeight uint64, workers int) (*RescanJob, error) {
+
+	if startHeight > endHeight {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "start block height: %d is greater than end block height: %d", startHeight, endHeight)
+	}
+
+	_, err := wm.getRescanBlockScanner(symbol)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	if workers <= 0 {
+		workers = defaultRescanWorkers
+	}
+
+	db, err := wm.openRescanJobDB()
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	now := time.Now()
+	jobID := common.Bytes2Hex(crypto.SHA256([]byte(fmt.Sprintf("%s_%d_%d_%d", symbol, startHeight, endHeight, now.UnixNano()))))
+	job := &RescanJob{
+		JobID:       jobID,
+		Symbol:      strings.ToUpper(symbol),
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		Workers:     workers,
+		Status:      RescanJobStatusRunning,
+		CreateAt:    now.Unix(),
+		UpdateAt:    now.Unix(),
+	}
+
+	err = db.Save(job)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	wm.runRescanJob(job)
+
+	return job, nil
+}
+
+//ResumeRescanJob 继续已暂停或因进程重启而中断的重扫任务，扫描成功的高度不会重复扫描，
+//失败的高度会重新扫描，已完成但有失败高度的任务也可以继续
+func (wm *WalletManager) ResumeRescanJob(jobID string) error {
+
+	wm.rescanMu.Lock()
+	runner, ok := wm.rescanRunners[jobID]
+	wm.rescanMu.Unlock()
+
+	if ok {
+		//运行中的任务无需继续，暂停中的任务等待正在扫描的高度完成
+		if !runner.isPaused() {
+			return nil
+		}
+		<-runner.finished
+	}
+
+	job, err := wm.GetRescanJob(jobID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	if job.Status == RescanJobStatusCancelled {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "rescan job: %s has been %s", jobID, job.Status)
+	}
+
+	if job.Status == RescanJobStatusFinished {
+		progress, err := wm.GetRescanJobProgress(jobID)
+		if err != nil {
+			return openwallet.ConvertError(err)
+		}
+		if progress.Failed == 0 {
+			return openwallet.Errorf(openwallet.ErrInvalidParameter, "rescan job: %s has been %s", jobID, job.Status)
+		}
+	}
+
+	err = wm.updateRescanJobStatus(job, RescanJobStatusRunning)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	wm.runRescanJob(job)
+	return nil
+}
+
+//ResumeAllRescanJobs 进程重启后，继续所有运行中的重扫任务
+func (wm *WalletManager) ResumeAllRescanJobs() error {
+	jobs, err := wm.GetRescanJobs()
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+	for _, job := range jobs {
+		if job.Status != RescanJobStatusRunning {
+			continue
+		}
+		err = wm.ResumeRescanJob(job.JobID)
+		if err != nil {
+			log.Errorf("resume rescan job: %s failed, unexpected error: %v", job.JobID, err)
+		}
+	}
+	return nil
+}
+
+//PauseRescanJob 暂停重扫任务，正在扫描的高度会继续完成
+func (wm *WalletManager) PauseRescanJob(jobID string) error {
+
+	wm.rescanMu.Lock()
+	runner, ok := wm.rescanRunners[jobID]
+	wm.rescanMu.Unlock()
+	if !ok {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "rescan job: %s is not running", jobID)
+	}
+
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	//任务可能已完成或已暂停，只有运行中的任务可以暂停
+	if runner.job.Status != RescanJobStatusRunning {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "rescan job: %s is %s", jobID, runner.job.Status)
+	}
+
+	select {
+	case <-runner.pause:
+	default:
+		close(runner.pause)
+	}
+
+	return wm.updateRescanJobStatus(runner.job, RescanJobStatusPaused)
+}
+
+//CancelRescanJob 取消重扫任务，取消后不能再继续
+func (wm *WalletManager) CancelRescanJob(jobID string) error {
+
+	wm.rescanMu.Lock()
+	runner, ok := wm.rescanRunners[jobID]
+	wm.rescanMu.Unlock()
+
+	if ok {
+		runner.mu.Lock()
+		select {
+		case <-runner.quit:
+		default:
+			close(runner.quit)
+		}
+		runner.mu.Unlock()
+		<-runner.finished
+		return wm.updateRescanJobStatus(runner.job, RescanJobStatusCancelled)
+	}
+
+	job, err := wm.GetRescanJob(jobID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+	if job.Status == RescanJobStatusFinished {
+		return openwallet.Errorf(openwallet.ErrInvalidParameter, "rescan job: %s has been finished", jobID)
+	}
+	return wm.updateRescanJobStatus(job, RescanJobStatusCancelled)
+}
+
+//closeRescanJobs 停止运行中的重扫任务并关闭任务数据库，任务状态保持不变，重启后可继续
+func (wm *WalletManager) closeRescanJobs() {
+
+	wm.rescanMu.Lock()
+	runners := make([]*rescanJobRunner, 0, len(wm.rescanRunners))
+	for _, runner := range wm.rescanRunners {
+		runners = append(runners, runner)
+	}
+	wm.rescanMu.Unlock()
+
+	for _, runner := range runners {
+		runner.mu.Lock()
+		select {
+		case <-runner.quit:
+		default:
+			close(runner.quit)
+		}
+		runner.mu.Unlock()
+		<-runner.finished
+	}
+
+	wm.rescanMu.Lock()
+	defer wm.rescanMu.Unlock()
+	if wm.rescanDB != nil {
+		wm.rescanDB.Close()
+		wm.rescanDB = nil
+	}
+}
+
+//WaitRescanJob 等待运行中的重扫任务结束或暂停
+func (wm *WalletManager) WaitRescanJob(jobID string) error {
+	wm.rescanMu.Lock()
+	runner, ok := wm.rescanRunners[jobID]
+	wm.rescanMu.Unlock()
+	if !ok {
+		return nil
+	}
+	<-runner.finished
+	return runner.err
+}
+
+//GetRescanJob 获取重扫任务
+func (wm *WalletManager) GetRescanJob(jobID string) (*RescanJob, error) {
+	db, err := wm.openRescanJobDB()
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	var job RescanJob
+	err = db.One("JobID", jobID, &job)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "rescan job: %s not found", jobID)
+	}
+	return &job, nil
+}
+
+//GetRescanJobs 获取全部重扫任务
+func (wm *WalletManager) GetRescanJobs() ([]*RescanJob, error) {
+	db, err := wm.openRescanJobDB()
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	var jobs []*RescanJob
+	err = db.All(&jobs)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	return jobs, nil
+}
+
+//GetRescanJobProgress 查询重扫任务进度
+func (wm *WalletManager) GetRescanJobProgress(jobID string) (*RescanJobProgress, error) {
+
+	job, err := wm.GetRescanJob(jobID)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	results, err := wm.getRescanHeightResults(jobID)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	progress := &RescanJobProgress{
+		JobID:         job.JobID,
+		Status:        job.Status,
+		Total:         job.EndHeight - job.StartHeight + 1,
+		FailedHeights: make([]uint64, 0),
+	}
+
+	for _, r := range results {
+		if r.Success {
+			progress.Done++
+		} else {
+			progress.Failed++
+			progress.FailedHeights = append(progress.FailedHeights, r.Height)
+		}
+	}
+	progress.Remaining = progress.Total - progress.Done - progress.Failed
+
+	return progress, nil
+}
+
+//getRescanHeightResults 获取任务已扫描的高度结果
+func (wm *WalletManager) getRescanHeightResults(jobID string) ([]*RescanHeightResult, error) {
+	db, err := wm.openRescanJobDB()
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	var results []*RescanHeightResult
+	err = db.Find("JobID", jobID, &results)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return results, nil
+}
+
+//updateRescanJobStatus 更新任务状态
+func (wm *WalletManager) updateRescanJobStatus(job *RescanJob, status string) error {
+	db, err := wm.openRescanJobDB()
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+	job.Status = status
+	job.UpdateAt = time.Now().Unix()
+	return db.Save(job)
+}
+
+//getRescanBlockScanner 获取资产的区块扫描器
+func (wm *WalletManager) getRescanBlockScanner(symbol string) (openwallet.BlockScanner, error) {
+	assetsMgr, err := GetAssetsAdapter(symbol)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	scanner := assetsMgr.GetBlockScanner()
+	if scanner == nil {
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "%s is not support block scan", symbol)
+	}
+	return scanner, nil
+}
+
+//runRescanJob 启动工作池执行重扫任务
+func (wm *WalletManager) runRescanJob(job *RescanJob) {
+
+	runner := &rescanJobRunner{
+		job:      job,
+		pause:    make(chan struct{}),
+		quit:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	wm.rescanMu.Lock()
+	if wm.rescanRunners == nil {
+		wm.rescanRunners = make(map[string]*rescanJobRunner)
+	}
+	wm.rescanRunners[job.JobID] = runner
+	wm.rescanMu.Unlock()
+
+	go func() {
+		defer func() {
+			wm.rescanMu.Lock()
+			delete(wm.rescanRunners, job.JobID)
+			wm.rescanMu.Unlock()
+			close(runner.finished)
+		}()
+
+		runner.err = wm.rescanJobRuntime(runner)
+	}()
+}
+
+//rescanJobRuntime 派发未扫描的高度给工作池，直到全部完成，暂停或取消
+func (wm *WalletManager) rescanJobRuntime(runner *rescanJobRunner) error {
+
+	job := runner.job
+
+	scanner, err := wm.getRescanBlockScanner(job.Symbol)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	//扫描成功的高度不再重复扫描，失败的高度保留在重试集合中重新扫描
+	results, err := wm.getRescanHeightResults(job.JobID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+	scanned := make(map[uint64]bool)
+	for _, r := range results {
+		if r.Success {
+			scanned[r.Height] = true
+		}
+	}
+
+	var (
+		heights = make(chan uint64)
+		wg      sync.WaitGroup
+		paused  bool
+	)
+
+	for i := 0; i < job.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for height := range heights {
+				wm.rescanHeight(scanner, job, height)
+			}
+		}()
+	}
+
+dispatch:
+	for height := job.StartHeight; height <= job.EndHeight; height++ {
+		if scanned[height] {
+			continue
+		}
+
+		select {
+		case <-runner.quit:
+			break dispatch
+		case <-runner.pause:
+			paused = true
+			break dispatch
+		case heights <- height:
+		}
+	}
+	close(heights)
+	wg.Wait()
+
+	select {
+	case <-runner.quit:
+		return nil
+	default:
+	}
+
+	if paused {
+		return nil
+	}
+
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	return wm.updateRescanJobStatus(job, RescanJobStatusFinished)
+}
+
+//rescanHeight 扫描单个高度，并记录结果，失败的高度保存为UnscanRecord
+func (wm *WalletManager) rescanHeight(scanner openwallet.BlockScanner, job *RescanJob, height uint64) {
+
+	result := &RescanHeightResult{
+		ID:     newRescanHeightResultID(job.JobID, height),
+		JobID:  job.JobID,
+		Height: height,
+	}
+
+	dai := wm.getBlockchainDAI(job.Symbol)
+
+	err := scanner.ScanBlock(height)
+	if err != nil {
+		log.Errorf("rescan job: %s scan block height: %d failed, unexpected error: %v", job.JobID, height, err)
+		result.Reason = err.Error()
+		if dai != nil {
+			dai.SaveUnscanRecord(openwallet.NewUnscanRecord(height, "", err.Error(), job.Symbol))
+		}
+	} else {
+		result.Success = true
+		if dai != nil {
+			dai.DeleteUnscanRecordByHeight(height, job.Symbol)
+		}
+	}
+
+	db, err := wm.openRescanJobDB()
+	if err != nil {
+		log.Errorf("rescan job: %s can not open job db, unexpected error: %v", job.JobID, err)
+		return
+	}
+	err = db.Save(result)
+	if err != nil {
+		log.Errorf("rescan job: %s save result of height: %d failed, unexpected error: %v", job.JobID, height, err)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+//testRescanScanner 模拟区块扫描器，记录扫描过的高度
+type testRescanScanner struct {
+	*openwallet.BlockScannerBase
+	mu      sync.Mutex
+	scanned map[uint64]int
+	fail    map[uint64]bool
+	delay   time.Duration
+}
+
+func (s *testRescanScanner) ScanBlock(height uint64) error {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scanned[height]++
+	if s.fail[height] {
+		return fmt.Errorf("rpc call error")
+	}
+	return nil
+}
+
+func (s *testRescanScanner) scanCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.scanned {
+		total += n
+	}
+	return total
+}
+
+type testRescanAdapter struct {
+	openwallet.AssetsAdapterBase
+	scanner *testRescanScanner
+}
+
+func (a *testRescanAdapter) GetBlockScanner() openwallet.BlockScanner {
+	return a.scanner
+}
+
+func registerTestRescanScanner(symbol string, fail map[uint64]bool, delay time.Duration) *testRescanScanner {
+	scanner := &testRescanScanner{
+		BlockScannerBase: openwallet.NewBlockScannerBase(),
+		scanned:          make(map[uint64]int),
+		fail:             fail,
+		delay:            delay,
+	}
+	assetsAdapterManagers[symbol] = &testRescanAdapter{scanner: scanner}
+	return scanner
+}
+
+func TestWalletManager_RescanBlockHeight(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	scanner := registerTestRescanScanner("RSCAN1", map[uint64]bool{15: true}, 0)
+	dai, err := openwallet.NewBlockchainLocal(filepath.Join(wm.cfg.DBPath, "blockchain.db"), true)
+	if err != nil {
+		t.Fatalf("NewBlockchainLocal err: %v", err)
+	}
+	wm.SetBlockchainDAI("RSCAN1", dai)
+
+	err = wm.RescanBlockHeight("RSCAN1", 10, 29)
+	if err == nil {
+		t.Fatalf("RescanBlockHeight should return error of failed height")
+	}
+	if scanner.scanCount() != 20 {
+		t.Fatalf("scanned %d heights, want 20", scanner.scanCount())
+	}
+
+	records, _ := dai.GetUnscanRecords("RSCAN1")
+	if len(records) != 1 || records[0].BlockHeight != 15 {
+		t.Fatalf("unscan records = %+v, want height 15", records)
+	}
+
+	if err = wm.RescanBlockHeight("RSCAN1", 30, 10); err == nil {
+		t.Fatalf("RescanBlockHeight should return error when start > end")
+	}
+}
+
+func TestWalletManager_RescanJobPauseResume(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	scanner := registerTestRescanScanner("RSCAN2", nil, 5*time.Millisecond)
+
+	job, err := wm.StartRescanJob("RSCAN2", 1, 100, 2)
+	if err != nil {
+		t.Fatalf("StartRescanJob err: %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err = wm.PauseRescanJob(job.JobID); err != nil {
+		t.Fatalf("PauseRescanJob err: %v", err)
+	}
+	wm.WaitRescanJob(job.JobID)
+
+	progress, err := wm.GetRescanJobProgress(job.JobID)
+	if err != nil {
+		t.Fatalf("GetRescanJobProgress err: %v", err)
+	}
+	if progress.Status != RescanJobStatusPaused || progress.Done == 0 || progress.Remaining == 0 {
+		t.Fatalf("progress after pause = %+v", progress)
+	}
+	if progress.Done+progress.Failed+progress.Remaining != 100 {
+		t.Fatalf("progress = %+v, total mismatch", progress)
+	}
+
+	//模拟进程重启，新的管理器从数据库恢复任务
+	wm.Close()
+	wm2 := NewWalletManager(wm.cfg)
+	if err = wm2.ResumeRescanJob(job.JobID); err != nil {
+		t.Fatalf("ResumeRescanJob err: %v", err)
+	}
+	wm2.WaitRescanJob(job.JobID)
+
+	progress, _ = wm2.GetRescanJobProgress(job.JobID)
+	if progress.Status != RescanJobStatusFinished || progress.Done != 100 || progress.Remaining != 0 {
+		t.Fatalf("progress after resume = %+v", progress)
+	}
+
+	//每个高度只扫描一次
+	for h := uint64(1); h <= 100; h++ {
+		if scanner.scanned[h] != 1 {
+			t.Fatalf("height %d scanned %d times", h, scanner.scanned[h])
+		}
+	}
+
+	if err = wm2.ResumeRescanJob(job.JobID); err == nil {
+		t.Fatalf("finished job should not be resumed")
+	}
+}
+
+func TestWalletManager_RescanJobRetryFailed(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	scanner := registerTestRescanScanner("RSCAN4", map[uint64]bool{5: true}, 0)
+
+	job, err := wm.StartRescanJob("RSCAN4", 1, 10, 2)
+	if err != nil {
+		t.Fatalf("StartRescanJob err: %v", err)
+	}
+	wm.WaitRescanJob(job.JobID)
+
+	progress, _ := wm.GetRescanJobProgress(job.JobID)
+	if progress.Status != RescanJobStatusFinished || progress.Failed != 1 || progress.FailedHeights[0] != 5 {
+		t.Fatalf("progress with failed height = %+v", progress)
+	}
+	if err = wm.PauseRescanJob(job.JobID); err == nil {
+		t.Fatalf("finished job should not be paused")
+	}
+
+	//失败的高度重新扫描，成功的高度不重复扫描
+	scanner.mu.Lock()
+	scanner.fail[5] = false
+	scanner.mu.Unlock()
+	if err = wm.ResumeRescanJob(job.JobID); err != nil {
+		t.Fatalf("ResumeRescanJob err: %v", err)
+	}
+	wm.WaitRescanJob(job.JobID)
+
+	progress, _ = wm.GetRescanJobProgress(job.JobID)
+	if progress.Status != RescanJobStatusFinished || progress.Done != 10 || progress.Failed != 0 {
+		t.Fatalf("progress after retry = %+v", progress)
+	}
+	if scanner.scanned[5] != 2 || scanner.scanCount() != 11 {
+		t.Fatalf("scanned = %v", scanner.scanned)
+	}
+
+	if err = wm.ResumeRescanJob(job.JobID); err == nil {
+		t.Fatalf("finished job without failed heights should not be resumed")
+	}
+}
+
+func TestWalletManager_CancelRescanJob(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	registerTestRescanScanner("RSCAN3", nil, 5*time.Millisecond)
+
+	job, err := wm.StartRescanJob("RSCAN3", 1, 1000, 2)
+	if err != nil {
+		t.Fatalf("StartRescanJob err: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err = wm.CancelRescanJob(job.JobID); err != nil {
+		t.Fatalf("CancelRescanJob err: %v", err)
+	}
+
+	progress, _ := wm.GetRescanJobProgress(job.JobID)
+	if progress.Status != RescanJobStatusCancelled || progress.Remaining == 0 {
+		t.Fatalf("progress after cancel = %+v", progress)
+	}
+	if err = wm.ResumeRescanJob(job.JobID); err == nil {
+		t.Fatalf("cancelled job should not be resumed")
+	}
+}
@@ -16,6 +16,8 @@
 package openw
 
 import (
+	"strings"
+
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 )
@@ -28,7 +30,7 @@ func (wm *WalletManager) BlockScanNotify(header *openwallet.BlockHeader) error {
 		//加载已存在所有app
 		appIDs, err := wm.loadAllAppIDs()
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 
 		//分叉的区块，删除提出记录
@@ -36,13 +38,13 @@ func (wm *WalletManager) BlockScanNotify(header *openwallet.BlockHeader) error {
 
 			wrapper, err := wm.NewWalletWrapper(appID, "")
 			if err != nil {
-				return err
+				return openwallet.ConvertError(err)
 			}
 
 			txWrapper := NewTransactionWrapper(wrapper)
 			err = txWrapper.DeleteBlockDataByHeight(header.Height)
 			if err != nil {
-				return err
+				return openwallet.ConvertError(err)
 			}
 
 		}
@@ -54,6 +56,12 @@ func (wm *WalletManager) BlockScanNotify(header *openwallet.BlockHeader) error {
 		o.BlockScanNotify(header)
 	}
 
+	//更新交易确认数
+	err := wm.updateConfirmations(header)
+	if err != nil {
+		log.Error("update confirmations error:", err)
+	}
+
 	//TODO:定时删除过时的记录，保证数据库不会无限增加
 	//可以由配置，自定义删除超过例如1000个块之前的记录
 
@@ -70,15 +78,24 @@ func (wm *WalletManager) BlockExtractDataNotify(sourceKey string, data *openwall
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	txWrapper := NewTransactionWrapper(wrapper)
 	err = txWrapper.SaveBlockExtractData(accountID, data)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
+	}
+
+	//交易已上链，删除内存池记录
+	err = txWrapper.DeleteMemPoolTransaction(data.Transaction.WxID)
+	if err != nil {
+		log.Error("DeleteMemPoolTransaction error:", err)
 	}
 
+	//余额已变化，删除地址余额缓存
+	wm.removeBalanceCache(data)
+
 	//更新账户余额
 	//err = wm.RefreshAssetsAccountBalance(appID, accountID)
 	//if err != nil {
@@ -87,7 +104,7 @@ func (wm *WalletManager) BlockExtractDataNotify(sourceKey string, data *openwall
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	for o, _ := range wm.observers {
@@ -97,6 +114,52 @@ func (wm *WalletManager) BlockExtractDataNotify(sourceKey string, data *openwall
 	return nil
 }
 
+//BlockExtractMemPoolDataNotify 内存池未确认交易提取结果通知
+func (wm *WalletManager) BlockExtractMemPoolDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+
+	//保存提取出来的数据
+	appID, accountID := wm.decodeSourceKey(sourceKey)
+
+	log.Debug("NewMemPoolExtractData:", appID, accountID)
+
+	wrapper, err := wm.NewWalletWrapper(appID, "")
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	txWrapper := NewTransactionWrapper(wrapper)
+
+	//已上链的交易不再记录
+	trxs, _ := txWrapper.GetTransactions(0, -1, "WxID", openwallet.GenTransactionWxID(data.Transaction))
+	if len(trxs) > 0 {
+		return nil
+	}
+
+	_, err = txWrapper.SaveMemPoolExtractData(accountID, data)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	//清理已被丢弃或替换的交易记录
+	_, err = txWrapper.DeleteExpiredMemPoolTransactions()
+	if err != nil {
+		log.Error("DeleteExpiredMemPoolTransactions error:", err)
+	}
+
+	account, err := wrapper.GetAssetsAccountInfo(accountID)
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	for o, _ := range wm.observers {
+		if mo, ok := o.(TxMemPoolNotificationObject); ok {
+			mo.BlockTxMemPoolNotify(account, data)
+		}
+	}
+
+	return nil
+}
+
 //BlockExtractSmartContractDataNotify 区块提取智能合约交易结果通知
 //@param sourceKey: 为contractID
 //@param data: 合约交易回执
@@ -111,23 +174,86 @@ func (wm *WalletManager) DeleteRechargesByHeight(height uint64) error {
 	//加载已存在所有app
 	appIDs, err := wm.loadAllAppIDs()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	for _, appID := range appIDs {
 
 		wrapper, err := wm.NewWalletWrapper(appID, "")
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 
 		txWrapper := NewTransactionWrapper(wrapper)
 		err = txWrapper.DeleteBlockDataByHeight(height)
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 
 	}
 
 	return nil
 }
+
+//SetConfirmThreshold 设置交易确认数阈值，为0不跟踪确认数
+func (wm *WalletManager) SetConfirmThreshold(symbol string, confirms uint64) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if wm.cfg.ConfirmThresholds == nil {
+		wm.cfg.ConfirmThresholds = make(map[string]uint64)
+	}
+	wm.cfg.ConfirmThresholds[strings.ToUpper(symbol)] = confirms
+}
+
+//GetConfirmThreshold 获取交易确认数阈值
+func (wm *WalletManager) GetConfirmThreshold(symbol string) uint64 {
+	wm.mu.RLock()
+	defer wm.mu.RUnlock()
+	return wm.cfg.ConfirmThresholds[strings.ToUpper(symbol)]
+}
+
+//updateConfirmations 新区块到达后，更新各个应用的交易记录确认数，并通知达到确认数的交易
+func (wm *WalletManager) updateConfirmations(header *openwallet.BlockHeader) error {
+
+	threshold := wm.GetConfirmThreshold(header.Symbol)
+	if threshold == 0 {
+		return nil
+	}
+
+	//加载已存在所有app
+	appIDs, err := wm.loadAllAppIDs()
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	for _, appID := range appIDs {
+
+		wrapper, err := wm.NewWalletWrapper(appID, "")
+		if err != nil {
+			return openwallet.ConvertError(err)
+		}
+
+		txWrapper := NewTransactionWrapper(wrapper)
+		confirmed, err := txWrapper.UpdateConfirmations(header.Symbol, header.Height, threshold)
+		if err != nil {
+			return openwallet.ConvertError(err)
+		}
+
+		for _, tx := range confirmed {
+
+			account, err := wrapper.GetAssetsAccountInfo(tx.AccountID)
+			if err != nil {
+				log.Error("confirmed transaction can not find account:", tx.AccountID)
+				continue
+			}
+
+			for o, _ := range wm.observers {
+				if co, ok := o.(TxConfirmedNotificationObject); ok {
+					co.BlockTxConfirmedNotify(account, tx)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+type testConfirmObserver struct {
+	confirmed []*openwallet.Transaction
+	mempool   []*openwallet.TxExtractData
+}
+
+func (o *testConfirmObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *testConfirmObserver) BlockTxExtractDataNotify(account *openwallet.AssetsAccount, data *openwallet.TxExtractData) error {
+	return nil
+}
+
+func (o *testConfirmObserver) BlockTxConfirmedNotify(account *openwallet.AssetsAccount, tx *openwallet.Transaction) error {
+	o.confirmed = append(o.confirmed, tx)
+	return nil
+}
+
+func (o *testConfirmObserver) BlockTxMemPoolNotify(account *openwallet.AssetsAccount, data *openwallet.TxExtractData) error {
+	o.mempool = append(o.mempool, data)
+	return nil
+}
+
+func testTempWalletManager(t *testing.T) (*WalletManager, func()) {
+	dir, err := ioutil.TempDir("", "openw")
+	if err != nil {
+		t.Fatalf("TempDir err: %v", err)
+	}
+	tc := NewConfig()
+	tc.KeyDir = filepath.Join(dir, "key")
+	tc.DBPath = filepath.Join(dir, "db")
+	tc.BackupDir = filepath.Join(dir, "backup")
+	tc.EnableBlockScan = false
+	tc.SupportAssets = []string{}
+	return NewWalletManager(tc), func() { os.RemoveAll(dir) }
+}
+
+func TestWalletManager_BlockTxConfirmedNotify(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	wrapper, err := wm.NewWalletWrapper(testApp, "")
+	if err != nil {
+		t.Fatalf("NewWalletWrapper err: %v", err)
+	}
+	account := &openwallet.AssetsAccount{AccountID: "account1", Symbol: "BTC"}
+	wrapper.SaveAssetsAccount(account)
+
+	coin := openwallet.Coin{Symbol: "BTC"}
+	txWrapper := NewTransactionWrapper(wrapper)
+	db, err := wrapper.OpenStormDB()
+	if err != nil {
+		t.Fatalf("OpenStormDB err: %v", err)
+	}
+	for _, height := range []uint64{100, 101} {
+		txid := fmt.Sprintf("tx%d", height)
+		output := &openwallet.TxOutPut{}
+		output.Sid = openwallet.GenTxOutPutSID(txid, "BTC", "", 0)
+		output.TxID = txid
+		output.Coin = coin
+		output.BlockHeight = height
+		output.AccountID = account.AccountID
+		if err = db.Save(output); err != nil {
+			t.Fatalf("Save TxOutPut err: %v", err)
+		}
+		data := &openwallet.TxExtractData{
+			Transaction: &openwallet.Transaction{
+				TxID:        txid,
+				Coin:        coin,
+				BlockHeight: height,
+				Decimal:     8,
+			},
+		}
+		data.Transaction.WxID = openwallet.GenTransactionWxID(data.Transaction)
+		if err = txWrapper.SaveBlockExtractData(account.AccountID, data); err != nil {
+			t.Fatalf("SaveBlockExtractData err: %v", err)
+		}
+	}
+
+	observer := &testConfirmObserver{}
+	wm.AddObserver(observer)
+	wm.SetConfirmThreshold("btc", 3)
+
+	//高度101时，tx100有2个确认
+	wm.BlockScanNotify(&openwallet.BlockHeader{Height: 101, Symbol: "BTC"})
+	if len(observer.confirmed) != 0 {
+		t.Fatalf("confirmed = %d, want 0", len(observer.confirmed))
+	}
+	trxs, _ := wrapper.GetTransactions(0, -1, "TxID", "tx100")
+	if len(trxs) != 1 || trxs[0].Confirm != 2 {
+		t.Fatalf("tx100 confirm = %+v, want 2", trxs)
+	}
+
+	//其他币种的区块不影响
+	wm.BlockScanNotify(&openwallet.BlockHeader{Height: 200, Symbol: "ETH"})
+	if len(observer.confirmed) != 0 {
+		t.Fatalf("confirmed = %d, want 0", len(observer.confirmed))
+	}
+
+	//高度102时，tx100达到3个确认
+	wm.BlockScanNotify(&openwallet.BlockHeader{Height: 102, Symbol: "BTC"})
+	if len(observer.confirmed) != 1 || observer.confirmed[0].TxID != "tx100" || observer.confirmed[0].Confirm != 3 {
+		t.Fatalf("confirmed = %+v, want tx100", observer.confirmed)
+	}
+	outputs, _ := wrapper.GetTxOutputs(0, -1, "TxID", "tx100")
+	if len(outputs) != 1 || outputs[0].Confirm != 3 {
+		t.Fatalf("tx100 output confirm = %+v, want 3", outputs)
+	}
+
+	//已达到确认数的交易不重复通知
+	wm.BlockScanNotify(&openwallet.BlockHeader{Height: 103, Symbol: "BTC"})
+	if len(observer.confirmed) != 2 || observer.confirmed[1].TxID != "tx101" {
+		t.Fatalf("confirmed = %+v, want tx100, tx101", observer.confirmed)
+	}
+}
+
+func TestWalletManager_BlockExtractMemPoolDataNotify(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	wrapper, err := wm.NewWalletWrapper(testApp, "")
+	if err != nil {
+		t.Fatalf("NewWalletWrapper err: %v", err)
+	}
+	account := &openwallet.AssetsAccount{AccountID: "account1", Symbol: "BTC"}
+	wrapper.SaveAssetsAccount(account)
+	db, err := wrapper.OpenStormDB()
+	if err != nil {
+		t.Fatalf("OpenStormDB err: %v", err)
+	}
+	db.Save(&openwallet.Address{AccountID: account.AccountID, Address: "addr1"})
+
+	observer := &testConfirmObserver{}
+	wm.AddObserver(observer)
+
+	newData := func(height uint64) *openwallet.TxExtractData {
+		coin := openwallet.Coin{Symbol: "BTC"}
+		output := &openwallet.TxOutPut{}
+		output.Sid = openwallet.GenTxOutPutSID("tx1", "BTC", "", 0)
+		output.TxID = "tx1"
+		output.Address = "addr1"
+		output.Amount = "1.5"
+		output.Coin = coin
+		output.BlockHeight = height
+		data := &openwallet.TxExtractData{
+			TxOutputs: []*openwallet.TxOutPut{output},
+			Transaction: &openwallet.Transaction{
+				TxID:        "tx1",
+				Coin:        coin,
+				BlockHeight: height,
+				Decimal:     8,
+			},
+			MemPool: height == 0,
+		}
+		data.Transaction.WxID = openwallet.GenTransactionWxID(data.Transaction)
+		return data
+	}
+
+	sourceKey := wm.encodeSourceKey(testApp, account.AccountID)
+
+	//内存池发现未确认交易
+	if err = wm.BlockExtractMemPoolDataNotify(sourceKey, newData(0)); err != nil {
+		t.Fatalf("BlockExtractMemPoolDataNotify err: %v", err)
+	}
+	if len(observer.mempool) != 1 || !observer.mempool[0].MemPool {
+		t.Fatalf("mempool notify = %+v, want 1", observer.mempool)
+	}
+	list, err := wm.GetMemPoolTransactions(testApp, account.AccountID)
+	if err != nil {
+		t.Fatalf("GetMemPoolTransactions err: %v", err)
+	}
+	if len(list) != 1 || list[0].Data.Transaction.Amount != "1.50000000" {
+		t.Fatalf("mempool transactions = %+v, want tx1 with amount 1.5", list)
+	}
+
+	//交易上链后，删除内存池记录
+	if err = wm.BlockExtractDataNotify(sourceKey, newData(100)); err != nil {
+		t.Fatalf("BlockExtractDataNotify err: %v", err)
+	}
+	list, _ = wm.GetMemPoolTransactions(testApp, account.AccountID)
+	if len(list) != 0 {
+		t.Fatalf("mempool transactions = %d, want 0 after confirmed", len(list))
+	}
+
+	//已上链的交易，不再记录为内存池交易
+	wm.BlockExtractMemPoolDataNotify(sourceKey, newData(0))
+	list, _ = wm.GetMemPoolTransactions(testApp, account.AccountID)
+	if len(list) != 0 || len(observer.mempool) != 1 {
+		t.Fatalf("mined transaction should not be recorded as mempool transaction")
+	}
+
+	//被丢弃或替换的交易过期后不再返回，并被清理
+	dropped := &MemPoolTransaction{
+		WxID:      "dropped",
+		AccountID: account.AccountID,
+		Data:      newData(0),
+		CreateAt:  time.Now().Add(-MemPoolTransactionExpireTime).Unix() - 1,
+	}
+	db.Save(dropped)
+	list, _ = wm.GetMemPoolTransactions(testApp, account.AccountID)
+	if len(list) != 0 {
+		t.Fatalf("expired mempool transactions = %d, want 0", len(list))
+	}
+	if deleted, err := wm.DeleteExpiredMemPoolTransactions(testApp); err != nil || deleted != 1 {
+		t.Fatalf("DeleteExpiredMemPoolTransactions = %d, err: %v", deleted, err)
+	}
+}
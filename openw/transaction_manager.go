@@ -16,7 +16,6 @@
 package openw
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/blocktree/openwallet/v2/log"
@@ -28,17 +27,17 @@ func (wm *WalletManager) CreateErc20TokenTransaction(appID, walletID, accountID,
 	contractAddr, tokenName, tokenSymbol string, tokenDecimal uint64) (*openwallet.RawTransaction, error) {
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	rawTx := openwallet.RawTransaction{
@@ -63,11 +62,11 @@ func (wm *WalletManager) CreateErc20TokenTransaction(appID, walletID, accountID,
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 	err = txdecoder.CreateRawTransaction(wrapper, &rawTx)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("transaction has been created successfully")
@@ -79,17 +78,17 @@ func (wm *WalletManager) CreateQrc20TokenTransaction(appID, walletID, accountID,
 	contractAddr, tokenName, tokenSymbol string, tokenDecimal uint64) (*openwallet.RawTransaction, error) {
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	rawTx := openwallet.RawTransaction{
@@ -115,11 +114,11 @@ func (wm *WalletManager) CreateQrc20TokenTransaction(appID, walletID, accountID,
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 	err = txdecoder.CreateRawTransaction(wrapper, &rawTx)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("Qrc20Token transaction has been created successfully")
@@ -136,17 +135,17 @@ func (wm *WalletManager) CreateTransaction(appID, walletID, accountID, amount, a
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	//fmt.Println("contract:", contract)
 	if contract != nil {
@@ -172,18 +171,23 @@ func (wm *WalletManager) CreateTransaction(appID, walletID, accountID, amount, a
 		Required: 1,
 	}
 
+	//多签账户需要足够的拥有者签名
+	if account.IsMultiSig() && account.Required > 1 {
+		rawTx.Required = account.Required
+	}
+
 	if len(memo) > 0 {
 		rawTx.SetExtParam("memo", memo)
 	}
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 
 	err = txdecoder.CreateRawTransaction(wrapper, &rawTx)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("transaction has been created successfully")
@@ -196,34 +200,80 @@ func (wm *WalletManager) SignTransaction(appID, walletID, accountID, password st
 
 	account, err := wm.GetAssetsAccountInfo(appID, "", accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	wrapper, err := wm.NewWalletWrapper(appID, account.WalletID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 
-	//解锁钱包
-	err = wrapper.UnlockWallet(password, 5*time.Second)
-	if err != nil {
-		return nil, err
+	//观察钱包没有私钥，需要导出交易包离线签名
+	if w := wrapper.GetWallet(); w != nil && w.WatchOnly {
+		return nil, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, "wallet: %s is watch-only, can not sign transaction", w.WalletID)
 	}
 
-	err = txdecoder.SignRawTransaction(wrapper, rawTx)
+	//多签交易单，签名账户必须是交易账户的拥有者
+	msAccount, err := loadMultiSigAccount(wrapper, account, rawTx)
 	if err != nil {
 		return nil, err
 	}
+	multiSig := msAccount != nil
+	if multiSig && msAccount.GetOwnerKey(account.AccountID) == nil {
+		return nil, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed,
+			"signer: %s is not the owner of account: %s", account.AccountID, rawTx.Account.AccountID)
+	}
+
+	wm.mu.RLock()
+	signerFactory := wm.signerFactory
+	wm.mu.RUnlock()
+
+	if signerFactory != nil {
+		//签名器按HDPath签名待签消息，私钥不经过资产适配器
+		w := wrapper.GetWallet()
+		if w == nil {
+			return nil, openwallet.Errorf(openwallet.ErrWalletNotFound, "wallet: %s is not found", account.WalletID)
+		}
+		signer, err := signerFactory(w, password)
+		if err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+		err = openwallet.SignKeySignatures(signer, rawTx.Signatures)
+		if err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+	} else {
+		//解锁钱包
+		err = wrapper.UnlockWallet(password, 5*time.Second)
+		if err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+
+		err = txdecoder.SignRawTransaction(wrapper, rawTx)
+		if err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+	}
+
+	if multiSig {
+		//验证本拥有者的签名，并按有效签名数更新IsCompleted
+		owner := msAccount.GetOwnerKey(account.AccountID)
+		err = owner.VerifyKeySignatures(rawTx.Signatures[account.AccountID])
+		if err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+		rawTx.CheckSignatures()
+	}
 
 	log.Debug("transaction has been signed successfully")
 
@@ -235,27 +285,27 @@ func (wm *WalletManager) VerifyTransaction(appID, walletID, accountID string, ra
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 
 	err = txdecoder.VerifyRawTransaction(wrapper, rawTx)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("transaction has been validated successfully")
@@ -268,28 +318,40 @@ func (wm *WalletManager) SubmitTransaction(appID, walletID, accountID string, ra
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 
-	tx, err := txdecoder.SubmitRawTransaction(wrapper, rawTx)
+	//多签交易单，有效签名数达到要求才能广播
+	msAccount, err := loadMultiSigAccount(wrapper, account, rawTx)
 	if err != nil {
 		return nil, err
 	}
+	if msAccount != nil {
+		err = rawTx.CheckSignatures()
+		if err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+	}
+
+	tx, err := txdecoder.SubmitRawTransaction(wrapper, rawTx)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
 
 	log.Debug("transaction has been submitted successfully")
 
@@ -310,6 +372,95 @@ func (wm *WalletManager) SubmitTransaction(appID, walletID, accountID string, ra
 	//return perfectTx, nil
 }
 
+//MergeTransactionSignatures 合并多签交易单各拥有者的签名，返回合并后的交易单。
+//signedTxs为其他拥有者签名后导出的同一交易单，所有签名逐个拥有者验证。
+//交易账户的拥有者和必要签名数以应用数据库保存的为准。
+func (wm *WalletManager) MergeTransactionSignatures(appID string, rawTx *openwallet.RawTransaction, signedTxs ...*openwallet.RawTransaction) (*openwallet.RawTransaction, error) {
+
+	if rawTx == nil || rawTx.Account == nil {
+		return nil, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, "transaction account is nil")
+	}
+
+	wrapper, err := wm.NewWalletWrapper(appID, "")
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	msAccount, err := loadMultiSigAccount(wrapper, nil, rawTx)
+	if err != nil {
+		return nil, err
+	}
+	if msAccount == nil {
+		return nil, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, "account: %s is not multisig account", rawTx.Account.AccountID)
+	}
+
+	for _, signedTx := range signedTxs {
+		err = rawTx.MergeSignatures(signedTx)
+		if err != nil {
+			return nil, openwallet.ConvertError(err)
+		}
+	}
+
+	//按数据库的必要签名数重新检查签名状态
+	rawTx.CheckSignatures()
+
+	log.Debugf("transaction signed owners: %v, missing signers: %v", rawTx.SignedOwners(), rawTx.MissingSigners())
+
+	return rawTx, nil
+}
+
+//loadMultiSigAccount 从数据库加载交易单的多签账户，非多签账户返回nil。
+//多签状态、拥有者和必要签名数以数据库保存的为准，并覆盖交易单中调用方提供的值。
+//交易单由其他钱包创建时，本地签名账户须与交易账户为同一多签组（拥有者和必要签名数相同）
+func loadMultiSigAccount(wrapper *WalletWrapper, signer *openwallet.AssetsAccount, rawTx *openwallet.RawTransaction) (*openwallet.AssetsAccount, error) {
+
+	if rawTx.Account == nil {
+		if signer != nil && signer.IsMultiSig() {
+			return nil, openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, "transaction account is nil")
+		}
+		return nil, nil
+	}
+
+	account, err := wrapper.GetAssetsAccountInfo(rawTx.Account.AccountID)
+	if err != nil {
+		switch {
+		case signer != nil && signer.IsMultiSig() && isSameMultiSigGroup(signer, rawTx.Account):
+			account = signer
+		case rawTx.Account.IsMultiSig() || (signer != nil && signer.IsMultiSig()):
+			return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "multisig account: %s is not found", rawTx.Account.AccountID)
+		default:
+			return nil, nil
+		}
+	}
+
+	if !account.IsMultiSig() {
+		return nil, nil
+	}
+
+	rawTx.Account.OwnerKeys = account.OwnerKeys
+	rawTx.Account.Required = account.Required
+	rawTx.Required = account.Required
+
+	return account, nil
+}
+
+//isSameMultiSigGroup 两个多签账户的拥有者和必要签名数是否相同
+func isSameMultiSigGroup(a, b *openwallet.AssetsAccount) bool {
+	if a.Required != b.Required || len(a.OwnerKeys) != len(b.OwnerKeys) {
+		return false
+	}
+	keys := make(map[string]bool)
+	for _, k := range a.OwnerKeys {
+		keys[k] = true
+	}
+	for _, k := range b.OwnerKeys {
+		if !keys[k] {
+			return false
+		}
+	}
+	return true
+}
+
 //GetAssetsAccountBalance 获取账户余额
 func (wm *WalletManager) GetAssetsAccountBalance(appID, walletID, accountID string) (*openwallet.Balance, error) {
 
@@ -320,23 +471,23 @@ func (wm *WalletManager) GetAssetsAccountBalance(appID, walletID, accountID stri
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	//提取交易单
 	scanner := assetsMgr.GetBlockScanner()
 	if scanner == nil {
-		return nil, fmt.Errorf("[%s] not support block scan", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] not support block scan", account.Symbol)
 	}
 
 	accountBalanceDec := decimal.New(0, 0)
@@ -354,15 +505,15 @@ func (wm *WalletManager) GetAssetsAccountBalance(appID, walletID, accountID stri
 			addressMap[address.Address] = address
 		}
 
-		balances, err = scanner.GetBalanceByAddress(searchAddrs...)
+		balances, err = wm.getBalanceByAddress(account.Symbol, scanner, searchAddrs...)
 		if err != nil {
-			return nil, err
+			return nil, openwallet.ConvertError(err)
 		}
 
 	} else if assetsMgr.BalanceModelType() == openwallet.BalanceModelTypeAccount { //账户模型
-		balances, err = scanner.GetBalanceByAddress(account.Alias)
+		balances, err = wm.getBalanceByAddress(account.Symbol, scanner, account.Alias)
 		if err != nil {
-			return nil, err
+			return nil, openwallet.ConvertError(err)
 		}
 
 	}
@@ -393,23 +544,23 @@ func (wm *WalletManager) GetAssetsAccountTokenBalance(appID, walletID, accountID
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	//提取交易单
 	smartContractDecoder := assetsMgr.GetSmartContractDecoder()
 	if smartContractDecoder == nil {
-		return nil, fmt.Errorf("[%s] not support smart contract", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] not support smart contract", account.Symbol)
 	}
 
 	accountBalanceDec := decimal.New(0, 0)
@@ -429,12 +580,12 @@ func (wm *WalletManager) GetAssetsAccountTokenBalance(appID, walletID, accountID
 
 		balances, err = smartContractDecoder.GetTokenBalanceByAddress(contract, searchAddrs...)
 		if err != nil {
-			return nil, err
+			return nil, openwallet.ConvertError(err)
 		}
 	} else if assetsMgr.BalanceModelType() == openwallet.BalanceModelTypeAccount {
 		balances, err = smartContractDecoder.GetTokenBalanceByAddress(contract, account.Alias)
 		if err != nil {
-			return nil, err
+			return nil, openwallet.ConvertError(err)
 		}
 	}
 
@@ -464,13 +615,13 @@ func (wm *WalletManager) GetTransactions(appID string, offset, limit int, cols .
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	txWrapper := NewTransactionWrapper(wrapper)
 	trx, err := txWrapper.GetTransactions(offset, limit, cols...)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return trx, nil
@@ -481,7 +632,7 @@ func (wm *WalletManager) GetTransactionByWxID(appID, wxID string) (*openwallet.T
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	txWrapper := NewTransactionWrapper(wrapper)
@@ -493,18 +644,42 @@ func (wm *WalletManager) GetTransactionByWxID(appID, wxID string) (*openwallet.T
 	return trx[0], nil
 }
 
+//GetMemPoolTransactions 获取资产账户在内存池中未确认的交易记录，accountID为空获取应用全部记录
+func (wm *WalletManager) GetMemPoolTransactions(appID, accountID string) ([]*MemPoolTransaction, error) {
+
+	wrapper, err := wm.NewWalletWrapper(appID, "")
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	txWrapper := NewTransactionWrapper(wrapper)
+	return txWrapper.GetMemPoolTransactions(accountID)
+}
+
+//DeleteExpiredMemPoolTransactions 删除应用中过期的内存池交易记录，返回删除的数量
+func (wm *WalletManager) DeleteExpiredMemPoolTransactions(appID string) (int, error) {
+
+	wrapper, err := wm.NewWalletWrapper(appID, "")
+	if err != nil {
+		return 0, openwallet.ConvertError(err)
+	}
+
+	txWrapper := NewTransactionWrapper(wrapper)
+	return txWrapper.DeleteExpiredMemPoolTransactions()
+}
+
 //GetTxUnspent
 func (wm *WalletManager) GetTxUnspent(appID string, offset, limit int, cols ...interface{}) ([]*openwallet.TxOutPut, error) {
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	txWrapper := NewTransactionWrapper(wrapper)
 	trx, err := txWrapper.GetTxOutputs(offset, limit, cols...)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return trx, nil
@@ -515,13 +690,13 @@ func (wm *WalletManager) GetTxSpent(appID string, offset, limit int, cols ...int
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	txWrapper := NewTransactionWrapper(wrapper)
 	trx, err := txWrapper.GetTxInputs(offset, limit, cols...)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return trx, nil
@@ -532,15 +707,15 @@ func (wm *WalletManager) GetEstimateFeeRate(coin openwallet.Coin) (feeRate strin
 
 	assetsMgr, err := GetAssetsAdapter(coin.Symbol)
 	if err != nil {
-		return "", "", err
+		return "", "", openwallet.ConvertError(err)
 	}
 
 	txDecoder := assetsMgr.GetTransactionDecoder()
 	if txDecoder == nil {
-		return "", "", fmt.Errorf("[%s] is not support transaction. ", coin.Symbol)
+		return "", "", openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", coin.Symbol)
 	}
 
-	return txDecoder.GetRawTransactionFeeRate()
+	return wm.getRawTransactionFeeRate(coin.Symbol, txDecoder)
 
 }
 
@@ -556,17 +731,17 @@ func (wm *WalletManager) CreateSummaryTransaction(
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	if contract != nil {
@@ -597,12 +772,12 @@ func (wm *WalletManager) CreateSummaryTransaction(
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 
 	rawTxArray, err := txdecoder.CreateSummaryRawTransaction(wrapper, &sumTx)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("transaction has been created successfully")
@@ -624,17 +799,17 @@ func (wm *WalletManager) CreateSummaryRawTransactionWithError(
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	assetsMgr, err := GetAssetsAdapter(account.Symbol)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	if contract != nil {
@@ -666,12 +841,12 @@ func (wm *WalletManager) CreateSummaryRawTransactionWithError(
 
 	txdecoder := assetsMgr.GetTransactionDecoder()
 	if txdecoder == nil {
-		return nil, fmt.Errorf("[%s] is not support transaction. ", account.Symbol)
+		return nil, openwallet.Errorf(openwallet.ErrAssetsNotSupport, "[%s] is not support transaction. ", account.Symbol)
 	}
 
 	rawTxArray, err := txdecoder.CreateSummaryRawTransactionWithError(wrapper, &sumTx)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("transaction has been created successfully")
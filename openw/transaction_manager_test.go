@@ -16,10 +16,14 @@
 package openw
 
 import (
+	"encoding/hex"
 	"github.com/astaxie/beego/config"
 	"path/filepath"
 	"testing"
 
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/crypto"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 )
@@ -401,3 +405,81 @@ func TestGetAddressBalance(t *testing.T) {
 		log.Infof("ConfirmBalance[%s] = %s", b.Address, b.ConfirmBalance)
 	}
 }
+
+func TestWalletManager_MergeTransactionSignatures(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	accountPath := "m/44'/88'/1'"
+	newOwner := func(seed string) (*hdkeystore.HDKey, string, string) {
+		key, _ := hdkeystore.NewHDKey(crypto.SHA256([]byte(seed)), seed, "m/44'/88'")
+		accountKey, _ := key.DerivedKeyWithPath(accountPath, owcrypt.ECC_CURVE_SECP256K1)
+		pub := accountKey.GetPublicKey().OWEncode()
+		return key, pub, openwallet.GenAccountID(pub)
+	}
+	keyA, pubA, idA := newOwner("owner a")
+	keyB, pubB, idB := newOwner("owner b")
+
+	//数据库保存的多签账户，2-of-2
+	wrapper, err := wm.NewWalletWrapper(testApp, "")
+	if err != nil {
+		t.Fatalf("NewWalletWrapper err: %v", err)
+	}
+	stored := &openwallet.AssetsAccount{AccountID: idA, PublicKey: pubA, OwnerKeys: []string{pubA, pubB}, Required: 2, Symbol: "BTC"}
+	if err = wrapper.SaveAssetsAccount(stored); err != nil {
+		t.Fatalf("SaveAssetsAccount err: %v", err)
+	}
+
+	msg := hex.EncodeToString(crypto.SHA256([]byte("input0")))
+	newKeySignature := func() []*openwallet.KeySignature {
+		return []*openwallet.KeySignature{{
+			EccType: owcrypt.ECC_CURVE_SECP256K1,
+			Message: msg,
+			Address: &openwallet.Address{Address: "multisig", HDPath: accountPath + "/0/1", Index: 1},
+		}}
+	}
+	sign := func(key *hdkeystore.HDKey, rawTx *openwallet.RawTransaction) *openwallet.RawTransaction {
+		pkg, _ := openwallet.ExportRawTransaction(rawTx)
+		signedPkg, err := wm.SignTransactionPackage(key, pkg)
+		if err != nil {
+			t.Fatalf("SignTransactionPackage err: %v", err)
+		}
+		signedTx, _ := openwallet.ImportRawTransaction(signedPkg)
+		return signedTx
+	}
+
+	//调用方提供的交易账户声称只需要1个签名
+	rawTx := &openwallet.RawTransaction{
+		Coin:       openwallet.Coin{Symbol: "BTC"},
+		RawHex:     "0100000001abcdef",
+		Account:    &openwallet.AssetsAccount{AccountID: idA, PublicKey: pubA, OwnerKeys: []string{pubA, pubB}, Required: 1},
+		Required:   1,
+		Signatures: map[string][]*openwallet.KeySignature{idA: newKeySignature(), idB: newKeySignature()},
+	}
+	rawTx = sign(keyA, rawTx)
+
+	merged, err := wm.MergeTransactionSignatures(testApp, rawTx)
+	if err != nil {
+		t.Fatalf("MergeTransactionSignatures err: %v", err)
+	}
+	if merged.IsCompleted || merged.Required != 2 {
+		t.Fatalf("transaction should require 2 signatures of stored account, required: %d", merged.Required)
+	}
+
+	merged, err = wm.MergeTransactionSignatures(testApp, rawTx, sign(keyB, rawTx))
+	if err != nil {
+		t.Fatalf("MergeTransactionSignatures err: %v", err)
+	}
+	if !merged.IsCompleted {
+		t.Fatalf("transaction should be completed, missing signers: %v", merged.MissingSigners())
+	}
+
+	//数据库没有的多签账户
+	unknown := &openwallet.RawTransaction{
+		RawHex:  "0100000001abcdef",
+		Account: &openwallet.AssetsAccount{AccountID: idB, PublicKey: pubB, OwnerKeys: []string{pubB, pubA}, Required: 2},
+	}
+	if _, err = wm.MergeTransactionSignatures(testApp, unknown); err == nil {
+		t.Fatalf("merge transaction of unknown multisig account should return error")
+	}
+}
@@ -16,13 +16,39 @@
 package openw
 
 import (
-	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm"
 	"github.com/asdine/storm/q"
 	"github.com/blocktree/openwallet/v2/common"
 	"github.com/blocktree/openwallet/v2/openwallet"
 	"github.com/shopspring/decimal"
 )
 
+//MemPoolTransactionExpireTime 内存池交易记录的有效期，期间未上链也未再被扫描到的交易，
+//视为已被丢弃或替换（如RBF），不再返回并会被清理
+var MemPoolTransactionExpireTime = 72 * time.Hour
+
+// MemPoolTransaction 内存池中未确认的交易记录，交易上链或过期后删除
+type MemPoolTransaction struct {
+	WxID      string                    `json:"wxid" storm:"id"`         //与上链后的Transaction.WxID一致
+	AccountID string                    `json:"accountID" storm:"index"` //资产账户ID
+	Symbol    string                    `json:"symbol"`                  //币种标识
+	Data      *openwallet.TxExtractData `json:"data"`                    //提取结果
+	CreateAt  int64                     `json:"createdAt"`               //发现时间
+	ExpireAt  int64                     `json:"expireAt"`                //过期时间，再次扫描到时延长
+}
+
+//IsExpired 是否已过期，没有过期时间的旧记录按发现时间计算
+func (memTx *MemPoolTransaction) IsExpired(now time.Time) bool {
+	expireAt := memTx.ExpireAt
+	if expireAt == 0 {
+		expireAt = memTx.CreateAt + int64(MemPoolTransactionExpireTime/time.Second)
+	}
+	return expireAt <= now.Unix()
+}
+
 // TransactionWrapper 交易包装器，扩展钱包交易单相关功能
 type TransactionWrapper struct {
 	*WalletWrapper
@@ -50,7 +76,7 @@ func (wrapper *WalletWrapper) GetTxInputs(offset, limit int, cols ...interface{}
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -59,7 +85,7 @@ func (wrapper *WalletWrapper) GetTxInputs(offset, limit int, cols ...interface{}
 	query := make([]q.Matcher, 0)
 
 	if len(cols)%2 != 0 {
-		return nil, fmt.Errorf("condition param is not pair")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "condition param is not pair")
 	}
 
 	for i := 0; i < len(cols); i = i + 2 {
@@ -83,7 +109,7 @@ func (wrapper *WalletWrapper) GetTxInputs(offset, limit int, cols ...interface{}
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find txInputs")
+		return nil, openwallet.Errorf(openwallet.ErrSystemException, "can not find txInputs")
 	}
 
 	return txs, nil
@@ -95,7 +121,7 @@ func (wrapper *WalletWrapper) GetTxOutputs(offset, limit int, cols ...interface{
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -104,7 +130,7 @@ func (wrapper *WalletWrapper) GetTxOutputs(offset, limit int, cols ...interface{
 	query := make([]q.Matcher, 0)
 
 	if len(cols)%2 != 0 {
-		return nil, fmt.Errorf("condition param is not pair")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "condition param is not pair")
 	}
 
 	for i := 0; i < len(cols); i = i + 2 {
@@ -128,7 +154,7 @@ func (wrapper *WalletWrapper) GetTxOutputs(offset, limit int, cols ...interface{
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find txoutputs")
+		return nil, openwallet.Errorf(openwallet.ErrSystemException, "can not find txoutputs")
 	}
 
 	return txs, nil
@@ -140,7 +166,7 @@ func (wrapper *WalletWrapper) GetTransactions(offset, limit int, cols ...interfa
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -149,7 +175,7 @@ func (wrapper *WalletWrapper) GetTransactions(offset, limit int, cols ...interfa
 	query := make([]q.Matcher, 0)
 
 	if len(cols)%2 != 0 {
-		return nil, fmt.Errorf("condition param is not pair")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "condition param is not pair")
 	}
 
 	for i := 0; i < len(cols); i = i + 2 {
@@ -173,7 +199,7 @@ func (wrapper *WalletWrapper) GetTransactions(offset, limit int, cols ...interfa
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find transactions")
+		return nil, openwallet.Errorf(openwallet.ErrSystemException, "can not find transactions")
 	}
 
 	return txs, nil
@@ -190,13 +216,13 @@ func (wrapper *TransactionWrapper) SaveBlockExtractData(accountID string, data *
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	tx, err := db.Begin(true)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	defer tx.Rollback()
@@ -210,7 +236,7 @@ func (wrapper *TransactionWrapper) SaveBlockExtractData(accountID string, data *
 		input.AccountID = a.AccountID
 		err = tx.Save(input)
 		if err != nil {
-			return fmt.Errorf("wallet save TxInputs failed, unexpected error: %v", err)
+			return openwallet.Errorf(openwallet.ErrSystemException, "wallet save TxInputs failed, unexpected error: %v", err)
 		}
 
 		//统计该交易单下的各个资产账户的支出总数
@@ -229,7 +255,7 @@ func (wrapper *TransactionWrapper) SaveBlockExtractData(accountID string, data *
 		output.AccountID = a.AccountID
 		err = tx.Save(output)
 		if err != nil {
-			return fmt.Errorf("wallet save TxOutputs failed, unexpected error: %v", err)
+			return openwallet.Errorf(openwallet.ErrSystemException, "wallet save TxOutputs failed, unexpected error: %v", err)
 		}
 
 		//统计该交易单下的各个资产账户的收入总数
@@ -247,12 +273,12 @@ func (wrapper *TransactionWrapper) SaveBlockExtractData(accountID string, data *
 	//保存账户相关的记录
 	err = tx.Save(trx)
 	if err != nil {
-		return fmt.Errorf("wallet save Transactions failed, unexpected error: %v", err)
+		return openwallet.Errorf(openwallet.ErrSystemException, "wallet save Transactions failed, unexpected error: %v", err)
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("wallet save TxExtractData failed, unexpected error: %v", err)
+		return openwallet.Errorf(openwallet.ErrSystemException, "wallet save TxExtractData failed, unexpected error: %v", err)
 	}
 
 	return nil
@@ -264,52 +290,322 @@ func (wrapper *TransactionWrapper) DeleteBlockDataByHeight(height uint64) error
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	tx, err := db.Begin(true)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	defer tx.Rollback()
 
 	trxs, err := wrapper.GetTransactions(0, -1, "BlockHeight", height)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	for _, obj := range trxs {
 		err = db.DeleteStruct(&obj)
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 	}
 
 	inputs, err := wrapper.GetTxInputs(0, -1, "BlockHeight", height)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	for _, obj := range inputs {
 		err = db.DeleteStruct(&obj)
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 	}
 
 	outputs, err := wrapper.GetTxOutputs(0, -1, "BlockHeight", height)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	for _, obj := range outputs {
 		err = db.DeleteStruct(&obj)
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 	}
 
 	return tx.Commit()
 }
+
+//calcConfirmations 计算交易所在区块相对最新区块的确认数，未上链或高度超前返回false
+func calcConfirmations(blockHeight, newHeight uint64) (int64, bool) {
+	if blockHeight == 0 || blockHeight > newHeight {
+		return 0, false
+	}
+	return int64(newHeight - blockHeight + 1), true
+}
+
+//UpdateConfirmations 根据最新区块高度，更新未达到确认数阈值的交易记录确认数
+//@return 本次更新后达到确认数阈值的交易记录
+func (wrapper *TransactionWrapper) UpdateConfirmations(symbol string, newHeight, threshold uint64) ([]*openwallet.Transaction, error) {
+
+	//打开数据库
+	db, err := wrapper.OpenStormDB()
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	defer wrapper.CloseDB()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+
+	defer tx.Rollback()
+
+	var (
+		trxs      []*openwallet.Transaction
+		inputs    []*openwallet.TxInput
+		outputs   []*openwallet.TxOutPut
+		confirmed = make([]*openwallet.Transaction, 0)
+	)
+
+	//更新出账记录
+	err = tx.Select(q.Lt("Confirm", int64(threshold))).Find(&inputs)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	for _, input := range inputs {
+		if !strings.EqualFold(input.Coin.Symbol, symbol) {
+			continue
+		}
+		confirm, ok := calcConfirmations(input.BlockHeight, newHeight)
+		if !ok || confirm == input.Confirm {
+			continue
+		}
+		input.Confirm = confirm
+		err = tx.Save(input)
+		if err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrSystemException, "wallet update TxInputs confirm failed, unexpected error: %v", err)
+		}
+	}
+
+	//更新入账记录
+	err = tx.Select(q.Lt("Confirm", int64(threshold))).Find(&outputs)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	for _, output := range outputs {
+		if !strings.EqualFold(output.Coin.Symbol, symbol) {
+			continue
+		}
+		confirm, ok := calcConfirmations(output.BlockHeight, newHeight)
+		if !ok || confirm == output.Confirm {
+			continue
+		}
+		output.Confirm = confirm
+		err = tx.Save(output)
+		if err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrSystemException, "wallet update TxOutputs confirm failed, unexpected error: %v", err)
+		}
+	}
+
+	//更新交易记录，并收集达到确认数的交易
+	err = tx.Select(q.Lt("Confirm", int64(threshold))).Find(&trxs)
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	for _, trx := range trxs {
+		if !strings.EqualFold(trx.Coin.Symbol, symbol) {
+			continue
+		}
+		confirm, ok := calcConfirmations(trx.BlockHeight, newHeight)
+		if !ok || confirm == trx.Confirm {
+			continue
+		}
+		trx.Confirm = confirm
+		err = tx.Save(trx)
+		if err != nil {
+			return nil, openwallet.Errorf(openwallet.ErrSystemException, "wallet update Transactions confirm failed, unexpected error: %v", err)
+		}
+		if confirm >= int64(threshold) {
+			confirmed = append(confirmed, trx)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrSystemException, "wallet update confirmations failed, unexpected error: %v", err)
+	}
+
+	return confirmed, nil
+}
+
+//SaveMemPoolExtractData 保存内存池中未确认交易的提取数据
+func (wrapper *TransactionWrapper) SaveMemPoolExtractData(accountID string, data *openwallet.TxExtractData) (*MemPoolTransaction, error) {
+
+	var (
+		accountSpent    = decimal.Zero
+		accountReceived = decimal.Zero
+	)
+
+	if data == nil || data.Transaction == nil {
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "mempool extract data has no transaction")
+	}
+
+	//统计该交易单下资产账户的收支
+	for _, input := range data.TxInputs {
+		a, err := wrapper.GetAddress(input.Address)
+		if err != nil {
+			continue
+		}
+		input.AccountID = a.AccountID
+		if a.AccountID == accountID {
+			amount, _ := decimal.NewFromString(input.Amount)
+			accountSpent = accountSpent.Add(amount)
+		}
+	}
+
+	for _, output := range data.TxOutputs {
+		a, err := wrapper.GetAddress(output.Address)
+		if err != nil {
+			continue
+		}
+		output.AccountID = a.AccountID
+		if a.AccountID == accountID {
+			amount, _ := decimal.NewFromString(output.Amount)
+			accountReceived = accountReceived.Add(amount)
+		}
+	}
+
+	trx := data.Transaction
+	trx.AccountID = accountID
+	trx.Confirm = 0
+	trx.Amount = accountReceived.Sub(accountSpent).StringFixed(trx.Decimal)
+	if len(trx.WxID) == 0 {
+		trx.WxID = openwallet.GenTransactionWxID(trx)
+	}
+
+	//打开数据库
+	db, err := wrapper.OpenStormDB()
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	defer wrapper.CloseDB()
+
+	now := time.Now()
+	memTx := &MemPoolTransaction{
+		WxID:      trx.WxID,
+		AccountID: accountID,
+		Symbol:    trx.Coin.Symbol,
+		Data:      data,
+		CreateAt:  now.Unix(),
+		ExpireAt:  now.Add(MemPoolTransactionExpireTime).Unix(),
+	}
+
+	err = db.Save(memTx)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrSystemException, "wallet save MemPoolTransaction failed, unexpected error: %v", err)
+	}
+
+	return memTx, nil
+}
+
+//DeleteMemPoolTransaction 删除内存池交易记录，交易上链后调用
+func (wrapper *TransactionWrapper) DeleteMemPoolTransaction(wxID string) error {
+
+	//打开数据库
+	db, err := wrapper.OpenStormDB()
+	if err != nil {
+		return openwallet.ConvertError(err)
+	}
+	defer wrapper.CloseDB()
+
+	var memTx MemPoolTransaction
+	err = db.One("WxID", wxID, &memTx)
+	if err == storm.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return openwallet.ConvertError(err)
+	}
+
+	return db.DeleteStruct(&memTx)
+}
+
+//GetMemPoolTransactions 获取资产账户在内存池中未确认的交易记录，accountID为空获取全部
+func (wrapper *TransactionWrapper) GetMemPoolTransactions(accountID string) ([]*MemPoolTransaction, error) {
+
+	//打开数据库
+	db, err := wrapper.OpenStormDB()
+	if err != nil {
+		return nil, openwallet.ConvertError(err)
+	}
+	defer wrapper.CloseDB()
+
+	var list []*MemPoolTransaction
+	if len(accountID) > 0 {
+		err = db.Find("AccountID", accountID, &list)
+	} else {
+		err = db.All(&list)
+	}
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	//过期的交易已被丢弃或替换，不返回
+	now := time.Now()
+	unexpired := make([]*MemPoolTransaction, 0, len(list))
+	for _, memTx := range list {
+		if !memTx.IsExpired(now) {
+			unexpired = append(unexpired, memTx)
+		}
+	}
+
+	return unexpired, nil
+}
+
+//DeleteExpiredMemPoolTransactions 删除过期的内存池交易记录，返回删除的数量
+func (wrapper *TransactionWrapper) DeleteExpiredMemPoolTransactions() (int, error) {
+
+	//打开数据库
+	db, err := wrapper.OpenStormDB()
+	if err != nil {
+		return 0, openwallet.ConvertError(err)
+	}
+	defer wrapper.CloseDB()
+
+	var list []*MemPoolTransaction
+	err = db.All(&list)
+	if err != nil && err != storm.ErrNotFound {
+		return 0, openwallet.ConvertError(err)
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return 0, openwallet.ConvertError(err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	deleted := 0
+	for _, memTx := range list {
+		if !memTx.IsExpired(now) {
+			continue
+		}
+		err = tx.DeleteStruct(memTx)
+		if err != nil {
+			return 0, openwallet.Errorf(openwallet.ErrSystemException, "wallet delete MemPoolTransaction failed, unexpected error: %v", err)
+		}
+		deleted++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, openwallet.Errorf(openwallet.ErrSystemException, "wallet delete MemPoolTransaction failed, unexpected error: %v", err)
+	}
+
+	return deleted, nil
+}
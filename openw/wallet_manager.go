@@ -16,14 +16,20 @@
 package openw
 
 import (
-	"fmt"
 	"github.com/blocktree/openwallet/v2/hdkeystore"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/blocktree/openwallet/v2/openwallet"
 )
 
-// CreateWallet 创建钱包
-func (wm *WalletManager) CreateWallet(appID string, wallet *openwallet.Wallet) (*openwallet.Wallet, *hdkeystore.HDKey, error) {
+//CreateWalletOptions 创建托管钱包的助记词选项，只用于生成密钥，不保存到钱包记录
+type CreateWalletOptions struct {
+	Mnemonic           string //通过助记词恢复
+	MnemonicWords      int    //生成新助记词的单词数，0为使用随机种子
+	MnemonicPassphrase string //助记词的密码短语，可选
+}
+
+// CreateWallet 创建钱包，opts为托管密钥的助记词选项，新生成的助记词通过key.Mnemonic()返回
+func (wm *WalletManager) CreateWallet(appID string, wallet *openwallet.Wallet, opts ...*CreateWalletOptions) (*openwallet.Wallet, *hdkeystore.HDKey, error) {
 
 	var (
 		key *hdkeystore.HDKey
@@ -31,7 +37,7 @@ func (wm *WalletManager) CreateWallet(appID string, wallet *openwallet.Wallet) (
 	//打开数据库
 	db, err := wm.OpenDB(appID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	//托管密钥
@@ -39,11 +45,16 @@ func (wm *WalletManager) CreateWallet(appID string, wallet *openwallet.Wallet) (
 	if wallet.IsTrust {
 
 		if len(wallet.Password) == 0 {
-			return nil, nil, fmt.Errorf("password is empty")
+			return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "password is empty")
+		}
+
+		var opt CreateWalletOptions
+		if len(opts) > 0 && opts[0] != nil {
+			opt = *opts[0]
 		}
 
 		//生成keystore
-		_key, filePath, err := hdkeystore.StoreHDKey(wm.cfg.KeyDir, wallet.Alias, wallet.Password, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
+		_key, filePath, err := wm.storeWalletKey(db, wallet, &opt)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -55,7 +66,7 @@ func (wm *WalletManager) CreateWallet(appID string, wallet *openwallet.Wallet) (
 	}
 
 	if len(wallet.WalletID) == 0 {
-		return nil, nil, fmt.Errorf("walletID is empty")
+		return nil, nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "walletID is empty")
 	}
 
 	//数据路径
@@ -64,7 +75,7 @@ func (wm *WalletManager) CreateWallet(appID string, wallet *openwallet.Wallet) (
 	//保存钱包到本地应用数据库
 	err = db.Save(wallet)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, openwallet.ConvertError(err)
 	}
 
 	log.Debug("new wallet create success:", wallet.WalletID)
@@ -72,12 +83,59 @@ func (wm *WalletManager) CreateWallet(appID string, wallet *openwallet.Wallet) (
 	return wallet, key, nil
 }
 
+//storeWalletKey 生成托管钱包的keystore，配置了助记词则通过助记词恢复，配置了单词数则生成新助记词
+func (wm *WalletManager) storeWalletKey(db *StormDB, wallet *openwallet.Wallet, opt *CreateWalletOptions) (*hdkeystore.HDKey, string, error) {
+
+	mnemonic := opt.Mnemonic
+
+	if len(mnemonic) == 0 && opt.MnemonicWords == 0 {
+		if len(opt.MnemonicPassphrase) > 0 {
+			return nil, "", openwallet.Errorf(openwallet.ErrInvalidParameter, "mnemonic passphrase without mnemonic")
+		}
+		key, filePath, err := hdkeystore.StoreHDKey(wm.cfg.KeyDir, wallet.Alias, wallet.Password, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
+		if err != nil {
+			return nil, "", openwallet.ConvertError(err)
+		}
+		return key, filePath, nil
+	}
+
+	if len(mnemonic) == 0 {
+		newMnemonic, err := hdkeystore.NewMnemonic(opt.MnemonicWords)
+		if err != nil {
+			return nil, "", openwallet.Errorf(openwallet.ErrInvalidParameter, "%v", err)
+		}
+		mnemonic = newMnemonic
+	}
+
+	if err := hdkeystore.ValidateMnemonic(mnemonic); err != nil {
+		return nil, "", openwallet.Errorf(openwallet.ErrInvalidParameter, "%v", err)
+	}
+
+	key, err := hdkeystore.NewHDKeyWithMnemonic(mnemonic, opt.MnemonicPassphrase, wallet.Alias)
+	if err != nil {
+		return nil, "", openwallet.ConvertError(err)
+	}
+
+	//相同的助记词恢复相同的钱包，已存在则不覆盖
+	var exist openwallet.Wallet
+	if err = db.One("WalletID", key.KeyID, &exist); err == nil {
+		return nil, "", openwallet.Errorf(openwallet.ErrWalletExist, "wallet: %s already exist", key.KeyID)
+	}
+
+	ks := hdkeystore.NewHDKeystore(wm.cfg.KeyDir, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
+	filePath := ks.JoinPath(hdkeystore.KeyFileName(key.Alias, key.KeyID) + ".key")
+	if err = ks.StoreKey(filePath, key, wallet.Password); err != nil {
+		return nil, "", openwallet.ConvertError(err)
+	}
+	return key, filePath, nil
+}
+
 // GetWalletInfo
 func (wm *WalletManager) GetWalletInfo(appID string, walletID string) (*openwallet.Wallet, error) {
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	return wrapper.GetWalletInfo(walletID)
 }
@@ -87,7 +145,7 @@ func (wm *WalletManager) GetWalletList(appID string, offset, limit int) ([]*open
 
 	wrapper, err := wm.NewWalletWrapper(appID, "")
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	return wrapper.GetWalletList(offset, limit)
 
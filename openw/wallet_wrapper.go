@@ -79,14 +79,14 @@ func (wrapper *WalletWrapper) GetWalletByID(walletID string) (*openwallet.Wallet
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	var wallet openwallet.Wallet
 	err = db.One("WalletID", walletID, &wallet)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return &wallet, nil
@@ -98,14 +98,14 @@ func (wrapper *WalletWrapper) GetAssetsAccountInfo(accountID string) (*openwalle
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	var account openwallet.AssetsAccount
 	err = db.One("AccountID", accountID, &account)
 	if err != nil {
-		return nil, fmt.Errorf("can not find account: %s", accountID)
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "can not find account: %s", accountID)
 	}
 
 	return &account, nil
@@ -117,7 +117,7 @@ func (wrapper *WalletWrapper) GetAssetsAccountList(offset, limit int, cols ...in
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -130,7 +130,7 @@ func (wrapper *WalletWrapper) GetAssetsAccountList(offset, limit int, cols ...in
 	}
 
 	if len(cols)%2 != 0 {
-		return nil, fmt.Errorf("condition param is not pair")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "condition param is not pair")
 	}
 
 	for i := 0; i < len(cols); i = i + 2 {
@@ -154,7 +154,7 @@ func (wrapper *WalletWrapper) GetAssetsAccountList(offset, limit int, cols ...in
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find accounts")
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "can not find accounts")
 	}
 
 	return accounts, nil
@@ -164,7 +164,7 @@ func (wrapper *WalletWrapper) GetAssetsAccountList(offset, limit int, cols ...in
 func (wrapper *WalletWrapper) GetAssetsAccountByAddress(address string) (*openwallet.AssetsAccount, error) {
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -172,13 +172,13 @@ func (wrapper *WalletWrapper) GetAssetsAccountByAddress(address string) (*openwa
 	err = db.One("Address", address, &obj)
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find address")
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "can not find address")
 	}
 
 	var account openwallet.AssetsAccount
 	err = db.One("AccountID", obj.AccountID, &account)
 	if err != nil {
-		return nil, fmt.Errorf("can not find account by address: %s", address)
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotFound, "can not find account by address: %s", address)
 	}
 
 	return &account, nil
@@ -188,7 +188,7 @@ func (wrapper *WalletWrapper) GetAssetsAccountByAddress(address string) (*openwa
 func (wrapper *WalletWrapper) GetAddress(address string) (*openwallet.Address, error) {
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -196,7 +196,7 @@ func (wrapper *WalletWrapper) GetAddress(address string) (*openwallet.Address, e
 	err = db.One("Address", address, &obj)
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find address")
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "can not find address")
 	}
 
 	return &obj, nil
@@ -207,7 +207,7 @@ func (wrapper *WalletWrapper) GetAddressList(offset, limit int, cols ...interfac
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -216,7 +216,7 @@ func (wrapper *WalletWrapper) GetAddressList(offset, limit int, cols ...interfac
 	query := make([]q.Matcher, 0)
 
 	if len(cols)%2 != 0 {
-		return nil, fmt.Errorf("condition param is not pair")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "condition param is not pair")
 	}
 
 	for i := 0; i < len(cols); i = i + 2 {
@@ -240,7 +240,7 @@ func (wrapper *WalletWrapper) GetAddressList(offset, limit int, cols ...interfac
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find addresses")
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "can not find addresses")
 	}
 
 	return addrs, nil
@@ -251,7 +251,7 @@ func (wrapper *WalletWrapper) GetImportAddressList(offset, limit int, cols ...in
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -260,7 +260,7 @@ func (wrapper *WalletWrapper) GetImportAddressList(offset, limit int, cols ...in
 	query := make([]q.Matcher, 0)
 
 	if len(cols)%2 != 0 {
-		return nil, fmt.Errorf("condition param is not pair")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "condition param is not pair")
 	}
 
 	for i := 0; i < len(cols); i = i + 2 {
@@ -284,7 +284,7 @@ func (wrapper *WalletWrapper) GetImportAddressList(offset, limit int, cols ...in
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find addresses")
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "can not find addresses")
 	}
 
 	return addrs, nil
@@ -307,23 +307,23 @@ func (wrapper *WalletWrapper) CreateAddress(accountID string, count uint64, deco
 
 	account, err := wrapper.GetAssetsAccountInfo(accountID)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	if count == 0 {
-		return nil, fmt.Errorf("create address count is zero")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "create address count is zero")
 	}
 
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	tx, err := db.Begin(true)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	defer tx.Rollback()
@@ -351,7 +351,7 @@ func (wrapper *WalletWrapper) CreateAddress(accountID string, count uint64, deco
 
 			pubkey, err := owkeychain.OWDecode(pub)
 			if err != nil {
-				return nil, err
+				return nil, openwallet.ConvertError(err)
 			}
 
 			start, err := pubkey.GenPublicChild(changeIndex)
@@ -363,13 +363,13 @@ func (wrapper *WalletWrapper) CreateAddress(accountID string, count uint64, deco
 		if len(newKeys) > 1 {
 			address, err = decoder.RedeemScriptToAddress(newKeys, account.Required, isTestNet)
 			if err != nil {
-				return nil, err
+				return nil, openwallet.ConvertError(err)
 			}
 			publicKey = ""
 		} else {
 			address, err = decoder.PublicKeyToAddress(newKeys[0], isTestNet)
 			if err != nil {
-				return nil, err
+				return nil, openwallet.ConvertError(err)
 			}
 			publicKey = hex.EncodeToString(newKeys[0])
 		}
@@ -391,12 +391,12 @@ func (wrapper *WalletWrapper) CreateAddress(accountID string, count uint64, deco
 		err = tx.Save(account)
 		if err != nil {
 
-			return nil, err
+			return nil, openwallet.ConvertError(err)
 		}
 
 		err = tx.Save(addr)
 		if err != nil {
-			return nil, err
+			return nil, openwallet.ConvertError(err)
 		}
 
 		////记录要导入到核心钱包的地址
@@ -415,7 +415,7 @@ func (wrapper *WalletWrapper) CreateAddress(accountID string, count uint64, deco
 
 	err = tx.Commit()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	return addrs, nil
@@ -427,13 +427,13 @@ func (wrapper *WalletWrapper) ImportWatchOnlyAddress(address ...*openwallet.Addr
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
 	tx, err := db.Begin(true)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 
 	defer tx.Rollback()
@@ -464,7 +464,7 @@ func (wrapper *WalletWrapper) SaveAssetsAccount(account *openwallet.AssetsAccoun
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -474,7 +474,7 @@ func (wrapper *WalletWrapper) SaveAssetsAccount(account *openwallet.AssetsAccoun
 func (wrapper *WalletWrapper) UnlockWallet(password string, time time.Duration) error {
 	key, err := wrapper.HDKey(password)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	wrapper.key = key
 	return nil
@@ -491,12 +491,12 @@ func (wrapper *WalletWrapper) HDKey(password ...string) (*hdkeystore.HDKey, erro
 		if wrapper.key != nil {
 			return wrapper.key, nil
 		} else {
-			return nil, fmt.Errorf("the wallet is locked. ")
+			return nil, openwallet.Errorf(openwallet.ErrWalletLocked, "the wallet is locked. ")
 		}
 	}
 
 	if len(pw) == 0 {
-		return nil, fmt.Errorf("password is empty")
+		return nil, openwallet.Errorf(openwallet.ErrInvalidParameter, "password is empty")
 	}
 
 	if len(wrapper.keyFile) == 0 {
@@ -505,11 +505,11 @@ func (wrapper *WalletWrapper) HDKey(password ...string) (*hdkeystore.HDKey, erro
 
 	keyjson, err := ioutil.ReadFile(wrapper.keyFile)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	key, err := hdkeystore.DecryptHDKey(keyjson, pw)
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	return key, err
 }
@@ -519,7 +519,7 @@ func (wrapper *WalletWrapper) SetAddressExtParam(address string, key string, val
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -527,7 +527,7 @@ func (wrapper *WalletWrapper) SetAddressExtParam(address string, key string, val
 	err = db.One("Address", address, &obj)
 
 	if err != nil {
-		return fmt.Errorf("can not find address")
+		return openwallet.Errorf(openwallet.ErrAddressNotFound, "can not find address")
 	}
 
 	var ext map[string]interface{}
@@ -536,7 +536,7 @@ func (wrapper *WalletWrapper) SetAddressExtParam(address string, key string, val
 	} else {
 		err = json.Unmarshal([]byte(obj.ExtParam), &ext)
 		if err != nil {
-			return err
+			return openwallet.ConvertError(err)
 		}
 	}
 
@@ -544,7 +544,7 @@ func (wrapper *WalletWrapper) SetAddressExtParam(address string, key string, val
 
 	json, err := json.Marshal(ext)
 	if err != nil {
-		return err
+		return openwallet.ConvertError(err)
 	}
 	obj.ExtParam = string(json)
 	return db.Save(&obj)
@@ -555,7 +555,7 @@ func (wrapper *WalletWrapper) GetAddressExtParam(address string, key string) (in
 	//打开数据库
 	db, err := wrapper.OpenStormDB()
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 	defer wrapper.CloseDB()
 
@@ -563,7 +563,7 @@ func (wrapper *WalletWrapper) GetAddressExtParam(address string, key string) (in
 	err = db.One("Address", address, &obj)
 
 	if err != nil {
-		return nil, fmt.Errorf("can not find address")
+		return nil, openwallet.Errorf(openwallet.ErrAddressNotFound, "can not find address")
 	}
 
 	return gjson.ParseBytes([]byte(obj.ExtParam)).Get(key).Value(), nil
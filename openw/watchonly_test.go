@@ -0,0 +1,158 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openw
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/crypto"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+type testXPubDecoder struct {
+	openwallet.AddressDecoderV2Base
+}
+
+func (d *testXPubDecoder) AddressEncode(pub []byte, opts ...interface{}) (string, error) {
+	return "x" + hex.EncodeToString(crypto.SHA256(pub)[:20]), nil
+}
+
+type testXPubAdapter struct {
+	openwallet.AssetsAdapterBase
+}
+
+func (a *testXPubAdapter) GetAddressDecoderV2() openwallet.AddressDecoderV2 {
+	return &testXPubDecoder{}
+}
+
+func TestWalletManager_ImportWatchOnlyAccount(t *testing.T) {
+	wm, cleanup := testTempWalletManager(t)
+	defer cleanup()
+
+	origin, exist := assetsAdapterManagers["XPUB"]
+	assetsAdapterManagers["XPUB"] = &testXPubAdapter{}
+	defer func() {
+		if exist {
+			assetsAdapterManagers["XPUB"] = origin
+		} else {
+			delete(assetsAdapterManagers, "XPUB")
+		}
+	}()
+
+	key, err := hdkeystore.NewHDKey(crypto.SHA256([]byte("xpub seed")), "hot", "m/44'/88'")
+	if err != nil {
+		t.Fatalf("NewHDKey err: %v", err)
+	}
+	accountPath := "m/44'/88'/1'"
+	accountKey, _ := key.DerivedKeyWithPath(accountPath, owcrypt.ECC_CURVE_SECP256K1)
+	xpub := accountKey.GetPublicKey().OWEncode()
+
+	//私钥衍生的地址，用于对比
+	expectAddress := func(isChange, index int) string {
+		child, _ := key.DerivedKeyWithPath(fmt.Sprintf("%s/%d/%d", accountPath, isChange, index), owcrypt.ECC_CURVE_SECP256K1)
+		addr, _ := (&testXPubDecoder{}).AddressEncode(child.GetPublicKey().GetPublicKeyBytes())
+		return addr
+	}
+
+	account, addresses, err := wm.ImportWatchOnlyAccount("xpubApp", "watchWallet", &openwallet.AssetsAccount{
+		Alias:     "cold",
+		Symbol:    "XPUB",
+		PublicKey: xpub,
+		HDPath:    accountPath,
+	}, 3)
+	if err != nil {
+		t.Fatalf("ImportWatchOnlyAccount err: %v", err)
+	}
+	if account.AccountID != openwallet.GenAccountID(xpub) || len(addresses) != 3 {
+		t.Fatalf("account = %+v, addresses = %d", account, len(addresses))
+	}
+
+	wallet, err := wm.GetWalletInfo("xpubApp", "watchWallet")
+	if err != nil || !wallet.WatchOnly {
+		t.Fatalf("watch-only wallet = %+v, err: %v", wallet, err)
+	}
+
+	change, err := wm.CreateChangeAddress("xpubApp", "watchWallet", account.AccountID, 2)
+	if err != nil || len(change) != 2 {
+		t.Fatalf("CreateChangeAddress = %v, err: %v", change, err)
+	}
+
+	//找零地址单独索引，不影响收款地址的索引
+	more, err := wm.CreateAddress("xpubApp", "watchWallet", account.AccountID, 1)
+	if err != nil || len(more) != 1 {
+		t.Fatalf("CreateAddress = %v, err: %v", more, err)
+	}
+
+	paths := make(map[string]bool)
+	for _, a := range append(append(addresses, change...), more...) {
+		isChange := 0
+		if a.IsChange {
+			isChange = 1
+		}
+		if a.Address != expectAddress(isChange, int(a.Index)) {
+			t.Fatalf("address %s of index %d/%d is not derived from xpub", a.Address, isChange, a.Index)
+		}
+		if want := fmt.Sprintf("%s/%d/%d", accountPath, isChange, a.Index); a.HDPath != want {
+			t.Fatalf("address %s hdPath = %s, want %s", a.Address, a.HDPath, want)
+		}
+		paths[a.HDPath] = true
+		//区块扫描器视为本地地址
+		if _, ok := wm.GetSourceKeyByAddressForBlockScan(a.Address); !ok {
+			t.Fatalf("address %s is not added for block scan", a.Address)
+		}
+	}
+
+	for _, want := range []string{
+		accountPath + "/0/0", accountPath + "/0/1", accountPath + "/0/2", accountPath + "/0/3",
+		accountPath + "/1/0", accountPath + "/1/1",
+	} {
+		if !paths[want] {
+			t.Fatalf("hdPath %s is not derived, paths = %v", want, paths)
+		}
+	}
+
+	//重复导入
+	if _, _, err = wm.ImportWatchOnlyAccount("xpubApp", "watchWallet", &openwallet.AssetsAccount{
+		Alias: "cold", Symbol: "XPUB", PublicKey: xpub, HDPath: accountPath,
+	}, 0); err == nil {
+		t.Fatalf("import exist account should return error")
+	}
+
+	//相同公钥导入到其他钱包，不能接管已有账户
+	if _, _, err = wm.ImportWatchOnlyAccount("xpubApp", "otherWallet", &openwallet.AssetsAccount{
+		Alias: "cold", Symbol: "XPUB", PublicKey: xpub, HDPath: accountPath,
+	}, 0); err == nil {
+		t.Fatalf("import exist account to other wallet should return error")
+	}
+	if _, err = wm.GetWalletInfo("xpubApp", "otherWallet"); err == nil {
+		t.Fatalf("watch-only wallet should not be created for exist account")
+	}
+	if exist, _ := wm.GetAssetsAccountInfo("xpubApp", "watchWallet", account.AccountID); exist == nil || exist.WalletID != "watchWallet" {
+		t.Fatalf("exist account = %+v, want wallet watchWallet", exist)
+	}
+
+	//私钥不能导入为观察账户
+	xprv := accountKey.OWEncode()
+	if _, _, err = wm.ImportWatchOnlyAccount("xpubApp", "watchWallet", &openwallet.AssetsAccount{
+		Alias: "hot", Symbol: "XPUB", PublicKey: xprv, HDPath: accountPath,
+	}, 0); err == nil {
+		t.Fatalf("import private key should return error")
+	}
+}
@@ -86,7 +86,7 @@ func (wrapper *Wrapper) OpenStormDB() (*StormDB, error) {
 	)
 
 	if err != nil {
-		return nil, err
+		return nil, openwallet.ConvertError(err)
 	}
 
 	wrapper.isExternalDB = false
@@ -17,6 +17,7 @@ package openwallet
 
 import (
 	"encoding/hex"
+	"fmt"
 	"github.com/blocktree/go-owcdrivers/owkeychain"
 	"github.com/blocktree/openwallet/v2/crypto"
 	"github.com/btcsuite/btcutil/hdkeychain"
@@ -51,6 +52,7 @@ type AssetsAccount struct {
 	Required        uint64 `json:"required"`        //必要签名数
 	Symbol          string `json:"symbol"`          //资产币种类别
 	AddressIndex    int    `json:"addressIndex"`
+	ChangeCount     int    `json:"changeCount"` //已衍生的找零地址数量，找零地址与收款地址分别从0开始索引
 	Balance         string `json:"balance"`
 	IsTrust         bool   `json:"isTrust"`   //是否托管密钥
 	ExtParam        string `json:"extParam"`  //扩展参数，用于调用智能合约，json结构
@@ -59,9 +61,46 @@ type AssetsAccount struct {
 	core interface{} //核心账户指针
 }
 
-func NewMultiSigAccount(wallets []*Wallet, required uint, creator *Wallet) (*AssetsAccount, error) {
+//NewMultiSigAccount 以各钱包账户的扩展公钥作为拥有者，创建多签账户，创建者为第一个拥有者。
+//拥有者的签名按账户公钥验证，账户可来自不同的钱包或应用
+func NewMultiSigAccount(accounts []*AssetsAccount, required uint, creator *AssetsAccount) (*AssetsAccount, error) {
 
-	return nil, nil
+	if creator == nil {
+		return nil, fmt.Errorf("multisig account creator is nil")
+	}
+
+	if len(creator.PublicKey) == 0 {
+		return nil, fmt.Errorf("account: %s public key is empty", creator.AccountID)
+	}
+
+	ownerKeys := []string{creator.PublicKey}
+	for _, a := range accounts {
+		if a == nil || a.PublicKey == creator.PublicKey {
+			continue
+		}
+		if len(a.PublicKey) == 0 {
+			return nil, fmt.Errorf("account: %s public key is empty", a.AccountID)
+		}
+		ownerKeys = append(ownerKeys, a.PublicKey)
+	}
+
+	if required == 0 || int(required) > len(ownerKeys) {
+		return nil, fmt.Errorf("multisig account required: %d is invalid, owners: %d", required, len(ownerKeys))
+	}
+
+	account := &AssetsAccount{
+		WalletID:  creator.WalletID,
+		Alias:     creator.Alias,
+		Symbol:    creator.Symbol,
+		Index:     creator.Index,
+		HDPath:    creator.HDPath,
+		PublicKey: creator.PublicKey,
+		OwnerKeys: ownerKeys,
+		Required:  uint64(required),
+	}
+	account.AccountID = account.GetAccountID()
+
+	return account, nil
 }
 
 //NewUserAccount 创建账户
@@ -70,8 +109,19 @@ func NewUserAccount() *AssetsAccount {
 	return account
 }
 
+//GetOwners 账户拥有者列表，元素为*OwnerKey
 func (a *AssetsAccount) GetOwners() []AccountOwner {
-	return nil
+	owners := make([]AccountOwner, 0, len(a.OwnerKeys))
+	for _, pub := range a.OwnerKeys {
+		if len(pub) == 0 {
+			continue
+		}
+		owners = append(owners, &OwnerKey{
+			AccountID: GenAccountID(pub),
+			PublicKey: pub,
+		})
+	}
+	return owners
 }
 
 //GetAccountID 计算AccountID
@@ -36,6 +36,16 @@ type AddressCreateResult struct {
 // @count 连续创建数量
 // @workerSize 并行线程数。建议20条，并行执行5000条大约8.22秒。
 func BatchCreateAddressByAccount(account *AssetsAccount, adapter AssetsAdapter, count int64, workerSize int) ([]*Address, error) {
+	return batchCreateAddressByAccount(account, adapter, count, workerSize, 0)
+}
+
+// BatchCreateChangeAddressByAccount 批量创建找零地址，参数同BatchCreateAddressByAccount
+func BatchCreateChangeAddressByAccount(account *AssetsAccount, adapter AssetsAdapter, count int64, workerSize int) ([]*Address, error) {
+	return batchCreateAddressByAccount(account, adapter, count, workerSize, 1)
+}
+
+//batchCreateAddressByAccount 批量创建地址，addrIsChange = 1 创建找零地址
+func batchCreateAddressByAccount(account *AssetsAccount, adapter AssetsAdapter, count int64, workerSize int, addrIsChange int64) ([]*Address, error) {
 
 	var (
 		quit         = make(chan struct{})
@@ -82,13 +92,17 @@ func BatchCreateAddressByAccount(account *AssetsAccount, adapter AssetsAdapter,
 	//生产工作
 	produceWork := func(eAccount *AssetsAccount, eAdapter AssetsAdapter, eCount int64, eProducer chan AddressCreateResult) {
 		addrIndex := eAccount.AddressIndex
+		if addrIsChange == 1 {
+			//找零地址单独索引
+			addrIndex = eAccount.ChangeCount - 1
+		}
 		for i := uint64(0); i < uint64(eCount); i++ {
 			workPermitCH <- struct{}{}
 			addrIndex++
 			go func(mAccount *AssetsAccount, mAdapter AssetsAdapter, newIndex int, end chan struct{}, mProducer chan<- AddressCreateResult) {
 
 				//生成地址
-				mProducer <- CreateAddressByAccountWithIndex(mAccount, mAdapter, newIndex, 0)
+				mProducer <- CreateAddressByAccountWithIndex(mAccount, mAdapter, newIndex, addrIsChange)
 				//释放
 				<-end
 
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+	"github.com/blocktree/openwallet/v2/openwallet/blockchaintest"
+	"github.com/go-redis/redis"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+func newBlockchainLocalFunc(keepOpen bool) blockchaintest.NewDAIFunc {
+	return func(t *testing.T) (openwallet.BlockchainDAI, func()) {
+		dir, err := ioutil.TempDir("", "blockchain-local")
+		if err != nil {
+			t.Fatalf("TempDir err: %v", err)
+		}
+		dai, err := openwallet.NewBlockchainLocal(filepath.Join(dir, "blockchain.db"), keepOpen)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("NewBlockchainLocal err: %v", err)
+		}
+		return dai, func() { os.RemoveAll(dir) }
+	}
+}
+
+func TestBlockchainLocal_Conformance(t *testing.T) {
+	t.Run("KeepOpen", func(t *testing.T) {
+		blockchaintest.TestBlockchainDAI(t, newBlockchainLocalFunc(true))
+	})
+	t.Run("OpenPerCall", func(t *testing.T) {
+		blockchaintest.TestBlockchainDAI(t, newBlockchainLocalFunc(false))
+	})
+}
+
+//TestBlockchainSQL_Conformance 需要设置环境变量，例如：
+//OW_TEST_SQL_DRIVER=mysql OW_TEST_SQL_DSN="root:123456@tcp(127.0.0.1:3306)/openwallet"
+func TestBlockchainSQL_Conformance(t *testing.T) {
+	driver, dsn := os.Getenv("OW_TEST_SQL_DRIVER"), os.Getenv("OW_TEST_SQL_DSN")
+	if len(driver) == 0 || len(dsn) == 0 {
+		t.Skip("OW_TEST_SQL_DRIVER or OW_TEST_SQL_DSN is not set")
+	}
+	blockchaintest.TestBlockchainDAI(t, func(t *testing.T) (openwallet.BlockchainDAI, func()) {
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			t.Fatalf("sql.Open err: %v", err)
+		}
+		dai, err := openwallet.NewBlockchainSQL(db, driver)
+		if err != nil {
+			db.Close()
+			t.Fatalf("NewBlockchainSQL err: %v", err)
+		}
+		return dai, func() { db.Close() }
+	})
+}
+
+//TestBlockchainRedis_Conformance 需要设置环境变量，例如：
+//OW_TEST_REDIS_ADDR=127.0.0.1:6379
+func TestBlockchainRedis_Conformance(t *testing.T) {
+	addr := os.Getenv("OW_TEST_REDIS_ADDR")
+	if len(addr) == 0 {
+		t.Skip("OW_TEST_REDIS_ADDR is not set")
+	}
+	blockchaintest.TestBlockchainDAI(t, func(t *testing.T) (openwallet.BlockchainDAI, func()) {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		dai, err := openwallet.NewBlockchainRedis(client, "openwallet:test")
+		if err != nil {
+			client.Close()
+			t.Fatalf("NewBlockchainRedis err: %v", err)
+		}
+		return dai, func() { client.Close() }
+	})
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	defaultRedisKeyPrefix = "openwallet:blockchain"
+	unscanRecordBucket    = "unscan_record"
+	unscanRecordSymbols   = "unscan_record_symbols" //有未扫记录的symbol集合
+)
+
+//BlockchainRedis 区块链数据访问Redis实现
+//多个扫描器可共用同一个Redis，数据以symbol区分。
+//同一symbol的键使用{symbol}作为hash tag，保证集群模式下事务落在同一个slot。
+type BlockchainRedis struct {
+	client         redis.Cmdable
+	prefix         string
+	mu             sync.RWMutex
+	blockCacheSize map[string]uint64 //区块缓存数量，按symbol区分
+}
+
+// NewBlockchainRedis 创建Redis区块链数据库
+// @param client redis.Client或redis.ClusterClient
+// @param prefix 键前缀，为空则使用默认前缀
+func NewBlockchainRedis(client redis.Cmdable, prefix string) (*BlockchainRedis, error) {
+	if client == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	if len(prefix) == 0 {
+		prefix = defaultRedisKeyPrefix
+	}
+	base := &BlockchainRedis{
+		client:         client,
+		prefix:         prefix,
+		blockCacheSize: make(map[string]uint64),
+	}
+
+	//默认缓存1000个区块
+	base.SetMaxBlockCache(defaultBlockCacheSize, "")
+	return base, nil
+}
+
+//key 生成symbol下的键
+func (base *BlockchainRedis) key(symbol, name string) string {
+	return fmt.Sprintf("%s:{%s}:%s", base.prefix, blockchainSymbol(symbol), name)
+}
+
+//getMaxBlockCache 获取symbol的区块缓存数量
+func (base *BlockchainRedis) getMaxBlockCache(symbol string) uint64 {
+	base.mu.RLock()
+	defer base.mu.RUnlock()
+	if size, ok := base.blockCacheSize[symbol]; ok {
+		return size
+	}
+	return base.blockCacheSize[""]
+}
+
+func (base *BlockchainRedis) SaveCurrentBlockHead(header *BlockHeader) error {
+	if header == nil {
+		return fmt.Errorf("the block header to save is nil")
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	return base.client.Set(base.key(header.Symbol, CurrentBlockHeaderKey), data, 0).Err()
+}
+
+func (base *BlockchainRedis) GetCurrentBlockHead(symbol string) (*BlockHeader, error) {
+	var header BlockHeader
+	data, err := base.client.Get(base.key(symbol, CurrentBlockHeaderKey)).Bytes()
+	if err == redis.Nil {
+		//与本地实现一致，未记录时返回空区块头
+		return &header, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func (base *BlockchainRedis) SaveLocalBlockHead(header *BlockHeader) error {
+	if header == nil {
+		return fmt.Errorf("the block header to save is nil")
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	var (
+		symbol    = blockchainSymbol(header.Symbol)
+		cacheKey  = base.key(symbol, blockCacheBucket)
+		indexKey  = base.key(symbol, blockIndexBucket)
+		seqKey    = base.key(symbol, CurrentBlockIncreaseIndexKey)
+		heightKey = strconv.FormatUint(header.Height, 10)
+	)
+
+	//递增序号
+	seq, err := base.client.Incr(seqKey).Result()
+	if err != nil {
+		return err
+	}
+
+	//记录新高度的区块信息
+	_, err = base.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(cacheKey, heightKey, data)
+		pipe.ZAdd(indexKey, redis.Z{Score: float64(seq), Member: heightKey})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//移除超出缓存数量的旧记录
+	size := int64(base.getMaxBlockCache(symbol))
+	if seq <= size {
+		return nil
+	}
+	max := strconv.FormatInt(seq-size, 10)
+	expired, err := base.client.ZRangeByScore(indexKey, redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	_, err = base.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HDel(cacheKey, expired...)
+		pipe.ZRemRangeByScore(indexKey, "-inf", max)
+		return nil
+	})
+	return err
+}
+
+func (base *BlockchainRedis) GetLocalBlockHeadByHeight(height uint64, symbol string) (*BlockHeader, error) {
+	var header BlockHeader
+	data, err := base.client.HGet(base.key(symbol, blockCacheBucket), strconv.FormatUint(height, 10)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("block header of height: %d not found", height)
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func (base *BlockchainRedis) SaveUnscanRecord(record *UnscanRecord) error {
+	if record == nil {
+		return fmt.Errorf("the unscan record to save is nil")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	err = base.client.HSet(base.key(record.Symbol, unscanRecordBucket), record.ID, data).Err()
+	if err != nil {
+		return err
+	}
+	//记录symbol，查询全部symbol的未扫记录时使用
+	return base.client.SAdd(base.prefix+":"+unscanRecordSymbols, blockchainSymbol(record.Symbol)).Err()
+}
+
+//DeleteUnscanRecordByHeight 删除symbol指定高度的未扫记录，symbol为空则删除全部symbol的记录
+func (base *BlockchainRedis) DeleteUnscanRecordByHeight(height uint64, symbol string) error {
+	list, err := base.GetUnscanRecords(symbol)
+	if err != nil {
+		return err
+	}
+	//按记录所在的symbol分组删除
+	ids := make(map[string][]string)
+	for _, r := range list {
+		if r.BlockHeight == height {
+			ids[r.Symbol] = append(ids[r.Symbol], r.ID)
+		}
+	}
+	for s, group := range ids {
+		err = base.client.HDel(base.key(s, unscanRecordBucket), group...).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//DeleteUnscanRecordByID 删除symbol的未扫记录，symbol为空则从全部symbol中删除
+func (base *BlockchainRedis) DeleteUnscanRecordByID(id string, symbol string) error {
+	if len(symbol) > 0 {
+		return base.client.HDel(base.key(symbol, unscanRecordBucket), id).Err()
+	}
+
+	symbols, err := base.client.SMembers(base.prefix + ":" + unscanRecordSymbols).Result()
+	if err != nil {
+		return err
+	}
+	for _, s := range symbols {
+		err = base.client.HDel(base.key(s, unscanRecordBucket), id).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (base *BlockchainRedis) GetTransactionsByTxID(txid, symbol string) ([]*Transaction, error) {
+	return nil, fmt.Errorf("GetTransactionsByTxID is not implemented")
+}
+
+//GetUnscanRecords 获取symbol的未扫记录，symbol为空则获取全部symbol的记录
+func (base *BlockchainRedis) GetUnscanRecords(symbol string) ([]*UnscanRecord, error) {
+	if len(symbol) > 0 {
+		return base.getUnscanRecords(symbol)
+	}
+
+	symbols, err := base.client.SMembers(base.prefix + ":" + unscanRecordSymbols).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*UnscanRecord, 0)
+	for _, s := range symbols {
+		records, err := base.getUnscanRecords(s)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, records...)
+	}
+	return list, nil
+}
+
+//getUnscanRecords 获取symbol的未扫记录
+func (base *BlockchainRedis) getUnscanRecords(symbol string) ([]*UnscanRecord, error) {
+	values, err := base.client.HGetAll(base.key(symbol, unscanRecordBucket)).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*UnscanRecord, 0, len(values))
+	for _, v := range values {
+		var r UnscanRecord
+		if err = json.Unmarshal([]byte(v), &r); err != nil {
+			return nil, err
+		}
+		list = append(list, &r)
+	}
+	return list, nil
+}
+
+func (base *BlockchainRedis) SetMaxBlockCache(size uint64, symbol string) error {
+	base.mu.Lock()
+	defer base.mu.Unlock()
+	if len(symbol) > 0 {
+		symbol = blockchainSymbol(symbol)
+	}
+	base.blockCacheSize[symbol] = size
+	return nil
+}
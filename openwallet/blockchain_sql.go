@@ -0,0 +1,325 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	sqlBlockHeaderTable   = "ow_block_header"
+	sqlCurrentBlockTable  = "ow_current_block_header"
+	sqlUnscanRecordTable  = "ow_unscan_record"
+	defaultBlockCacheSize = 1000
+)
+
+//BlockchainSQL 区块链数据访问SQL数据库实现，支持MySQL，Postgres等database/sql驱动
+//多个扫描器可共用同一个数据库，数据以symbol区分
+type BlockchainSQL struct {
+	db             *sql.DB
+	driverName     string
+	mu             sync.RWMutex
+	blockCacheSize map[string]uint64 //区块缓存数量，按symbol区分
+}
+
+// NewBlockchainSQL 创建SQL区块链数据库，并初始化数据表
+// @param driverName 驱动名，用于选择占位符格式，如：mysql，postgres
+func NewBlockchainSQL(db *sql.DB, driverName string) (*BlockchainSQL, error) {
+	if db == nil {
+		return nil, fmt.Errorf("sql db is nil")
+	}
+	base := &BlockchainSQL{
+		db:             db,
+		driverName:     driverName,
+		blockCacheSize: make(map[string]uint64),
+	}
+
+	err := base.createTables()
+	if err != nil {
+		return nil, err
+	}
+
+	//默认缓存1000个区块
+	base.SetMaxBlockCache(defaultBlockCacheSize, "")
+	return base, nil
+}
+
+//createTables 创建数据表
+func (base *BlockchainSQL) createTables() error {
+	stmts := []string{
+		"CREATE TABLE IF NOT EXISTS " + sqlBlockHeaderTable + " (" +
+			"symbol VARCHAR(32) NOT NULL, " +
+			"height BIGINT NOT NULL, " +
+			"seq BIGINT NOT NULL, " +
+			"data TEXT NOT NULL, " +
+			"PRIMARY KEY (symbol, height))",
+		"CREATE TABLE IF NOT EXISTS " + sqlCurrentBlockTable + " (" +
+			"symbol VARCHAR(32) NOT NULL, " +
+			"data TEXT NOT NULL, " +
+			"PRIMARY KEY (symbol))",
+		"CREATE TABLE IF NOT EXISTS " + sqlUnscanRecordTable + " (" +
+			"id VARCHAR(128) NOT NULL, " +
+			"symbol VARCHAR(32) NOT NULL, " +
+			"block_height BIGINT NOT NULL, " +
+			"txid VARCHAR(255) NOT NULL, " +
+			"reason TEXT NOT NULL, " +
+			"PRIMARY KEY (id))",
+	}
+	for _, stmt := range stmts {
+		if _, err := base.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//rebind 转换占位符，postgres使用$1,$2...
+func (base *BlockchainSQL) rebind(query string) string {
+	switch base.driverName {
+	case "postgres", "pgx":
+	default:
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+//getMaxBlockCache 获取symbol的区块缓存数量
+func (base *BlockchainSQL) getMaxBlockCache(symbol string) uint64 {
+	base.mu.RLock()
+	defer base.mu.RUnlock()
+	if size, ok := base.blockCacheSize[symbol]; ok {
+		return size
+	}
+	return base.blockCacheSize[""]
+}
+
+func (base *BlockchainSQL) SaveCurrentBlockHead(header *BlockHeader) error {
+	if header == nil {
+		return fmt.Errorf("the block header to save is nil")
+	}
+	symbol := blockchainSymbol(header.Symbol)
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	tx, err := base.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(base.rebind("DELETE FROM "+sqlCurrentBlockTable+" WHERE symbol = ?"), symbol)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(base.rebind("INSERT INTO "+sqlCurrentBlockTable+" (symbol, data) VALUES (?, ?)"), symbol, string(data))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (base *BlockchainSQL) GetCurrentBlockHead(symbol string) (*BlockHeader, error) {
+	var (
+		header BlockHeader
+		data   string
+	)
+	row := base.db.QueryRow(base.rebind("SELECT data FROM "+sqlCurrentBlockTable+" WHERE symbol = ?"), blockchainSymbol(symbol))
+	err := row.Scan(&data)
+	if err == sql.ErrNoRows {
+		//与本地实现一致，未记录时返回空区块头
+		return &header, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(data), &header)
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func (base *BlockchainSQL) SaveLocalBlockHead(header *BlockHeader) error {
+	if header == nil {
+		return fmt.Errorf("the block header to save is nil")
+	}
+	symbol := blockchainSymbol(header.Symbol)
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	tx, err := base.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//查询当前记录的序号
+	var seq int64
+	row := tx.QueryRow(base.rebind("SELECT COALESCE(MAX(seq), 0) FROM "+sqlBlockHeaderTable+" WHERE symbol = ?"), symbol)
+	if err = row.Scan(&seq); err != nil {
+		return err
+	}
+	seq++
+
+	//记录新高度的区块信息
+	_, err = tx.Exec(base.rebind("DELETE FROM "+sqlBlockHeaderTable+" WHERE symbol = ? AND height = ?"), symbol, int64(header.Height))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(base.rebind("INSERT INTO "+sqlBlockHeaderTable+" (symbol, height, seq, data) VALUES (?, ?, ?, ?)"),
+		symbol, int64(header.Height), seq, string(data))
+	if err != nil {
+		return err
+	}
+
+	//移除超出缓存数量的旧记录
+	size := int64(base.getMaxBlockCache(symbol))
+	if seq > size {
+		_, err = tx.Exec(base.rebind("DELETE FROM "+sqlBlockHeaderTable+" WHERE symbol = ? AND seq <= ?"), symbol, seq-size)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (base *BlockchainSQL) GetLocalBlockHeadByHeight(height uint64, symbol string) (*BlockHeader, error) {
+	var (
+		header BlockHeader
+		data   string
+	)
+	row := base.db.QueryRow(base.rebind("SELECT data FROM "+sqlBlockHeaderTable+" WHERE symbol = ? AND height = ?"),
+		blockchainSymbol(symbol), int64(height))
+	err := row.Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("block header of height: %d not found", height)
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(data), &header)
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+func (base *BlockchainSQL) SaveUnscanRecord(record *UnscanRecord) error {
+	if record == nil {
+		return fmt.Errorf("the unscan record to save is nil")
+	}
+
+	tx, err := base.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(base.rebind("DELETE FROM "+sqlUnscanRecordTable+" WHERE id = ?"), record.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(base.rebind("INSERT INTO "+sqlUnscanRecordTable+" (id, symbol, block_height, txid, reason) VALUES (?, ?, ?, ?, ?)"),
+		record.ID, blockchainSymbol(record.Symbol), int64(record.BlockHeight), record.TxID, record.Reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//DeleteUnscanRecordByHeight 删除symbol指定高度的未扫记录，symbol为空则删除全部symbol的记录
+func (base *BlockchainSQL) DeleteUnscanRecordByHeight(height uint64, symbol string) error {
+	query := "DELETE FROM " + sqlUnscanRecordTable + " WHERE block_height = ?"
+	args := []interface{}{int64(height)}
+	if len(symbol) > 0 {
+		query += " AND symbol = ?"
+		args = append(args, blockchainSymbol(symbol))
+	}
+	_, err := base.db.Exec(base.rebind(query), args...)
+	return err
+}
+
+func (base *BlockchainSQL) DeleteUnscanRecordByID(id string, symbol string) error {
+	_, err := base.db.Exec(base.rebind("DELETE FROM "+sqlUnscanRecordTable+" WHERE id = ?"), id)
+	return err
+}
+
+func (base *BlockchainSQL) GetTransactionsByTxID(txid, symbol string) ([]*Transaction, error) {
+	return nil, fmt.Errorf("GetTransactionsByTxID is not implemented")
+}
+
+func (base *BlockchainSQL) GetUnscanRecords(symbol string) ([]*UnscanRecord, error) {
+	query := "SELECT id, symbol, block_height, txid, reason FROM " + sqlUnscanRecordTable
+	args := make([]interface{}, 0)
+	if len(symbol) > 0 {
+		query += " WHERE symbol = ?"
+		args = append(args, blockchainSymbol(symbol))
+	}
+	rows, err := base.db.Query(base.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]*UnscanRecord, 0)
+	for rows.Next() {
+		var (
+			r      UnscanRecord
+			height int64
+		)
+		if err = rows.Scan(&r.ID, &r.Symbol, &height, &r.TxID, &r.Reason); err != nil {
+			return nil, err
+		}
+		r.BlockHeight = uint64(height)
+		list = append(list, &r)
+	}
+	return list, rows.Err()
+}
+
+func (base *BlockchainSQL) SetMaxBlockCache(size uint64, symbol string) error {
+	base.mu.Lock()
+	defer base.mu.Unlock()
+	if len(symbol) > 0 {
+		symbol = blockchainSymbol(symbol)
+	}
+	base.blockCacheSize[symbol] = size
+	return nil
+}
+
+//blockchainSymbol 统一symbol格式
+func blockchainSymbol(symbol string) string {
+	return strings.ToUpper(symbol)
+}
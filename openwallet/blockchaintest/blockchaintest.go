@@ -0,0 +1,273 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+// Package blockchaintest 提供openwallet.BlockchainDAI实现的一致性测试，
+// 所有BlockchainDAI实现都应该通过TestBlockchainDAI。
+package blockchaintest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
+)
+
+// NewDAIFunc 创建一个空的BlockchainDAI实例，cleanup在子测试结束时调用
+type NewDAIFunc func(t *testing.T) (dai openwallet.BlockchainDAI, cleanup func())
+
+// TestBlockchainDAI 执行BlockchainDAI一致性测试
+func TestBlockchainDAI(t *testing.T, newDAI NewDAIFunc) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, dai openwallet.BlockchainDAI, symbol string)
+	}{
+		{"CurrentBlockHead", testCurrentBlockHead},
+		{"LocalBlockHead", testLocalBlockHead},
+		{"MaxBlockCache", testMaxBlockCache},
+		{"UnscanRecord", testUnscanRecord},
+		{"AllUnscanRecords", testAllUnscanRecords},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			dai, cleanup := newDAI(t)
+			if cleanup != nil {
+				defer cleanup()
+			}
+			//共享存储的实现以symbol隔离，每个子测试使用唯一symbol
+			symbol := fmt.Sprintf("T%d", time.Now().UnixNano())
+			c.fn(t, dai, symbol)
+		})
+	}
+}
+
+func newHeader(height uint64, symbol string) *openwallet.BlockHeader {
+	return &openwallet.BlockHeader{
+		Hash:              fmt.Sprintf("hash_%d", height),
+		Previousblockhash: fmt.Sprintf("hash_%d", height-1),
+		Height:            height,
+		Symbol:            symbol,
+	}
+}
+
+func testCurrentBlockHead(t *testing.T, dai openwallet.BlockchainDAI, symbol string) {
+	header, err := dai.GetCurrentBlockHead(symbol)
+	if err != nil {
+		t.Fatalf("GetCurrentBlockHead on empty store err: %v", err)
+	}
+	if header == nil || header.Height != 0 {
+		t.Fatalf("GetCurrentBlockHead on empty store = %+v, want empty header", header)
+	}
+
+	for _, height := range []uint64{100, 101} {
+		err = dai.SaveCurrentBlockHead(newHeader(height, symbol))
+		if err != nil {
+			t.Fatalf("SaveCurrentBlockHead err: %v", err)
+		}
+		header, err = dai.GetCurrentBlockHead(symbol)
+		if err != nil {
+			t.Fatalf("GetCurrentBlockHead err: %v", err)
+		}
+		if header.Height != height || header.Hash != fmt.Sprintf("hash_%d", height) {
+			t.Fatalf("GetCurrentBlockHead = %d/%s, want %d/hash_%d", header.Height, header.Hash, height, height)
+		}
+	}
+}
+
+func testLocalBlockHead(t *testing.T, dai openwallet.BlockchainDAI, symbol string) {
+	for i := uint64(1); i <= 10; i++ {
+		if err := dai.SaveLocalBlockHead(newHeader(i, symbol)); err != nil {
+			t.Fatalf("SaveLocalBlockHead err: %v", err)
+		}
+	}
+	for i := uint64(1); i <= 10; i++ {
+		header, err := dai.GetLocalBlockHeadByHeight(i, symbol)
+		if err != nil {
+			t.Fatalf("GetLocalBlockHeadByHeight(%d) err: %v", i, err)
+		}
+		if header.Height != i || header.Hash != fmt.Sprintf("hash_%d", i) ||
+			header.Previousblockhash != fmt.Sprintf("hash_%d", i-1) {
+			t.Fatalf("GetLocalBlockHeadByHeight(%d) = %+v", i, header)
+		}
+	}
+
+	if _, err := dai.GetLocalBlockHeadByHeight(11, symbol); err == nil {
+		t.Fatalf("GetLocalBlockHeadByHeight of unsaved height should return error")
+	}
+
+	//同一高度重新保存，覆盖旧记录
+	fork := newHeader(10, symbol)
+	fork.Hash = "hash_10_fork"
+	fork.Fork = true
+	if err := dai.SaveLocalBlockHead(fork); err != nil {
+		t.Fatalf("SaveLocalBlockHead err: %v", err)
+	}
+	header, err := dai.GetLocalBlockHeadByHeight(10, symbol)
+	if err != nil {
+		t.Fatalf("GetLocalBlockHeadByHeight(10) err: %v", err)
+	}
+	if header.Hash != "hash_10_fork" || !header.Fork {
+		t.Fatalf("GetLocalBlockHeadByHeight(10) = %+v, want overwritten header", header)
+	}
+}
+
+func testMaxBlockCache(t *testing.T, dai openwallet.BlockchainDAI, symbol string) {
+	const (
+		max   = 5
+		total = 12
+	)
+	if err := dai.SetMaxBlockCache(max, symbol); err != nil {
+		t.Fatalf("SetMaxBlockCache err: %v", err)
+	}
+	for i := uint64(1); i <= total; i++ {
+		if err := dai.SaveLocalBlockHead(newHeader(i, symbol)); err != nil {
+			t.Fatalf("SaveLocalBlockHead err: %v", err)
+		}
+	}
+
+	//只保留最近保存的max个区块
+	for i := uint64(1); i <= total; i++ {
+		_, err := dai.GetLocalBlockHeadByHeight(i, symbol)
+		if i <= total-max && err == nil {
+			t.Fatalf("height %d should be pruned", i)
+		}
+		if i > total-max && err != nil {
+			t.Fatalf("height %d should be kept, err: %v", i, err)
+		}
+	}
+}
+
+func testUnscanRecord(t *testing.T, dai openwallet.BlockchainDAI, symbol string) {
+	records := []*openwallet.UnscanRecord{
+		openwallet.NewUnscanRecord(10, "", "get block failed", symbol),
+		openwallet.NewUnscanRecord(10, "tx1", "get tx failed", symbol),
+		openwallet.NewUnscanRecord(11, "tx2", "get tx failed", symbol),
+	}
+	for _, r := range records {
+		if err := dai.SaveUnscanRecord(r); err != nil {
+			t.Fatalf("SaveUnscanRecord err: %v", err)
+		}
+	}
+	//重复保存同一记录不会产生新记录
+	if err := dai.SaveUnscanRecord(records[2]); err != nil {
+		t.Fatalf("SaveUnscanRecord err: %v", err)
+	}
+	if err := dai.SaveUnscanRecord(nil); err == nil {
+		t.Fatalf("SaveUnscanRecord(nil) should return error")
+	}
+
+	assertUnscanRecords(t, dai, symbol, records...)
+
+	if err := dai.DeleteUnscanRecordByHeight(10, symbol); err != nil {
+		t.Fatalf("DeleteUnscanRecordByHeight err: %v", err)
+	}
+	assertUnscanRecords(t, dai, symbol, records[2])
+
+	if err := dai.DeleteUnscanRecordByID(records[2].ID, symbol); err != nil {
+		t.Fatalf("DeleteUnscanRecordByID err: %v", err)
+	}
+	assertUnscanRecords(t, dai, symbol)
+}
+
+func testAllUnscanRecords(t *testing.T, dai openwallet.BlockchainDAI, symbol string) {
+	records := []*openwallet.UnscanRecord{
+		openwallet.NewUnscanRecord(20, "", "get block failed", symbol),
+		openwallet.NewUnscanRecord(21, "tx1", "get tx failed", symbol+"X"),
+	}
+	for _, r := range records {
+		if err := dai.SaveUnscanRecord(r); err != nil {
+			t.Fatalf("SaveUnscanRecord err: %v", err)
+		}
+	}
+
+	//symbol为空返回全部symbol的记录，共享存储可能有其他symbol的记录
+	got := allUnscanRecordIDs(t, dai)
+	for _, r := range records {
+		if !got[r.ID] {
+			t.Fatalf("GetUnscanRecords(\"\") does not return record %s of symbol %s", r.ID, r.Symbol)
+		}
+	}
+
+	for _, r := range records {
+		if err := dai.DeleteUnscanRecordByID(r.ID, r.Symbol); err != nil {
+			t.Fatalf("DeleteUnscanRecordByID err: %v", err)
+		}
+	}
+
+	//symbol为空删除全部symbol的记录
+	records = []*openwallet.UnscanRecord{
+		openwallet.NewUnscanRecord(30, "", "get block failed", symbol),
+		openwallet.NewUnscanRecord(30, "tx1", "get tx failed", symbol+"X"),
+		openwallet.NewUnscanRecord(31, "tx2", "get tx failed", symbol+"X"),
+	}
+	for _, r := range records {
+		if err := dai.SaveUnscanRecord(r); err != nil {
+			t.Fatalf("SaveUnscanRecord err: %v", err)
+		}
+	}
+	if err := dai.DeleteUnscanRecordByHeight(30, ""); err != nil {
+		t.Fatalf("DeleteUnscanRecordByHeight err: %v", err)
+	}
+	got = allUnscanRecordIDs(t, dai)
+	if got[records[0].ID] || got[records[1].ID] || !got[records[2].ID] {
+		t.Fatalf("DeleteUnscanRecordByHeight(30, \"\") should delete records of height 30 in all symbols")
+	}
+
+	if err := dai.DeleteUnscanRecordByID(records[2].ID, ""); err != nil {
+		t.Fatalf("DeleteUnscanRecordByID err: %v", err)
+	}
+	if got = allUnscanRecordIDs(t, dai); got[records[2].ID] {
+		t.Fatalf("DeleteUnscanRecordByID(id, \"\") should delete record of symbol %s", records[2].Symbol)
+	}
+}
+
+//allUnscanRecordIDs 全部symbol的未扫记录ID
+func allUnscanRecordIDs(t *testing.T, dai openwallet.BlockchainDAI) map[string]bool {
+	t.Helper()
+	list, err := dai.GetUnscanRecords("")
+	if err != nil {
+		t.Fatalf("GetUnscanRecords err: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, r := range list {
+		got[r.ID] = true
+	}
+	return got
+}
+
+func assertUnscanRecords(t *testing.T, dai openwallet.BlockchainDAI, symbol string, want ...*openwallet.UnscanRecord) {
+	t.Helper()
+	list, err := dai.GetUnscanRecords(symbol)
+	if err != nil {
+		t.Fatalf("GetUnscanRecords err: %v", err)
+	}
+	if len(list) != len(want) {
+		t.Fatalf("GetUnscanRecords returns %d records, want %d", len(list), len(want))
+	}
+	got := make(map[string]*openwallet.UnscanRecord)
+	for _, r := range list {
+		got[r.ID] = r
+	}
+	for _, w := range want {
+		r, ok := got[w.ID]
+		if !ok {
+			t.Fatalf("unscan record %s not found", w.ID)
+		}
+		if r.BlockHeight != w.BlockHeight || r.TxID != w.TxID || r.Reason != w.Reason {
+			t.Fatalf("unscan record = %+v, want %+v", r, w)
+		}
+	}
+}
@@ -177,6 +177,14 @@ type BlockScanner interface {
 	//ExtractTransactionAndReceiptData 提取交易单及交易回执数据
 	//@required
 	ExtractTransactionAndReceiptData(txid string, scanTargetFunc BlockScanTargetFuncV2) (map[string][]*TxExtractData, map[string]*SmartContractReceipt, error)
+
+	//SupportScanMemPool 支持扫描交易内存池
+	//@optional
+	SupportScanMemPool() bool
+
+	//ScanMemPool 扫描交易内存池，提取未确认的交易单，以MemPoolExtractDataNotify通知观察者
+	//@optional
+	ScanMemPool() error
 }
 
 //BlockScanNotificationObject 扫描被通知对象
@@ -197,6 +205,14 @@ type BlockScanNotificationObject interface {
 	BlockExtractSmartContractDataNotify(sourceKey string, data *SmartContractReceipt) error
 }
 
+//BlockScanMemPoolNotificationObject 内存池扫描被通知对象，观察者可选实现
+type BlockScanMemPoolNotificationObject interface {
+
+	//BlockExtractMemPoolDataNotify 内存池未确认交易提取结果通知，data.MemPool = true
+	//交易上链后，会再以BlockExtractDataNotify通知
+	BlockExtractMemPoolDataNotify(sourceKey string, data *TxExtractData) error
+}
+
 //TxExtractData 区块扫描后的交易单提取结果，每笔交易单
 type TxExtractData struct {
 
@@ -208,6 +224,9 @@ type TxExtractData struct {
 
 	//交易记录
 	Transaction *Transaction
+
+	//是否内存池中未确认的交易，0确认数据
+	MemPool bool
 }
 
 func NewBlockExtractData() *TxExtractData {
@@ -238,6 +257,7 @@ type BlockScannerBase struct {
 	isClose           bool //是否已关闭
 	WalletDAI         WalletDAI
 	BlockchainDAI     BlockchainDAI
+	scanProvider      BlockScanProvider //通用扫描引擎的链数据源
 }
 
 //NewBTCBlockScanner 创建区块链扫描器
@@ -343,7 +363,24 @@ func (bs *BlockScannerBase) RemoveObserver(obj BlockScanNotificationObject) erro
 
 //SetRescanBlockHeight 重置区块链扫描高度
 func (bs *BlockScannerBase) SetRescanBlockHeight(height uint64) error {
-	return nil
+
+	//未使用通用扫描引擎，由适配器自行实现
+	if bs.scanProvider == nil || bs.BlockchainDAI == nil {
+		return nil
+	}
+
+	if height <= 0 {
+		return fmt.Errorf("block height to rescan must greater than 0")
+	}
+
+	//以上一个区块作为扫描起点
+	header, err := bs.scanProvider.GetBlockHeaderByHeight(height - 1)
+	if err != nil {
+		return err
+	}
+	header.Symbol = bs.scanProvider.Symbol()
+
+	return bs.BlockchainDAI.SaveCurrentBlockHead(header)
 }
 
 //SetTask
@@ -497,6 +534,35 @@ func (bs *BlockScannerBase) SetBlockchainDAI(dai BlockchainDAI) error {
 	return nil
 }
 
+//SupportScanMemPool 支持扫描交易内存池
+//@optional
+func (bs *BlockScannerBase) SupportScanMemPool() bool {
+	return false
+}
+
+//ScanMemPool 扫描交易内存池
+//@optional
+func (bs *BlockScannerBase) ScanMemPool() error {
+	return fmt.Errorf("ScanMemPool is not implemented")
+}
+
+//MemPoolExtractDataNotify 推送内存池未确认交易提取结果给实现BlockScanMemPoolNotificationObject的观察者
+func (bs *BlockScannerBase) MemPoolExtractDataNotify(sourceKey string, data *TxExtractData) error {
+	if data == nil {
+		return nil
+	}
+	data.MemPool = true
+
+	bs.Mu.RLock()
+	defer bs.Mu.RUnlock()
+	for o, _ := range bs.Observers {
+		if mo, ok := o.(BlockScanMemPoolNotificationObject); ok {
+			mo.BlockExtractMemPoolDataNotify(sourceKey, data)
+		}
+	}
+	return nil
+}
+
 //NewBlockNotify 获得新区块后，发送到通知通道
 func (bs *BlockScannerBase) NewBlockNotify(block *BlockHeader) error {
 	bs.Mu.RLock()
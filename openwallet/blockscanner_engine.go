@@ -0,0 +1,214 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"fmt"
+
+	"github.com/blocktree/openwallet/v2/log"
+)
+
+// BlockScanProvider 通用扫描引擎的链数据源，由资产适配器实现。
+// 实现该接口后，适配器无需再自行处理区块分叉，
+// BlockScannerBase会比对Previousblockhash，回退到共同祖先区块，并通知观察者分叉的区块。
+type BlockScanProvider interface {
+
+	//Symbol 币种标识，用于BlockchainDAI读写区块数据
+	//@required
+	Symbol() string
+
+	//GetBlockHeaderByHeight 获取链上指定高度的区块头，高度未出块时返回ErrBlockNotFound编号的错误，
+	//其他错误（如节点无法访问）视为扫描异常
+	//@required
+	GetBlockHeaderByHeight(height uint64) (*BlockHeader, error)
+
+	//ExtractBlock 提取区块中的交易数据，并推送给观察者
+	//@required
+	ExtractBlock(header *BlockHeader) error
+}
+
+//BlockScanTipProvider 可选接口，链数据源实现后，本地没有扫描记录时从链上最新高度开始扫描，
+//否则从创世区块开始扫描
+type BlockScanTipProvider interface {
+
+	//GetGlobalMaxBlockHeight 获取链上最新高度
+	GetGlobalMaxBlockHeight() uint64
+}
+
+//SetBlockScanProvider 设置通用扫描引擎的链数据源，并以ScanBlockTask作为扫描任务
+func (bs *BlockScannerBase) SetBlockScanProvider(provider BlockScanProvider) error {
+	if provider == nil {
+		return fmt.Errorf("block scan provider is nil")
+	}
+	bs.scanProvider = provider
+	bs.SetTask(bs.ScanBlockTask)
+	return nil
+}
+
+//ScanBlockTask 通用区块扫描任务，从本地已扫高度扫描到链上最新高度，遇到分叉自动回滚
+func (bs *BlockScannerBase) ScanBlockTask() {
+
+	if bs.scanProvider == nil {
+		log.Error("block scanner has not set block scan provider")
+		return
+	}
+
+	if bs.BlockchainDAI == nil {
+		log.Error("block scanner has not set blockchain DAI")
+		return
+	}
+
+	symbol := bs.scanProvider.Symbol()
+
+	//获取本地区块高度
+	local, err := bs.BlockchainDAI.GetCurrentBlockHead(symbol)
+	if err != nil {
+		log.Errorf("block scanner can not get local block head; unexpected error: %v", err)
+		return
+	}
+
+	//本地没有扫描记录，从链上最新高度开始
+	if local.Height == 0 && len(local.Hash) == 0 {
+		if tip, ok := bs.scanProvider.(BlockScanTipProvider); ok {
+			if height := tip.GetGlobalMaxBlockHeight(); height > 0 {
+				block, err := bs.scanProvider.GetBlockHeaderByHeight(height)
+				if err != nil {
+					log.Errorf("block scanner can not get block header on height: %d; unexpected error: %v", height, err)
+					return
+				}
+				local = &BlockHeader{Hash: block.Previousblockhash, Height: height - 1, Symbol: symbol}
+			}
+		}
+	}
+
+	for {
+
+		if bs.IsClose() {
+			return
+		}
+
+		//继续扫描下一个区块
+		height := local.Height + 1
+
+		block, err := bs.scanProvider.GetBlockHeaderByHeight(height)
+		if err != nil {
+			//下一个高度未出块，视为已到最新高度
+			if ConvertError(err).Code() == ErrBlockNotFound {
+				log.Infof("block scanner has scanned full chain data. Current height: %d", local.Height)
+			} else {
+				log.Errorf("block scanner can not get block header on height: %d; unexpected error: %v", height, err)
+			}
+			return
+		}
+
+		//判断hash是否上一区块的hash
+		if local.Height > 0 && block.Previousblockhash != local.Hash {
+
+			log.Infof("block has been fork on height: %d.", height)
+			log.Infof("block height: %d local hash = %s ", local.Height, local.Hash)
+			log.Infof("block height: %d mainnet hash = %s ", local.Height, block.Previousblockhash)
+
+			ancestor, err := bs.rollbackToCommonAncestor(local)
+			if err != nil {
+				log.Errorf("block scanner can not rollback fork blocks; unexpected error: %v", err)
+				return
+			}
+
+			log.Infof("rescan block on height: %d, hash: %s .", ancestor.Height+1, ancestor.Hash)
+
+			local = ancestor
+			continue
+		}
+
+		log.Infof("block scanner scanning height: %d ...", height)
+
+		err = bs.scanProvider.ExtractBlock(block)
+		if err != nil {
+			log.Errorf("block scanner can not extract block; unexpected error: %v", err)
+			//记录未扫区块
+			unscanRecord := NewUnscanRecord(height, "", err.Error(), symbol)
+			bs.BlockchainDAI.SaveUnscanRecord(unscanRecord)
+		}
+
+		//保存本地新高度
+		block.Symbol = symbol
+		bs.BlockchainDAI.SaveLocalBlockHead(block)
+		bs.BlockchainDAI.SaveCurrentBlockHead(block)
+
+		//通知新区块给观测者，异步处理
+		bs.NewBlockNotify(block)
+
+		local = block
+	}
+}
+
+//rollbackToCommonAncestor 从本地最新区块往回找到与链上一致的共同祖先区块，
+//每个分叉的区块以Fork = true通知观察者，删除其扫描失败记录，并把共同祖先设为当前区块
+func (bs *BlockScannerBase) rollbackToCommonAncestor(local *BlockHeader) (*BlockHeader, error) {
+
+	symbol := bs.scanProvider.Symbol()
+	forks := make([]*BlockHeader, 0)
+	ancestor := &BlockHeader{Symbol: symbol}
+
+	for height := local.Height; height > 0; height-- {
+
+		chainBlock, err := bs.scanProvider.GetBlockHeaderByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+
+		var stored *BlockHeader
+		if height == local.Height {
+			stored = local
+		} else {
+			stored, err = bs.BlockchainDAI.GetLocalBlockHeadByHeight(height, symbol)
+			if err != nil {
+				//本地缓存已不存在该高度，无法再比对，以链上区块作为共同祖先
+				log.Warningf("local block of height: %d not found, take the mainnet block as common ancestor", height)
+				ancestor = chainBlock
+				break
+			}
+		}
+
+		if stored.Hash == chainBlock.Hash {
+			ancestor = stored
+			break
+		}
+
+		stored.Fork = true
+		stored.Symbol = symbol
+		forks = append(forks, stored)
+	}
+
+	for _, fork := range forks {
+		log.Infof("delete block data on fork height: %d, hash: %s.", fork.Height, fork.Hash)
+
+		//删除分叉区块的未扫记录
+		bs.BlockchainDAI.DeleteUnscanRecordByHeight(fork.Height, symbol)
+
+		//通知观测者分叉区块，由观测者删除该高度的数据
+		bs.NewBlockNotify(fork)
+	}
+
+	//重新记录一个新扫描起点
+	ancestor.Symbol = symbol
+	err := bs.BlockchainDAI.SaveCurrentBlockHead(ancestor)
+	if err != nil {
+		return nil, err
+	}
+
+	return ancestor, nil
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2018 The OpenWallet Authors
+ * This file is part of the OpenWallet library.
+ *
+ * The OpenWallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The OpenWallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+//testChain 模拟链数据源
+type testChain struct {
+	mu        sync.Mutex
+	blocks    []*BlockHeader //下标即高度，0为创世区块
+	extracted []string
+}
+
+func newTestChain(height uint64, branch string) *testChain {
+	chain := &testChain{}
+	chain.blocks = append(chain.blocks, &BlockHeader{Hash: "genesis"})
+	chain.grow(height, branch)
+	return chain
+}
+
+//grow 在链尾增加区块
+func (c *testChain) grow(height uint64, branch string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for h := uint64(len(c.blocks)); h <= height; h++ {
+		c.blocks = append(c.blocks, &BlockHeader{
+			Hash:              fmt.Sprintf("%s_%d", branch, h),
+			Previousblockhash: c.blocks[h-1].Hash,
+			Height:            h,
+		})
+	}
+}
+
+//reorg 从指定高度开始替换为新分支
+func (c *testChain) reorg(from, height uint64, branch string) {
+	c.mu.Lock()
+	c.blocks = c.blocks[:from]
+	c.mu.Unlock()
+	c.grow(height, branch)
+}
+
+func (c *testChain) Symbol() string {
+	return "TEST"
+}
+
+func (c *testChain) GetBlockHeaderByHeight(height uint64) (*BlockHeader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height >= uint64(len(c.blocks)) {
+		return nil, Errorf(ErrBlockNotFound, "block height %d not found", height)
+	}
+	header := *c.blocks[height]
+	return &header, nil
+}
+
+func (c *testChain) ExtractBlock(header *BlockHeader) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.extracted = append(c.extracted, header.Hash)
+	return nil
+}
+
+//testScanObserver 记录区块通知
+type testScanObserver struct {
+	headers chan *BlockHeader
+}
+
+func (o *testScanObserver) BlockScanNotify(header *BlockHeader) error {
+	o.headers <- header
+	return nil
+}
+
+func (o *testScanObserver) BlockExtractDataNotify(sourceKey string, data *TxExtractData) error {
+	return nil
+}
+
+func (o *testScanObserver) BlockExtractSmartContractDataNotify(sourceKey string, data *SmartContractReceipt) error {
+	return nil
+}
+
+func (o *testScanObserver) next(t *testing.T) *BlockHeader {
+	t.Helper()
+	select {
+	case h := <-o.headers:
+		return h
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait block notify timeout")
+	}
+	return nil
+}
+
+func TestBlockScannerBase_ScanBlockTaskReorg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockscanner")
+	if err != nil {
+		t.Fatalf("TempDir err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dai, err := NewBlockchainLocal(filepath.Join(dir, "blockchain.db"), true)
+	if err != nil {
+		t.Fatalf("NewBlockchainLocal err: %v", err)
+	}
+
+	chain := newTestChain(5, "a")
+	observer := &testScanObserver{headers: make(chan *BlockHeader, 100)}
+
+	bs := NewBlockScannerBase()
+	bs.SetBlockchainDAI(dai)
+	bs.SetBlockScanProvider(chain)
+	bs.AddObserver(observer)
+
+	bs.ScanBlockTask()
+	for h := uint64(1); h <= 5; h++ {
+		header := observer.next(t)
+		if header.Height != h || header.Fork {
+			t.Fatalf("notify header = %+v, want height %d", header, h)
+		}
+	}
+
+	//高度3开始分叉，新链高到7
+	chain.reorg(3, 7, "b")
+	dai.SaveUnscanRecord(NewUnscanRecord(4, "", "rpc call error", "TEST"))
+
+	bs.ScanBlockTask()
+
+	//先倒序通知分叉的区块
+	for _, h := range []uint64{5, 4, 3} {
+		header := observer.next(t)
+		if header.Height != h || !header.Fork || header.Hash != fmt.Sprintf("a_%d", h) {
+			t.Fatalf("notify fork header = %+v, want fork height %d", header, h)
+		}
+	}
+	//再通知新分支的区块
+	for h := uint64(3); h <= 7; h++ {
+		header := observer.next(t)
+		if header.Height != h || header.Fork || header.Hash != fmt.Sprintf("b_%d", h) {
+			t.Fatalf("notify header = %+v, want height %d on new branch", header, h)
+		}
+	}
+
+	current, err := dai.GetCurrentBlockHead("TEST")
+	if err != nil {
+		t.Fatalf("GetCurrentBlockHead err: %v", err)
+	}
+	if current.Height != 7 || current.Hash != "b_7" {
+		t.Fatalf("current block head = %+v, want b_7", current)
+	}
+
+	records, _ := dai.GetUnscanRecords("TEST")
+	if len(records) != 0 {
+		t.Fatalf("unscan records of fork height should be deleted, got %d", len(records))
+	}
+}
+
+//testTipChain 提供链上最新高度的数据源
+type testTipChain struct {
+	*testChain
+}
+
+func (c *testTipChain) GetGlobalMaxBlockHeight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return uint64(len(c.blocks) - 1)
+}
+
+func TestBlockScannerBase_ScanBlockTaskFromTip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockscanner")
+	if err != nil {
+		t.Fatalf("TempDir err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dai, err := NewBlockchainLocal(filepath.Join(dir, "blockchain.db"), true)
+	if err != nil {
+		t.Fatalf("NewBlockchainLocal err: %v", err)
+	}
+
+	chain := &testTipChain{newTestChain(10, "a")}
+	bs := NewBlockScannerBase()
+	bs.SetBlockchainDAI(dai)
+	bs.SetBlockScanProvider(chain)
+
+	//本地没有扫描记录，只扫描最新区块
+	bs.ScanBlockTask()
+	if len(chain.extracted) != 1 || chain.extracted[0] != "a_10" {
+		t.Fatalf("extracted blocks = %v, want a_10", chain.extracted)
+	}
+
+	chain.grow(12, "a")
+	bs.ScanBlockTask()
+	if len(chain.extracted) != 3 || chain.extracted[2] != "a_12" {
+		t.Fatalf("extracted blocks = %v, want a_10 to a_12", chain.extracted)
+	}
+}
+
+func TestBlockScannerBase_SetRescanBlockHeight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockscanner")
+	if err != nil {
+		t.Fatalf("TempDir err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dai, err := NewBlockchainLocal(filepath.Join(dir, "blockchain.db"), true)
+	if err != nil {
+		t.Fatalf("NewBlockchainLocal err: %v", err)
+	}
+
+	chain := newTestChain(10, "a")
+	bs := NewBlockScannerBase()
+	bs.SetBlockchainDAI(dai)
+	bs.SetBlockScanProvider(chain)
+
+	if err = bs.SetRescanBlockHeight(8); err != nil {
+		t.Fatalf("SetRescanBlockHeight err: %v", err)
+	}
+	bs.ScanBlockTask()
+
+	if len(chain.extracted) != 3 || chain.extracted[0] != "a_8" {
+		t.Fatalf("extracted blocks = %v, want a_8 to a_10", chain.extracted)
+	}
+}
@@ -15,7 +15,10 @@
 
 package openwallet
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // CacheEntry Cache Entry
 type CacheEntry struct {
@@ -33,3 +36,44 @@ type ICacheManager interface {
 	Contains(key string) bool
 	Clear()
 }
+
+//expired 条目是否已过期，Expiration为过期时间的UnixNano，0表示永不过期
+func (entry *CacheEntry) expired(now time.Time) bool {
+	return entry.Expiration > 0 && now.UnixNano() > entry.Expiration
+}
+
+//cacheExpiration 计算过期时间，duration <= 0 使用默认有效期
+func cacheExpiration(duration, defaultExpiration time.Duration) int64 {
+	if duration <= 0 {
+		duration = defaultExpiration
+	}
+	if duration <= 0 {
+		return 0
+	}
+	return time.Now().Add(duration).UnixNano()
+}
+
+//GetCacheObject 获取缓存值并解析到obj，兼容内存缓存与持久化缓存。
+//值以json转换，调用方修改obj不会影响缓存中的数据。
+func GetCacheObject(cache ICacheManager, key string, obj interface{}) bool {
+	value, ok := cache.Get(key)
+	if !ok {
+		return false
+	}
+	raw, isRaw := value.(json.RawMessage)
+	if !isRaw {
+		var err error
+		raw, err = json.Marshal(value)
+		if err != nil {
+			return false
+		}
+	}
+	return json.Unmarshal(raw, obj) == nil
+}
+
+//CachePolicy 资产适配器的缓存策略，有效期 <= 0 表示不缓存该类数据
+type CachePolicy struct {
+	FeeRateExpiration time.Duration `json:"feeRateExpiration"` //推荐手续费费率
+	BalanceExpiration time.Duration `json:"balanceExpiration"` //地址余额
+	ABIExpiration     time.Duration `json:"abiExpiration"`     //合约ABI
+}
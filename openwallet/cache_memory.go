@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+//MemoryCache 线程安全的内存缓存，条目按TTL过期，超出容量时淘汰最久未使用的条目
+type MemoryCache struct {
+	mu                sync.Mutex
+	capacity          int
+	defaultExpiration time.Duration
+	items             map[string]*list.Element
+	lru               *list.List //队头为最近使用
+}
+
+//NewMemoryCache 创建内存缓存
+//@param capacity 最大条目数，<= 0 不限制
+//@param defaultExpiration Add的duration <= 0时使用的默认有效期，<= 0 永不过期
+func NewMemoryCache(capacity int, defaultExpiration time.Duration) *MemoryCache {
+	return &MemoryCache{
+		capacity:          capacity,
+		defaultExpiration: defaultExpiration,
+		items:             make(map[string]*list.Element),
+		lru:               list.New(),
+	}
+}
+
+//Add 添加缓存，已存在的key会被覆盖
+func (c *MemoryCache) Add(key string, value interface{}, duration time.Duration) error {
+	entry := &CacheEntry{
+		Key:        key,
+		Value:      value,
+		Expiration: cacheExpiration(duration, c.defaultExpiration),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+
+	c.items[key] = c.lru.PushFront(entry)
+
+	if c.capacity > 0 {
+		for c.lru.Len() > c.capacity {
+			c.removeElement(c.lru.Back())
+		}
+	}
+	return nil
+}
+
+//Get 获取缓存值
+func (c *MemoryCache) Get(key string) (interface{}, bool) {
+	entry, ok := c.GetCacheEntry(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+//GetCacheEntry 获取缓存条目，过期的条目会被删除
+func (c *MemoryCache) GetCacheEntry(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*CacheEntry)
+	if entry.expired(time.Now()) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+//Remove 删除缓存，返回被删除的值
+func (c *MemoryCache) Remove(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := c.removeElement(elem)
+	if entry.expired(time.Now()) {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+//Contains 是否存在未过期的缓存
+func (c *MemoryCache) Contains(key string) bool {
+	_, ok := c.GetCacheEntry(key)
+	return ok
+}
+
+//Clear 清空缓存
+func (c *MemoryCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+//Len 当前条目数，包括未清理的过期条目
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+//DeleteExpired 清理所有过期条目
+func (c *MemoryCache) DeleteExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*CacheEntry).expired(now) {
+			c.removeElement(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *MemoryCache) removeElement(elem *list.Element) *CacheEntry {
+	entry := c.lru.Remove(elem).(*CacheEntry)
+	delete(c.items, entry.Key)
+	return entry
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/asdine/storm"
+)
+
+const (
+	stormCacheBucket = "cache"
+)
+
+//stormCacheEntry 持久化的缓存条目，值以json保存
+type stormCacheEntry struct {
+	Key        string          `storm:"id"`
+	Value      json.RawMessage `json:"value"`
+	Expiration int64           `json:"expiration"`
+}
+
+//StormCache 基于storm的持久化缓存，进程重启后缓存仍然有效。
+//值以json序列化保存，Get返回json.RawMessage，可通过GetCacheObject解析为具体类型。
+type StormCache struct {
+	root              *storm.DB
+	db                storm.Node
+	defaultExpiration time.Duration
+}
+
+//NewStormCache 创建持久化缓存
+//@param dbFile 数据库文件路径
+//@param defaultExpiration Add的duration <= 0时使用的默认有效期，<= 0 永不过期
+func NewStormCache(dbFile string, defaultExpiration time.Duration) (*StormCache, error) {
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	return &StormCache{
+		root:              db,
+		db:                db.From(stormCacheBucket),
+		defaultExpiration: defaultExpiration,
+	}, nil
+}
+
+//Close 关闭数据库
+func (c *StormCache) Close() error {
+	return c.root.Close()
+}
+
+//Add 添加缓存，已存在的key会被覆盖
+func (c *StormCache) Add(key string, value interface{}, duration time.Duration) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	entry := &stormCacheEntry{
+		Key:        key,
+		Value:      raw,
+		Expiration: cacheExpiration(duration, c.defaultExpiration),
+	}
+	return c.db.Save(entry)
+}
+
+//Get 获取缓存值，类型为json.RawMessage
+func (c *StormCache) Get(key string) (interface{}, bool) {
+	entry, ok := c.GetCacheEntry(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+//GetCacheEntry 获取缓存条目，过期的条目会被删除
+func (c *StormCache) GetCacheEntry(key string) (*CacheEntry, bool) {
+	var entry stormCacheEntry
+	err := c.db.One("Key", key, &entry)
+	if err != nil {
+		return nil, false
+	}
+	cacheEntry := &CacheEntry{
+		Key:        entry.Key,
+		Value:      entry.Value,
+		Expiration: entry.Expiration,
+	}
+	if cacheEntry.expired(time.Now()) {
+		c.db.DeleteStruct(&entry)
+		return nil, false
+	}
+	return cacheEntry, true
+}
+
+//Remove 删除缓存，返回被删除的值
+func (c *StormCache) Remove(key string) (interface{}, bool) {
+	entry, ok := c.GetCacheEntry(key)
+	if !ok {
+		return nil, false
+	}
+	err := c.db.DeleteStruct(&stormCacheEntry{Key: key})
+	if err != nil {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+//Contains 是否存在未过期的缓存
+func (c *StormCache) Contains(key string) bool {
+	_, ok := c.GetCacheEntry(key)
+	return ok
+}
+
+//Clear 清空缓存
+func (c *StormCache) Clear() {
+	c.db.Drop(&stormCacheEntry{})
+}
+
+//DeleteExpired 清理所有过期条目
+func (c *StormCache) DeleteExpired() error {
+	var entries []*stormCacheEntry
+	err := c.db.All(&entries)
+	if err != nil {
+		return err
+	}
+	tx, err := c.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, entry := range entries {
+		if (&CacheEntry{Expiration: entry.Expiration}).expired(now) {
+			if err = tx.DeleteStruct(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
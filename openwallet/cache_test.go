@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testCacheManager(t *testing.T, cache ICacheManager) {
+	balance := &Balance{Symbol: "BTC", Address: "addr1", Balance: "1.5"}
+
+	if err := cache.Add("balance", balance, 0); err != nil {
+		t.Fatalf("Add err: %v", err)
+	}
+	cache.Add("short", "value", 50*time.Millisecond)
+
+	var got Balance
+	if !GetCacheObject(cache, "balance", &got) || got.Balance != "1.5" || got.Address != "addr1" {
+		t.Fatalf("GetCacheObject = %+v", got)
+	}
+	if !cache.Contains("short") {
+		t.Fatalf("short should be cached")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if cache.Contains("short") {
+		t.Fatalf("short should be expired")
+	}
+	if _, ok := cache.GetCacheEntry("short"); ok {
+		t.Fatalf("expired entry should not be returned")
+	}
+
+	if _, ok := cache.Remove("balance"); !ok {
+		t.Fatalf("Remove should return the removed value")
+	}
+	if cache.Contains("balance") {
+		t.Fatalf("balance should be removed")
+	}
+
+	cache.Add("a", 1, 0)
+	cache.Add("b", 2, 0)
+	cache.Clear()
+	if cache.Contains("a") || cache.Contains("b") {
+		t.Fatalf("cache should be cleared")
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	testCacheManager(t, NewMemoryCache(0, 0))
+}
+
+func TestMemoryCache_LRU(t *testing.T) {
+	cache := NewMemoryCache(3, 0)
+	for i := 1; i <= 3; i++ {
+		cache.Add(fmt.Sprintf("k%d", i), i, 0)
+	}
+	//访问k1，k2成为最久未使用
+	cache.Get("k1")
+	cache.Add("k4", 4, 0)
+
+	if cache.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", cache.Len())
+	}
+	if cache.Contains("k2") {
+		t.Fatalf("k2 should be evicted")
+	}
+	for _, k := range []string{"k1", "k3", "k4"} {
+		if !cache.Contains(k) {
+			t.Fatalf("%s should be kept", k)
+		}
+	}
+}
+
+func TestMemoryCache_Concurrent(t *testing.T) {
+	cache := NewMemoryCache(100, time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("k%d", (n*j)%200)
+				cache.Add(key, j, 0)
+				cache.Get(key)
+				if j%10 == 0 {
+					cache.Remove(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if cache.Len() > 100 {
+		t.Fatalf("Len = %d, exceed capacity", cache.Len())
+	}
+}
+
+func TestStormCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storm-cache")
+	if err != nil {
+		t.Fatalf("TempDir err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "cache.db")
+
+	cache, err := NewStormCache(dbFile, 0)
+	if err != nil {
+		t.Fatalf("NewStormCache err: %v", err)
+	}
+	testCacheManager(t, cache)
+
+	//重新打开，缓存仍然有效
+	cache.Add("abi", &ABIInfo{Address: "0x1", ABI: "[]"}, time.Minute)
+	cache.Add("expired", "value", time.Millisecond)
+	cache.Close()
+
+	cache, err = NewStormCache(dbFile, 0)
+	if err != nil {
+		t.Fatalf("NewStormCache err: %v", err)
+	}
+	defer cache.Close()
+
+	var abi ABIInfo
+	if !GetCacheObject(cache, "abi", &abi) || abi.Address != "0x1" {
+		t.Fatalf("GetCacheObject after reopen = %+v", abi)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err = cache.DeleteExpired(); err != nil {
+		t.Fatalf("DeleteExpired err: %v", err)
+	}
+	var entries []*stormCacheEntry
+	cache.db.All(&entries)
+	if len(entries) != 1 {
+		t.Fatalf("%d entries after DeleteExpired, want 1", len(entries))
+	}
+}
@@ -37,3 +37,16 @@ func TestConvertError(t *testing.T) {
 	jerr2, _ := json.Marshal(owerr2)
 	log.Infof("jerr2: %v", string(jerr2))
 }
+
+func TestError_JSON(t *testing.T) {
+	err := Errorf(ErrAccountNotFound, "can not find account: %s", "a1")
+	data, _ := json.Marshal(err)
+
+	var got Error
+	if e := json.Unmarshal(data, &got); e != nil {
+		t.Fatalf("json.Unmarshal err: %v", e)
+	}
+	if got.Code() != ErrAccountNotFound || got.Message() != "can not find account: a1" {
+		t.Fatalf("unmarshal error = %v", &got)
+	}
+}
@@ -40,6 +40,10 @@ const (
 	ErrAdressDecodeFailed = 3006 //地址解码失败
 	ErrNonceInvaild       = 3007 //Nonce不正确
 	ErrAccountNotAddress  = 3008 //账户没有地址
+	ErrWalletNotFound     = 3009 //钱包不存在
+	ErrWalletLocked       = 3010 //钱包未解锁
+	ErrAccountExist       = 3011 //账户已存在
+	ErrWalletExist        = 3012 //钱包已存在
 
 	/* 网络类型 */
 	ErrCallFullNodeAPIFailed = 4001 //全节点API无法访问
@@ -50,11 +54,26 @@ const (
 	ErrCreateRawSmartContractTransactionFailed = 5002 //创建原始合约交易单失败
 	ErrSubmitRawSmartContractTransactionFailed = 5003 //广播原始合约交易单失败
 
+	/* 区块类 */
+	ErrBlockNotFound = 6001 //区块不存在
+
 	/* 其他 */
 	ErrUnknownException = 9001 //未知异常情况
 	ErrSystemException  = 9002 //系统程序异常情况
+	ErrAssetsNotSupport = 9003 //不支持的资产或功能
+	ErrInvalidParameter = 9004 //请求参数无效
 )
 
+//ErrorCoder 带错误编号的错误，*Error实现了该接口，
+//远程调用的错误（例如owtp.Response.Err()）也可以通过该接口还原为*Error
+type ErrorCoder interface {
+	error
+	//Code 错误编号
+	Code() uint64
+	//Message 不含错误编号的错误信息
+	Message() string
+}
+
 type Error struct {
 	code uint64
 	err  string
@@ -70,6 +89,11 @@ func (err *Error) Code() uint64 {
 	return err.code
 }
 
+// Message 不含错误编号的错误信息
+func (err *Error) Message() string {
+	return err.err
+}
+
 //ConvertError error转OWError
 func ConvertError(err error) *Error {
 
@@ -77,11 +101,15 @@ func ConvertError(err error) *Error {
 		return nil
 	}
 
-	owErr, ok := err.(*Error)
-	if !ok {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case ErrorCoder:
+		//保留远程错误的编号
+		return &Error{code: e.Code(), err: e.Message()}
+	default:
 		return &Error{code: ErrUnknownException, err: err.Error()}
 	}
-	return owErr
 }
 
 //Errorf 生成OWError
@@ -112,14 +140,17 @@ func (err *Error) MarshalJSON() ([]byte, error) {
 }
 
 func (err *Error) UnmarshalJSON(b []byte) error {
-	var obj map[string]interface{}
+	var obj struct {
+		Code uint64 `json:"code"`
+		Msg  string `json:"msg"`
+	}
 	e := json.Unmarshal(b, &obj)
 	if e != nil {
 		return e
 	}
 
-	err.err = obj["msg"].(string)
-	err.code = obj["code"].(uint64)
+	err.err = obj.Msg
+	err.code = obj.Code
 
 	return nil
 }
@@ -0,0 +1,254 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/blocktree/go-owcdrivers/owkeychain"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/common"
+)
+
+//OwnerKey 账户拥有者，多签账户的每个公钥为一个拥有者
+type OwnerKey struct {
+	AccountID string `json:"accountID"` //拥有者账户ID，由公钥计算
+	PublicKey string `json:"publicKey"` //拥有者账户公钥，OW编码
+}
+
+//IsMultiSig 是否多签账户
+func (a *AssetsAccount) IsMultiSig() bool {
+	return len(a.OwnerKeys) > 1
+}
+
+//GetOwnerKey 获取拥有者，accountID不是账户拥有者返回nil
+func (a *AssetsAccount) GetOwnerKey(accountID string) *OwnerKey {
+	for _, owner := range a.GetOwners() {
+		if key := owner.(*OwnerKey); key.AccountID == accountID {
+			return key
+		}
+	}
+	return nil
+}
+
+//IsCompleteSigned 多签账户是否已有足够的拥有者完成签名，非多签账户按适配器的IsCompleted判断
+func (rawtx *RawTransaction) IsCompleteSigned() bool {
+	if rawtx.Account == nil || !rawtx.Account.IsMultiSig() {
+		return rawtx.IsCompleted
+	}
+	return rawtx.CheckSignatures() == nil
+}
+
+//SignedOwners 已提供有效签名的拥有者账户ID
+func (rawtx *RawTransaction) SignedOwners() []string {
+	signed, _ := rawtx.signatureStatus()
+	return signed
+}
+
+//MissingSigners 未签名或签名无效的拥有者账户ID
+func (rawtx *RawTransaction) MissingSigners() []string {
+	_, missing := rawtx.signatureStatus()
+	return missing
+}
+
+//CheckSignatures 检查多签交易单的签名，有效签名的拥有者达到Required时IsCompleted = true，
+//否则IsCompleted = false，并返回缺少签名的拥有者
+func (rawtx *RawTransaction) CheckSignatures() error {
+	if rawtx.Account == nil {
+		return Errorf(ErrSignRawTransactionFailed, "transaction account is nil")
+	}
+
+	required := rawtx.Required
+	if required == 0 {
+		required = rawtx.Account.Required
+	}
+	if required == 0 {
+		required = 1
+	}
+
+	signed, missing := rawtx.signatureStatus()
+	if uint64(len(signed)) >= required {
+		rawtx.IsCompleted = true
+		return nil
+	}
+
+	rawtx.IsCompleted = false
+	return Errorf(ErrSignRawTransactionFailed, "transaction requires %d signatures, has %d, missing signers: %v",
+		required, len(signed), missing)
+}
+
+//MergeSignatures 合并其他拥有者签名后导出的交易单。
+//交易单必须是同一个原始交易，每个拥有者的待签消息必须与本交易单保存的完全一致，
+//只合并签名值，签名逐个拥有者验证，无效签名不会被合并。
+func (rawtx *RawTransaction) MergeSignatures(other *RawTransaction) error {
+	if other == nil {
+		return Errorf(ErrSignRawTransactionFailed, "merged transaction is nil")
+	}
+	if rawtx.Account == nil {
+		return Errorf(ErrSignRawTransactionFailed, "transaction account is nil")
+	}
+	if rawtx.RawHex != other.RawHex {
+		return Errorf(ErrSignRawTransactionFailed, "merged transaction is not the same raw transaction")
+	}
+
+	if rawtx.Signatures == nil {
+		rawtx.Signatures = make(map[string][]*KeySignature)
+	}
+
+	for accountID, sigs := range other.Signatures {
+		owner := rawtx.Account.GetOwnerKey(accountID)
+		if owner == nil {
+			return Errorf(ErrSignRawTransactionFailed, "signer: %s is not the owner of account: %s", accountID, rawtx.Account.AccountID)
+		}
+		if !isKeySignaturesSigned(sigs) {
+			continue
+		}
+		merged, err := mergeKeySignatures(rawtx.Signatures[accountID], sigs)
+		if err != nil {
+			return Errorf(ErrSignRawTransactionFailed, "signer: %s %v", accountID, err)
+		}
+		if err := owner.VerifyKeySignatures(merged); err != nil {
+			return err
+		}
+		rawtx.Signatures[accountID] = merged
+	}
+
+	rawtx.CheckSignatures()
+	return nil
+}
+
+//signatureStatus 按拥有者统计签名状态
+func (rawtx *RawTransaction) signatureStatus() (signed []string, missing []string) {
+	signed = make([]string, 0)
+	missing = make([]string, 0)
+	if rawtx.Account == nil {
+		return
+	}
+	for _, owner := range rawtx.Account.GetOwners() {
+		key := owner.(*OwnerKey)
+		sigs := rawtx.Signatures[key.AccountID]
+		if isKeySignaturesSigned(sigs) && key.VerifyKeySignatures(sigs) == nil {
+			signed = append(signed, key.AccountID)
+		} else {
+			missing = append(missing, key.AccountID)
+		}
+	}
+	sort.Strings(signed)
+	sort.Strings(missing)
+	return
+}
+
+//mergeKeySignatures 把签名值合并到本交易单保存的待签消息，返回合并后的副本。
+//数量、消息、地址、HDPath和曲线类型必须与保存的一致，防止拥有者替换被签消息
+func mergeKeySignatures(stored, sigs []*KeySignature) ([]*KeySignature, error) {
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("has no signature to be merged")
+	}
+	if len(stored) != len(sigs) {
+		return nil, fmt.Errorf("signatures count: %d is not equal to %d", len(sigs), len(stored))
+	}
+
+	merged := make([]*KeySignature, len(stored))
+	for i, ks := range stored {
+		other := sigs[i]
+		if ks == nil || ks.Address == nil || other.Address == nil ||
+			ks.Message != other.Message || ks.EccType != other.EccType ||
+			ks.Address.Address != other.Address.Address || ks.Address.HDPath != other.Address.HDPath {
+			return nil, fmt.Errorf("signature #%d is not the same message", i)
+		}
+		copied := *ks
+		copied.Signature = other.Signature
+		merged[i] = &copied
+	}
+	return merged, nil
+}
+
+//isKeySignaturesSigned 所有签名是否已填写
+func isKeySignaturesSigned(sigs []*KeySignature) bool {
+	if len(sigs) == 0 {
+		return false
+	}
+	for _, ks := range sigs {
+		if ks == nil || len(ks.Signature) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//VerifyKeySignatures 用拥有者公钥验证签名，签名地址的公钥由拥有者公钥按地址索引衍生
+func (owner *OwnerKey) VerifyKeySignatures(sigs []*KeySignature) error {
+
+	if len(sigs) == 0 {
+		return Errorf(ErrSignRawTransactionFailed, "owner: %s has no signature", owner.AccountID)
+	}
+
+	ownerPub, err := owkeychain.OWDecode(owner.PublicKey)
+	if err != nil {
+		return Errorf(ErrSignRawTransactionFailed, "owner: %s public key is invalid", owner.AccountID)
+	}
+
+	for _, ks := range sigs {
+		if ks == nil || ks.Address == nil {
+			return Errorf(ErrSignRawTransactionFailed, "owner: %s signature has no address", owner.AccountID)
+		}
+
+		changeKey, err := ownerPub.GenPublicChild(uint32(common.BoolToUInt(ks.Address.IsChange)))
+		if err != nil {
+			return Errorf(ErrSignRawTransactionFailed, "owner: %s derive public key failed", owner.AccountID)
+		}
+		childKey, err := changeKey.GenPublicChild(uint32(ks.Address.Index))
+		if err != nil {
+			return Errorf(ErrSignRawTransactionFailed, "owner: %s derive public key failed", owner.AccountID)
+		}
+
+		if err = verifyKeySignature(childKey.GetPublicKeyBytes(), ks); err != nil {
+			return Errorf(ErrSignRawTransactionFailed, "owner: %s signature of address: %s is invalid, %v",
+				owner.AccountID, ks.Address.Address, err)
+		}
+	}
+	return nil
+}
+
+//verifyKeySignature 验证签名
+func verifyKeySignature(pubkey []byte, ks *KeySignature) error {
+	msg, err := hex.DecodeString(ks.Message)
+	if err != nil {
+		return fmt.Errorf("message is not hex")
+	}
+	sig, err := hex.DecodeString(ks.Signature)
+	if err != nil {
+		return fmt.Errorf("signature is not hex")
+	}
+	if ks.RSV && len(sig) > 0 {
+		sig = sig[:len(sig)-1]
+	}
+
+	//ecdsa类曲线需要未压缩的公钥，去掉04前缀
+	if len(pubkey) == 33 && ks.EccType != owcrypt.ECC_CURVE_ED25519 && ks.EccType != owcrypt.ECC_CURVE_ED25519_NORMAL {
+		pubkey = owcrypt.PointDecompress(pubkey, ks.EccType)
+	}
+	if len(pubkey) == 65 {
+		pubkey = pubkey[1:]
+	}
+
+	if owcrypt.Verify(pubkey, nil, msg, sig, ks.EccType) != owcrypt.SUCCESS {
+		return fmt.Errorf("verify failed")
+	}
+	return nil
+}
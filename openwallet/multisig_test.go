@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/blocktree/go-owcdrivers/owkeychain"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/crypto"
+)
+
+type testOwner struct {
+	root *owkeychain.ExtendedKey
+	pub  string
+	id   string
+}
+
+func newTestOwner(t *testing.T, seed string) *testOwner {
+	root, err := owkeychain.InitRootKeyFromSeed(crypto.SHA256([]byte(seed)), owcrypt.ECC_CURVE_SECP256K1)
+	if err != nil {
+		t.Fatalf("InitRootKeyFromSeed err: %v", err)
+	}
+	pub := root.GetPublicKey().OWEncode()
+	return &testOwner{root: root, pub: pub, id: GenAccountID(pub)}
+}
+
+//sign 拥有者签名交易单中属于自己的签名
+func (o *testOwner) sign(t *testing.T, rawTx *RawTransaction) {
+	for _, ks := range rawTx.Signatures[o.id] {
+		change, _ := o.root.GenPrivateChild(0)
+		child, _ := change.GenPrivateChild(uint32(ks.Address.Index))
+		prikey, _ := child.GetPrivateKeyBytes()
+		msg, _ := hex.DecodeString(ks.Message)
+		sig, _, ret := owcrypt.Signature(prikey, nil, msg, ks.EccType)
+		if ret != owcrypt.SUCCESS {
+			t.Fatalf("owcrypt.Signature failed")
+		}
+		ks.Signature = hex.EncodeToString(sig)
+	}
+}
+
+//exportTx 模拟交易单导出到其他钱包
+func exportTx(t *testing.T, rawTx *RawTransaction) *RawTransaction {
+	data, err := json.Marshal(rawTx)
+	if err != nil {
+		t.Fatalf("json.Marshal err: %v", err)
+	}
+	var tx RawTransaction
+	if err = json.Unmarshal(data, &tx); err != nil {
+		t.Fatalf("json.Unmarshal err: %v", err)
+	}
+	return &tx
+}
+
+func newTestMultiSigTx(owners ...*testOwner) *RawTransaction {
+	account := &AssetsAccount{
+		Symbol:    "BTC",
+		PublicKey: owners[0].pub,
+		Required:  2,
+	}
+	for _, o := range owners {
+		account.OwnerKeys = append(account.OwnerKeys, o.pub)
+	}
+	account.AccountID = account.GetAccountID()
+
+	rawTx := &RawTransaction{
+		Account:    account,
+		RawHex:     "0100000001abcdef",
+		Required:   2,
+		Signatures: make(map[string][]*KeySignature),
+	}
+	msg := hex.EncodeToString(crypto.SHA256([]byte("input0")))
+	for _, o := range owners {
+		rawTx.Signatures[o.id] = []*KeySignature{{
+			EccType: owcrypt.ECC_CURVE_SECP256K1,
+			Address: &Address{Address: "multisig_address", Index: 3},
+			Message: msg,
+		}}
+	}
+	return rawTx
+}
+
+func TestNewMultiSigAccount(t *testing.T) {
+	a, b := newTestOwner(t, "a"), newTestOwner(t, "b")
+	creator := &AssetsAccount{WalletID: "wa", AccountID: a.id, Symbol: "BTC", PublicKey: a.pub}
+	accounts := []*AssetsAccount{creator, {WalletID: "wb", AccountID: b.id, Symbol: "BTC", PublicKey: b.pub}}
+
+	account, err := NewMultiSigAccount(accounts, 2, creator)
+	if err != nil {
+		t.Fatalf("NewMultiSigAccount err: %v", err)
+	}
+	if !account.IsMultiSig() || account.Required != 2 || account.AccountID != a.id {
+		t.Fatalf("account = %+v", account)
+	}
+	owners := account.GetOwners()
+	if len(owners) != 2 || owners[1].(*OwnerKey).AccountID != b.id {
+		t.Fatalf("owners = %+v", owners)
+	}
+
+	if _, err = NewMultiSigAccount(accounts, 3, creator); err == nil {
+		t.Fatalf("required exceeds owners should return error")
+	}
+
+	//没有签名不能通过验证
+	if err = owners[0].(*OwnerKey).VerifyKeySignatures(nil); err == nil {
+		t.Fatalf("empty signatures should not be verified")
+	}
+}
+
+func TestRawTransaction_MergeSignatures(t *testing.T) {
+	a, b, c := newTestOwner(t, "a"), newTestOwner(t, "b"), newTestOwner(t, "c")
+	outsider := newTestOwner(t, "outsider")
+
+	//创建者签名
+	rawTx := newTestMultiSigTx(a, b, c)
+	a.sign(t, rawTx)
+
+	err := rawTx.CheckSignatures()
+	if err == nil || rawTx.IsCompleted {
+		t.Fatalf("transaction should not be completed with 1 signature")
+	}
+	if !strings.Contains(err.Error(), b.id) || !strings.Contains(err.Error(), c.id) {
+		t.Fatalf("error should list missing signers: %v", err)
+	}
+
+	//b在其他钱包签名，但签名被篡改
+	txB := exportTx(t, rawTx)
+	b.sign(t, txB)
+	txB.Signatures[b.id][0].Message = hex.EncodeToString(crypto.SHA256([]byte("forged")))
+	if err = rawTx.MergeSignatures(txB); err == nil {
+		t.Fatalf("merge invalid signature should return error")
+	}
+
+	//b签名了另一个有效的消息，不能替换创建者保存的待签消息
+	txForged := exportTx(t, rawTx)
+	txForged.Signatures[b.id][0].Message = hex.EncodeToString(crypto.SHA256([]byte("forged")))
+	b.sign(t, txForged)
+	if err = txForged.Account.GetOwnerKey(b.id).VerifyKeySignatures(txForged.Signatures[b.id]); err != nil {
+		t.Fatalf("forged signature should be valid by itself: %v", err)
+	}
+	if err = rawTx.MergeSignatures(txForged); err == nil {
+		t.Fatalf("merge signature of different message should return error")
+	}
+
+	//签名数量不同
+	txMore := exportTx(t, rawTx)
+	b.sign(t, txMore)
+	txMore.Signatures[b.id] = append(txMore.Signatures[b.id], txMore.Signatures[b.id][0])
+	if err = rawTx.MergeSignatures(txMore); err == nil {
+		t.Fatalf("merge different signatures count should return error")
+	}
+
+	//非拥有者签名
+	txX := exportTx(t, rawTx)
+	txX.Signatures[outsider.id] = txX.Signatures[b.id]
+	if err = rawTx.MergeSignatures(txX); err == nil {
+		t.Fatalf("merge signature of outsider should return error")
+	}
+
+	//不同的原始交易
+	txOther := exportTx(t, rawTx)
+	txOther.RawHex = "0200"
+	if err = rawTx.MergeSignatures(txOther); err == nil {
+		t.Fatalf("merge different raw transaction should return error")
+	}
+
+	//c在其他钱包签名
+	txC := exportTx(t, rawTx)
+	c.sign(t, txC)
+	if err = rawTx.MergeSignatures(txC); err != nil {
+		t.Fatalf("MergeSignatures err: %v", err)
+	}
+	if !rawTx.IsCompleted || !rawTx.IsCompleteSigned() {
+		t.Fatalf("transaction should be completed with 2 signatures")
+	}
+	if missing := rawTx.MissingSigners(); len(missing) != 1 || missing[0] != b.id {
+		t.Fatalf("MissingSigners = %v", missing)
+	}
+}
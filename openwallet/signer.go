@@ -15,7 +15,14 @@
 
 package openwallet
 
-import "fmt"
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/hdkeystore"
+)
 
 //TransactionSigner 交易签署器
 type TransactionSigner interface {
@@ -34,4 +41,129 @@ type TransactionSignerBase struct {
 // required
 func (singer *TransactionSignerBase) SignTransactionHash(msg []byte, privateKey []byte, eccType uint32) ([]byte, error) {
 	return nil, fmt.Errorf("SignTransactionHash not implement")
-}
\ No newline at end of file
+}
+
+//Signer 签名器，按HDPath和曲线签名消息摘要，私钥只在签名器内使用
+type Signer interface {
+
+	//KeyID 签名器持有的HDKey的KeyID
+	KeyID() string
+
+	//DerivedPublicKey 按HDPath衍生扩展公钥，返回OW编码
+	DerivedPublicKey(hdPath string, eccType uint32) (string, error)
+
+	//SignMessage 用HDPath衍生的私钥签名消息摘要，返回签名和恢复值v
+	SignMessage(hdPath string, eccType uint32, msg []byte) ([]byte, byte, error)
+}
+
+//HDKeySigner 进程内的签名器，私钥由HDKey衍生
+type HDKeySigner struct {
+	key *hdkeystore.HDKey
+}
+
+//NewHDKeySigner 创建进程内的签名器
+func NewHDKeySigner(key *hdkeystore.HDKey) *HDKeySigner {
+	return &HDKeySigner{key: key}
+}
+
+//KeyID HDKey的KeyID
+func (s *HDKeySigner) KeyID() string {
+	return s.key.KeyID
+}
+
+//DerivedPublicKey 按HDPath衍生扩展公钥，返回OW编码
+func (s *HDKeySigner) DerivedPublicKey(hdPath string, eccType uint32) (string, error) {
+	childKey, err := s.key.DerivedKeyWithPath(hdPath, eccType)
+	if err != nil {
+		return "", err
+	}
+	return childKey.GetPublicKey().OWEncode(), nil
+}
+
+//SignMessage 用HDPath衍生的私钥签名消息摘要
+func (s *HDKeySigner) SignMessage(hdPath string, eccType uint32, msg []byte) ([]byte, byte, error) {
+	childKey, err := s.key.DerivedKeyWithPath(hdPath, eccType)
+	if err != nil {
+		return nil, 0, err
+	}
+	keyBytes, err := childKey.GetPrivateKeyBytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	signature, v, sigErr := owcrypt.Signature(keyBytes, nil, msg, eccType)
+	if sigErr != owcrypt.SUCCESS {
+		return nil, 0, Errorf(ErrSignRawTransactionFailed, "transaction hash sign failed")
+	}
+	return signature, v, nil
+}
+
+//SignKeySignatures 用签名器签名属于该钥匙的待签消息。
+//签名地址的HDPath去掉末尾的change/index为账户路径，账户公钥计算的AccountID与签名分组一致才签名。
+func SignKeySignatures(signer Signer, signatures map[string][]*KeySignature) error {
+
+	if signer == nil {
+		return Errorf(ErrInvalidParameter, "signer is nil")
+	}
+
+	signed := 0
+	accountIDs := make(map[string]string) //账户路径+曲线类型: AccountID
+
+	for accountID, keySignatures := range signatures {
+		for _, keySignature := range keySignatures {
+
+			if keySignature == nil || keySignature.Address == nil || len(keySignature.Address.HDPath) == 0 {
+				continue
+			}
+
+			hdPath := keySignature.Address.HDPath
+			index := strings.LastIndex(hdPath, "/")
+			if index <= 0 {
+				continue
+			}
+			index = strings.LastIndex(hdPath[:index], "/")
+			if index <= 0 {
+				continue
+			}
+			accountPath := hdPath[:index]
+
+			cacheKey := fmt.Sprintf("%s:%d", accountPath, keySignature.EccType)
+			keyID, ok := accountIDs[cacheKey]
+			if !ok {
+				accountPub, err := signer.DerivedPublicKey(accountPath, keySignature.EccType)
+				if err != nil {
+					return ConvertError(err)
+				}
+				keyID = GenAccountID(accountPub)
+				accountIDs[cacheKey] = keyID
+			}
+
+			//不属于该钥匙的签名
+			if keyID != accountID {
+				continue
+			}
+
+			msg, err := hex.DecodeString(keySignature.Message)
+			if err != nil {
+				return Errorf(ErrSignRawTransactionFailed, "sign message of address: %s is not hex", keySignature.Address.Address)
+			}
+
+			signature, v, err := signer.SignMessage(hdPath, keySignature.EccType, msg)
+			if err != nil {
+				return ConvertError(err)
+			}
+
+			if keySignature.RSV {
+				signature = append(signature, v)
+			}
+
+			keySignature.Signature = hex.EncodeToString(signature)
+			signed++
+		}
+	}
+
+	if signed == 0 {
+		return Errorf(ErrSignRawTransactionFailed, "no signature belongs to the hdkey: %s", signer.KeyID())
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/blocktree/openwallet/v2/crypto"
+)
+
+//交易包格式：TxPackagePrefix + base64url(版本号[1] | 类型[1] | json数据 | 校验码[4])
+//校验码为前面所有字节两次SHA256的前4字节。
+//输出只包含可打印字符，可保存为文件或生成二维码，在离线签名机与在线钱包之间传递交易单。
+const (
+	TxPackagePrefix  = "owtx:"
+	TxPackageVersion = 1
+
+	txPackageChecksumLen = 4
+)
+
+//交易包类型
+const (
+	TxPackageTypeRawTransaction              = 1 //RawTransaction
+	TxPackageTypeSmartContractRawTransaction = 2 //SmartContractRawTransaction
+)
+
+//EncodeTxPackage 编码交易包
+func EncodeTxPackage(pkgType uint8, obj interface{}) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 0, len(data)+2+txPackageChecksumLen)
+	buf = append(buf, TxPackageVersion, pkgType)
+	buf = append(buf, data...)
+	buf = append(buf, txPackageChecksum(buf)...)
+	return TxPackagePrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+//DecodeTxPackage 解码交易包，校验版本号与校验码，返回类型与json数据
+func DecodeTxPackage(pkg string) (uint8, []byte, error) {
+	pkg = strings.TrimSpace(pkg)
+	if !strings.HasPrefix(pkg, TxPackagePrefix) {
+		return 0, nil, fmt.Errorf("tx package prefix is invalid")
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(pkg[len(TxPackagePrefix):])
+	if err != nil {
+		return 0, nil, fmt.Errorf("tx package encoding is invalid: %v", err)
+	}
+	if len(buf) < 2+txPackageChecksumLen {
+		return 0, nil, fmt.Errorf("tx package is too short")
+	}
+	body, checksum := buf[:len(buf)-txPackageChecksumLen], buf[len(buf)-txPackageChecksumLen:]
+	if !bytes.Equal(txPackageChecksum(body), checksum) {
+		return 0, nil, fmt.Errorf("tx package checksum is invalid")
+	}
+	if body[0] != TxPackageVersion {
+		return 0, nil, fmt.Errorf("tx package version: %d is not supported", body[0])
+	}
+	return body[1], body[2:], nil
+}
+
+//ExportRawTransaction 导出交易单为交易包
+func ExportRawTransaction(rawTx *RawTransaction) (string, error) {
+	if rawTx == nil {
+		return "", fmt.Errorf("raw transaction is nil")
+	}
+	return EncodeTxPackage(TxPackageTypeRawTransaction, rawTx)
+}
+
+//ImportRawTransaction 从交易包导入交易单
+func ImportRawTransaction(pkg string) (*RawTransaction, error) {
+	var rawTx RawTransaction
+	err := decodeTxPackageAs(pkg, TxPackageTypeRawTransaction, &rawTx)
+	if err != nil {
+		return nil, err
+	}
+	return &rawTx, nil
+}
+
+//ExportSmartContractRawTransaction 导出智能合约交易单为交易包
+func ExportSmartContractRawTransaction(rawTx *SmartContractRawTransaction) (string, error) {
+	if rawTx == nil {
+		return "", fmt.Errorf("smart contract raw transaction is nil")
+	}
+	return EncodeTxPackage(TxPackageTypeSmartContractRawTransaction, rawTx)
+}
+
+//ImportSmartContractRawTransaction 从交易包导入智能合约交易单
+func ImportSmartContractRawTransaction(pkg string) (*SmartContractRawTransaction, error) {
+	var rawTx SmartContractRawTransaction
+	err := decodeTxPackageAs(pkg, TxPackageTypeSmartContractRawTransaction, &rawTx)
+	if err != nil {
+		return nil, err
+	}
+	return &rawTx, nil
+}
+
+func decodeTxPackageAs(pkg string, want uint8, obj interface{}) error {
+	pkgType, data, err := DecodeTxPackage(pkg)
+	if err != nil {
+		return err
+	}
+	if pkgType != want {
+		return fmt.Errorf("tx package type: %d is not expected type: %d", pkgType, want)
+	}
+	return json.Unmarshal(data, obj)
+}
+
+func txPackageChecksum(data []byte) []byte {
+	hash := crypto.SHA256(crypto.SHA256(data))
+	return hash[:txPackageChecksumLen]
+}
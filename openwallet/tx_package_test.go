@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package openwallet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTxPackage_RawTransaction(t *testing.T) {
+	rawTx := &RawTransaction{
+		Coin:     Coin{Symbol: "BTC"},
+		RawHex:   "0100000001abcdef",
+		To:       map[string]string{"addr": "0.1"},
+		Account:  &AssetsAccount{AccountID: "acc1", Symbol: "BTC"},
+		Required: 1,
+		Signatures: map[string][]*KeySignature{
+			"acc1": {{EccType: 0, Message: "abcd", Address: &Address{Address: "addr", HDPath: "m/44'/0'/1'/0/0"}}},
+		},
+	}
+
+	pkg, err := ExportRawTransaction(rawTx)
+	if err != nil {
+		t.Fatalf("ExportRawTransaction err: %v", err)
+	}
+	if !strings.HasPrefix(pkg, TxPackagePrefix) {
+		t.Fatalf("package prefix is invalid: %s", pkg)
+	}
+
+	got, err := ImportRawTransaction(pkg)
+	if err != nil {
+		t.Fatalf("ImportRawTransaction err: %v", err)
+	}
+	if got.RawHex != rawTx.RawHex || got.Signatures["acc1"][0].Address.HDPath != "m/44'/0'/1'/0/0" {
+		t.Fatalf("imported transaction = %+v", got)
+	}
+
+	//类型不一致
+	if _, err = ImportSmartContractRawTransaction(pkg); err == nil {
+		t.Fatalf("import package of other type should return error")
+	}
+
+	//篡改数据
+	tampered := []byte(pkg)
+	i := len(TxPackagePrefix) + 10
+	if tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+	if _, err = ImportRawTransaction(string(tampered)); err == nil {
+		t.Fatalf("import tampered package should return error")
+	}
+}
+
+func TestTxPackage_SmartContractRawTransaction(t *testing.T) {
+	rawTx := &SmartContractRawTransaction{
+		Coin:     Coin{Symbol: "ETH"},
+		Raw:      "0xa9059cbb",
+		ABIParam: []string{"transfer", "0x1", "100"},
+	}
+	pkg, err := ExportSmartContractRawTransaction(rawTx)
+	if err != nil {
+		t.Fatalf("ExportSmartContractRawTransaction err: %v", err)
+	}
+	got, err := ImportSmartContractRawTransaction(pkg)
+	if err != nil {
+		t.Fatalf("ImportSmartContractRawTransaction err: %v", err)
+	}
+	if got.Raw != rawTx.Raw || len(got.ABIParam) != 3 {
+		t.Fatalf("imported transaction = %+v", got)
+	}
+}
@@ -16,6 +16,7 @@
 package owtp
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -23,16 +24,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/blocktree/go-owcrypt"
-	"github.com/blocktree/openwallet/v2/common"
-	"github.com/blocktree/openwallet/v2/crypto"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/mr-tron/base58/base58"
 	"math/big"
+	"strings"
 )
 
 //KeyAgreement 协商密码
 type KeyAgreement struct {
-	EncryptType            string //协商密码类型
+	EncryptType            string //协商密码类型，"曲线/加密算法"，sm2只有加密算法，如aes，secp256k1/aes-gcm
 	PublicKeyInitiator     string //发送方：本地公钥
 	PrivateKeyInitiator    string //发送方：本地私钥
 	TmpPublicKeyInitiator  string //发送方：临时公钥
@@ -208,6 +208,28 @@ func (cert *Certificate) PublicKeyBytes() []byte {
 	return cert.publicKeyBytes
 }
 
+//PublicKeyWithCurve 证书私钥在指定曲线上的公钥，sm2与PublicKeyBytes相同
+func (cert *Certificate) PublicKeyWithCurve(curve string) ([]byte, error) {
+	if len(curve) == 0 || curve == CurveSM2 {
+		return cert.publicKeyBytes, nil
+	}
+	c, ok := getCurve(curve)
+	if !ok {
+		return nil, fmt.Errorf("unsupported curve: %s", curve)
+	}
+	return c.PublicKey(cert.privateKeyBytes)
+}
+
+//IDWithCurve 指定曲线的节点ID，对方通过该曲线的公钥计算我方节点ID
+func (cert *Certificate) IDWithCurve(curve string) string {
+	pub, err := cert.PublicKeyWithCurve(curve)
+	if err != nil || len(pub) == 0 {
+		return ""
+	}
+	nodeID := owcrypt.Hash(pub, 0, owcrypt.HASH_ALG_SHA256)
+	return base58.Encode(nodeID)
+}
+
 func (cert *Certificate) PrivateKeyBytes() []byte {
 	return cert.privateKeyBytes
 }
@@ -222,6 +244,10 @@ type OWTPAuth struct {
 	localPrivateKey []byte
 	//远程节点的公钥
 	remotePublicKey []byte
+	//远程节点的公钥来自对方证书，协商密码只接受该公钥发起
+	certified bool
+	//连接使用的签名曲线和加密算法
+	suite CipherSuite
 	//是否开启
 	enable bool
 	//是否协商
@@ -251,6 +277,46 @@ func NewOWTPAuthWithCertificate(cert Certificate, enable bool) (*OWTPAuth, error
 	return auth, nil
 }
 
+//NewOWTPAuthWithCipherSuite 使用证书私钥在指定曲线上的密钥对创建授权
+func NewOWTPAuthWithCipherSuite(cert Certificate, enable bool, suite CipherSuite) (*OWTPAuth, error) {
+
+	suite = suite.normalize()
+	pub, err := cert.PublicKeyWithCurve(suite.Curve)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &OWTPAuth{
+		localPrivateKey: cert.PrivateKeyBytes(),
+		localPublicKey:  pub,
+		enable:          enable,
+		suite:           suite,
+	}
+
+	return auth, nil
+}
+
+//CipherSuite 连接使用的签名曲线和加密算法
+func (auth *OWTPAuth) CipherSuite() CipherSuite {
+	return auth.suite.normalize()
+}
+
+//negotiateCipherSuite 协商加密算法，曲线必须与连接的曲线一致，只有加密算法时使用连接的曲线
+func (auth *OWTPAuth) negotiateCipherSuite(encryptType string) (CipherSuite, error) {
+	suite, err := ParseCipherSuite(encryptType)
+	if err != nil {
+		return suite, err
+	}
+	curve := auth.CipherSuite().Curve
+	if !strings.Contains(encryptType, "/") {
+		suite.Curve = curve
+	}
+	if suite.Curve != curve {
+		return suite, fmt.Errorf("key agreement curve: %s is not matched with connection curve: %s", suite.Curve, curve)
+	}
+	return suite, nil
+}
+
 // RemotePID 远程节点ID
 func (auth *OWTPAuth) RemotePID() string {
 	//nodeID := crypto.SHA256(auth.remotePublicKey)
@@ -273,12 +339,13 @@ func (auth *OWTPAuth) GenerateSignature(data *DataPacket) bool {
 	if auth.EnableAuth() {
 		pub := base58.Encode(auth.localPublicKey)
 		//给数据包生成签名
-		dataString := common.NewString(data.Data)
-		plainText := fmt.Sprintf("%d%s%d%d%s", data.Req, data.Method, data.Nonce, data.Timestamp, dataString)
-		hash := owcrypt.Hash([]byte(plainText), 0, owcrypt.HASH_ALG_DOUBLE_SHA256)
-		nodeID := owcrypt.Hash(auth.localPublicKey, 0, owcrypt.HASH_ALG_SHA256)
-		signature, _, ret := owcrypt.Signature(auth.localPrivateKey, nodeID, hash, owcrypt.ECC_CURVE_SM2_STANDARD)
-		if ret != owcrypt.SUCCESS {
+		plainText, err := data.SigningBytes()
+		if err != nil {
+			return false
+		}
+		hash := owcrypt.Hash(plainText, 0, owcrypt.HASH_ALG_DOUBLE_SHA256)
+		signature, err := auth.suite.curve().Sign(auth.localPrivateKey, auth.localPublicKey, hash)
+		if err != nil {
 			return false
 		}
 		data.SecretData.PublicKeyInitiator = pub
@@ -306,10 +373,12 @@ func (auth *OWTPAuth) VerifySignature(data *DataPacket) bool {
 		//log.Debug("VerifySignature packet.Req: ", data.Req)
 		//log.Debug("VerifySignature packet.Signature: ", data.Signature)
 
-		dataString := data.Data.(string)
-		plainText := fmt.Sprintf("%d%s%d%d%s", data.Req, data.Method, data.Nonce, data.Timestamp, dataString)
+		plainText, err := data.SigningBytes()
+		if err != nil {
+			return false
+		}
 		//log.Debug("VerifySignature plainText: ", plainText)
-		hash := owcrypt.Hash([]byte(plainText), 0, owcrypt.HASH_ALG_DOUBLE_SHA256)
+		hash := owcrypt.Hash(plainText, 0, owcrypt.HASH_ALG_DOUBLE_SHA256)
 		//log.Debug("VerifySignature hash: ", hex.EncodeToString(hash))
 		nodeID := owcrypt.Hash(publickey, 0, owcrypt.HASH_ALG_SHA256)
 		//log.Debug("VerifySignature remotePublicKey: ", hex.EncodeToString(auth.remotePublicKey))
@@ -324,8 +393,7 @@ func (auth *OWTPAuth) VerifySignature(data *DataPacket) bool {
 			return false
 		}
 
-		ret := owcrypt.Verify(publickey, nodeID, hash, signature, owcrypt.ECC_CURVE_SM2_STANDARD)
-		if ret != owcrypt.SUCCESS {
+		if !auth.suite.curve().Verify(publickey, hash, signature) {
 			return false
 		}
 	}
@@ -341,7 +409,7 @@ func (auth *OWTPAuth) EnableAuth() bool {
 func (auth *OWTPAuth) EncryptData(data []byte, key []byte) ([]byte, error) {
 	//使用协商密钥加密数据
 	if auth.EnableKeyAgreement() && len(key) > 0 && len(data) > 0 {
-		encD, err := crypto.AESEncrypt(data, key)
+		encD, err := auth.suite.cipher().Encrypt(data, key)
 		if err != nil {
 			return data, err
 		}
@@ -360,7 +428,7 @@ func (auth *OWTPAuth) DecryptData(data []byte, key []byte) ([]byte, error) {
 		if err != nil {
 			return data, err
 		}
-		decD, err := crypto.AESDecrypt(encD, key)
+		decD, err := auth.suite.cipher().Decrypt(encD, key)
 		if err != nil {
 			return data, err
 		}
@@ -375,7 +443,13 @@ func (auth *OWTPAuth) EncryptDataPacket(packet *DataPacket, key []byte) error {
 
 	var dataByte []byte
 
-	if encStr, ok := packet.Data.(string); ok {
+	if packet.Version >= DataPacketVersionV2 {
+		//v2数据主体编码为二进制
+		if err := packet.packData(); err != nil {
+			return err
+		}
+		dataByte = packet.Data.([]byte)
+	} else if encStr, ok := packet.Data.(string); ok {
 		//无需转换为json
 		dataByte = []byte(encStr)
 	} else {
@@ -389,8 +463,8 @@ func (auth *OWTPAuth) EncryptDataPacket(packet *DataPacket, key []byte) error {
 	//使用协商密钥加密数据
 	if auth.EnableKeyAgreement() && len(key) > 0 && len(dataByte) > 0 {
 
-		//DataPacket = 1时，使用新的加密方案
-		if packet.Version == DataPacketVersionV1 {
+		//DataPacket >= 1时，使用新的加密方案
+		if packet.Version >= DataPacketVersionV1 {
 			//把nonce作为salt
 			nonceBit := big.NewInt(int64(packet.Nonce)).Bytes()
 			h := hmac.New(sha256.New, nonceBit)
@@ -399,13 +473,18 @@ func (auth *OWTPAuth) EncryptDataPacket(packet *DataPacket, key []byte) error {
 			key = md
 		}
 
-		encD, err := crypto.AESEncrypt(dataByte, key)
+		encD, err := auth.suite.cipher().Encrypt(dataByte, key)
 		if err != nil {
 			return err
 		}
-		chipText := base64.StdEncoding.EncodeToString(encD)
-		packet.Data = chipText
-	} else {
+		if packet.Version >= DataPacketVersionV2 {
+			//v2直接传输二进制密文
+			packet.Data = encD
+		} else {
+			chipText := base64.StdEncoding.EncodeToString(encD)
+			packet.Data = chipText
+		}
+	} else if packet.Version < DataPacketVersionV2 {
 		packet.Data = string(dataByte)
 	}
 
@@ -415,15 +494,27 @@ func (auth *OWTPAuth) EncryptDataPacket(packet *DataPacket, key []byte) error {
 //DecryptDataPacket 解密数据
 func (auth *OWTPAuth) DecryptDataPacket(packet *DataPacket, key []byte) error {
 
-	rawData, ok := packet.Data.(string)
-	if !ok {
-		return fmt.Errorf("data parse failed")
+	var rawData []byte
+
+	if packet.Version >= DataPacketVersionV2 {
+		data, ok := packet.Data.([]byte)
+		if !ok {
+			return fmt.Errorf("data parse failed")
+		}
+		rawData = data
+	} else {
+		data, ok := packet.Data.(string)
+		if !ok {
+			return fmt.Errorf("data parse failed")
+		}
+		rawData = []byte(data)
 	}
+
 	//使用协商密钥解密数据
 	if auth.EnableKeyAgreement() && len(key) > 0 && len(rawData) > 0 {
 
-		//DataPacket = 1时，使用新的加密方案
-		if packet.Version == DataPacketVersionV1 {
+		//DataPacket >= 1时，使用新的加密方案
+		if packet.Version >= DataPacketVersionV1 {
 			//把nonce作为salt
 			nonceBit := big.NewInt(int64(packet.Nonce)).Bytes()
 			h := hmac.New(sha256.New, nonceBit)
@@ -432,19 +523,32 @@ func (auth *OWTPAuth) DecryptDataPacket(packet *DataPacket, key []byte) error {
 			key = md
 		}
 
-		encD, err := base64.StdEncoding.DecodeString(rawData)
+		encD := rawData
+		if packet.Version < DataPacketVersionV2 {
+			var err error
+			encD, err = base64.StdEncoding.DecodeString(string(rawData))
+			if err != nil {
+				return err
+			}
+		}
+		decD, err := auth.suite.cipher().Decrypt(encD, key)
 		if err != nil {
 			return err
 		}
-		decD, err := crypto.AESDecrypt(encD, key)
+		rawData = decD
+	}
+
+	//v2数据主体还原为json
+	if packet.Version >= DataPacketVersionV2 {
+		data, err := unmarshalPacketData(rawData)
 		if err != nil {
 			return err
 		}
-		packet.Data = decD
-	} else {
-		packet.Data = []byte(rawData)
+		rawData = data
 	}
 
+	packet.Data = rawData
+
 	return nil
 }
 
@@ -457,9 +561,16 @@ func (auth *OWTPAuth) HTTPAuthHeader() map[string]string {
 
 	a := base58.Encode(auth.localPublicKey)
 
-	return map[string]string{
+	header := map[string]string{
 		"a": a,
 	}
+
+	//sm2以外的曲线，握手时告知对方连接使用的曲线
+	if suite := auth.CipherSuite(); suite.Curve != CurveSM2 {
+		header["c"] = suite.Curve + "/" + suite.Cipher
+	}
+
+	return header
 }
 
 //EnableKeyAgreement 开启密码协商
@@ -511,8 +622,12 @@ func (auth *OWTPAuth) VerifyKeyAgreement(keyAgreement *KeyAgreement) bool {
 		return false
 	}
 
-	ret := owcrypt.KeyAgreement_responder_step2(sa, s2, owcrypt.ECC_CURVE_SM2_STANDARD)
-	if ret != owcrypt.SUCCESS {
+	if auth.CipherSuite().Curve == CurveSM2 {
+		ret := owcrypt.KeyAgreement_responder_step2(sa, s2, owcrypt.ECC_CURVE_SM2_STANDARD)
+		if ret != owcrypt.SUCCESS {
+			return false
+		}
+	} else if !hmac.Equal(sa, s2) {
 		return false
 	}
 
@@ -527,7 +642,16 @@ func (auth *OWTPAuth) VerifyKeyAgreement(keyAgreement *KeyAgreement) bool {
 
 //InitKeyAgreement 发起协商
 func (auth *OWTPAuth) InitKeyAgreement(keyAgreement *KeyAgreement) error {
-	tmpPrikeyInitiator, tmpPubkeyInitiator := owcrypt.KeyAgreement_initiator_step1(owcrypt.ECC_CURVE_SM2_STANDARD)
+
+	suite, err := auth.negotiateCipherSuite(keyAgreement.EncryptType)
+	if err != nil {
+		return err
+	}
+
+	tmpPrikeyInitiator, tmpPubkeyInitiator, err := suite.curve().GenerateKey()
+	if err != nil {
+		return err
+	}
 	//auth.tmpPrivateKey = tmpPrikeyInitiator
 	//auth.tmpPublicKey = tmpPubkeyInitiator
 	//auth.consultType = keyAgreement.EncryptType
@@ -535,7 +659,9 @@ func (auth *OWTPAuth) InitKeyAgreement(keyAgreement *KeyAgreement) error {
 	keyAgreement.TmpPrivateKeyInitiator = base58.Encode(tmpPrikeyInitiator)
 	keyAgreement.TmpPublicKeyInitiator = base58.Encode(tmpPubkeyInitiator)
 	keyAgreement.PublicKeyInitiator = base58.Encode(auth.localPublicKey)
+	keyAgreement.EncryptType = suite.String()
 
+	auth.suite = suite
 	auth.isConsult = true
 
 	return nil
@@ -544,6 +670,11 @@ func (auth *OWTPAuth) InitKeyAgreement(keyAgreement *KeyAgreement) error {
 //RequestKeyAgreement 请求协商
 func (auth *OWTPAuth) RequestKeyAgreement(keyAgreement *KeyAgreement) error {
 
+	suite, err := auth.negotiateCipherSuite(keyAgreement.EncryptType)
+	if err != nil {
+		return err
+	}
+
 	pubkeyBytes, err := base58.Decode(keyAgreement.PublicKeyInitiator)
 	if err != nil {
 		return err
@@ -554,18 +685,24 @@ func (auth *OWTPAuth) RequestKeyAgreement(keyAgreement *KeyAgreement) error {
 		return err
 	}
 
-	localPubkey, err := base58.Decode(keyAgreement.PublicKeyResponder)
+	localPrivkey, err := base58.Decode(keyAgreement.PrivateKeyResponder)
 	if err != nil {
 		return err
 	}
 
-	localPrivkey, err := base58.Decode(keyAgreement.PrivateKeyResponder)
+	//响应方公钥为私钥在连接曲线上的公钥
+	localPubkey, err := suite.curve().PublicKey(localPrivkey)
 	if err != nil {
 		return err
 	}
 
+	if auth.certified && !bytes.Equal(pubkeyBytes, auth.remotePublicKey) {
+		return fmt.Errorf("the public key of key agreement initiator is not certified")
+	}
+
 	auth.localPublicKey = localPubkey
 	auth.localPrivateKey = localPrivkey
+	auth.suite = suite
 
 	key, tmpPubkeyResponder, s2, sb, err := auth.requestKeyAgreement(pubkeyBytes, tmpPubkeyBytes, localPubkey, localPrivkey)
 	if err != nil {
@@ -576,6 +713,8 @@ func (auth *OWTPAuth) RequestKeyAgreement(keyAgreement *KeyAgreement) error {
 	//auth.localChecksum = s2
 	auth.isConsult = true
 
+	keyAgreement.EncryptType = suite.String()
+	keyAgreement.PublicKeyResponder = base58.Encode(localPubkey)
 	keyAgreement.SB = base58.Encode(sb)
 	keyAgreement.Key = base58.Encode(key)
 	keyAgreement.S2 = base58.Encode(s2)
@@ -645,6 +784,10 @@ func (auth *OWTPAuth) requestKeyAgreement(
 	pubkeyInitiatorBytes, tmpPubkeyInitiatorBytes []byte,
 	pubkeyResponderBytes, privkeyResponderBytes []byte) ([]byte, []byte, []byte, []byte, error) {
 
+	if curve := auth.suite.curve(); curve.Name() != CurveSM2 {
+		return curveKeyAgreementResponder(auth.suite, pubkeyInitiatorBytes, tmpPubkeyInitiatorBytes, pubkeyResponderBytes, privkeyResponderBytes)
+	}
+
 	IDinitiator := owcrypt.Hash(pubkeyInitiatorBytes, 0, owcrypt.HASH_ALG_SHA256)
 	IDresponder := owcrypt.Hash(pubkeyResponderBytes, 0, owcrypt.HASH_ALG_SHA256)
 
@@ -681,6 +824,11 @@ func (auth *OWTPAuth) requestKeyAgreement(
 //responseKeyAgreement 响应协商
 func (auth *OWTPAuth) responseKeyAgreement(pubkeyResponder, tmpPubkeyResponder, sb, tmpPublicKey, tmpPrivateKey []byte) ([]byte, []byte, error) {
 
+	if curve := auth.suite.curve(); curve.Name() != CurveSM2 {
+		return curveKeyAgreementInitiator(auth.suite, auth.localPrivateKey, auth.localPublicKey, pubkeyResponder,
+			tmpPrivateKey, tmpPublicKey, tmpPubkeyResponder, sb)
+	}
+
 	IDinitiator := owcrypt.Hash(auth.localPublicKey, 0, owcrypt.HASH_ALG_SHA256)
 	IDresponder := owcrypt.Hash(pubkeyResponder, 0, owcrypt.HASH_ALG_SHA256)
 
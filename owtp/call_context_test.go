@@ -0,0 +1,105 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOWTPNode_CallContext(t *testing.T) {
+
+	const addr = "127.0.0.1:8435"
+
+	host := RandomOWTPNode()
+	host.HandleFunc("slow", func(ctx *Context) {
+		time.Sleep(500 * time.Millisecond)
+		ctx.Response(nil, StatusSuccess, "success")
+	})
+	host.HandleFunc("fast", func(ctx *Context) {
+		ctx.Response(nil, StatusSuccess, "success")
+	})
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	client := RandomOWTPNode()
+	defer client.Close()
+
+	_, err = client.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	pendingRequests := func() int {
+		client.serveMux.mu.RLock()
+		defer client.serveMux.mu.RUnlock()
+		return len(client.serveMux.peerRequest[host.NodeID()])
+	}
+
+	//超时
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.CallSyncContext(timeoutCtx, host.NodeID(), "slow", nil)
+	var canceledErr *CallCanceledError
+	if !errors.As(err, &canceledErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallSyncContext error = %v, want deadline exceeded", err)
+	}
+	if canceledErr.Code() != ErrRequestTimeout {
+		t.Errorf("error code = %d", canceledErr.Code())
+	}
+	if time.Since(start) > 400*time.Millisecond {
+		t.Errorf("CallSyncContext does not return on deadline")
+	}
+	if n := pendingRequests(); n != 0 {
+		t.Errorf("pending requests = %d after timeout", n)
+	}
+
+	//取消
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancelFunc)
+	err = client.CallContext(cancelCtx, host.NodeID(), "slow", nil, func(resp Response) {
+		t.Errorf("reqFunc should not be called after cancel")
+	})
+	if !errors.As(err, &canceledErr) || !errors.Is(err, context.Canceled) || canceledErr.Code() != ErrRequestCanceled {
+		t.Fatalf("CallContext error = %v, want canceled", err)
+	}
+	if n := pendingRequests(); n != 0 {
+		t.Errorf("pending requests = %d after cancel", n)
+	}
+
+	//已取消的context不发送请求
+	err = client.CallContext(cancelCtx, host.NodeID(), "fast", nil, func(resp Response) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CallContext error = %v, want canceled", err)
+	}
+
+	//等待被取消请求的响应返回，不影响后续请求
+	time.Sleep(600 * time.Millisecond)
+
+	resp, err := client.CallSyncContext(context.Background(), host.NodeID(), "fast", nil)
+	if err != nil {
+		t.Fatalf("CallSyncContext unexpected error: %v", err)
+	}
+	if resp.Status != StatusSuccess {
+		t.Fatalf("response = %+v", resp)
+	}
+}
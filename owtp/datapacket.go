@@ -0,0 +1,238 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/blocktree/openwallet/v2/common"
+	"github.com/tidwall/gjson"
+)
+
+//packetVersionHeader 连接握手时协商数据包版本的头字段，值为发起方支持的最高版本
+const packetVersionHeader = "v"
+
+//negotiatePacketVersion 按对方支持的最高版本协商数据包版本
+func negotiatePacketVersion(remote string) int64 {
+	v, _ := strconv.ParseInt(remote, 10, 64)
+	if v >= DataPacketVersionV2 {
+		return DataPacketVersionV2
+	}
+	return DataPacketVersionV1
+}
+
+//EncodeDataPacket 按数据包版本编码，v1为json，v2为MessagePack
+func EncodeDataPacket(packet DataPacket) ([]byte, error) {
+
+	if packet.Version < DataPacketVersionV2 {
+		return json.Marshal(packet)
+	}
+
+	err := packet.packData()
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{
+		"r": packet.Req,
+		"m": packet.Method,
+		"n": packet.Nonce,
+		"t": packet.Timestamp,
+		"d": packet.Data,
+		"v": packet.Version,
+	}
+
+	if len(packet.Signature) > 0 {
+		m["s"] = packet.Signature
+	}
+
+	//协商密码数据包只编码有值的字段
+	k := make(map[string]interface{})
+	for key, value := range map[string]string{
+		"pk":  packet.SecretData.PublicKeyInitiator,
+		"tpk": packet.SecretData.TmpPublicKeyInitiator,
+		"et":  packet.SecretData.EncryptType,
+		"pko": packet.SecretData.PublicKeyResponder,
+		"tpo": packet.SecretData.TmpPublicKeyResponder,
+		"sb":  packet.SecretData.SB,
+		"sa":  packet.SecretData.SA,
+		"s2":  packet.SecretData.S2,
+	} {
+		if len(value) > 0 {
+			k[key] = value
+		}
+	}
+	if len(k) > 0 {
+		m["k"] = k
+	}
+
+	return msgpackMarshal(m)
+}
+
+//DecodeDataPacket 解码数据包，json格式按v1解析，否则按v2的MessagePack解析
+func DecodeDataPacket(raw []byte) (*DataPacket, error) {
+
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] == '{' {
+		return NewDataPacket(gjson.ParseBytes(raw)), nil
+	}
+
+	value, err := msgpackUnmarshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid binary data packet")
+	}
+
+	dp := &DataPacket{}
+	dp.Req = uint64(msgpackInt(m["r"]))
+	dp.Method = msgpackString(m["m"])
+	dp.Nonce = msgpackUint(m["n"])
+	dp.Timestamp = msgpackInt(m["t"])
+	dp.Signature = msgpackString(m["s"])
+	dp.Version = msgpackInt(m["v"])
+
+	switch d := m["d"].(type) {
+	case nil:
+		dp.Data = []byte{}
+	case []byte:
+		dp.Data = d
+	default:
+		return nil, fmt.Errorf("invalid binary data packet: data must be binary")
+	}
+
+	k, _ := m["k"].(map[string]interface{})
+	dp.SecretData = SecretData{
+		PublicKeyInitiator:    msgpackString(k["pk"]),
+		TmpPublicKeyInitiator: msgpackString(k["tpk"]),
+		EncryptType:           msgpackString(k["et"]),
+		PublicKeyResponder:    msgpackString(k["pko"]),
+		TmpPublicKeyResponder: msgpackString(k["tpo"]),
+		SB:                    msgpackString(k["sb"]),
+		SA:                    msgpackString(k["sa"]),
+		S2:                    msgpackString(k["s2"]),
+	}
+
+	return dp, nil
+}
+
+//SigningBytes 数据包签名的原文。
+//v1为[r+m+n+t+d]的字符串拼接，v2为[v,r,m,n,t,d]的MessagePack编码，d为二进制数据主体
+func (dp *DataPacket) SigningBytes() ([]byte, error) {
+
+	if dp.Version < DataPacketVersionV2 {
+		dataString := common.NewString(dp.Data)
+		plainText := fmt.Sprintf("%d%s%d%d%s", dp.Req, dp.Method, dp.Nonce, dp.Timestamp, dataString)
+		return []byte(plainText), nil
+	}
+
+	err := dp.packData()
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpackMarshal([]interface{}{dp.Version, dp.Req, dp.Method, dp.Nonce, dp.Timestamp, dp.Data})
+}
+
+//packData v2数据包的数据主体编码为二进制，已编码的不重复处理
+func (dp *DataPacket) packData() error {
+
+	if dp.Version < DataPacketVersionV2 {
+		return nil
+	}
+
+	if _, ok := dp.Data.([]byte); ok {
+		return nil
+	}
+
+	//与v1的"d":null一致，没有数据为空
+	if dp.Data == nil {
+		dp.Data = []byte{}
+		return nil
+	}
+
+	data, err := marshalPacketData(dp.Data)
+	if err != nil {
+		return err
+	}
+	dp.Data = data
+	return nil
+}
+
+//marshalPacketData 数据主体编码为MessagePack，先经过json转换，字段名与v1保持一致
+func marshalPacketData(v interface{}) ([]byte, error) {
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	err = dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpackMarshal(value)
+}
+
+//unmarshalPacketData MessagePack编码的数据主体还原为json，供Context.Params解析
+func unmarshalPacketData(data []byte) ([]byte, error) {
+
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	value, err := msgpackUnmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+func msgpackInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	}
+	return 0
+}
+
+func msgpackUint(v interface{}) uint64 {
+	switch n := v.(type) {
+	case int64:
+		return uint64(n)
+	case uint64:
+		return n
+	}
+	return 0
+}
+
+func msgpackString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
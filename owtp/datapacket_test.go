@@ -0,0 +1,195 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestMsgpack_RoundTrip(t *testing.T) {
+	values := []interface{}{
+		nil, true, false,
+		int64(0), int64(127), int64(128), int64(65536), int64(-1), int64(-33), int64(-40000), int64(-1 << 40),
+		uint64(1 << 63),
+		1.5,
+		"", "hello", string(bytes.Repeat([]byte("a"), 300)),
+		[]byte{1, 2, 3},
+		json.Number("123456789012345678901234567890.000001"),
+		[]interface{}{int64(1), "a", []interface{}{}},
+		map[string]interface{}{"b": int64(2), "a": map[string]interface{}{"c": nil}},
+	}
+
+	for _, v := range values {
+		b, err := msgpackMarshal(v)
+		if err != nil {
+			t.Fatalf("msgpackMarshal(%v) unexpected error: %v", v, err)
+		}
+		got, err := msgpackUnmarshal(b)
+		if err != nil {
+			t.Fatalf("msgpackUnmarshal(%v) unexpected error: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("round trip = %#v, want %#v", got, v)
+		}
+	}
+
+	//截断的数据
+	b, _ := msgpackMarshal(map[string]interface{}{"a": "hello"})
+	if _, err := msgpackUnmarshal(b[:len(b)-1]); err == nil {
+		t.Errorf("msgpackUnmarshal truncated data should fail")
+	}
+}
+
+func TestDataPacket_EncodeDecode(t *testing.T) {
+
+	params := map[string]interface{}{
+		"address": "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		"amount":  json.Number("0.000000000000000001"),
+		"index":   uint64(1 << 63),
+	}
+
+	for _, version := range []int64{DataPacketVersionV1, DataPacketVersionV2} {
+		packet := DataPacket{
+			Req:        WSRequest,
+			Method:     "getAddress",
+			Nonce:      123,
+			Timestamp:  1528520843,
+			Data:       params,
+			Version:    version,
+			Signature:  "Qwse",
+			SecretData: SecretData{EncryptType: "aes"},
+		}
+
+		raw, err := EncodeDataPacket(packet)
+		if err != nil {
+			t.Fatalf("v%d EncodeDataPacket unexpected error: %v", version, err)
+		}
+		if isJSON := raw[0] == '{'; isJSON != (version == DataPacketVersionV1) {
+			t.Errorf("v%d packet is json: %v", version, isJSON)
+		}
+
+		dp, err := DecodeDataPacket(raw)
+		if err != nil {
+			t.Fatalf("v%d DecodeDataPacket unexpected error: %v", version, err)
+		}
+		if dp.Req != packet.Req || dp.Method != packet.Method || dp.Nonce != packet.Nonce ||
+			dp.Timestamp != packet.Timestamp || dp.Version != version || dp.Signature != packet.Signature ||
+			dp.SecretData != packet.SecretData {
+			t.Errorf("v%d decoded packet = %+v", version, dp)
+		}
+
+		//签名原文与发送方一致
+		sent, _ := packet.SigningBytes()
+		received, _ := dp.SigningBytes()
+		if !bytes.Equal(sent, received) {
+			t.Errorf("v%d signing bytes mismatch", version)
+		}
+
+		auth := &OWTPAuth{}
+		if err := auth.DecryptDataPacket(dp, nil); err != nil {
+			t.Fatalf("v%d DecryptDataPacket unexpected error: %v", version, err)
+		}
+		data := gjson.ParseBytes(dp.Data.([]byte))
+		if data.Get("address").String() != params["address"] ||
+			data.Get("amount").Raw != "0.000000000000000001" ||
+			data.Get("index").Uint() != 1<<63 {
+			t.Errorf("v%d decoded data = %s", version, data.Raw)
+		}
+	}
+
+	if _, err := DecodeDataPacket([]byte{0xc1}); err == nil {
+		t.Errorf("DecodeDataPacket invalid data should fail")
+	}
+}
+
+func TestOWTPNode_BinaryPacket(t *testing.T) {
+
+	const addr = "127.0.0.1:8439"
+
+	echo := func(ctx *Context) {
+		ctx.Response(map[string]interface{}{
+			"version": ctx.Version,
+			"params":  json.RawMessage(ctx.Params().Raw),
+		}, StatusSuccess, "success")
+	}
+
+	host := RandomOWTPNode()
+	host.HandleFunc("echo", echo)
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	tests := []struct {
+		name    string
+		config  ConnectConfig
+		version int64
+	}{
+		{"v1", ConnectConfig{Address: addr, ConnectType: Websocket}, DataPacketVersionV1},
+		{"v2", ConnectConfig{Address: addr, ConnectType: Websocket, EnableBinaryPacket: true}, DataPacketVersionV2},
+		{"v2 with key agreement", ConnectConfig{Address: addr, ConnectType: Websocket, EnableBinaryPacket: true,
+			EnableSignature: true, EnableKeyAgreement: true}, DataPacketVersionV2},
+	}
+
+	for _, test := range tests {
+		client := RandomOWTPNode()
+		client.HandleFunc("echo", echo)
+
+		peer, err := client.Connect(host.NodeID(), test.config)
+		if err != nil {
+			t.Fatalf("%s: Connect unexpected error: %v", test.name, err)
+		}
+		if peer.packetVersion() != test.version {
+			t.Errorf("%s: client packet version = %d", test.name, peer.packetVersion())
+		}
+
+		params := map[string]interface{}{"amount": "1.23456789", "list": []int{1, 2, 3}}
+		resp, err := client.CallSync(host.NodeID(), "echo", params)
+		if err != nil {
+			t.Fatalf("%s: CallSync unexpected error: %v", test.name, err)
+		}
+		result := resp.JsonData()
+		if result.Get("version").Int() != test.version ||
+			result.Get("params.amount").String() != "1.23456789" ||
+			result.Get("params.list.2").Int() != 3 {
+			t.Errorf("%s: response = %s", test.name, result.Raw)
+		}
+
+		hostPeer := host.GetOnlinePeer(client.NodeID())
+		if hostPeer == nil || hostPeer.packetVersion() != test.version {
+			t.Fatalf("%s: host peer is not negotiated", test.name)
+		}
+
+		//服务端发起请求，使用协商的版本
+		if !test.config.EnableSignature {
+			resp, err = host.CallSync(client.NodeID(), "echo", params)
+			if err != nil {
+				t.Fatalf("%s: host CallSync unexpected error: %v", test.name, err)
+			}
+			if resp.JsonData().Get("version").Int() != test.version {
+				t.Errorf("%s: host response = %s", test.name, resp.JsonData().Raw)
+			}
+		}
+
+		client.Close()
+	}
+}
@@ -0,0 +1,481 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	传输帧，对编码后的数据包（已签名和加密）进行压缩和分片，接收方重组后再解码数据包。
+	未压缩且不超过分片大小的数据包直接发送，不使用传输帧。
+
+	| 字段     | 长度 | 描述                         |
+	|----------|------|----------------------------|
+	| magic    | 2    | 固定为"OF"                   |
+	| flags    | 1    | bit0：已压缩                  |
+	| nameLen  | 1    | 压缩算法名长度                 |
+	| name     | n    | 压缩算法名，如gzip             |
+	| id       | 8    | 消息ID，同一数据包的分片相同     |
+	| index    | 4    | 分片序号，从0开始               |
+	| total    | 4    | 分片总数                      |
+	| length   | 4    | 本分片数据长度                 |
+	| payload  | n    | 分片数据                      |
+
+	整数采用大端编码。http的请求和响应体可包含连续的多个传输帧。
+*/
+
+const (
+	//默认分片大小（字节）
+	DefaultFragmentSize = 64 * 1024
+	//最小分片大小（字节）
+	MinFragmentSize = 1024
+	//默认压缩阈值（字节），小于阈值的数据包不压缩
+	DefaultCompressThreshold = 1024
+	//重组或解压后数据包的上限（字节）
+	MaxPacketSize = 64 * 1024 * 1024
+)
+
+const (
+	//握手时协商分片的头字段，值为分片大小，有值代表支持传输帧
+	packetFragmentHeader = "f"
+	//握手时协商压缩算法的头字段，请求方为支持的算法列表（逗号分隔），响应方为选定的算法
+	packetCompressionHeader = "z"
+
+	frameCompressed = 1 << 0
+	//分片重组的超时时间
+	fragmentTimeout = 60 * time.Second
+	//每个连接同时重组中的数据包上限
+	maxPartialPackets = 16
+	//每个连接重组中的分片总字节上限
+	maxPartialBytes = MaxPacketSize
+)
+
+var frameMagic = []byte("OF")
+
+//Compressor 数据包压缩算法
+type Compressor interface {
+	//Compress 压缩
+	Compress(data []byte) ([]byte, error)
+	//Decompress 解压，解压后超过limit返回错误
+	Decompress(data []byte, limit int) ([]byte, error)
+}
+
+var (
+	compressors  = map[string]Compressor{"gzip": gzipCompressor{}}
+	compressorMu sync.RWMutex
+)
+
+//RegisterCompressor 注册压缩算法，内置gzip，可注册zstd等其他实现。
+//双方都注册了同名的算法才会协商使用
+func RegisterCompressor(name string, compressor Compressor) {
+	compressorMu.Lock()
+	defer compressorMu.Unlock()
+	compressors[name] = compressor
+}
+
+func getCompressor(name string) (Compressor, bool) {
+	compressorMu.RLock()
+	defer compressorMu.RUnlock()
+	c, ok := compressors[name]
+	return c, ok
+}
+
+//gzipCompressor gzip压缩
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, fmt.Errorf("decompressed packet exceeds %d bytes", limit)
+	}
+	return out, nil
+}
+
+//frameOptions 连接的分片与压缩选项
+type frameOptions struct {
+	enable       bool   //对方支持传输帧
+	compression  string //压缩算法，空为不压缩
+	fragmentSize int    //分片大小
+}
+
+//frameOptionsFromConfig mq，http没有握手过程，按配置使用传输帧，双方需一致
+func frameOptionsFromConfig(config ConnectConfig) frameOptions {
+	if config.FragmentSize <= 0 && len(config.Compression) == 0 {
+		return frameOptions{}
+	}
+	opts := frameOptions{enable: true, fragmentSize: config.FragmentSize}
+	if _, ok := getCompressor(config.Compression); ok {
+		opts.compression = config.Compression
+	}
+	return opts.normalize()
+}
+
+//frameHeader 握手时带上的头字段
+func frameHeader(config ConnectConfig) map[string]string {
+	opts := frameOptionsFromConfig(config)
+	if !opts.enable {
+		return nil
+	}
+	header := map[string]string{
+		packetFragmentHeader: strconv.Itoa(opts.fragmentSize),
+	}
+	if len(opts.compression) > 0 {
+		header[packetCompressionHeader] = opts.compression
+	}
+	return header
+}
+
+//negotiateFrameOptions 按握手的头字段协商传输帧，选用第一个支持的压缩算法
+func negotiateFrameOptions(header http.Header) frameOptions {
+	size, _ := strconv.Atoi(header.Get(packetFragmentHeader))
+	if size <= 0 {
+		return frameOptions{}
+	}
+	opts := frameOptions{enable: true, fragmentSize: size}
+	for _, name := range strings.Split(header.Get(packetCompressionHeader), ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := getCompressor(name); ok {
+			opts.compression = name
+			break
+		}
+	}
+	return opts.normalize()
+}
+
+//setHeader 握手响应中返回协商的结果
+func (opts frameOptions) setHeader(header http.Header) {
+	if !opts.enable {
+		return
+	}
+	header.Set(packetFragmentHeader, strconv.Itoa(opts.fragmentSize))
+	if len(opts.compression) > 0 {
+		header.Set(packetCompressionHeader, opts.compression)
+	}
+}
+
+func (opts frameOptions) normalize() frameOptions {
+	if opts.fragmentSize <= 0 {
+		opts.fragmentSize = DefaultFragmentSize
+	}
+	if opts.fragmentSize < MinFragmentSize {
+		opts.fragmentSize = MinFragmentSize
+	}
+	if opts.fragmentSize > MaxPacketSize {
+		opts.fragmentSize = MaxPacketSize
+	}
+	return opts
+}
+
+//partialPacket 重组中的数据包
+type partialPacket struct {
+	parts    [][]byte
+	received int
+	size     int
+	created  time.Time
+}
+
+//packetFramer 连接的传输帧编解码，零值可用，未开启时直接收发数据包
+type packetFramer struct {
+	options      frameOptions
+	nextID       uint64
+	partials     map[uint64]*partialPacket
+	partialBytes int //重组中的分片总字节
+	mu           sync.Mutex
+}
+
+//setOptions 设置协商的选项
+func (f *packetFramer) setOptions(opts frameOptions) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.options = opts
+}
+
+//getOptions 协商的选项
+func (f *packetFramer) getOptions() frameOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.options
+}
+
+//encode 数据包编码为待发送的消息，可能压缩并分为多个传输帧
+func (f *packetFramer) encode(packet DataPacket) ([][]byte, error) {
+
+	raw, err := EncodeDataPacket(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := f.getOptions()
+	if !opts.enable {
+		return [][]byte{raw}, nil
+	}
+
+	var flags byte
+	compression := ""
+	if len(opts.compression) > 0 && len(raw) >= DefaultCompressThreshold {
+		if c, ok := getCompressor(opts.compression); ok {
+			compressed, err := c.Compress(raw)
+			if err != nil {
+				return nil, err
+			}
+			//压缩无效果的不使用
+			if len(compressed) < len(raw) {
+				raw = compressed
+				flags |= frameCompressed
+				compression = opts.compression
+			}
+		}
+	}
+
+	if flags == 0 && len(raw) <= opts.fragmentSize {
+		return [][]byte{raw}, nil
+	}
+
+	f.mu.Lock()
+	f.nextID++
+	id := f.nextID
+	f.mu.Unlock()
+
+	total := (len(raw) + opts.fragmentSize - 1) / opts.fragmentSize
+	frames := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * opts.fragmentSize
+		if end > len(raw) {
+			end = len(raw)
+		}
+		frames = append(frames, encodeFrame(flags, compression, id, i, total, raw[i*opts.fragmentSize:end]))
+	}
+
+	return frames, nil
+}
+
+func encodeFrame(flags byte, compression string, id uint64, index, total int, payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(frameMagic)
+	buf.WriteByte(flags)
+	buf.WriteByte(byte(len(compression)))
+	buf.WriteString(compression)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], id)
+	buf.Write(b[:])
+	binary.BigEndian.PutUint32(b[:4], uint32(index))
+	buf.Write(b[:4])
+	binary.BigEndian.PutUint32(b[:4], uint32(total))
+	buf.Write(b[:4])
+	binary.BigEndian.PutUint32(b[:4], uint32(len(payload)))
+	buf.Write(b[:4])
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+//isFrame 消息是否传输帧
+func isFrame(message []byte) bool {
+	return bytes.HasPrefix(message, frameMagic)
+}
+
+//frame 解析的传输帧
+type frame struct {
+	flags       byte
+	compression string
+	id          uint64
+	index       int
+	total       int
+	payload     []byte
+}
+
+//decodeFrame 解析一个传输帧，返回剩余的数据
+func decodeFrame(message []byte) (*frame, []byte, error) {
+	if !isFrame(message) || len(message) < 4 {
+		return nil, nil, fmt.Errorf("invalid frame")
+	}
+	fr := &frame{flags: message[2]}
+	nameLen := int(message[3])
+	message = message[4:]
+	if len(message) < nameLen+20 {
+		return nil, nil, fmt.Errorf("invalid frame: unexpected end of header")
+	}
+	fr.compression = string(message[:nameLen])
+	message = message[nameLen:]
+	fr.id = binary.BigEndian.Uint64(message)
+	fr.index = int(binary.BigEndian.Uint32(message[8:]))
+	fr.total = int(binary.BigEndian.Uint32(message[12:]))
+	length := int(binary.BigEndian.Uint32(message[16:]))
+	message = message[20:]
+	if length > len(message) {
+		return nil, nil, fmt.Errorf("invalid frame: unexpected end of payload")
+	}
+	if fr.total <= 0 || fr.index >= fr.total {
+		return nil, nil, fmt.Errorf("invalid frame: index %d of %d", fr.index, fr.total)
+	}
+	fr.payload = message[:length]
+	return fr, message[length:], nil
+}
+
+//decode 接收的消息解码为数据包，分片未接收完整时不返回数据包。
+//http的消息体可包含连续的多个传输帧
+func (f *packetFramer) decode(message []byte) ([]*DataPacket, error) {
+
+	if !isFrame(message) {
+		packet, err := DecodeDataPacket(message)
+		if err != nil {
+			return nil, err
+		}
+		return []*DataPacket{packet}, nil
+	}
+
+	packets := make([]*DataPacket, 0)
+	for len(message) > 0 {
+		fr, rest, err := decodeFrame(message)
+		if err != nil {
+			return packets, err
+		}
+		message = rest
+
+		raw, err := f.reassemble(fr)
+		if err != nil {
+			return packets, err
+		}
+		if raw == nil {
+			continue
+		}
+
+		packet, err := DecodeDataPacket(raw)
+		if err != nil {
+			return packets, err
+		}
+		packets = append(packets, packet)
+	}
+	return packets, nil
+}
+
+//removePartial 移除重组中的数据包，调用方需持有f.mu
+func (f *packetFramer) removePartial(id uint64) {
+	if p, exist := f.partials[id]; exist {
+		f.partialBytes -= p.size
+		delete(f.partials, id)
+	}
+}
+
+//reassemble 重组分片，完整后解压，未完整返回nil
+func (f *packetFramer) reassemble(fr *frame) ([]byte, error) {
+
+	var raw []byte
+
+	if fr.total == 1 {
+		raw = fr.payload
+	} else {
+		f.mu.Lock()
+		if f.partials == nil {
+			f.partials = make(map[uint64]*partialPacket)
+		}
+
+		//清理超时未完成的分片
+		now := time.Now()
+		for id, p := range f.partials {
+			if now.Sub(p.created) > fragmentTimeout {
+				f.removePartial(id)
+			}
+		}
+
+		p, exist := f.partials[fr.id]
+		if !exist {
+			if fr.total > MaxPacketSize/MinFragmentSize+1 {
+				f.mu.Unlock()
+				return nil, fmt.Errorf("too many fragments: %d", fr.total)
+			}
+			if len(f.partials) >= maxPartialPackets {
+				f.mu.Unlock()
+				return nil, fmt.Errorf("too many partial packets: %d", len(f.partials))
+			}
+			p = &partialPacket{
+				parts:   make([][]byte, fr.total),
+				created: now,
+			}
+			f.partials[fr.id] = p
+		}
+
+		if len(p.parts) != fr.total || p.parts[fr.index] != nil {
+			f.removePartial(fr.id)
+			f.mu.Unlock()
+			return nil, fmt.Errorf("invalid fragment: %d of %d", fr.index, fr.total)
+		}
+
+		if p.size+len(fr.payload) > MaxPacketSize {
+			f.removePartial(fr.id)
+			f.mu.Unlock()
+			return nil, fmt.Errorf("packet exceeds %d bytes", MaxPacketSize)
+		}
+		if f.partialBytes+len(fr.payload) > maxPartialBytes {
+			f.removePartial(fr.id)
+			f.mu.Unlock()
+			return nil, fmt.Errorf("partial packets exceed %d bytes", maxPartialBytes)
+		}
+		p.size += len(fr.payload)
+		f.partialBytes += len(fr.payload)
+		p.parts[fr.index] = append([]byte(nil), fr.payload...)
+		p.received++
+
+		if p.received < fr.total {
+			f.mu.Unlock()
+			return nil, nil
+		}
+
+		f.removePartial(fr.id)
+		f.mu.Unlock()
+		raw = bytes.Join(p.parts, nil)
+	}
+
+	if fr.flags&frameCompressed != 0 {
+		c, ok := getCompressor(fr.compression)
+		if !ok {
+			return nil, fmt.Errorf("unsupported compression: %s", fr.compression)
+		}
+		return c.Decompress(raw, MaxPacketSize)
+	}
+
+	return raw, nil
+}
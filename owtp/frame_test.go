@@ -0,0 +1,258 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+//testAddresses 生成批量地址作为大数据包
+func testAddresses(n int) []map[string]interface{} {
+	addrs := make([]map[string]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		addrs = append(addrs, map[string]interface{}{
+			"address":   fmt.Sprintf("1BvBMSEYstWetqTFn5Au4m4GFg7x%06d", i),
+			"accountID": "W4VUMN3wxQcwVEwsRvoyuhrJ95zhyc4zRW",
+			"index":     i,
+		})
+	}
+	return addrs
+}
+
+func TestPacketFramer(t *testing.T) {
+
+	for _, version := range []int64{DataPacketVersionV1, DataPacketVersionV2} {
+
+		sender := &packetFramer{}
+		sender.setOptions(frameOptions{enable: true, compression: "gzip", fragmentSize: MinFragmentSize})
+		receiver := &packetFramer{}
+
+		packet := DataPacket{
+			Req:       WSRequest,
+			Method:    "importAddress",
+			Nonce:     1,
+			Timestamp: 1528520843,
+			Data:      map[string]interface{}{"addresses": testAddresses(2000)},
+			Version:   version,
+		}
+
+		raw, _ := EncodeDataPacket(packet)
+		frames, err := sender.encode(packet)
+		if err != nil {
+			t.Fatalf("v%d encode unexpected error: %v", version, err)
+		}
+		size := 0
+		for _, frame := range frames {
+			if !isFrame(frame) {
+				t.Fatalf("v%d message is not frame", version)
+			}
+			size += len(frame)
+		}
+		if len(frames) < 2 || size >= len(raw) {
+			t.Errorf("v%d frames = %d, size = %d, raw size = %d", version, len(frames), size, len(raw))
+		}
+
+		//乱序接收
+		var got []*DataPacket
+		for i := len(frames) - 1; i >= 0; i-- {
+			packets, err := receiver.decode(frames[i])
+			if err != nil {
+				t.Fatalf("v%d decode unexpected error: %v", version, err)
+			}
+			if i > 0 && len(packets) > 0 {
+				t.Fatalf("v%d packet is completed before all fragments received", version)
+			}
+			got = append(got, packets...)
+		}
+		if len(got) != 1 || got[0].Method != packet.Method || got[0].Version != version {
+			t.Fatalf("v%d decoded packets = %+v", version, got)
+		}
+		if len(receiver.partials) != 0 {
+			t.Errorf("v%d partials are not cleaned", version)
+		}
+
+		//http的消息体包含连续的传输帧
+		packets, err := receiver.decode(bytes.Join(frames, nil))
+		if err != nil || len(packets) != 1 {
+			t.Errorf("v%d decode joined frames = %d, err = %v", version, len(packets), err)
+		}
+	}
+
+	//小数据包直接发送
+	sender := &packetFramer{}
+	sender.setOptions(frameOptions{enable: true, compression: "gzip", fragmentSize: MinFragmentSize})
+	frames, _ := sender.encode(DataPacket{Method: "ping", Version: DataPacketVersionV1})
+	if len(frames) != 1 || isFrame(frames[0]) {
+		t.Errorf("small packet should not be framed")
+	}
+
+	//重复的分片
+	frame := encodeFrame(0, "", 1, 0, 2, []byte("{}"))
+	receiver := &packetFramer{}
+	if _, err := receiver.decode(frame); err != nil {
+		t.Fatalf("decode unexpected error: %v", err)
+	}
+	if _, err := receiver.decode(frame); err == nil {
+		t.Errorf("duplicate fragment should fail")
+	}
+
+	//不支持的压缩算法
+	frame = encodeFrame(frameCompressed, "unknown", 2, 0, 1, []byte("abc"))
+	if _, err := receiver.decode(frame); err == nil {
+		t.Errorf("unsupported compression should fail")
+	}
+
+	//同时重组的数据包有上限
+	receiver = &packetFramer{}
+	for id := uint64(1); id <= maxPartialPackets; id++ {
+		if _, err := receiver.decode(encodeFrame(0, "", id, 0, 2, []byte("{}"))); err != nil {
+			t.Fatalf("decode partial %d unexpected error: %v", id, err)
+		}
+	}
+	if _, err := receiver.decode(encodeFrame(0, "", maxPartialPackets+1, 0, 2, []byte("{}"))); err == nil {
+		t.Errorf("partial packets over limit should fail")
+	}
+	if receiver.partialBytes != maxPartialPackets*2 {
+		t.Errorf("partial bytes = %d, want %d", receiver.partialBytes, maxPartialPackets*2)
+	}
+	if _, err := receiver.decode(encodeFrame(0, "", 1, 1, 2, []byte("{}"))); err != nil {
+		t.Fatalf("decode last fragment unexpected error: %v", err)
+	}
+	if len(receiver.partials) != maxPartialPackets-1 || receiver.partialBytes != (maxPartialPackets-1)*2 {
+		t.Errorf("partials = %d, bytes = %d after completed", len(receiver.partials), receiver.partialBytes)
+	}
+}
+
+func TestNegotiateFrameOptions(t *testing.T) {
+
+	header := http.Header{}
+	for key, value := range frameHeader(ConnectConfig{Compression: "gzip"}) {
+		header.Set(key, value)
+	}
+	opts := negotiateFrameOptions(header)
+	if !opts.enable || opts.compression != "gzip" || opts.fragmentSize != DefaultFragmentSize {
+		t.Errorf("negotiated options = %+v", opts)
+	}
+
+	//不支持的压缩算法只开启分片
+	header.Set(packetCompressionHeader, "zstd")
+	opts = negotiateFrameOptions(header)
+	if !opts.enable || opts.compression != "" {
+		t.Errorf("negotiated options = %+v", opts)
+	}
+
+	//旧版本不带头字段
+	if opts = negotiateFrameOptions(http.Header{}); opts.enable {
+		t.Errorf("negotiated options = %+v", opts)
+	}
+}
+
+//importAddress 返回导入的地址
+func importAddress(ctx *Context) {
+	addrs := ctx.Params().Get("addresses").Array()
+	ctx.Response(map[string]interface{}{
+		"count":     len(addrs),
+		"last":      addrs[len(addrs)-1].Get("address").String(),
+		"addresses": ctx.Params().Get("addresses").Value(),
+	}, StatusSuccess, "success")
+}
+
+//checkImportAddress 检查导入地址的响应
+func checkImportAddress(t *testing.T, name string, client *OWTPNode, pid string) {
+	resp, err := client.CallSync(pid, "importAddress", map[string]interface{}{
+		"addresses": testAddresses(3000),
+	})
+	if err != nil {
+		t.Fatalf("%s: CallSync unexpected error: %v", name, err)
+	}
+	result := resp.JsonData()
+	if resp.Status != StatusSuccess || result.Get("count").Int() != 3000 ||
+		result.Get("last").String() != "1BvBMSEYstWetqTFn5Au4m4GFg7x002999" ||
+		len(result.Get("addresses").Array()) != 3000 {
+		t.Errorf("%s: response status = %d, msg = %s", name, resp.Status, resp.Msg)
+	}
+}
+
+func TestOWTPNode_FragmentCompression(t *testing.T) {
+
+	const addr = "127.0.0.1:8440"
+
+	host := RandomOWTPNode()
+	host.HandleFunc("importAddress", importAddress)
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	tests := []struct {
+		name   string
+		config ConnectConfig
+	}{
+		{"v1 without frame", ConnectConfig{Address: addr, ConnectType: Websocket}},
+		{"v1 gzip", ConnectConfig{Address: addr, ConnectType: Websocket, Compression: "gzip", FragmentSize: 4096}},
+		{"v2 gzip with key agreement", ConnectConfig{Address: addr, ConnectType: Websocket, Compression: "gzip", FragmentSize: 4096,
+			EnableBinaryPacket: true, EnableSignature: true, EnableKeyAgreement: true}},
+	}
+
+	for _, test := range tests {
+		client := RandomOWTPNode()
+		peer, err := client.Connect(host.NodeID(), test.config)
+		if err != nil {
+			t.Fatalf("%s: Connect unexpected error: %v", test.name, err)
+		}
+
+		wsPeer := peer.(*WSClient)
+		if opts := wsPeer.framer.getOptions(); opts.compression != test.config.Compression {
+			t.Errorf("%s: negotiated options = %+v", test.name, opts)
+		}
+		hostPeer := host.GetOnlinePeer(client.NodeID()).(*WSClient)
+		if opts := hostPeer.framer.getOptions(); opts.compression != test.config.Compression {
+			t.Errorf("%s: host negotiated options = %+v", test.name, opts)
+		}
+
+		checkImportAddress(t, test.name, client, host.NodeID())
+
+		client.Close()
+	}
+}
+
+func TestOWTPNode_HTTPCompression(t *testing.T) {
+
+	const addr = "127.0.0.1:8441"
+
+	host := RandomOWTPNode()
+	host.HandleFunc("importAddress", importAddress)
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: HTTP})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	client := RandomOWTPNode()
+	defer client.Close()
+
+	//http没有握手过程，请求方按配置使用传输帧，响应方使用相同的压缩算法
+	_, err = client.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: HTTP, Compression: "gzip"})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	checkImportAddress(t, "http gzip", client, host.NodeID())
+}
@@ -16,14 +16,13 @@
 package owtp
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/imroc/req"
 	"github.com/mr-tron/base58/base58"
-	"github.com/tidwall/gjson"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -50,6 +49,7 @@ type HTTPClient struct {
 	mu              sync.RWMutex //读写锁
 	closeOnce       sync.Once
 	config          ConnectConfig //节点配置
+	framer          packetFramer  //传输帧的分片与压缩
 	httpClient      *req.Req
 	baseURL         string
 	authHeader      map[string]string
@@ -148,9 +148,16 @@ func NewHTTPClientWithHeader(responseWriter http.ResponseWriter, request *http.R
 
 	//nodeID = base58.Encode(owcrypt.Hash(tmpPublicKey, 0, owcrypt.HASH_ALG_SHA256))
 
+	//客户端使用的签名曲线，旧版本不带头字段为sm2
+	suite, err := ParseCipherSuite(header.Get("c"))
+	if err != nil {
+		return nil, err
+	}
+
 	auth := &OWTPAuth{
 		remotePublicKey: remotePublicKey,
 		enable:          enableSignature,
+		suite:           suite,
 	}
 
 	//err = auth.VerifyHeader()
@@ -212,6 +219,11 @@ func (c *HTTPClient) IsConnected() bool {
 	return c.isConnect
 }
 
+//packetVersion HTTP没有握手过程，发送请求使用v1，响应与请求的版本一致
+func (c *HTTPClient) packetVersion() int64 {
+	return DataPacketVersionV1
+}
+
 func (c *HTTPClient) ConnectConfig() ConnectConfig {
 	return c.config
 }
@@ -281,7 +293,14 @@ func (c *HTTPClient) sendHTTPRequest(data DataPacket) error {
 		return errors.New("API url is not setup. ")
 	}
 
-	r, err := c.httpClient.Post(c.baseURL, req.BodyJSON(&data), req.Header(c.authHeader))
+	frames, err := c.framer.encode(data)
+	if err != nil {
+		return err
+	}
+
+	//传输帧连续写入请求体
+	body := bytes.Join(frames, nil)
+	r, err := c.httpClient.Post(c.baseURL, body, req.Header(c.authHeader), req.Header{"Content-Type": contentType(data, frames)})
 
 	if Debug {
 		log.Std.Info("%+v", r)
@@ -299,14 +318,13 @@ func (c *HTTPClient) sendHTTPRequest(data DataPacket) error {
 		return fmt.Errorf("%s", r.Response().Status)
 	}
 
-	resp := gjson.ParseBytes(r.Bytes())
-
-	packet := NewDataPacket(resp)
-
-	//有可能存在数据已返回，上层才添加请求
-	go c.handler.OnPeerNewDataPacketReceived(c, packet)
+	packets, err := c.framer.decode(r.Bytes())
+	for _, packet := range packets {
+		//有可能存在数据已返回，上层才添加请求
+		go c.handler.OnPeerNewDataPacketReceived(c, packet)
+	}
 
-	return nil
+	return err
 }
 
 //OpenPipe 打开通道
@@ -317,12 +335,24 @@ func (c *HTTPClient) openPipe() error {
 	return nil
 }
 
+//contentType 数据包的http内容类型
+func contentType(data DataPacket, frames [][]byte) string {
+	if len(frames) > 0 && isFrame(frames[0]) {
+		return "application/octet-stream"
+	}
+	if data.Version >= DataPacketVersionV2 {
+		return "application/msgpack"
+	}
+	return "application/json"
+}
+
 // writeResponse 输出数据
 func (c *HTTPClient) writeResponse(data DataPacket) error {
-	respBytes, err := json.Marshal(data)
+	frames, err := c.framer.encode(data)
 	if err != nil {
 		return err
 	}
+	respBytes := bytes.Join(frames, nil)
 
 	if Debug {
 		log.Debug("Send: ", string(respBytes))
@@ -332,7 +362,7 @@ func (c *HTTPClient) writeResponse(data DataPacket) error {
 		return fmt.Errorf("responseWriter is nil")
 	}
 	w := c.responseWriter
-	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Content-type", contentType(data, frames))
 	_, err = w.Write(respBytes)
 	if err != nil {
 		return fmt.Errorf("responseWriter is close")
@@ -357,12 +387,18 @@ func (c *HTTPClient) HandleRequest() error {
 		return fmt.Errorf("body is empty")
 	}
 
-	packet := NewDataPacket(gjson.ParseBytes(s))
+	//请求使用了传输帧，响应也使用相同的压缩算法
+	if fr, _, err := decodeFrame(s); err == nil {
+		c.framer.setOptions(frameOptions{enable: true, compression: fr.compression}.normalize())
+	}
 
-	//转交给处理器处理数据包
-	c.handler.OnPeerNewDataPacketReceived(c, packet)
+	packets, err := c.framer.decode(s)
+	for _, packet := range packets {
+		//转交给处理器处理数据包
+		c.handler.OnPeerNewDataPacketReceived(c, packet)
+	}
 
-	return nil
+	return err
 
 }
 
@@ -0,0 +1,414 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blocktree/openwallet/v2/log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	//进程内的监听器，按监听地址登记
+	loopbackListeners   = make(map[string]*loopbackListener)
+	loopbackListenersMu sync.RWMutex
+
+	//主动连接方的地址序号
+	loopbackDialSeq uint64
+)
+
+//loopbackAddr 进程内连接的地址
+type loopbackAddr string
+
+func (a loopbackAddr) Network() string {
+	return Loopback
+}
+
+func (a loopbackAddr) String() string {
+	return string(a)
+}
+
+//loopbackConn 进程内连接的一端，双方通过内存通道收发消息
+type loopbackConn struct {
+	in         <-chan []byte
+	out        chan<- []byte
+	closed     chan struct{}
+	closeOnce  *sync.Once
+	localAddr  loopbackAddr
+	remoteAddr loopbackAddr
+}
+
+//newLoopbackPipe 创建一对互连的进程内连接
+func newLoopbackPipe(dialAddr, listenAddr loopbackAddr) (*loopbackConn, *loopbackConn) {
+	a := make(chan []byte, MaxMessageSize)
+	b := make(chan []byte, MaxMessageSize)
+	closed := make(chan struct{})
+	closeOnce := &sync.Once{}
+	dialer := &loopbackConn{in: a, out: b, closed: closed, closeOnce: closeOnce, localAddr: dialAddr, remoteAddr: listenAddr}
+	listener := &loopbackConn{in: b, out: a, closed: closed, closeOnce: closeOnce, localAddr: listenAddr, remoteAddr: dialAddr}
+	return dialer, listener
+}
+
+//close 关闭连接，双方同时断开
+func (c *loopbackConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+//loopbackListener 进程内监听器
+type loopbackListener struct {
+	handler         PeerHandler
+	closed          chan struct{}
+	closeOnce       sync.Once
+	incoming        chan Peer
+	laddr           string
+	enableSignature bool
+	cert            Certificate
+}
+
+//LoopbackListenAddr 创建进程内通信监听，同一进程的节点通过地址连接
+func LoopbackListenAddr(addr string, cert Certificate, enableSignature bool, handler PeerHandler) (*loopbackListener, error) {
+
+	if len(addr) == 0 {
+		return nil, errors.New("loopback address should not be empty! ")
+	}
+
+	loopbackListenersMu.Lock()
+	defer loopbackListenersMu.Unlock()
+
+	if _, exist := loopbackListeners[addr]; exist {
+		return nil, fmt.Errorf("loopback address: %s already in use", addr)
+	}
+
+	listener := &loopbackListener{
+		laddr:           addr,
+		cert:            cert,
+		handler:         handler,
+		incoming:        make(chan Peer),
+		closed:          make(chan struct{}),
+		enableSignature: enableSignature,
+	}
+	loopbackListeners[addr] = listener
+
+	return listener, nil
+}
+
+//handshake 处理握手请求，与websocket的握手过程一致，返回响应头
+func (l *loopbackListener) handshake(header http.Header, conn *loopbackConn) (http.Header, error) {
+
+	//客户端支持v2时，响应协商的数据包版本
+	responseHeader := http.Header{}
+	if version := negotiatePacketVersion(header.Get(packetVersionHeader)); version >= DataPacketVersionV2 {
+		responseHeader.Set(packetVersionHeader, strconv.FormatInt(version, 10))
+	}
+	//响应协商的分片和压缩选项
+	negotiateFrameOptions(header).setHeader(responseHeader)
+
+	peer, err := NewLoopbackClientWithHeader(header, l.cert, conn, l.handler, l.enableSignature, nil)
+	if err != nil {
+		log.Error("NewLoopbackClientWithHeader unexpected error:", err)
+		return nil, fmt.Errorf("authorization not passed: %v", err)
+	}
+
+	select {
+	case l.incoming <- peer:
+	case <-l.closed:
+		return nil, fmt.Errorf("loopback address: %s is closed", l.laddr)
+	}
+
+	//监听器关闭时断开已接入的节点
+	go func() {
+		select {
+		case <-conn.closed:
+		case <-l.closed:
+			peer.close()
+		}
+	}()
+
+	return responseHeader, nil
+}
+
+//Accept 接收新节点链接，线程阻塞
+func (l *loopbackListener) Accept() (Peer, error) {
+	select {
+	case c := <-l.incoming:
+		return c, nil
+	case <-l.closed:
+		return nil, fmt.Errorf("listener is closed")
+	}
+}
+
+//Close 关闭监听，注销监听地址
+func (l *loopbackListener) Close() error {
+	l.closeOnce.Do(func() {
+		loopbackListenersMu.Lock()
+		if loopbackListeners[l.laddr] == l {
+			delete(loopbackListeners, l.laddr)
+		}
+		loopbackListenersMu.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+//Addr 监听地址
+func (l *loopbackListener) Addr() net.Addr {
+	return loopbackAddr(l.laddr)
+}
+
+//LoopbackClient 基于内存通道的进程内通信客户端
+type LoopbackClient struct {
+	_auth     Authorization
+	conn      *loopbackConn
+	handler   PeerHandler
+	isHost    bool
+	pid       string
+	connected int32 //连接状态，1为已连接，原子读写
+	closeOnce sync.Once
+	done      func()
+	config    ConnectConfig //节点配置
+	version   int64         //连接协商的数据包版本
+	framer    packetFramer  //传输帧的分片与压缩
+}
+
+//LoopbackDial 连接同一进程内监听的地址
+func LoopbackDial(pid, addr string, handler PeerHandler, header map[string]string) (*LoopbackClient, error) {
+	return loopbackDialWithAuth(pid, addr, handler, header, nil, ConnectConfig{})
+}
+
+//loopbackDialWithAuth 连接同一进程内监听的地址，通知节点打开前设置授权规则和配置
+func loopbackDialWithAuth(pid, addr string, handler PeerHandler, header map[string]string, auth Authorization, config ConnectConfig) (*LoopbackClient, error) {
+
+	if handler == nil {
+		return nil, errors.New("handler should not be nil! ")
+	}
+
+	loopbackListenersMu.RLock()
+	listener := loopbackListeners[addr]
+	loopbackListenersMu.RUnlock()
+
+	if listener == nil {
+		return nil, fmt.Errorf("loopback address: %s connection refused", addr)
+	}
+
+	httpHeader := make(http.Header)
+	for key, value := range header {
+		httpHeader.Add(key, value)
+	}
+
+	dialAddr := loopbackAddr(fmt.Sprintf("%s#%d", addr, atomic.AddUint64(&loopbackDialSeq, 1)))
+	conn, remote := newLoopbackPipe(dialAddr, loopbackAddr(addr))
+
+	respHeader, err := listener.handshake(httpHeader, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewLoopbackClient(pid, conn, handler, auth, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.ConnectType) > 0 {
+		client.config = config
+	}
+
+	//服务端返回协商的数据包版本
+	client.version = negotiatePacketVersion(respHeader.Get(packetVersionHeader))
+	client.framer.setOptions(negotiateFrameOptions(respHeader))
+
+	client.isHost = true //我方主动连接
+	client.handler.OnPeerOpen(client)
+
+	return client, nil
+}
+
+//NewLoopbackClientWithHeader 通过握手头字段创建服务端的节点
+func NewLoopbackClientWithHeader(header http.Header, cert Certificate, conn *loopbackConn, handler PeerHandler, enableSignature bool, done func()) (*LoopbackClient, error) {
+
+	auth, err := newOWTPAuthWithHeader(header, cert, enableSignature)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewLoopbackClient(auth.RemotePID(), conn, handler, auth, done)
+	if err != nil {
+		return nil, err
+	}
+
+	//按客户端支持的最高版本协商数据包版本
+	client.version = negotiatePacketVersion(header.Get(packetVersionHeader))
+	client.framer.setOptions(negotiateFrameOptions(header))
+
+	return client, nil
+}
+
+func NewLoopbackClient(pid string, conn *loopbackConn, handler PeerHandler, auth Authorization, done func()) (*LoopbackClient, error) {
+
+	if handler == nil {
+		return nil, errors.New("handler should not be nil! ")
+	}
+
+	client := &LoopbackClient{
+		pid:   pid,
+		conn:  conn,
+		_auth: auth,
+		done:  done,
+		config: ConnectConfig{
+			ConnectType: Loopback,
+			Address:     conn.remoteAddr.String(),
+		},
+	}
+
+	atomic.StoreInt32(&client.connected, 1)
+	client.setHandler(handler)
+
+	return client, nil
+}
+
+func (c *LoopbackClient) PID() string {
+	return c.pid
+}
+
+func (c *LoopbackClient) EnableKeyAgreement() bool {
+	return c._auth.EnableKeyAgreement()
+}
+
+func (c *LoopbackClient) auth() Authorization {
+	return c._auth
+}
+
+func (c *LoopbackClient) setHandler(handler PeerHandler) error {
+	c.handler = handler
+	return nil
+}
+
+func (c *LoopbackClient) IsHost() bool {
+	return c.isHost
+}
+
+func (c *LoopbackClient) IsConnected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+func (c *LoopbackClient) ConnectConfig() ConnectConfig {
+	return c.config
+}
+
+//packetVersion 连接协商的数据包版本
+func (c *LoopbackClient) packetVersion() int64 {
+	if c.version < DataPacketVersionV1 {
+		return DataPacketVersionV1
+	}
+	return c.version
+}
+
+//Close 关闭连接
+func (c *LoopbackClient) close() error {
+
+	//保证节点只关闭一次
+	c.closeOnce.Do(func() {
+
+		if !atomic.CompareAndSwapInt32(&c.connected, 1, 0) {
+			return
+		}
+
+		//调用关闭函数通知上级
+		if c.done != nil {
+			c.done()
+			c.done = nil
+		}
+
+		c.conn.close()
+		c.handler.OnPeerClose(c, "client close")
+	})
+	return nil
+}
+
+//LocalAddr 本地节点地址
+func (c *LoopbackClient) LocalAddr() net.Addr {
+	return c.conn.localAddr
+}
+
+//RemoteAddr 远程节点地址
+func (c *LoopbackClient) RemoteAddr() net.Addr {
+	return c.conn.remoteAddr
+}
+
+//Send 发送消息
+func (c *LoopbackClient) send(data DataPacket) error {
+
+	frames, err := c.framer.encode(data)
+	if err != nil {
+		return err
+	}
+
+	for _, frame := range frames {
+		select {
+		case c.conn.out <- frame:
+		case <-c.conn.closed:
+			return fmt.Errorf("peer: %s is closed", c.PID())
+		}
+	}
+	return nil
+}
+
+//OpenPipe 打开通道
+func (c *LoopbackClient) openPipe() error {
+
+	if !c.IsConnected() {
+		return fmt.Errorf("client is not connect")
+	}
+
+	//监听消息
+	go c.readPump()
+
+	return nil
+}
+
+// ReadPump 监听消息
+func (c *LoopbackClient) readPump() {
+
+	defer c.close()
+
+	for {
+		select {
+		case message := <-c.conn.in:
+
+			if Debug {
+				log.Debug("Read: ", string(message))
+			}
+
+			packets, err := c.framer.decode(message)
+			if err != nil {
+				log.Error("peer:", c.PID(), "decode data packet unexpected error: ", err)
+			}
+
+			for _, packet := range packets {
+				//开一个goroutine处理消息
+				go c.handler.OnPeerNewDataPacketReceived(c, packet)
+			}
+		case <-c.conn.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOWTPNode_Loopback(t *testing.T) {
+
+	const addr = "loopback-host"
+
+	host := RandomOWTPNode()
+	host.HandleFunc("getInfo", mqGetInfo)
+	host.HandleFunc("importAddress", importAddress)
+	host.HandleFunc("slow", func(ctx *Context) {
+		time.Sleep(500 * time.Millisecond)
+		ctx.Response(nil, StatusSuccess, "success")
+	})
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Loopback, EnableSignature: true})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	//同一地址不能重复监听
+	if _, err := LoopbackListenAddr(addr, host.cert, false, host); err == nil {
+		t.Errorf("listen the same address should fail")
+	}
+
+	tests := []struct {
+		name   string
+		config ConnectConfig
+	}{
+		{"plain", ConnectConfig{}},
+		{"key agreement", ConnectConfig{EnableKeyAgreement: true}},
+		{"ed25519 chacha20-poly1305 v2 gzip", ConnectConfig{EnableKeyAgreement: true, Curve: CurveEd25519,
+			Cipher: CipherChaCha20Poly1305, EnableBinaryPacket: true, Compression: "gzip", FragmentSize: 4096}},
+	}
+
+	for _, test := range tests {
+		config := test.config
+		config.Address = addr
+		config.ConnectType = Loopback
+		config.EnableSignature = true
+
+		client := RandomOWTPNode()
+		peer, err := client.Connect(host.NodeID(), config)
+		if err != nil {
+			t.Fatalf("%s: Connect unexpected error: %v", test.name, err)
+		}
+		if peer.LocalAddr().Network() != Loopback || peer.RemoteAddr().String() != addr {
+			t.Errorf("%s: local addr = %s, remote addr = %s", test.name, peer.LocalAddr(), peer.RemoteAddr())
+		}
+
+		resp, err := client.CallSync(host.NodeID(), "getInfo", map[string]interface{}{"name": "chance"})
+		if err != nil {
+			t.Fatalf("%s: CallSync unexpected error: %v", test.name, err)
+		}
+		if resp.Status != StatusSuccess || resp.JsonData().Get("name").String() != "chance" {
+			t.Errorf("%s: response status = %d, msg = %s", test.name, resp.Status, resp.Msg)
+		}
+
+		checkImportAddress(t, test.name, client, host.NodeID())
+
+		//服务端的节点与客户端协商一致
+		hostPeer, ok := host.GetOnlinePeer(client.Certificate().IDWithCurve(config.Curve)).(*LoopbackClient)
+		if !ok {
+			t.Fatalf("%s: host peer is not found", test.name)
+		}
+		if hostPeer.EnableKeyAgreement() != config.EnableKeyAgreement || hostPeer.packetVersion() != peer.(*LoopbackClient).packetVersion() {
+			t.Errorf("%s: host peer keyAgreement = %v, version = %d", test.name, hostPeer.EnableKeyAgreement(), hostPeer.packetVersion())
+		}
+
+		client.Close()
+	}
+
+	//请求超时
+	client := RandomOWTPNode()
+	defer client.Close()
+	_, err = client.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: Loopback, EnableSignature: true, EnableKeyAgreement: true})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.CallSyncContext(ctx, host.NodeID(), "slow", nil)
+	var canceledErr *CallCanceledError
+	if !errors.As(err, &canceledErr) || canceledErr.Code() != ErrRequestTimeout {
+		t.Errorf("CallSyncContext error = %v, want timeout", err)
+	}
+}
+
+func TestOWTPNode_LoopbackClose(t *testing.T) {
+
+	const addr = "loopback-close"
+
+	host := RandomOWTPNode()
+	host.HandleFunc("getInfo", mqGetInfo)
+
+	client := RandomOWTPNode()
+	client.HandleFunc("getInfo", mqGetInfo)
+	defer client.Close()
+
+	config := ConnectConfig{Address: addr, ConnectType: Loopback}
+
+	//没有监听的地址
+	if _, err := client.Connect(host.NodeID(), config); err == nil {
+		t.Fatalf("Connect to unlistened address should fail")
+	}
+
+	err := host.Listen(config)
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+
+	_, err = client.Connect(host.NodeID(), config)
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	//服务端向客户端发起请求
+	resp, err := host.CallSync(client.NodeID(), "getInfo", map[string]interface{}{"name": "chance"})
+	if err != nil || resp.Status != StatusSuccess || resp.JsonData().Get("name").String() != "chance" {
+		t.Fatalf("host CallSync = %+v, err = %v", resp, err)
+	}
+
+	//关闭监听，已接入的节点断开，地址可重新监听
+	host.CloseListener(Loopback)
+	deadline := time.Now().Add(2 * time.Second)
+	for client.IsConnectPeer(host.NodeID()) || host.IsConnectPeer(client.NodeID()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("peers are not closed after listener closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := host.Listen(config); err != nil {
+		t.Fatalf("Listen again unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	_, err = client.Connect(host.NodeID(), config)
+	if err != nil {
+		t.Fatalf("Connect again unexpected error: %v", err)
+	}
+	resp, err = client.CallSync(host.NodeID(), "getInfo", map[string]interface{}{"name": "chance"})
+	if err != nil || resp.Status != StatusSuccess {
+		t.Fatalf("CallSync = %+v, err = %v", resp, err)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+)
+
+//Middleware 中间件，包装路由方法。
+//中间件可在调用next前后处理，不调用next并使用ctx.ResponseStopRun可中断请求
+type Middleware func(next HandlerFunc) HandlerFunc
+
+//Use 添加全局中间件，按添加顺序由外到内执行，不作用于内置方法
+func (mux *ServeMux) Use(middlewares ...Middleware) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.middlewares = append(mux.middlewares, middlewares...)
+}
+
+//handlerWithMiddlewares 组合全局中间件，方法中间件和路由方法
+func (mux *ServeMux) handlerWithMiddlewares(f muxEntry, exist bool) HandlerFunc {
+
+	h := f.h
+	if !exist {
+		//找不到方法的处理
+		h = func(ctx *Context) {
+			ctx.Resp = responseError("can not find method", ErrNotFoundMethod)
+		}
+	}
+
+	for i := len(f.middlewares) - 1; i >= 0; i-- {
+		h = f.middlewares[i](h)
+	}
+
+	mux.mu.RLock()
+	middlewares := mux.middlewares
+	mux.mu.RUnlock()
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+//RemotePID 请求方的节点ID，优先使用授权中对方公钥计算的节点ID
+func (ctx *Context) RemotePID() string {
+	if ctx.Peer != nil {
+		if auth, ok := ctx.Peer.auth().(*OWTPAuth); ok && len(auth.remotePublicKey) > 0 {
+			return auth.RemotePID()
+		}
+	}
+	return ctx.PID
+}
+
+//LoggerMiddleware 记录请求的方法，节点，响应状态和耗时
+func LoggerMiddleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			start := time.Now()
+			next(ctx)
+			log.Infof("OWTP: peer[%s] call method[%s], status: %d, elapsed: %v",
+				ctx.RemotePID(), ctx.Method, ctx.Resp.Status, time.Since(start))
+		}
+	}
+}
+
+//RecoveryMiddleware 捕获路由方法的panic，响应ErrInternalServerError
+func RecoveryMiddleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("OWTP: method[%s] panic: %v\n%s", ctx.Method, r, debug.Stack())
+					ctx.ResponseStopRun(nil, ErrInternalServerError, "internal server error")
+				}
+			}()
+			next(ctx)
+		}
+	}
+}
+
+//RateLimitMiddleware 按请求方节点ID限流，令牌桶每秒补充rate个，最多累积burst个。
+//未开启签名时节点ID可被冒用，冒用者会消耗被冒用节点的令牌
+func RateLimitMiddleware(rate float64, burst int) Middleware {
+	limiter := newPeerRateLimiter(rate, burst)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			if !limiter.allow(ctx.RemotePID(), time.Now()) {
+				ctx.ResponseStopRun(nil, ErrTooManyRequests, "too many requests")
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+//ACLMiddleware 按请求方节点ID检查方法的访问权限。
+//节点ID由对方公钥计算，未开启签名时公钥没有经过验证，请求一律响应ErrUnauthorized
+func ACLMiddleware(store ACLStore) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) {
+			if ctx.Peer == nil || ctx.Peer.auth() == nil || !ctx.Peer.auth().EnableAuth() {
+				ctx.ResponseStopRun(nil, ErrUnauthorized, "signature is not enabled, unauthorized")
+				return
+			}
+			if !store.IsAllowed(ctx.RemotePID(), ctx.Method) {
+				ctx.ResponseStopRun(nil, ErrForbidden, fmt.Sprintf("peer is not allowed to call method: %s", ctx.Method))
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+//tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//清理空闲令牌桶的间隔
+const rateLimitSweepInterval = time.Minute
+
+//peerRateLimiter 按节点ID限流
+type peerRateLimiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func newPeerRateLimiter(rate float64, burst int) *peerRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &peerRateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+//allow 消耗一个令牌，没有令牌返回false
+func (l *peerRateLimiter) allow(pid string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	bucket, exist := l.buckets[pid]
+	if !exist {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[pid] = bucket
+	}
+
+	//按时间补充令牌
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens += elapsed * l.rate
+		if bucket.tokens > l.burst {
+			bucket.tokens = l.burst
+		}
+		bucket.last = now
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+//sweep 移除已补满的令牌桶，补满的桶与新建的桶等价，调用方需持有l.mu
+func (l *peerRateLimiter) sweep(now time.Time) {
+	for pid, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, pid)
+		}
+	}
+	l.lastSweep = now
+}
+
+//ACLAnyPeer ACL规则中代表任意节点
+const ACLAnyPeer = "*"
+
+//ACLStore 访问控制存储
+type ACLStore interface {
+	//IsAllowed 节点是否允许访问方法
+	IsAllowed(pid, method string) bool
+}
+
+//ACL 内置的访问控制表，未授权的方法都拒绝访问。
+//方法名支持通配符：*代表所有方法，前缀加*如wallet_*代表该前缀的所有方法
+type ACL struct {
+	rules map[string]map[string]bool
+	mu    sync.RWMutex
+}
+
+//NewACL 创建访问控制表
+//@param rules 节点ID对应允许访问的方法，可用于从配置文件加载
+func NewACL(rules map[string][]string) *ACL {
+	acl := &ACL{
+		rules: make(map[string]map[string]bool),
+	}
+	for pid, methods := range rules {
+		acl.Grant(pid, methods...)
+	}
+	return acl
+}
+
+//Grant 授权节点访问方法，pid为ACLAnyPeer代表任意节点
+func (acl *ACL) Grant(pid string, methods ...string) {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	allowed := acl.rules[pid]
+	if allowed == nil {
+		allowed = make(map[string]bool)
+		acl.rules[pid] = allowed
+	}
+	for _, method := range methods {
+		allowed[method] = true
+	}
+}
+
+//Revoke 撤销节点访问方法的授权，不传方法撤销该节点的所有授权
+func (acl *ACL) Revoke(pid string, methods ...string) {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	if len(methods) == 0 {
+		delete(acl.rules, pid)
+		return
+	}
+
+	allowed := acl.rules[pid]
+	for _, method := range methods {
+		delete(allowed, method)
+	}
+}
+
+//Rules 节点ID对应允许访问的方法
+func (acl *ACL) Rules() map[string][]string {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	rules := make(map[string][]string)
+	for pid, allowed := range acl.rules {
+		for method := range allowed {
+			rules[pid] = append(rules[pid], method)
+		}
+	}
+	return rules
+}
+
+//IsAllowed 节点是否允许访问方法
+func (acl *ACL) IsAllowed(pid, method string) bool {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+
+	return matchACLMethod(acl.rules[pid], method) || matchACLMethod(acl.rules[ACLAnyPeer], method)
+}
+
+//matchACLMethod 方法是否匹配授权规则
+func matchACLMethod(allowed map[string]bool, method string) bool {
+	if allowed[method] {
+		return true
+	}
+	for pattern := range allowed {
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(method, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
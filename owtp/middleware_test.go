@@ -0,0 +1,233 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestACL(t *testing.T) {
+
+	acl := NewACL(map[string][]string{
+		"peerA":    {"getBalance", "getAddress"},
+		"peerB":    {"sign*"},
+		ACLAnyPeer: {"ping"},
+	})
+
+	tests := []struct {
+		pid     string
+		method  string
+		allowed bool
+	}{
+		{"peerA", "getBalance", true},
+		{"peerA", "signTransaction", false},
+		{"peerB", "signTransaction", true},
+		{"peerB", "getBalance", false},
+		{"peerC", "ping", true},
+		{"peerC", "getBalance", false},
+	}
+
+	for _, test := range tests {
+		if got := acl.IsAllowed(test.pid, test.method); got != test.allowed {
+			t.Errorf("IsAllowed(%s, %s) = %v, want %v", test.pid, test.method, got, test.allowed)
+		}
+	}
+
+	acl.Revoke("peerA", "getBalance")
+	if acl.IsAllowed("peerA", "getBalance") || !acl.IsAllowed("peerA", "getAddress") {
+		t.Errorf("Revoke method failed: %v", acl.Rules())
+	}
+
+	acl.Revoke("peerB")
+	if acl.IsAllowed("peerB", "signTransaction") {
+		t.Errorf("Revoke peer failed: %v", acl.Rules())
+	}
+}
+
+func TestPeerRateLimiter(t *testing.T) {
+
+	limiter := newPeerRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !limiter.allow("peerA", now) {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	if limiter.allow("peerA", now) {
+		t.Fatalf("request over burst should be denied")
+	}
+
+	//其他节点不受影响
+	if !limiter.allow("peerB", now) {
+		t.Fatalf("peerB should be allowed")
+	}
+
+	//0.5秒补充1个令牌
+	now = now.Add(500 * time.Millisecond)
+	if !limiter.allow("peerA", now) {
+		t.Fatalf("request after refill should be allowed")
+	}
+	if limiter.allow("peerA", now) {
+		t.Fatalf("request should be denied")
+	}
+
+	//补满的令牌桶被清理
+	now = now.Add(rateLimitSweepInterval)
+	if !limiter.allow("peerC", now) {
+		t.Fatalf("peerC should be allowed")
+	}
+	if len(limiter.buckets) != 1 || limiter.buckets["peerC"] == nil {
+		t.Fatalf("idle buckets are not evicted, buckets = %d", len(limiter.buckets))
+	}
+}
+
+func TestServeMux_Middlewares(t *testing.T) {
+
+	var calls []string
+
+	trace := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) {
+				calls = append(calls, name+":before")
+				next(ctx)
+				calls = append(calls, name+":after")
+			}
+		}
+	}
+
+	mux := NewServeMux(0)
+	mux.Use(RecoveryMiddleware(), trace("global"))
+	mux.HandleFunc("hello", func(ctx *Context) {
+		calls = append(calls, "hello")
+		ctx.Response(nil, StatusSuccess, "success")
+	}, trace("method"))
+	mux.HandleFunc("panic", func(ctx *Context) {
+		panic("boom")
+	})
+
+	ctx := NewContext(WSRequest, 1, "peerA", "hello", nil)
+	mux.handlerWithMiddlewares(mux.m["hello"], true)(ctx)
+	want := []string{"global:before", "method:before", "hello", "method:after", "global:after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+
+	ctx = NewContext(WSRequest, 2, "peerA", "panic", nil)
+	mux.handlerWithMiddlewares(mux.m["panic"], true)(ctx)
+	if ctx.Resp.Status != ErrInternalServerError || !ctx.stop {
+		t.Fatalf("panic response = %+v", ctx.Resp)
+	}
+
+	ctx = NewContext(WSRequest, 3, "peerA", "notExist", nil)
+	f, ok := mux.m["notExist"]
+	mux.handlerWithMiddlewares(f, ok)(ctx)
+	if ctx.Resp.Status != ErrNotFoundMethod {
+		t.Fatalf("not found response = %+v", ctx.Resp)
+	}
+}
+
+func TestOWTPNode_ACLMiddleware(t *testing.T) {
+
+	const addr = "127.0.0.1:8436"
+
+	queryClient := RandomOWTPNode()
+	defer queryClient.Close()
+	signClient := RandomOWTPNode()
+	defer signClient.Close()
+
+	//查询方法开放给queryClient，签名方法只开放给signClient
+	acl := NewACL(map[string][]string{
+		queryClient.NodeID(): {"get*"},
+		signClient.NodeID():  {"signTransaction"},
+	})
+
+	host := RandomOWTPNode()
+	host.Use(RecoveryMiddleware(), ACLMiddleware(acl), RateLimitMiddleware(0.01, 1))
+	host.HandleFunc("getBalance", func(ctx *Context) {
+		ctx.Response(nil, StatusSuccess, "success")
+	})
+	host.HandleFunc("signTransaction", func(ctx *Context) {
+		ctx.Response(nil, StatusSuccess, "success")
+	})
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket, EnableSignature: true})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	config := ConnectConfig{Address: addr, ConnectType: Websocket, EnableSignature: true, EnableKeyAgreement: true}
+
+	tests := []struct {
+		client *OWTPNode
+		method string
+		status uint64
+	}{
+		{queryClient, "getBalance", StatusSuccess},
+		{queryClient, "signTransaction", ErrForbidden},
+		{signClient, "signTransaction", StatusSuccess},
+		{signClient, "getBalance", ErrForbidden},
+	}
+
+	for _, test := range tests {
+		_, err = test.client.Connect(host.NodeID(), config)
+		if err != nil {
+			t.Fatalf("Connect unexpected error: %v", err)
+		}
+		resp, err := test.client.CallSync(host.NodeID(), test.method, nil)
+		if err != nil {
+			t.Fatalf("CallSync unexpected error: %v", err)
+		}
+		if resp.Status != test.status {
+			t.Errorf("client[%s] call %s status = %d, want %d", test.client.NodeID(), test.method, resp.Status, test.status)
+		}
+	}
+
+	//超过限流
+	resp, err := queryClient.CallSync(host.NodeID(), "getBalance", nil)
+	if err != nil {
+		t.Fatalf("CallSync unexpected error: %v", err)
+	}
+	if resp.Status != ErrTooManyRequests {
+		t.Errorf("status = %d, want %d", resp.Status, ErrTooManyRequests)
+	}
+
+	//未开启签名，对方公钥没有经过验证，冒用已授权节点也不能访问
+	unsigned := RandomOWTPNode()
+	unsigned.Use(ACLMiddleware(NewACL(map[string][]string{ACLAnyPeer: {"*"}})))
+	unsigned.HandleFunc("getBalance", func(ctx *Context) {
+		ctx.Response(nil, StatusSuccess, "success")
+	})
+	err = unsigned.Listen(ConnectConfig{Address: "127.0.0.1:8444", ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer unsigned.Close()
+
+	_, err = queryClient.Connect(unsigned.NodeID(), ConnectConfig{Address: "127.0.0.1:8444", ConnectType: Websocket, EnableKeyAgreement: true})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+	resp, err = queryClient.CallSync(unsigned.NodeID(), "getBalance", nil)
+	if err != nil {
+		t.Fatalf("CallSync unexpected error: %v", err)
+	}
+	if resp.Status != ErrUnauthorized {
+		t.Errorf("status without signature = %d, want %d", resp.Status, ErrUnauthorized)
+	}
+}
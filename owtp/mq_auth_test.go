@@ -0,0 +1,197 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mr-tron/base58/base58"
+)
+
+//mqTestPeer 模拟mq节点，双方都是主动连接，数据包编码后直接投递给对方节点
+type mqTestPeer struct {
+	pid    string
+	node   *OWTPNode
+	remote *mqTestPeer
+	_auth  *OWTPAuth
+	config ConnectConfig
+	sent   chan []byte
+}
+
+//newMQTestPeers 按mq的连接配置创建一对互连的节点
+func newMQTestPeers(t *testing.T, a, b *OWTPNode, config ConnectConfig) (*mqTestPeer, *mqTestPeer) {
+	newPeer := func(local, remote *OWTPNode) *mqTestPeer {
+		c := config
+		c.ConnectType = MQ
+		c.RemotePublicKey = base58.Encode(remote.Certificate().PublicKeyBytes())
+		pid, publicKey, err := remotePeerID("", c)
+		if err != nil {
+			t.Fatalf("remotePeerID unexpected error: %v", err)
+		}
+		auth, _ := NewOWTPAuthWithCertificate(local.cert, c.EnableSignature)
+		auth.remotePublicKey = publicKey
+		auth.certified = true
+		return &mqTestPeer{pid: pid, node: local, _auth: auth, config: c, sent: make(chan []byte, 100)}
+	}
+
+	peerA, peerB := newPeer(a, b), newPeer(b, a)
+	peerA.remote, peerB.remote = peerB, peerA
+	a.AddOnlinePeer(peerA)
+	b.AddOnlinePeer(peerB)
+	return peerA, peerB
+}
+
+func (p *mqTestPeer) PID() string                  { return p.pid }
+func (p *mqTestPeer) IsHost() bool                 { return true }
+func (p *mqTestPeer) IsConnected() bool            { return true }
+func (p *mqTestPeer) LocalAddr() net.Addr          { return &MqAddr{NetWork: "local"} }
+func (p *mqTestPeer) RemoteAddr() net.Addr         { return &MqAddr{NetWork: "remote"} }
+func (p *mqTestPeer) ConnectConfig() ConnectConfig { return p.config }
+func (p *mqTestPeer) EnableKeyAgreement() bool     { return p._auth.EnableKeyAgreement() }
+func (p *mqTestPeer) auth() Authorization          { return p._auth }
+func (p *mqTestPeer) setHandler(PeerHandler) error { return nil }
+func (p *mqTestPeer) openPipe() error              { return nil }
+func (p *mqTestPeer) packetVersion() int64         { return DataPacketVersionV1 }
+func (p *mqTestPeer) close() error                 { return nil }
+
+func (p *mqTestPeer) send(data DataPacket) error {
+	raw, err := EncodeDataPacket(data)
+	if err != nil {
+		return err
+	}
+	select {
+	case p.sent <- raw:
+	default:
+	}
+	packet, err := DecodeDataPacket(raw)
+	if err != nil {
+		return err
+	}
+	go p.remote.node.OnPeerNewDataPacketReceived(p.remote, packet)
+	return nil
+}
+
+func mqGetInfo(ctx *Context) {
+	ctx.Response(map[string]interface{}{"name": ctx.Params().Get("name").String()}, StatusSuccess, "success")
+}
+
+func TestRemotePeerID(t *testing.T) {
+
+	node := RandomOWTPNode()
+	publicKey := base58.Encode(node.Certificate().PublicKeyBytes())
+
+	pid, _, err := remotePeerID("", ConnectConfig{ConnectType: MQ, EnableSignature: true, RemotePublicKey: publicKey})
+	if err != nil || pid != node.NodeID() {
+		t.Errorf("remotePeerID = %s, err = %v, want %s", pid, err, node.NodeID())
+	}
+
+	//mq开启签名必须配置对方证书公钥
+	if _, _, err = remotePeerID(node.NodeID(), ConnectConfig{ConnectType: MQ, EnableSignature: true}); err == nil {
+		t.Errorf("mq signature without remotePublicKey should fail")
+	}
+
+	//pid与证书公钥不一致
+	if _, _, err = remotePeerID("hello", ConnectConfig{ConnectType: MQ, RemotePublicKey: publicKey}); err == nil {
+		t.Errorf("pid not matched with remotePublicKey should fail")
+	}
+
+	//不开启签名保持原有行为
+	if pid, _, err = remotePeerID("hello", ConnectConfig{ConnectType: MQ}); err != nil || pid != "hello" {
+		t.Errorf("remotePeerID = %s, err = %v", pid, err)
+	}
+}
+
+func TestMQPeer_KeyAgreement(t *testing.T) {
+
+	a, b := RandomOWTPNode(), RandomOWTPNode()
+	defer a.Close()
+	defer b.Close()
+	a.HandleFunc("getInfo", mqGetInfo)
+	b.HandleFunc("getInfo", mqGetInfo)
+
+	peerA, peerB := newMQTestPeers(t, a, b, ConnectConfig{EnableSignature: true, EnableKeyAgreement: true})
+
+	//双方同时连接，只有一方发起协商密码
+	if a.isKeyAgreementInitiator(peerA) == b.isKeyAgreementInitiator(peerB) {
+		t.Fatalf("both peers have the same key agreement role")
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- a.startKeyAgreement(peerA, "aes") }()
+	go func() { errs <- b.startKeyAgreement(peerB, "aes") }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("startKeyAgreement unexpected error: %v", err)
+		}
+	}
+
+	//双方都可以发起加密请求
+	for _, test := range []struct {
+		caller *OWTPNode
+		peer   *mqTestPeer
+	}{{a, peerA}, {b, peerB}, {a, peerA}} {
+		for len(test.peer.sent) > 0 {
+			<-test.peer.sent
+		}
+		resp, err := test.caller.CallSync(test.peer.PID(), "getInfo", map[string]interface{}{"name": "chance"})
+		if err != nil {
+			t.Fatalf("CallSync unexpected error: %v", err)
+		}
+		if resp.Status != StatusSuccess || resp.JsonData().Get("name").String() != "chance" {
+			t.Errorf("response status = %d, msg = %s, result = %s", resp.Status, resp.Msg, resp.JsonData().Raw)
+		}
+		if raw := <-test.peer.sent; bytes.Contains(raw, []byte("chance")) {
+			t.Errorf("request is not encrypted: %s", raw)
+		}
+	}
+}
+
+func TestMQPeer_Certified(t *testing.T) {
+
+	a, b, c := RandomOWTPNode(), RandomOWTPNode(), RandomOWTPNode()
+	defer a.Close()
+	defer b.Close()
+	defer c.Close()
+	b.HandleFunc("getInfo", mqGetInfo)
+
+	_, peerB := newMQTestPeers(t, a, b, ConnectConfig{EnableSignature: true})
+
+	//其他证书签名的请求被拒绝
+	forger, _ := NewOWTPAuthWithCertificate(c.cert, true)
+	packet := DataPacket{Method: "getInfo", Req: WSRequest, Nonce: 1, Timestamp: 1528520843,
+		Data: map[string]interface{}{"name": "chance"}, Version: DataPacketVersionV1}
+	forger.GenerateSignature(&packet)
+	if peerB._auth.VerifySignature(&packet) {
+		t.Errorf("packet signed by other certificate should not be verified")
+	}
+
+	//其他证书发起的协商密码被拒绝
+	ka := &KeyAgreement{EncryptType: "aes"}
+	forger.InitKeyAgreement(ka)
+	ka.PublicKeyResponder = base58.Encode(b.cert.PublicKeyBytes())
+	ka.PrivateKeyResponder = base58.Encode(b.cert.PrivateKeyBytes())
+	if err := peerB._auth.RequestKeyAgreement(ka); err == nil {
+		t.Errorf("key agreement initiated by other certificate should fail")
+	}
+
+	//对方证书签名的请求通过
+	signer, _ := NewOWTPAuthWithCertificate(a.cert, true)
+	signer.GenerateSignature(&packet)
+	if !peerB._auth.VerifySignature(&packet) {
+		t.Errorf("packet signed by remote certificate should be verified")
+	}
+}
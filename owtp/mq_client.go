@@ -16,13 +16,11 @@
 package owtp
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/gorilla/websocket"
 	"github.com/streadway/amqp"
-	"github.com/tidwall/gjson"
 	"net"
 	"sync"
 )
@@ -43,10 +41,16 @@ type MQClient struct {
 	closeOnce       sync.Once
 	done            func()
 	config          ConnectConfig //节点配置
+	framer          packetFramer  //传输帧的分片与压缩
 }
 
 // Dial connects a client to the given URL.
 func MQDial(pid, url string, handler PeerHandler) (*MQClient, error) {
+	return MQDialWithAuth(pid, url, handler, nil, ConnectConfig{})
+}
+
+//MQDialWithAuth 连接mq服务，auth为节点的授权规则，打开通道前设置授权规则和配置
+func MQDialWithAuth(pid, url string, handler PeerHandler, auth Authorization, config ConnectConfig) (*MQClient, error) {
 
 	if handler == nil {
 		return nil, errors.New("hander should not be nil! ")
@@ -68,11 +72,14 @@ func MQDial(pid, url string, handler PeerHandler) (*MQClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	client, err := NewMQClient(pid, conn, channel, handler, nil, nil)
+	client, err := NewMQClient(pid, conn, channel, handler, auth, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	client.config = config
+	client.framer.setOptions(frameOptionsFromConfig(config))
+
 	client.isConnect = true
 	client.isHost = true //我方主动连接
 	client.handler.OnPeerOpen(client)
@@ -130,6 +137,11 @@ func (c *MQClient) IsConnected() bool {
 	return c.isConnect
 }
 
+//packetVersion MQ没有握手过程，发送请求使用v1，响应与请求的版本一致
+func (c *MQClient) packetVersion() int64 {
+	return DataPacketVersionV1
+}
+
 func (c *MQClient) ConnectConfig() ConnectConfig {
 	return c.config
 }
@@ -182,12 +194,14 @@ func (c *MQClient) RemoteAddr() net.Addr {
 //Send 发送消息
 func (c *MQClient) send(data DataPacket) error {
 
-	respBytes, err := json.Marshal(data)
+	frames, err := c.framer.encode(data)
 	if err != nil {
 		return err
 	}
 
-	c._send <- respBytes
+	for _, frame := range frames {
+		c._send <- frame
+	}
 	return nil
 }
 
@@ -275,10 +289,15 @@ func (c *MQClient) readPump() {
 	go func() {
 		//fmt.Println(*msgs)
 		for d := range messages {
-			packet := NewDataPacket(gjson.ParseBytes(d.Body))
+			packets, err := c.framer.decode(d.Body)
+			if err != nil {
+				log.Error("peer:", c.PID(), "decode data packet unexpected error: ", err)
+			}
 			fmt.Printf("packet：%s", string(d.Body))
-			//开一个goroutine处理消息
-			go c.handler.OnPeerNewDataPacketReceived(c, packet)
+			for _, packet := range packets {
+				//开一个goroutine处理消息
+				go c.handler.OnPeerNewDataPacketReceived(c, packet)
+			}
 		}
 	}()
 
@@ -0,0 +1,381 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+//数据包v2使用的MessagePack编码，只支持数据包需要的类型：
+//nil，bool，整数，浮点数，字符串，二进制，数组，键为字符串的map。
+//map按键排序编码，相同的值总是得到相同的字节，可用于签名
+
+//msgpackExtJSONNumber 扩展类型：无法用整数表示的json数字，保存原文避免精度丢失
+const msgpackExtJSONNumber = 1
+
+//msgpackMarshal 编码为MessagePack
+func msgpackMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpackEncode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//msgpackUnmarshal 解码MessagePack，整数为int64（超出范围为uint64），
+//数组为[]interface{}，map为map[string]interface{}
+func msgpackUnmarshal(data []byte) (interface{}, error) {
+	d := &msgpackDecoder{data: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+func msgpackEncode(buf *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if val {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int:
+		msgpackEncodeInt(buf, int64(val))
+	case int64:
+		msgpackEncodeInt(buf, val)
+	case uint64:
+		msgpackEncodeUint(buf, val)
+	case float64:
+		buf.WriteByte(0xcb)
+		msgpackWriteUint(buf, math.Float64bits(val), 8)
+	case json.Number:
+		s := val.String()
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			msgpackEncodeInt(buf, i)
+		} else if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			msgpackEncodeUint(buf, u)
+		} else {
+			msgpackEncodeExt(buf, msgpackExtJSONNumber, []byte(s))
+		}
+	case string:
+		msgpackEncodeHeader(buf, len(val), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(val)
+	case []byte:
+		msgpackEncodeHeader(buf, len(val), 0, 0, 0xc4, 0xc5, 0xc6)
+		buf.Write(val)
+	case []interface{}:
+		msgpackEncodeHeader(buf, len(val), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range val {
+			if err := msgpackEncode(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		msgpackEncodeHeader(buf, len(val), 0x80, 16, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := msgpackEncode(buf, k); err != nil {
+				return err
+			}
+			if err := msgpackEncode(buf, val[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
+
+//msgpackEncodeHeader 编码长度头，fix为0表示不支持fix格式，code8为0表示不支持8位长度
+func msgpackEncodeHeader(buf *bytes.Buffer, n int, fix byte, fixLimit int, code8, code16, code32 byte) {
+	switch {
+	case fix != 0 && n < fixLimit:
+		buf.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(code8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		msgpackWriteUint(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(code32)
+		msgpackWriteUint(buf, uint64(n), 4)
+	}
+}
+
+func msgpackEncodeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		msgpackEncodeUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		msgpackWriteUint(buf, uint64(i), 2)
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		msgpackWriteUint(buf, uint64(i), 4)
+	default:
+		buf.WriteByte(0xd3)
+		msgpackWriteUint(buf, uint64(i), 8)
+	}
+}
+
+func msgpackEncodeUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		msgpackWriteUint(buf, u, 2)
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		msgpackWriteUint(buf, u, 4)
+	default:
+		buf.WriteByte(0xcf)
+		msgpackWriteUint(buf, u, 8)
+	}
+}
+
+func msgpackEncodeExt(buf *bytes.Buffer, typ int8, data []byte) {
+	msgpackEncodeHeader(buf, len(data), 0, 0, 0xc7, 0xc8, 0xc9)
+	buf.WriteByte(byte(typ))
+	buf.Write(data)
+}
+
+//msgpackWriteUint 大端写入n个字节
+func msgpackWriteUint(buf *bytes.Buffer, u uint64, n int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], u)
+	buf.Write(b[8-n:])
+}
+
+//msgpackDecoder MessagePack解码器
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+//read 读取n个字节
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("msgpack: unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+//readUint 大端读取n个字节的无符号整数
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (d *msgpackDecoder) readLen(n int) (int, error) {
+	u, err := d.readUint(n)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.data)-d.pos) {
+		return 0, fmt.Errorf("msgpack: length %d out of range", u)
+	}
+	return int(u), nil
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	head, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	c := head[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return d.decodeMap(int(c & 0x0f))
+	case c >= 0x90 && c <= 0x9f:
+		return d.decodeArray(int(c & 0x0f))
+	case c >= 0xa0 && c <= 0xbf:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLen(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLen(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		u, err := d.readUint(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(u))), nil
+	case 0xcb:
+		u, err := d.readUint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(u), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.readUint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		u, err := d.readUint(n)
+		if err != nil {
+			return nil, err
+		}
+		//符号扩展
+		shift := uint(64 - n*8)
+		return int64(u<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLen(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLen(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n)
+	case 0xde, 0xdf:
+		n, err := d.readLen(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n)
+	}
+
+	return nil, fmt.Errorf("msgpack: invalid code 0x%x", c)
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int) (interface{}, error) {
+	arr := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key must be string, got %T", k)
+		}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (d *msgpackDecoder) decodeExt(n int) (interface{}, error) {
+	typ, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) != msgpackExtJSONNumber {
+		return nil, fmt.Errorf("msgpack: unsupported ext type %d", int8(typ[0]))
+	}
+	return json.Number(b), nil
+}
@@ -17,9 +17,9 @@
 package owtp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/astaxie/beego/cache"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/pkg/errors"
 	"github.com/tidwall/gjson"
@@ -51,9 +51,10 @@ type RequestFunc func(resp Response)
 type RequestQueue map[uint64]requestEntry
 
 type muxEntry struct {
-	h      HandlerFunc
-	method string
-	inner  bool
+	h           HandlerFunc
+	method      string
+	inner       bool
+	middlewares []Middleware
 }
 
 type requestEntry struct {
@@ -70,6 +71,72 @@ type Response struct {
 	Result interface{} `json:"result"`
 }
 
+//errorCoder 带错误编号的错误，与openwallet.ErrorCoder一致
+type errorCoder interface {
+	Code() uint64
+	Message() string
+}
+
+//ResponseError 响应的错误，实现了openwallet.ErrorCoder
+type ResponseError struct {
+	Status uint64
+	Msg    string
+}
+
+//Error 错误信息
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("[%d]%s", e.Status, e.Msg)
+}
+
+//Code 错误编号，即响应的Status
+func (e *ResponseError) Code() uint64 {
+	return e.Status
+}
+
+//Message 不含错误编号的错误信息
+func (e *ResponseError) Message() string {
+	return e.Msg
+}
+
+//Err 响应的错误，Status为StatusSuccess时返回nil
+func (resp *Response) Err() error {
+	if resp.Status == StatusSuccess {
+		return nil
+	}
+	return &ResponseError{Status: resp.Status, Msg: resp.Msg}
+}
+
+//CallCanceledError 请求在响应前被调用方的context取消或超时
+type CallCanceledError struct {
+	PID    string
+	Method string
+	Nonce  uint64
+	Err    error //context.Canceled或context.DeadlineExceeded
+}
+
+//Error 错误信息
+func (e *CallCanceledError) Error() string {
+	return fmt.Sprintf("OWTP: call peer[%s] method[%s] canceled: %v", e.PID, e.Method, e.Err)
+}
+
+//Unwrap 返回context的错误，可使用errors.Is判断
+func (e *CallCanceledError) Unwrap() error {
+	return e.Err
+}
+
+//Code 错误编号，context超时为ErrRequestTimeout，否则为ErrRequestCanceled
+func (e *CallCanceledError) Code() uint64 {
+	if e.Err == context.DeadlineExceeded {
+		return ErrRequestTimeout
+	}
+	return ErrRequestCanceled
+}
+
+//Message 不含错误编号的错误信息
+func (e *CallCanceledError) Message() string {
+	return e.Error()
+}
+
 type Param struct {
 	rawValue interface{}
 }
@@ -99,6 +166,8 @@ type Context struct {
 	Peer Peer
 	//数据包版本
 	Version int64
+	//请求时间戳
+	timestamp int64
 }
 
 //NewContext
@@ -138,6 +207,23 @@ func (ctx *Context) Response(result interface{}, status uint64, msg string) {
 	ctx.Resp = resp
 }
 
+//ResponseError 以错误响应。
+//err带有错误编号时（实现了Code() uint64与Message() string，例如*openwallet.Error），
+//Status为该错误编号，Msg为不含编号的错误信息；否则Status为ErrCustomError，Msg为err.Error()。
+//openwallet的错误编号从1000开始，与OWTP协议的状态码（小于1000）不会冲突，
+//请求方通过Response.Err()还原错误，再用openwallet.ConvertError转为*openwallet.Error。
+func (ctx *Context) ResponseError(result interface{}, err error) {
+	if err == nil {
+		ctx.Response(result, StatusSuccess, "success")
+		return
+	}
+	if coder, ok := err.(errorCoder); ok {
+		ctx.Response(result, coder.Code(), coder.Message())
+		return
+	}
+	ctx.Response(result, ErrCustomError, err.Error())
+}
+
 // ResponseStopRun 中断操作，Context.stop = true，将不再执行后面的绑定的业务
 // 并完成Response处理
 func (ctx *Context) ResponseStopRun(result interface{}, status uint64, msg string) {
@@ -188,34 +274,39 @@ type ServeMux struct {
 	startRequestTimeoutCheck bool
 	//节点的请求队列
 	peerRequest map[string]RequestQueue
-	//请求缓存
-	peerRequestCache cache.Cache
+	//已使用的请求nonce存储
+	nonceStore NonceStore
 	//请求nonce的市场限制
 	requestNonceLimit time.Duration
+	//全局中间件，按添加顺序由外到内执行
+	middlewares []Middleware
 }
 
 func NewServeMux(timeoutSEC int) *ServeMux {
-	//6小时清理一次内存中的请求nonce
-	cache, err := cache.NewCache("memory", `{"interval":21600}`)
-	if err != nil {
-		log.Error("NewServeMux unexpected err:", err)
-	}
 
 	serveMux := ServeMux{
 		timeout:           time.Duration(timeoutSEC) * time.Second,
 		peerRequest:       make(map[string]RequestQueue),
 		m:                 make(map[string]muxEntry),
-		peerRequestCache:  cache,
+		nonceStore:        NewMemoryNonceStore(),
 		requestNonceLimit: replayLimit,
 	}
 	return &serveMux
 }
 
+//SetNonceStore 设置已使用的请求nonce存储
+func (mux *ServeMux) SetNonceStore(store NonceStore) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.nonceStore = store
+}
+
 //HandleFunc 路由处理器绑定
 //@param method API方法名
 //@param handler 处理方法入口
-func (mux *ServeMux) HandleFunc(method string, handler HandlerFunc) {
-	mux.handleFunc(method, handler, false)
+//@param middlewares 只作用于该方法的中间件，在全局中间件之后执行
+func (mux *ServeMux) HandleFunc(method string, handler HandlerFunc, middlewares ...Middleware) {
+	mux.handleFunc(method, handler, false, middlewares...)
 }
 
 //handleFuncInner 设置内置方法
@@ -227,7 +318,7 @@ func (mux *ServeMux) handleFuncInner(method string, handler HandlerFunc) {
 //@param method API方法名
 //@param handler 处理方法入口
 //@param handler 是否内置方法
-func (mux *ServeMux) handleFunc(method string, handler HandlerFunc, inner bool) {
+func (mux *ServeMux) handleFunc(method string, handler HandlerFunc, inner bool, middlewares ...Middleware) {
 	mux.mu.Lock()
 	defer mux.mu.Unlock()
 
@@ -244,7 +335,7 @@ func (mux *ServeMux) handleFunc(method string, handler HandlerFunc, inner bool)
 	if mux.m == nil {
 		mux.m = make(map[string]muxEntry)
 	}
-	mux.m[method] = muxEntry{h: handler, method: method, inner: inner}
+	mux.m[method] = muxEntry{h: handler, method: method, inner: inner, middlewares: middlewares}
 
 }
 
@@ -266,7 +357,7 @@ func (mux *ServeMux) AddRequest(peer Peer, nonce uint64, time int64, method stri
 	pid := peer.PID()
 
 	if !mux.startRequestTimeoutCheck {
-		go mux.timeoutRequestHandle()
+		mux.startTimeoutCheck()
 	}
 
 	requestQueue := mux.peerRequest[pid]
@@ -354,14 +445,11 @@ func (mux *ServeMux) ServeOWTP(pid string, ctx *Context) {
 			}
 
 			if !ctx.stop {
-				//路由方法存在
-				if ok {
-					//执行路由方法
+				//执行路由方法，内置方法不经过中间件
+				if ok && f.inner {
 					f.h(ctx)
-
 				} else {
-					//找不到方法的处理
-					ctx.Resp = responseError("can not find method", ErrNotFoundMethod)
+					mux.handlerWithMiddlewares(f, ok)(ctx)
 				}
 			}
 
@@ -376,9 +464,6 @@ func (mux *ServeMux) ServeOWTP(pid string, ctx *Context) {
 			}
 		}
 
-		//添加已完成的请求
-		mux.completeRequest(ctx)
-
 	case WSResponse: //我方请求后，对方响应返回
 		mux.mu.Lock()
 
@@ -387,8 +472,11 @@ func (mux *ServeMux) ServeOWTP(pid string, ctx *Context) {
 			log.Error("peer:", pid, "requestQueue is nil.")
 			return
 		}
-		f := requestQueue[ctx.nonce]
-		if f.method == ctx.Method {
+		f, exist := requestQueue[ctx.nonce]
+		if !exist {
+			//请求已超时或被调用方取消
+			log.Debug("peer:", pid, "request nonce:", ctx.nonce, "has been removed.")
+		} else if f.method == ctx.Method {
 			//log.Printf("f: %v", f)
 			if f.sync {
 				f.respChan <- ctx.Resp
@@ -410,13 +498,19 @@ func (mux *ServeMux) ServeOWTP(pid string, ctx *Context) {
 	}
 }
 
-// timeoutRequestHandle 超时请求检查
-func (mux *ServeMux) timeoutRequestHandle() {
+//startTimeoutCheck 启动超时请求检查，调用方需持有mux.mu
+func (mux *ServeMux) startTimeoutCheck() {
+	mux.startRequestTimeoutCheck = true
 	if mux.timeout == 0 {
 		mux.timeout = DefaultTimoutSEC * time.Second
 	}
+	go mux.timeoutRequestHandle(mux.timeout)
+}
+
+// timeoutRequestHandle 超时请求检查
+func (mux *ServeMux) timeoutRequestHandle(timeout time.Duration) {
 
-	period := (mux.timeout * 6) / 10
+	period := (timeout * 6) / 10
 	//log.Debug("mux.timeout:", mux.timeout)
 	//log.Debug("period:", period)
 	ticker := time.NewTicker(period) //检查超时过程要<超时时间
@@ -424,8 +518,6 @@ func (mux *ServeMux) timeoutRequestHandle() {
 		ticker.Stop()
 	}()
 
-	mux.startRequestTimeoutCheck = true
-
 	for {
 		select {
 		case <-ticker.C:
@@ -471,23 +563,6 @@ func (mux *ServeMux) timeoutRequestHandle() {
 	}
 }
 
-//completeRequest
-func (mux *ServeMux) completeRequest(ctx *Context) {
-
-	//如果节点没有开启签名授权，不需要检查nonce重放，没有意义
-	if !ctx.Peer.auth().EnableAuth() {
-		return
-	}
-
-	//添加已完成的请求
-	if mux.peerRequestCache != nil {
-		mux.peerRequestCache.Put(
-			fmt.Sprintf("%s_%d", ctx.PID, ctx.nonce),
-			ctx.Method,
-			mux.requestNonceLimit)
-	}
-}
-
 //checkNonceReplay 检查nonce是否重放
 func (mux *ServeMux) checkNonceReplay(ctx *Context) bool {
 
@@ -499,6 +574,16 @@ func (mux *ServeMux) checkNonceReplay(ctx *Context) bool {
 	//检查
 	status, errMsg := mux.checkNonceReplayReason(ctx.PID, ctx.nonce)
 
+	//时间戳超过重放限制时长，nonce记录可能已过期，拒绝请求
+	if status == StatusSuccess {
+		status, errMsg = mux.checkTimestampReason(ctx.timestamp, time.Now())
+	}
+
+	//执行请求前记录nonce，相同nonce的并发请求只有一个能执行
+	if status == StatusSuccess {
+		status, errMsg = mux.claimNonceReason(ctx.PID, ctx.nonce)
+	}
+
 	if status != StatusSuccess {
 		resp := Response{
 			Status: status,
@@ -522,9 +607,46 @@ func (mux *ServeMux) checkNonceReplayReason(pid string, nonce uint64) (uint64, s
 	}
 
 	//检查是否重放
-	if mux.peerRequestCache.IsExist(fmt.Sprintf("%s_%d", pid, nonce)) {
+	if mux.nonceStore != nil && mux.nonceStore.IsExist(pid, nonce) {
 		return ErrReplayAttack, "this is a replay attack"
 	}
 
 	return StatusSuccess, ""
 }
+
+//claimNonceReason 记录请求nonce，已使用或存储出错都拒绝请求
+func (mux *ServeMux) claimNonceReason(pid string, nonce uint64) (uint64, string) {
+
+	if mux.nonceStore == nil {
+		return StatusSuccess, ""
+	}
+
+	claimed, err := mux.nonceStore.Claim(pid, nonce, mux.requestNonceLimit)
+	if err != nil {
+		log.Error("save request nonce failed, unexpected err:", err)
+		return ErrReplayAttack, "request nonce can not be saved"
+	}
+	if !claimed {
+		return ErrReplayAttack, "this is a replay attack"
+	}
+
+	return StatusSuccess, ""
+}
+
+//checkTimestampReason 检查请求时间戳是否在重放限制时长内
+func (mux *ServeMux) checkTimestampReason(timestamp int64, now time.Time) (uint64, string) {
+
+	if timestamp == 0 {
+		return ErrReplayAttack, "no timestamp"
+	}
+
+	diff := now.Sub(time.Unix(timestamp, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > mux.requestNonceLimit {
+		return ErrReplayAttack, "timestamp is out of replay limit"
+	}
+
+	return StatusSuccess, ""
+}
@@ -16,8 +16,11 @@
 package owtp
 
 import (
+	"fmt"
 	"testing"
 	"time"
+
+	"github.com/blocktree/openwallet/v2/openwallet"
 )
 
 func TestRequestReplayAttack(t *testing.T) {
@@ -53,3 +56,28 @@ func TestRequestReplayAttack(t *testing.T) {
 	status, msg = mux.checkNonceReplayReason("1", 1)
 	t.Logf("status = %d, msg = %s", status, msg)
 }
+
+func TestContext_ResponseError(t *testing.T) {
+
+	ctx := NewContext(WSRequest, 1, "1", "getBalance", nil)
+	ctx.ResponseError(nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "balance is not enough"))
+	if ctx.Resp.Status != openwallet.ErrInsufficientBalanceOfAccount || ctx.Resp.Msg != "balance is not enough" {
+		t.Fatalf("response = %+v", ctx.Resp)
+	}
+
+	//请求方还原错误
+	owErr := openwallet.ConvertError(ctx.Resp.Err())
+	if owErr.Code() != openwallet.ErrInsufficientBalanceOfAccount || owErr.Message() != "balance is not enough" {
+		t.Fatalf("converted error = %v", owErr)
+	}
+
+	ctx.ResponseError(nil, fmt.Errorf("plain error"))
+	if ctx.Resp.Status != ErrCustomError || ctx.Resp.Msg != "plain error" {
+		t.Fatalf("response = %+v", ctx.Resp)
+	}
+
+	ctx.ResponseError("ok", nil)
+	if ctx.Resp.Status != StatusSuccess || ctx.Resp.Err() != nil {
+		t.Fatalf("response = %+v", ctx.Resp)
+	}
+}
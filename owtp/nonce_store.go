@@ -0,0 +1,322 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/astaxie/beego/cache"
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/blocktree/openwallet/v2/session"
+	bolt "go.etcd.io/bbolt"
+)
+
+//NonceStore 已使用的请求nonce存储，用于防重放攻击。
+//需要跨重启或多节点共享时，使用StormNonceStore或SessionNonceStore
+type NonceStore interface {
+	//IsExist 节点的nonce是否已使用，存储出错时视为已使用
+	IsExist(pid string, nonce uint64) bool
+	//Put 记录节点已使用的nonce，expiration后过期
+	Put(pid string, nonce uint64, expiration time.Duration) error
+	//Claim nonce未使用时记录并返回true，已使用返回false，检查与记录是原子的
+	Claim(pid string, nonce uint64, expiration time.Duration) (bool, error)
+}
+
+//nonceKey nonce的存储键
+func nonceKey(pid string, nonce uint64) string {
+	return fmt.Sprintf("%s_%d", pid, nonce)
+}
+
+//MemoryNonceStore 内存存储，节点重启后丢失，默认使用
+type MemoryNonceStore struct {
+	cache cache.Cache
+	mu    sync.Mutex
+}
+
+//NewMemoryNonceStore 创建内存存储，6小时清理一次过期的nonce
+func NewMemoryNonceStore() *MemoryNonceStore {
+	c, err := cache.NewCache("memory", `{"interval":21600}`)
+	if err != nil {
+		log.Error("NewMemoryNonceStore unexpected err:", err)
+	}
+	return &MemoryNonceStore{cache: c}
+}
+
+//IsExist 节点的nonce是否已使用
+func (store *MemoryNonceStore) IsExist(pid string, nonce uint64) bool {
+	if store.cache == nil {
+		return false
+	}
+	return store.cache.IsExist(nonceKey(pid, nonce))
+}
+
+//Put 记录节点已使用的nonce
+func (store *MemoryNonceStore) Put(pid string, nonce uint64, expiration time.Duration) error {
+	if store.cache == nil {
+		return fmt.Errorf("nonce cache is not initialized")
+	}
+	return store.cache.Put(nonceKey(pid, nonce), true, expiration)
+}
+
+//Claim 记录未使用的nonce
+func (store *MemoryNonceStore) Claim(pid string, nonce uint64, expiration time.Duration) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.IsExist(pid, nonce) {
+		return false, nil
+	}
+	if err := store.Put(pid, nonce, expiration); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+const (
+	//nonce的存储桶
+	nonceBucket = "owtp_nonce"
+	//清理过期nonce的间隔
+	nonceGCInterval = 10 * time.Minute
+)
+
+//StormNonceStore 基于storm/bbolt文件的存储，节点重启后保留
+type StormNonceStore struct {
+	db   *storm.DB
+	stop chan struct{}
+	once sync.Once
+}
+
+//NewStormNonceStore 打开nonce存储文件，并定时清理过期的nonce
+func NewStormNonceStore(dbFile string) (*StormNonceStore, error) {
+	db, err := storm.Open(dbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &StormNonceStore{
+		db:   db,
+		stop: make(chan struct{}),
+	}
+
+	go store.gc()
+
+	return store, nil
+}
+
+//IsExist 节点的nonce是否已使用
+func (store *StormNonceStore) IsExist(pid string, nonce uint64) bool {
+	var expired int64
+	err := store.db.Get(nonceBucket, nonceKey(pid, nonce), &expired)
+	if err == storm.ErrNotFound {
+		return false
+	}
+	if err != nil {
+		//读取出错不能放行重放的请求
+		log.Error("StormNonceStore get nonce failed, unexpected err:", err)
+		return true
+	}
+	return time.Now().Unix() <= expired
+}
+
+//Put 记录节点已使用的nonce
+func (store *StormNonceStore) Put(pid string, nonce uint64, expiration time.Duration) error {
+	expired := time.Now().Add(expiration).Unix()
+	return store.db.Set(nonceBucket, nonceKey(pid, nonce), expired)
+}
+
+//Claim 在同一个事务中检查并记录nonce
+func (store *StormNonceStore) Claim(pid string, nonce uint64, expiration time.Duration) (bool, error) {
+	claimed := false
+	codec := store.db.Codec()
+	err := store.db.Bolt.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(nonceBucket))
+		if err != nil {
+			return err
+		}
+		key := []byte(nonceKey(pid, nonce))
+		now := time.Now()
+		if v := bucket.Get(key); v != nil {
+			var expired int64
+			if err := codec.Unmarshal(v, &expired); err != nil {
+				return err
+			}
+			if now.Unix() <= expired {
+				return nil
+			}
+		}
+		value, err := codec.Marshal(now.Add(expiration).Unix())
+		if err != nil {
+			return err
+		}
+		if err = bucket.Put(key, value); err != nil {
+			return err
+		}
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+//DeleteExpired 删除过期的nonce
+func (store *StormNonceStore) DeleteExpired() error {
+	now := time.Now().Unix()
+	codec := store.db.Codec()
+	return store.db.Bolt.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(nonceBucket))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			//跳过storm的元数据子桶
+			if v == nil {
+				continue
+			}
+			var expired int64
+			if err := codec.Unmarshal(v, &expired); err != nil || expired < now {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+//Close 关闭存储文件
+func (store *StormNonceStore) Close() error {
+	store.once.Do(func() {
+		close(store.stop)
+	})
+	return store.db.Close()
+}
+
+//gc 定时清理过期的nonce
+func (store *StormNonceStore) gc() {
+	ticker := time.NewTicker(nonceGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := store.DeleteExpired(); err != nil {
+				log.Error("StormNonceStore delete expired nonce failed, unexpected err:", err)
+			}
+		case <-store.stop:
+			return
+		}
+	}
+}
+
+//SessionNonceStore 基于session provider（redis等）的存储。
+//每个nonce保存为一个会话，过期时间为provider的Maxlifetime，不小于replayLimit。
+//provider实现session.Claimer（如redis，redis_cluster）时Claim是跨进程原子的，多个节点可共享；
+//其他provider的Claim只在本节点内原子，只适用于单节点
+type SessionNonceStore struct {
+	provider session.Provider
+	config   *session.ManagerConfig
+	mu       sync.Mutex
+}
+
+//NewSessionNonceStore 创建session provider存储，参数与NewSessionManager一致
+func NewSessionNonceStore(provideName string, cf *session.ManagerConfig) (*SessionNonceStore, error) {
+	provider, err := session.GetProvider(provideName)
+	if err != nil {
+		return nil, err
+	}
+
+	//复制配置，不修改调用方的配置
+	config := session.ManagerConfig{}
+	if cf != nil {
+		config = *cf
+	}
+	cf = &config
+
+	if limit := int64(replayLimit / time.Second); cf.Maxlifetime < limit {
+		cf.Maxlifetime = limit
+	}
+	if cf.Gclifetime == 0 {
+		cf.Gclifetime = int64(nonceGCInterval / time.Second)
+	}
+
+	err = provider.SessionInit(cf.Maxlifetime, cf.ProviderConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionNonceStore{
+		provider: provider,
+		config:   cf,
+	}, nil
+}
+
+//sessionID nonce的会话ID
+func (store *SessionNonceStore) sessionID(pid string, nonce uint64) string {
+	return store.config.SessionIDPrefix + "owtp_nonce_" + nonceKey(pid, nonce)
+}
+
+//IsExist 节点的nonce是否已使用，provider出错时视为已使用
+func (store *SessionNonceStore) IsExist(pid string, nonce uint64) bool {
+	sess, err := store.provider.SessionRead(store.sessionID(pid, nonce))
+	if err != nil {
+		log.Error("SessionNonceStore read nonce failed, unexpected err:", err)
+		return true
+	}
+	return sess.Get("expired") != nil
+}
+
+//Put 记录节点已使用的nonce，过期时间由provider决定
+func (store *SessionNonceStore) Put(pid string, nonce uint64, expiration time.Duration) error {
+	sess, err := store.provider.SessionRead(store.sessionID(pid, nonce))
+	if err != nil {
+		return err
+	}
+	err = sess.Set("expired", time.Now().Add(expiration).Unix())
+	if err != nil {
+		return err
+	}
+	sess.SessionRelease(nil)
+	return nil
+}
+
+//Claim 记录未使用的nonce，provider实现session.Claimer时跨进程原子，否则只在本节点内原子
+func (store *SessionNonceStore) Claim(pid string, nonce uint64, expiration time.Duration) (bool, error) {
+	if claimer, ok := store.provider.(session.Claimer); ok {
+		return claimer.SessionClaim(store.sessionID(pid, nonce), map[interface{}]interface{}{
+			"expired": time.Now().Add(expiration).Unix(),
+		})
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.IsExist(pid, nonce) {
+		return false, nil
+	}
+	if err := store.Put(pid, nonce, expiration); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//GC 定时清理过期的会话，使用redis等自带过期的provider无需调用
+func (store *SessionNonceStore) GC() {
+	store.provider.SessionGC()
+	time.AfterFunc(time.Duration(store.config.Gclifetime)*time.Second, func() { store.GC() })
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/session"
+)
+
+func testNonceStore(t *testing.T, store NonceStore) {
+	t.Helper()
+
+	if store.IsExist("peerA", 1) {
+		t.Fatalf("nonce should not exist")
+	}
+
+	if err := store.Put("peerA", 1, time.Minute); err != nil {
+		t.Fatalf("Put unexpected error: %v", err)
+	}
+
+	if !store.IsExist("peerA", 1) {
+		t.Fatalf("nonce should exist after put")
+	}
+
+	if store.IsExist("peerB", 1) || store.IsExist("peerA", 2) {
+		t.Fatalf("nonce should be isolated by peer and nonce")
+	}
+
+	if claimed, err := store.Claim("peerA", 1, time.Minute); err != nil || claimed {
+		t.Fatalf("Claim used nonce = %v, %v", claimed, err)
+	}
+
+	//并发请求相同的nonce，只有一个能记录
+	var (
+		wg      sync.WaitGroup
+		claimed int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := store.Claim("peerA", 5, time.Minute); err == nil && ok {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("concurrent Claim succeeded %d times, want 1", claimed)
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	testNonceStore(t, NewMemoryNonceStore())
+}
+
+func TestSessionNonceStore(t *testing.T) {
+	cf := &session.ManagerConfig{}
+	store, err := NewSessionNonceStore("memory", cf)
+	if err != nil {
+		t.Fatalf("NewSessionNonceStore unexpected error: %v", err)
+	}
+	if cf.Maxlifetime != 0 || cf.Gclifetime != 0 {
+		t.Fatalf("caller config should not be modified: %+v", cf)
+	}
+	testNonceStore(t, store)
+}
+
+//claimProvider 模拟redis的SET NX，多个节点共享同一个provider
+type claimProvider struct {
+	session.Provider
+	mu      sync.Mutex
+	claimed map[string]bool
+	readErr error
+}
+
+func (p *claimProvider) SessionClaim(sid string, values map[interface{}]interface{}) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.claimed[sid] {
+		return false, nil
+	}
+	p.claimed[sid] = true
+	return true, nil
+}
+
+func (p *claimProvider) SessionRead(sid string) (session.Store, error) {
+	if p.readErr != nil {
+		return nil, p.readErr
+	}
+	return p.Provider.SessionRead(sid)
+}
+
+func TestSessionNonceStore_Claimer(t *testing.T) {
+	memory, _ := session.GetProvider("memory")
+	provider := &claimProvider{Provider: memory, claimed: make(map[string]bool)}
+	config := &session.ManagerConfig{}
+
+	//两个节点各自的存储共享provider，本地锁不能保证原子，由provider的SessionClaim保证
+	stores := []*SessionNonceStore{
+		{provider: provider, config: config},
+		{provider: provider, config: config},
+	}
+	var (
+		wg      sync.WaitGroup
+		claimed int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(store *SessionNonceStore) {
+			defer wg.Done()
+			if ok, err := store.Claim("peerA", 7, time.Minute); err == nil && ok {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}(stores[i%2])
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("Claim on shared provider succeeded %d times, want 1", claimed)
+	}
+
+	//读取出错视为已使用
+	provider.readErr = fmt.Errorf("connection refused")
+	if !stores[0].IsExist("peerA", 8) {
+		t.Fatalf("nonce should be treated as used when provider fails")
+	}
+}
+
+func TestStormNonceStore(t *testing.T) {
+
+	dbFile := filepath.Join(t.TempDir(), "nonce.db")
+
+	store, err := NewStormNonceStore(dbFile)
+	if err != nil {
+		t.Fatalf("NewStormNonceStore unexpected error: %v", err)
+	}
+	testNonceStore(t, store)
+
+	//已过期
+	store.Put("peerA", 3, -time.Second)
+	if store.IsExist("peerA", 3) {
+		t.Fatalf("expired nonce should not exist")
+	}
+	if claimed, err := store.Claim("peerA", 3, time.Minute); err != nil || !claimed {
+		t.Fatalf("Claim expired nonce = %v, %v", claimed, err)
+	}
+	if err = store.DeleteExpired(); err != nil {
+		t.Fatalf("DeleteExpired unexpected error: %v", err)
+	}
+	store.Close()
+
+	//重启后保留
+	store, err = NewStormNonceStore(dbFile)
+	if err != nil {
+		t.Fatalf("NewStormNonceStore unexpected error: %v", err)
+	}
+	defer store.Close()
+	if !store.IsExist("peerA", 1) {
+		t.Fatalf("nonce should exist after reopen")
+	}
+
+	//读取出错视为已使用
+	closed, err := NewStormNonceStore(filepath.Join(t.TempDir(), "closed.db"))
+	if err != nil {
+		t.Fatalf("NewStormNonceStore unexpected error: %v", err)
+	}
+	closed.Close()
+	if !closed.IsExist("peerA", 1) {
+		t.Fatalf("nonce should be treated as used when store fails")
+	}
+}
+
+func TestServeMux_CheckTimestamp(t *testing.T) {
+
+	mux := NewServeMux(0)
+	now := time.Now()
+
+	tests := []struct {
+		timestamp int64
+		status    uint64
+	}{
+		{now.Unix(), StatusSuccess},
+		{now.Add(-replayLimit + time.Minute).Unix(), StatusSuccess},
+		{now.Add(-replayLimit - time.Minute).Unix(), ErrReplayAttack},
+		{now.Add(replayLimit + time.Minute).Unix(), ErrReplayAttack},
+		{0, ErrReplayAttack},
+	}
+
+	for _, test := range tests {
+		if status, msg := mux.checkTimestampReason(test.timestamp, now); status != test.status {
+			t.Errorf("checkTimestampReason(%d) = %d %s, want %d", test.timestamp, status, msg, test.status)
+		}
+	}
+
+	//nonce存储可替换
+	store := NewMemoryNonceStore()
+	store.Put("1", 1, time.Minute)
+	mux.SetNonceStore(store)
+	if status, _ := mux.checkNonceReplayReason("1", 1); status != ErrReplayAttack {
+		t.Errorf("checkNonceReplayReason status = %d, want %d", status, ErrReplayAttack)
+	}
+}
@@ -17,13 +17,16 @@
 package owtp
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/bwmarrin/snowflake"
 	"github.com/mr-tron/base58/base58"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -42,12 +45,18 @@ const (
 	ErrUnauthorized uint64 = 401
 	//通信密钥不正确
 	ErrSecretKeyInvalid uint64 = 402
+	//没有访问方法的权限
+	ErrForbidden uint64 = 403
 	//找不到方法
 	ErrNotFoundMethod uint64 = 404
 	//重放攻击
 	ErrReplayAttack uint64 = 409
 	//请求超时
 	ErrRequestTimeout uint64 = 408
+	//请求过于频繁
+	ErrTooManyRequests uint64 = 429
+	//请求被调用方取消
+	ErrRequestCanceled uint64 = 499
 	//网络断开
 	ErrNetworkDisconnected uint64 = 430
 	//服务器错误
@@ -68,6 +77,7 @@ const (
 	Websocket string = "ws"
 	MQ        string = "mq"
 	HTTP      string = "http"
+	Loopback  string = "loopback" //进程内连接，用于测试或同一程序内嵌服务端和客户端
 )
 
 //内置方法
@@ -104,6 +114,19 @@ type ConnectConfig struct {
 	ReadBufferSize     int    `json:"readBufferSize"`     //socket读取缓存
 	WriteBufferSize    int    `json:"writeBufferSize"`    //socket写入缓存
 	EnableKeyAgreement bool   `json:"enableKeyAgreement"` //是否开启协商密码
+	RemotePublicKey    string `json:"remotePublicKey"`    //对方节点的证书公钥，base58，节点ID由公钥计算。mq开启签名或协商密码时必填
+	Curve              string `json:"curve"`              //签名和协商密码使用的曲线：sm2（默认），secp256k1，ed25519
+	Cipher             string `json:"cipher"`             //协商密码后的加密算法：aes（默认，AES-CBC），aes-gcm，chacha20-poly1305
+	EnableBinaryPacket bool   `json:"enableBinaryPacket"` //是否协商使用二进制数据包v2，只对ws有效，对方不支持时使用v1
+	Compression        string `json:"compression"`        //数据包压缩算法，如gzip，ws握手时协商，mq和http双方需配置一致
+	FragmentSize       int    `json:"fragmentSize"`       //数据包分片大小（字节），大于0或配置了压缩算法时开启传输帧，默认64KB
+	//断线重连策略，只对我方主动连接的ws，mq，loopback节点有效
+	EnableReconnect      bool    `json:"enableReconnect"`      //是否开启断线重连
+	ReconnectMaxAttempts int     `json:"reconnectMaxAttempts"` //最大重连次数，0为不限制
+	ReconnectMinInterval int     `json:"reconnectMinInterval"` //首次重连的等待时间（毫秒），默认1000
+	ReconnectMaxInterval int     `json:"reconnectMaxInterval"` //重连等待时间的上限（毫秒），默认60000
+	ReconnectMultiplier  float64 `json:"reconnectMultiplier"`  //退避倍数，小于1时默认2
+	ReconnectJitter      float64 `json:"reconnectJitter"`      //等待时间的随机抖动比例，取值[0,1]，0为不抖动
 }
 
 //节点主配置 作为json解析工具
@@ -111,6 +134,7 @@ type NodeConfig struct {
 	TimeoutSEC int         `json:"timeoutSEC"` //超时时间
 	Cert       Certificate `json:"cert"`       //证书
 	Peerstore  Peerstore   //会话缓存
+	NonceStore NonceStore  //已使用的请求nonce存储，默认为内存存储
 }
 
 //OWTPNode 实现OWTP协议的节点
@@ -147,6 +171,32 @@ type OWTPNode struct {
 	Stop  chan struct{}
 	//请求超时（秒）
 	timeoutSEC int
+	//断线重连任务
+	reconnectTasks map[string]*reconnectTask
+	//我方主动关闭的节点，不进行断线重连
+	manualClosedPeers map[string]bool
+	//节点已关闭
+	closed bool
+	//断线重连的锁
+	reconnectMu sync.Mutex
+	//发布的主题
+	topics map[string]*topicState
+	//每个主题缓存的消息数量
+	topicBufferSize int
+	//主题订阅的授权检查
+	topicAuthorizer TopicAuthorizer
+	//每个订阅节点可订阅的主题数量
+	maxTopicsPerPeer int
+	//作为响应方协商密码时允许的加密算法，为空时允许所有已注册的算法
+	allowedCiphers map[string]bool
+	//订阅的主题，发布方节点ID -> 主题 -> 订阅记录
+	subscriptions map[string]map[string]*subscription
+	//发布订阅的锁
+	pubsubMu sync.Mutex
+	//协商密码完成的通知通道，节点ID -> 通道
+	keyAgreementDone map[string]chan struct{}
+	//协商密码通知的锁
+	keyAgreementMu sync.Mutex
 	//通道的读写缓存大小
 	//ReadBufferSize, WriteBufferSize int
 }
@@ -198,6 +248,10 @@ func NewNode(config NodeConfig) *OWTPNode {
 		node.serveMux = NewServeMux(node.timeoutSEC)
 	}
 
+	if config.NonceStore != nil {
+		node.serveMux.SetNonceStore(config.NonceStore)
+	}
+
 	node.nonceGen, _ = snowflake.NewNode(1)
 
 	node.Join = make(chan Peer)
@@ -209,6 +263,11 @@ func NewNode(config NodeConfig) *OWTPNode {
 	//内部配置一个协商密码处理过程
 	node.serveMux.handleFuncInner(KeyAgreementMethod, node.keyAgreement)
 
+	//内部配置发布订阅处理过程
+	node.serveMux.handleFuncInner(SubscribeMethod, node.subscribeHandler)
+	node.serveMux.handleFuncInner(UnsubscribeMethod, node.unsubscribeHandler)
+	node.serveMux.handleFuncInner(PublishMethod, node.publishHandler)
+
 	//马上执行
 	go node.Run()
 
@@ -234,6 +293,11 @@ func NewOWTPNode(cert Certificate, readBufferSize, writeBufferSize int) *OWTPNod
 	//内部配置一个协商密码处理过程
 	node.serveMux.handleFuncInner(KeyAgreementMethod, node.keyAgreement)
 
+	//内部配置发布订阅处理过程
+	node.serveMux.handleFuncInner(SubscribeMethod, node.subscribeHandler)
+	node.serveMux.handleFuncInner(UnsubscribeMethod, node.unsubscribeHandler)
+	node.serveMux.handleFuncInner(PublishMethod, node.publishHandler)
+
 	//马上执行
 	go node.Run()
 
@@ -250,6 +314,11 @@ func (node *OWTPNode) NodeID() string {
 	return node.cert.ID()
 }
 
+//SetNonceStore 设置已使用的请求nonce存储，用于防重放攻击
+func (node *OWTPNode) SetNonceStore(store NonceStore) {
+	node.serveMux.SetNonceStore(store)
+}
+
 //SetPeerstore 设置一个Peerstore指针
 func (node *OWTPNode) SetPeerstore(store Peerstore) {
 	node.peerstore = store
@@ -274,6 +343,16 @@ func (node *OWTPNode) Listen(config ConnectConfig) error {
 	//	return fmt.Errorf("the node is listening, please close listener first")
 	//}
 
+	//监听配置的加密算法加入允许的算法
+	if len(config.Cipher) > 0 {
+		node.mu.Lock()
+		if node.allowedCiphers == nil {
+			node.allowedCiphers = make(map[string]bool)
+		}
+		node.allowedCiphers[config.Cipher] = true
+		node.mu.Unlock()
+	}
+
 	if connectType == Websocket || connectType == MQ {
 		l, err := WSListenAddr(addr, node.cert, enableSignature, node)
 		if err != nil {
@@ -281,17 +360,17 @@ func (node *OWTPNode) Listen(config ConnectConfig) error {
 		}
 		node.listeners[connectType] = l
 
-		go func(listener Listener) {
-			for {
-				peer, err := listener.Accept()
-				if err != nil {
-					return
-				}
-				node.Join <- peer
-			}
-		}(l)
+		go node.acceptPeers(l)
 
 		//node.listening = true
+	} else if connectType == Loopback {
+		l, err := LoopbackListenAddr(addr, node.cert, enableSignature, node)
+		if err != nil {
+			return err
+		}
+		node.listeners[connectType] = l
+
+		go node.acceptPeers(l)
 	} else if connectType == HTTP {
 		l, err := HttpListenAddr(addr, enableSignature, node)
 		if err != nil {
@@ -304,6 +383,52 @@ func (node *OWTPNode) Listen(config ConnectConfig) error {
 	return nil
 }
 
+//acceptPeers 接收监听器的新节点连接，直到监听器关闭
+func (node *OWTPNode) acceptPeers(listener Listener) {
+	for {
+		peer, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		node.Join <- peer
+	}
+}
+
+//SetAllowedCiphers 设置作为响应方协商密码时允许的加密算法，对方请求其他算法时拒绝协商。
+//为空时允许所有已注册的算法，Listen配置的Cipher也会加入允许的算法
+func (node *OWTPNode) SetAllowedCiphers(ciphers ...string) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.allowedCiphers = make(map[string]bool)
+	for _, c := range ciphers {
+		node.allowedCiphers[c] = true
+	}
+}
+
+//checkKeyAgreementCipher 响应方检查对方请求的加密算法，防止中间人降级为未认证的加密算法
+func (node *OWTPNode) checkKeyAgreementCipher(peer Peer, encryptType string) error {
+	suite, err := ParseCipherSuite(encryptType)
+	if err != nil {
+		return err
+	}
+
+	node.mu.RLock()
+	restricted := len(node.allowedCiphers) > 0
+	allowed := node.allowedCiphers[suite.Cipher]
+	node.mu.RUnlock()
+
+	//我方连接配置的加密算法
+	if cipher := peer.ConnectConfig().Cipher; len(cipher) > 0 {
+		restricted = true
+		allowed = allowed || cipher == suite.Cipher
+	}
+
+	if restricted && !allowed {
+		return fmt.Errorf("key agreement cipher: %s is not allowed", suite.Cipher)
+	}
+	return nil
+}
+
 //listening 是否监听中
 func (node *OWTPNode) Listening(connectType string) bool {
 	_, exist := node.listeners[connectType]
@@ -334,7 +459,8 @@ func (node *OWTPNode) Connect(pid string, config ConnectConfig) (Peer, error) {
 		//该节点未开启，首先请求开启协商密码
 		if peer != nil && peer.auth().EnableKeyAgreement() == false {
 			log.Debugf("first connect to call KeyAgreement request")
-			err = node.KeyAgreement(pid, "aes")
+			suite, _ := cipherSuiteFromConfig(config)
+			err = node.startKeyAgreement(peer, suite.String())
 			if err != nil {
 				return nil, err
 			}
@@ -359,6 +485,12 @@ func (node *OWTPNode) connect(pid string, config ConnectConfig) (Peer, error) {
 	writeBufferSize := config.WriteBufferSize
 	timeout := time.Duration(node.timeoutSEC) * time.Second
 
+	//配置了对方证书公钥，节点ID由公钥计算
+	pid, remotePublicKey, err := remotePeerID(pid, config)
+	if err != nil {
+		return nil, err
+	}
+
 	//检查是否已经连接服务
 	peer = node.GetOnlinePeer(pid)
 	if peer != nil && peer.IsConnected() && peer.ConnectConfig().Address != "" {
@@ -376,7 +508,12 @@ func (node *OWTPNode) connect(pid string, config ConnectConfig) (Peer, error) {
 		return nil, fmt.Errorf("pid: %s, address must contain by config", pid)
 	}
 
-	auth, err := NewOWTPAuthWithCertificate(node.cert, enableSignature)
+	suite, err := cipherSuiteFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := NewOWTPAuthWithCipherSuite(node.cert, enableSignature, suite)
 
 	//发起协商密钥
 	//err = auth.InitKeyAgreement()
@@ -384,6 +521,12 @@ func (node *OWTPNode) connect(pid string, config ConnectConfig) (Peer, error) {
 		return nil, err
 	}
 
+	if len(remotePublicKey) > 0 {
+		//签名和协商密码只接受对方证书公钥
+		auth.remotePublicKey = remotePublicKey
+		auth.certified = true
+	}
+
 	if len(connectType) == 0 {
 		return nil, fmt.Errorf("connectType must contain by config")
 	}
@@ -400,7 +543,7 @@ func (node *OWTPNode) connect(pid string, config ConnectConfig) (Peer, error) {
 		url := protocol + strings.TrimSuffix(addr, "/") + "/"
 
 		//建立链接，记录默认的客户端
-		client, err := Dial(pid, url, node, auth.HTTPAuthHeader(), readBufferSize, writeBufferSize)
+		client, err := Dial(pid, url, node, handshakeHeader(auth, config), readBufferSize, writeBufferSize)
 		if err != nil {
 			return nil, err
 		}
@@ -418,15 +561,22 @@ func (node *OWTPNode) connect(pid string, config ConnectConfig) (Peer, error) {
 		mqPassword := config.Password
 		url := "amqp://" + mqAccount + ":" + mqPassword + "@" + strings.TrimSuffix(addr, "/") + "/"
 
-		//建立链接，记录默认的客户端
-		client, err := MQDial(pid, url, node)
+		//建立链接，记录默认的客户端，打开通道前设置授权规则和配置
+		client, err := MQDialWithAuth(pid, url, node, auth, config)
+		if err != nil {
+			return nil, err
+		}
+		peer = client
+	}
+
+	//进程内连接类型
+	if connectType == Loopback {
+
+		//建立链接，握手过程与websocket一致
+		client, err := loopbackDialWithAuth(pid, addr, node, handshakeHeader(auth, config), auth, config)
 		if err != nil {
 			return nil, err
 		}
-		//设置授权规则
-		client._auth = auth
-		//设置配置
-		client.config = config
 		peer = client
 	}
 
@@ -450,6 +600,7 @@ func (node *OWTPNode) connect(pid string, config ConnectConfig) (Peer, error) {
 		client._auth = auth
 		//设置配置
 		client.config = config
+		client.framer.setOptions(frameOptionsFromConfig(config))
 
 		peer = client
 	}
@@ -463,6 +614,141 @@ func (node *OWTPNode) connect(pid string, config ConnectConfig) (Peer, error) {
 	return peer, nil
 }
 
+//handshakeHeader 长连接握手的头字段，包括授权公钥，支持的数据包版本，分片和压缩选项
+func handshakeHeader(auth *OWTPAuth, config ConnectConfig) map[string]string {
+
+	header := auth.HTTPAuthHeader()
+	if config.EnableBinaryPacket {
+		//握手时带上支持的最高数据包版本
+		if header == nil {
+			header = make(map[string]string)
+		}
+		header[packetVersionHeader] = strconv.FormatInt(DataPacketVersionV2, 10)
+	}
+	for key, value := range frameHeader(config) {
+		//握手时带上分片和压缩选项
+		if header == nil {
+			header = make(map[string]string)
+		}
+		header[key] = value
+	}
+	return header
+}
+
+//remotePeerID 配置了对方证书公钥时，节点ID由公钥计算，不信任传入的pid。
+//mq没有握手过程，开启签名或协商密码必须配置对方证书公钥
+func remotePeerID(pid string, config ConnectConfig) (string, []byte, error) {
+
+	if len(config.RemotePublicKey) == 0 {
+		if config.ConnectType == MQ && (config.EnableSignature || config.EnableKeyAgreement) {
+			return "", nil, fmt.Errorf("pid: %s, remotePublicKey must contain by config when mq enable signature or keyAgreement", pid)
+		}
+		return pid, nil, nil
+	}
+
+	publicKey, err := base58.Decode(config.RemotePublicKey)
+	if err != nil || len(publicKey) == 0 {
+		return "", nil, fmt.Errorf("pid: %s, remotePublicKey is invalid", pid)
+	}
+
+	remotePID := base58.Encode(owcrypt.Hash(publicKey, 0, owcrypt.HASH_ALG_SHA256))
+	if len(pid) > 0 && pid != remotePID {
+		return "", nil, fmt.Errorf("pid: %s is not matched with remotePublicKey, expected: %s", pid, remotePID)
+	}
+
+	return remotePID, publicKey, nil
+}
+
+//isKeyAgreementInitiator 我方是否协商密码的发起方。
+//ws和http由主动连接的一方发起，mq双方都是主动连接，由节点ID较小的一方发起
+func (node *OWTPNode) isKeyAgreementInitiator(peer Peer) bool {
+	if peer.ConnectConfig().ConnectType == MQ {
+		return node.NodeID() < peer.PID()
+	}
+	return peer.IsHost()
+}
+
+//startKeyAgreement 按协商角色开始协商密码，我方是响应方时等待对方发起
+func (node *OWTPNode) startKeyAgreement(peer Peer, consultType string) error {
+
+	if node.isKeyAgreementInitiator(peer) {
+		err := node.callKeyAgreement(peer, consultType)
+		if err != nil || peer.ConnectConfig().ConnectType != MQ {
+			return err
+		}
+		//mq的响应方等待验证协商结果，再请求一次带上SA给对方确认
+		return node.requestKeyAgreement(peer)
+	}
+
+	timeoutSEC := node.timeoutSEC
+	if timeoutSEC == 0 {
+		timeoutSEC = DefaultTimoutSEC
+	}
+
+	//对方的SA验证通过才完成协商
+	done := node.keyAgreementDoneChan(peer.PID())
+	defer node.resetKeyAgreementDone(peer.PID())
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(time.Duration(timeoutSEC) * time.Second):
+		return fmt.Errorf("peer: %s, wait for keyAgreement timeout", peer.PID())
+	}
+}
+
+//keyAgreementDoneChan 节点完成协商密码的通知通道，完成后通道关闭
+func (node *OWTPNode) keyAgreementDoneChan(pid string) chan struct{} {
+	node.keyAgreementMu.Lock()
+	defer node.keyAgreementMu.Unlock()
+
+	if node.keyAgreementDone == nil {
+		node.keyAgreementDone = make(map[string]chan struct{})
+	}
+	done, ok := node.keyAgreementDone[pid]
+	if !ok {
+		done = make(chan struct{})
+		node.keyAgreementDone[pid] = done
+	}
+	return done
+}
+
+//notifyKeyAgreementDone 通知节点已完成协商密码
+func (node *OWTPNode) notifyKeyAgreementDone(pid string) {
+	done := node.keyAgreementDoneChan(pid)
+
+	node.keyAgreementMu.Lock()
+	defer node.keyAgreementMu.Unlock()
+
+	select {
+	case <-done:
+	default:
+		close(done)
+	}
+}
+
+//renewKeyAgreementDone 重新协商时移除已关闭的通知通道，正在等待的通道保留
+func (node *OWTPNode) renewKeyAgreementDone(pid string) {
+	node.keyAgreementMu.Lock()
+	defer node.keyAgreementMu.Unlock()
+
+	if done, ok := node.keyAgreementDone[pid]; ok {
+		select {
+		case <-done:
+			delete(node.keyAgreementDone, pid)
+		default:
+		}
+	}
+}
+
+//resetKeyAgreementDone 移除通知通道，等待结束或断开连接时调用
+func (node *OWTPNode) resetKeyAgreementDone(pid string) {
+	node.keyAgreementMu.Lock()
+	defer node.keyAgreementMu.Unlock()
+
+	delete(node.keyAgreementDone, pid)
+}
+
 //SetCloseHandler 设置关闭连接时的回调
 func (node *OWTPNode) SetOpenHandler(h func(n *OWTPNode, peer PeerInfo)) {
 	node.connectHandler = h
@@ -501,8 +787,11 @@ func (node *OWTPNode) Run() error {
 				continue
 			}
 
-			if node.connectHandler != nil {
-				go node.connectHandler(node, node.Peerstore().PeerInfo(peer.PID()))
+			//断线重连的节点，重新协商密码后再通知
+			if node.connectHandler != nil && !node.isReconnecting(peer.PID()) {
+				peerInfo := node.Peerstore().PeerInfo(peer.PID())
+				peerInfo.State = PeerStateConnected
+				go node.connectHandler(node, peerInfo)
 			}
 
 		case peer := <-node.Leave:
@@ -511,9 +800,24 @@ func (node *OWTPNode) Run() error {
 
 			node.serveMux.ResetRequestQueue(peer.PID())
 			node.RemoveOfflinePeer(peer.PID())
+			node.resetKeyAgreementDone(peer.PID())
+
+			//按连接配置开启断线重连
+			reconnecting := node.startReconnect(peer)
+
+			//不再重连的节点，删除其主题订阅
+			if !reconnecting {
+				node.removePeerTopics(peer.PID())
+			}
 
 			if node.disconnectHandler != nil {
-				go node.disconnectHandler(node, node.Peerstore().PeerInfo(peer.PID()))
+				peerInfo := node.Peerstore().PeerInfo(peer.PID())
+				peerInfo.State = PeerStateDisconnected
+				if reconnecting {
+					peerInfo.State = PeerStateReconnecting
+				}
+				peerInfo.ReconnectAttempts = node.reconnectAttempts(peer.PID())
+				go node.disconnectHandler(node, peerInfo)
 			}
 
 		case <-node.Stop:
@@ -524,7 +828,9 @@ func (node *OWTPNode) Run() error {
 			//	p.broadcastMessage(m)
 			//	break
 		}
+		node.mu.RLock()
 		log.Debug("Total Nodes:", len(node.onlinePeers))
+		node.mu.RUnlock()
 	}
 
 	return nil
@@ -539,20 +845,27 @@ func (node *OWTPNode) IsConnectPeer(pid string) bool {
 	return peer.IsConnected()
 }
 
-//ClosePeer 断开连接节点
+//ClosePeer 断开连接节点，主动断开的节点不会断线重连
 func (node *OWTPNode) ClosePeer(pid string) {
 
+	//停止正在进行的断线重连
+	node.stopReconnect(pid)
+
 	//检查是否已经连接服务
 	peer := node.GetOnlinePeer(pid)
 	if peer == nil {
 		return
 	}
+	node.markManualClosed(pid)
 	peer.close()
 }
 
 //Close 关闭节点
 func (node *OWTPNode) Close() {
 
+	//停止所有断线重连
+	node.stopAllReconnect()
+
 	for _, listener := range node.listeners {
 		listener.Close()
 	}
@@ -605,13 +918,23 @@ func (node *OWTPNode) CallSync(
 	method string,
 	params interface{},
 ) (*Response, error) {
+	return node.CallSyncContext(context.Background(), pid, method, params)
+}
+
+//CallSyncContext 同步请求，ctx取消或超时后返回*CallCanceledError
+func (node *OWTPNode) CallSyncContext(
+	ctx context.Context,
+	pid string,
+	method string,
+	params interface{},
+) (*Response, error) {
 
 	var (
 		err      error
 		respChan = make(chan Response, 1)
 	)
 
-	err = node.Call(pid, method, params, true, func(resp Response) {
+	err = node.CallContext(ctx, pid, method, params, func(resp Response) {
 		respChan <- resp
 	})
 
@@ -630,12 +953,39 @@ func (node *OWTPNode) Call(
 	params interface{},
 	sync bool,
 	reqFunc RequestFunc) error {
+	return node.call(context.Background(), pid, method, params, sync, reqFunc)
+}
+
+//CallContext 向对方节点进行同步调用，等待响应期间ctx取消或超时，
+//请求马上从队列中移除，返回*CallCanceledError，reqFunc不会被回调
+func (node *OWTPNode) CallContext(
+	ctx context.Context,
+	pid string,
+	method string,
+	params interface{},
+	reqFunc RequestFunc) error {
+	return node.call(ctx, pid, method, params, true, reqFunc)
+}
+
+//call 向对方节点进行调用，内部调用
+func (node *OWTPNode) call(
+	ctx context.Context,
+	pid string,
+	method string,
+	params interface{},
+	sync bool,
+	reqFunc RequestFunc) error {
 
 	var (
-		err      error
-		respChan = make(chan Response)
+		err error
+		//缓存一个响应，取消请求后，响应方不会阻塞
+		respChan = make(chan Response, 1)
 	)
 
+	if ctx.Err() != nil {
+		return &CallCanceledError{PID: pid, Method: method, Err: ctx.Err()}
+	}
+
 	//检查是否已经连接服务
 	peer := node.GetOnlinePeer(pid)
 	if peer == nil {
@@ -659,7 +1009,7 @@ func (node *OWTPNode) Call(
 		Nonce:     nonce,
 		Timestamp: time,
 		Data:      params,
-		Version:   CurrentDataPacketVersion,
+		Version:   peer.packetVersion(),
 	}
 
 	//如果开启了协商密码，添加协商密码参数
@@ -686,7 +1036,7 @@ func (node *OWTPNode) Call(
 			EncryptType:           ka.EncryptType,
 		}
 
-		if peer.IsHost() {
+		if node.isKeyAgreementInitiator(peer) {
 			//对方是服务端
 			packet.SecretData.SA = ka.SA
 		} else {
@@ -715,8 +1065,20 @@ func (node *OWTPNode) Call(
 
 	if sync {
 		//等待返回
-		result := <-respChan
-		reqFunc(result)
+		select {
+		case result := <-respChan:
+			reqFunc(result)
+		case <-ctx.Done():
+			node.serveMux.RemoveRequest(peer.PID(), nonce)
+			//移除请求前，响应已到达
+			select {
+			case result := <-respChan:
+				reqFunc(result)
+				return nil
+			default:
+			}
+			return &CallCanceledError{PID: peer.PID(), Method: method, Nonce: nonce, Err: ctx.Err()}
+		}
 	}
 
 	return nil
@@ -767,9 +1129,14 @@ func (node *OWTPNode) encryptPacket(peer Peer, packet *DataPacket, key string) e
 	return nil
 }
 
-//HandleFunc 绑定路由器方法
-func (node *OWTPNode) HandleFunc(method string, handler HandlerFunc) {
-	node.serveMux.HandleFunc(method, handler)
+//HandleFunc 绑定路由器方法，可附加只作用于该方法的中间件
+func (node *OWTPNode) HandleFunc(method string, handler HandlerFunc, middlewares ...Middleware) {
+	node.serveMux.HandleFunc(method, handler, middlewares...)
+}
+
+//Use 添加全局中间件，作用于所有非内置方法
+func (node *OWTPNode) Use(middlewares ...Middleware) {
+	node.serveMux.Use(middlewares...)
 }
 
 //HandlePrepareFunc 绑定准备前的处理方法
@@ -813,6 +1180,16 @@ func (node *OWTPNode) callKeyAgreement(peer Peer, consultType string) error {
 	//保存请求协商密码的参数
 	node.peerstore.Put(peer.PID(), keyAgreementCipher, ka)
 
+	return node.requestKeyAgreement(peer)
+}
+
+//requestKeyAgreement 请求协商方法，协商完成后再次请求会带上SA给对方验证
+func (node *OWTPNode) requestKeyAgreement(peer Peer) error {
+
+	var (
+		err error
+	)
+
 	callErr := node.Call(
 		peer.PID(),
 		KeyAgreementMethod,
@@ -921,7 +1298,7 @@ func (node *OWTPNode) handleKeyAgreementForRequest(peer Peer, packet *DataPacket
 
 		//发起方的请求协商密码的参数
 
-		if peer.IsHost() {
+		if node.isKeyAgreementInitiator(peer) {
 			//对方是服务端，请求带SecretData.S2
 			ka.S2 = packet.SecretData.S2
 		} else {
@@ -931,19 +1308,29 @@ func (node *OWTPNode) handleKeyAgreementForRequest(peer Peer, packet *DataPacket
 
 		ka.PublicKeyInitiator = packet.SecretData.PublicKeyInitiator
 		ka.TmpPublicKeyInitiator = packet.SecretData.TmpPublicKeyInitiator
+		if len(packet.SecretData.EncryptType) > 0 {
+			ka.EncryptType = packet.SecretData.EncryptType
+		}
 
 		//验证协商密码
 		if !peer.auth().VerifyKeyAgreement(ka) {
 
 			//协商不通过，需要重新协商
 			log.Warning("keyAgreement is regenerating")
+			node.renewKeyAgreementDone(peer.PID())
+
+			//对方请求的加密算法必须是我方允许的
+			err := node.checkKeyAgreementCipher(peer, ka.EncryptType)
+			if err != nil {
+				return nil, err
+			}
 
 			//传入响应公私钥
 			ka.PublicKeyResponder = base58.Encode(node.cert.PublicKeyBytes())
 			ka.PrivateKeyResponder = base58.Encode(node.cert.PrivateKeyBytes())
 
 			//请求协商
-			err := peer.auth().RequestKeyAgreement(ka)
+			err = peer.auth().RequestKeyAgreement(ka)
 			if err != nil {
 				return nil, err
 			}
@@ -956,6 +1343,9 @@ func (node *OWTPNode) handleKeyAgreementForRequest(peer Peer, packet *DataPacket
 			packet.SecretData.TmpPublicKeyResponder = ka.TmpPublicKeyResponder
 			packet.SecretData.SB = ka.SB
 
+		} else if !node.isKeyAgreementInitiator(peer) && len(ka.SA) > 0 {
+			//发起方的SA验证通过，响应方完成协商
+			node.notifyKeyAgreementDone(peer.PID())
 		}
 
 		//加载到授权中
@@ -1078,6 +1468,7 @@ func (node *OWTPNode) OnPeerNewDataPacketReceived(peer Peer, packet *DataPacket)
 			Req:           packet.Req,
 			RemoteAddress: peer.RemoteAddr().String(),
 			nonce:         packet.Nonce,
+			timestamp:     packet.Timestamp,
 			Method:        packet.Method,
 			peerstore:     node.Peerstore(),
 			Peer:          peer,
@@ -22,6 +22,7 @@ import (
 
 const (
 	DataPacketVersionV1 = 1 //数据包版本v1
+	DataPacketVersionV2 = 2 //数据包版本v2，MessagePack二进制编码，按连接协商使用
 
 	CurrentDataPacketVersion = DataPacketVersionV1 //当前的数据包版本
 )
@@ -31,6 +32,7 @@ type DataPacket struct {
 	/*
 
 		本协议传输数据，格式编码采用json。消息接收与发送，都遵循数据包规范定义字段内容。
+		数据包v2采用MessagePack编码，字段相同，d为二进制数据主体，加密后直接传输密文。
 
 		| 参数名 | 类型   | 示例             | 描述                                                                                |
 		|--------|--------|------------------|-----------------------------------------------------------------------------------|
@@ -96,9 +98,22 @@ func NewDataPacket(json gjson.Result) *DataPacket {
 	return dp
 }
 
+//PeerState 节点连接状态
+type PeerState int
+
+const (
+	PeerStateUnknown         PeerState = iota //未知，非连接事件获取的节点信息
+	PeerStateConnected                        //已连接
+	PeerStateDisconnected                     //已断开
+	PeerStateReconnecting                     //已断开，正在断线重连
+	PeerStateReconnectFailed                  //断线重连达到最大次数，放弃重连
+)
+
 type PeerInfo struct {
-	ID     string
-	Config ConnectConfig
+	ID                string
+	Config            ConnectConfig
+	State             PeerState //连接状态，在SetOpenHandler，SetCloseHandler的回调中有效
+	ReconnectAttempts int       //断线重连已尝试的次数
 }
 
 type PeerAttribute map[string]interface{}
@@ -122,6 +137,7 @@ type Peer interface {
 	setHandler(handler PeerHandler) error //设置节点的服务者
 	openPipe() error                      //OpenPipe 打开通道
 	send(data DataPacket) error           //发送请求
+	packetVersion() int64                 //连接协商的数据包版本
 	close() error                         //关闭节点
 }
 
@@ -0,0 +1,508 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+	"github.com/tidwall/gjson"
+)
+
+//发布订阅的内置方法
+const (
+	//订阅主题
+	SubscribeMethod = "internal_subscribe"
+	//取消订阅主题
+	UnsubscribeMethod = "internal_unsubscribe"
+	//推送主题消息
+	PublishMethod = "internal_publish"
+)
+
+const (
+	//默认每个主题缓存的消息数量
+	DefaultTopicBufferSize = 1000
+	//默认每个订阅节点可订阅的主题数量
+	DefaultMaxTopicsPerPeer = 100
+)
+
+//TopicMessage 主题消息
+type TopicMessage struct {
+	Topic     string          `json:"topic"`
+	Seq       uint64          `json:"seq"` //主题内递增的消息序号，从1开始
+	Timestamp int64           `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+//JsonData 消息内容
+func (msg *TopicMessage) JsonData() gjson.Result {
+	return gjson.ParseBytes(msg.Data)
+}
+
+//TopicHandler 订阅方处理主题消息，返回nil代表确认消息，返回错误的消息会在重新订阅时重发
+type TopicHandler func(msg *TopicMessage) error
+
+//TopicAuthorizer 检查节点pid是否允许订阅主题topic
+type TopicAuthorizer func(pid, topic string) bool
+
+//topicSubscriber 发布方记录的订阅节点
+type topicSubscriber struct {
+	lastAck    uint64 //已确认的消息序号
+	delivering bool   //推送中
+}
+
+//topicState 发布方的主题状态
+type topicState struct {
+	seq         uint64                      //最新的消息序号
+	buffer      []*TopicMessage             //缓存的最近消息
+	subscribers map[string]*topicSubscriber //订阅节点
+}
+
+//subscription 订阅方的订阅记录
+type subscription struct {
+	handler TopicHandler
+	lastSeq uint64 //已处理的消息序号
+	replay  bool   //重新订阅时是否补发缓存的消息
+}
+
+//SetTopicBufferSize 设置每个主题缓存的消息数量，订阅节点重新订阅时可补发缓存中未确认的消息
+func (node *OWTPNode) SetTopicBufferSize(size int) {
+	node.pubsubMu.Lock()
+	defer node.pubsubMu.Unlock()
+	node.topicBufferSize = size
+}
+
+//SetMaxTopicsPerPeer 设置每个订阅节点可订阅的主题数量，防止节点订阅大量主题占用发布方内存
+func (node *OWTPNode) SetMaxTopicsPerPeer(max int) {
+	node.pubsubMu.Lock()
+	defer node.pubsubMu.Unlock()
+	node.maxTopicsPerPeer = max
+}
+
+//SetTopicAuthorizer 设置主题订阅的授权检查，未设置时所有节点都可订阅。
+//发布订阅的内部方法不经过中间件，应通过此方法限制可订阅的主题
+func (node *OWTPNode) SetTopicAuthorizer(authorizer TopicAuthorizer) {
+	node.pubsubMu.Lock()
+	defer node.pubsubMu.Unlock()
+	node.topicAuthorizer = authorizer
+}
+
+//Publish 发布主题消息，推送给所有在线的订阅节点，返回消息序号
+func (node *OWTPNode) Publish(topic string, data interface{}) (uint64, error) {
+
+	if len(topic) == 0 {
+		return 0, fmt.Errorf("topic is empty")
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	node.pubsubMu.Lock()
+
+	state := node.topicStateLocked(topic)
+	state.seq++
+	msg := &TopicMessage{
+		Topic:     topic,
+		Seq:       state.seq,
+		Timestamp: time.Now().Unix(),
+		Data:      raw,
+	}
+
+	bufferSize := node.topicBufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultTopicBufferSize
+	}
+	state.buffer = append(state.buffer, msg)
+	if len(state.buffer) > bufferSize {
+		state.buffer = state.buffer[len(state.buffer)-bufferSize:]
+	}
+
+	pids := make([]string, 0, len(state.subscribers))
+	for pid := range state.subscribers {
+		pids = append(pids, pid)
+	}
+
+	node.pubsubMu.Unlock()
+
+	for _, pid := range pids {
+		node.startDeliverTopic(topic, pid)
+	}
+
+	return msg.Seq, nil
+}
+
+//TopicSubscribers 主题的订阅节点
+func (node *OWTPNode) TopicSubscribers(topic string) []string {
+	node.pubsubMu.Lock()
+	defer node.pubsubMu.Unlock()
+
+	pids := make([]string, 0)
+	if state, exist := node.topics[topic]; exist {
+		for pid := range state.subscribers {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+//Subscribe 向节点订阅主题
+//@param pid 发布方节点ID
+//@param topic 主题，如newBlock:BTC，recharge:<accountID>
+//@param replay 是否补发发布方缓存中未确认的消息，断线重连后会自动重新订阅
+//@param handler 消息处理方法
+func (node *OWTPNode) Subscribe(pid, topic string, replay bool, handler TopicHandler) error {
+
+	if len(topic) == 0 {
+		return fmt.Errorf("topic is empty")
+	}
+
+	if handler == nil {
+		return fmt.Errorf("topic handler is nil")
+	}
+
+	node.pubsubMu.Lock()
+	if node.subscriptions == nil {
+		node.subscriptions = make(map[string]map[string]*subscription)
+	}
+	if node.subscriptions[pid] == nil {
+		node.subscriptions[pid] = make(map[string]*subscription)
+	}
+	sub, exist := node.subscriptions[pid][topic]
+	if !exist {
+		sub = &subscription{}
+		node.subscriptions[pid][topic] = sub
+	}
+	sub.handler = handler
+	sub.replay = replay
+	lastSeq := sub.lastSeq
+	node.pubsubMu.Unlock()
+
+	err := node.callSubscribe(pid, topic, replay, lastSeq)
+	if err != nil && !exist {
+		node.pubsubMu.Lock()
+		delete(node.subscriptions[pid], topic)
+		node.pubsubMu.Unlock()
+	}
+	return err
+}
+
+//Unsubscribe 取消订阅主题
+func (node *OWTPNode) Unsubscribe(pid, topic string) error {
+
+	node.pubsubMu.Lock()
+	if node.subscriptions[pid] != nil {
+		delete(node.subscriptions[pid], topic)
+	}
+	node.pubsubMu.Unlock()
+
+	resp, err := node.CallSync(pid, UnsubscribeMethod, map[string]interface{}{
+		"topic": topic,
+	})
+	if err != nil {
+		return err
+	}
+
+	return resp.Err()
+}
+
+//callSubscribe 发起订阅请求
+func (node *OWTPNode) callSubscribe(pid, topic string, replay bool, lastSeq uint64) error {
+
+	resp, err := node.CallSync(pid, SubscribeMethod, map[string]interface{}{
+		"topic":   topic,
+		"replay":  replay,
+		"lastSeq": lastSeq,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = resp.Err(); err != nil {
+		return err
+	}
+
+	//发布方的序号小于已处理的序号，说明发布方已重置序号
+	seq := resp.JsonData().Get("seq").Uint()
+	node.pubsubMu.Lock()
+	if sub, exist := node.subscriptions[pid][topic]; exist && sub.lastSeq > seq {
+		sub.lastSeq = 0
+	}
+	node.pubsubMu.Unlock()
+
+	return nil
+}
+
+//resubscribe 断线重连后重新订阅节点的所有主题
+func (node *OWTPNode) resubscribe(pid string) {
+
+	type resubscribeItem struct {
+		topic   string
+		replay  bool
+		lastSeq uint64
+	}
+
+	node.pubsubMu.Lock()
+	items := make([]resubscribeItem, 0)
+	for topic, sub := range node.subscriptions[pid] {
+		items = append(items, resubscribeItem{topic, sub.replay, sub.lastSeq})
+	}
+	node.pubsubMu.Unlock()
+
+	for _, item := range items {
+		err := node.callSubscribe(pid, item.topic, item.replay, item.lastSeq)
+		if err != nil {
+			log.Errorf("peer[%s] resubscribe topic[%s] failed, unexpected error: %v", pid, item.topic, err)
+		}
+	}
+}
+
+//topicStateLocked 获取主题状态，不存在则创建，调用前需加锁
+func (node *OWTPNode) topicStateLocked(topic string) *topicState {
+	if node.topics == nil {
+		node.topics = make(map[string]*topicState)
+	}
+	state, exist := node.topics[topic]
+	if !exist {
+		state = &topicState{
+			subscribers: make(map[string]*topicSubscriber),
+		}
+		node.topics[topic] = state
+	}
+	return state
+}
+
+//removeTopicSubscriberLocked 删除主题的订阅节点，没有订阅节点且未发布过消息的主题一并删除，调用前需加锁
+func (node *OWTPNode) removeTopicSubscriberLocked(topic, pid string) {
+	state, exist := node.topics[topic]
+	if !exist {
+		return
+	}
+	delete(state.subscribers, pid)
+	if len(state.subscribers) == 0 && state.seq == 0 {
+		delete(node.topics, topic)
+	}
+}
+
+//removePeerTopics 节点离开且不再重连时，删除其在所有主题的订阅，重新连接后由订阅方重新订阅
+func (node *OWTPNode) removePeerTopics(pid string) {
+	node.pubsubMu.Lock()
+	defer node.pubsubMu.Unlock()
+	for topic := range node.topics {
+		node.removeTopicSubscriberLocked(topic, pid)
+	}
+}
+
+//startDeliverTopic 开始向订阅节点推送未确认的消息
+func (node *OWTPNode) startDeliverTopic(topic, pid string) {
+
+	if node.GetOnlinePeer(pid) == nil {
+		//节点离线，等待重新订阅时补发
+		return
+	}
+
+	node.pubsubMu.Lock()
+	defer node.pubsubMu.Unlock()
+
+	state, exist := node.topics[topic]
+	if !exist {
+		return
+	}
+	sub, exist := state.subscribers[pid]
+	if !exist || sub.delivering {
+		return
+	}
+	sub.delivering = true
+
+	go node.deliverTopic(topic, pid, sub)
+}
+
+//deliverTopic 按序号逐条推送消息，订阅方确认后再推送下一条
+func (node *OWTPNode) deliverTopic(topic, pid string, sub *topicSubscriber) {
+
+	for {
+		node.pubsubMu.Lock()
+		state := node.topics[topic]
+		if state == nil || state.subscribers[pid] != sub {
+			//已取消订阅
+			node.pubsubMu.Unlock()
+			return
+		}
+
+		var next *TopicMessage
+		for _, msg := range state.buffer {
+			if msg.Seq > sub.lastAck {
+				next = msg
+				break
+			}
+		}
+		if next == nil {
+			sub.delivering = false
+			node.pubsubMu.Unlock()
+			return
+		}
+		if next.Seq > sub.lastAck+1 {
+			log.Warningf("peer[%s] topic[%s] messages [%d, %d) are out of buffer", pid, topic, sub.lastAck+1, next.Seq)
+		}
+		node.pubsubMu.Unlock()
+
+		resp, err := node.CallSync(pid, PublishMethod, next)
+
+		node.pubsubMu.Lock()
+		if err != nil || resp.Status != StatusSuccess {
+			sub.delivering = false
+			if err == nil && resp.Status == ErrNotFoundMethod && state.subscribers[pid] == sub {
+				//订阅方已没有该主题
+				delete(state.subscribers, pid)
+			}
+			node.pubsubMu.Unlock()
+			if err == nil {
+				err = resp.Err()
+			}
+			log.Warningf("peer[%s] topic[%s] deliver message[%d] failed, unexpected error: %v", pid, topic, next.Seq, err)
+			return
+		}
+		if next.Seq > sub.lastAck {
+			sub.lastAck = next.Seq
+		}
+		node.pubsubMu.Unlock()
+	}
+}
+
+//subscribeHandler 发布方处理订阅请求
+func (node *OWTPNode) subscribeHandler(ctx *Context) {
+
+	topic := ctx.Params().Get("topic").String()
+	replay := ctx.Params().Get("replay").Bool()
+	lastSeq := ctx.Params().Get("lastSeq").Uint()
+
+	if len(topic) == 0 {
+		ctx.Response(nil, ErrBadRequest, "topic is empty")
+		return
+	}
+
+	node.pubsubMu.Lock()
+	authorizer := node.topicAuthorizer
+	node.pubsubMu.Unlock()
+
+	//开启签名时以公钥计算的节点ID授权，防止冒用其他节点ID
+	if authorizer != nil && !authorizer(ctx.RemotePID(), topic) {
+		ctx.Response(nil, ErrForbidden, fmt.Sprintf("peer is not allowed to subscribe topic: %s", topic))
+		return
+	}
+
+	node.pubsubMu.Lock()
+	if state, exist := node.topics[topic]; !exist || state.subscribers[ctx.PID] == nil {
+		maxTopics := node.maxTopicsPerPeer
+		if maxTopics <= 0 {
+			maxTopics = DefaultMaxTopicsPerPeer
+		}
+		subscribed := 0
+		for _, state := range node.topics {
+			if state.subscribers[ctx.PID] != nil {
+				subscribed++
+			}
+		}
+		if subscribed >= maxTopics {
+			node.pubsubMu.Unlock()
+			ctx.Response(nil, ErrForbidden, fmt.Sprintf("peer has subscribed too many topics, max: %d", maxTopics))
+			return
+		}
+	}
+	state := node.topicStateLocked(topic)
+	sub, exist := state.subscribers[ctx.PID]
+	if !exist {
+		sub = &topicSubscriber{lastAck: state.seq}
+		if replay {
+			//补发缓存中的所有消息
+			sub.lastAck = 0
+		}
+		state.subscribers[ctx.PID] = sub
+	}
+	if replay {
+		//以订阅方已处理的序号为准，发布方重启后序号重置，则补发缓存中的所有消息
+		if lastSeq > sub.lastAck && lastSeq <= state.seq {
+			sub.lastAck = lastSeq
+		} else if lastSeq > state.seq {
+			sub.lastAck = 0
+		}
+	} else {
+		sub.lastAck = state.seq
+	}
+	seq := state.seq
+	node.pubsubMu.Unlock()
+
+	ctx.Response(map[string]interface{}{
+		"topic": topic,
+		"seq":   seq,
+	}, StatusSuccess, "success")
+
+	go node.startDeliverTopic(topic, ctx.PID)
+}
+
+//unsubscribeHandler 发布方处理取消订阅请求
+func (node *OWTPNode) unsubscribeHandler(ctx *Context) {
+
+	topic := ctx.Params().Get("topic").String()
+
+	node.pubsubMu.Lock()
+	node.removeTopicSubscriberLocked(topic, ctx.PID)
+	node.pubsubMu.Unlock()
+
+	ctx.Response(nil, StatusSuccess, "success")
+}
+
+//publishHandler 订阅方处理推送的消息
+func (node *OWTPNode) publishHandler(ctx *Context) {
+
+	var msg TopicMessage
+	err := json.Unmarshal([]byte(ctx.Params().Raw), &msg)
+	if err != nil {
+		ctx.Response(nil, ErrBadRequest, "topic message is invalid")
+		return
+	}
+
+	node.pubsubMu.Lock()
+	sub, exist := node.subscriptions[ctx.PID][msg.Topic]
+	if !exist {
+		node.pubsubMu.Unlock()
+		ctx.Response(nil, ErrNotFoundMethod, fmt.Sprintf("topic[%s] is not subscribed", msg.Topic))
+		return
+	}
+	handler := sub.handler
+	duplicate := msg.Seq <= sub.lastSeq
+	node.pubsubMu.Unlock()
+
+	//重复的消息直接确认
+	if !duplicate {
+		err = handler(&msg)
+		if err != nil {
+			ctx.ResponseError(nil, err)
+			return
+		}
+
+		node.pubsubMu.Lock()
+		if msg.Seq > sub.lastSeq {
+			sub.lastSeq = msg.Seq
+		}
+		node.pubsubMu.Unlock()
+	}
+
+	ctx.Response(nil, StatusSuccess, "success")
+}
@@ -0,0 +1,286 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func waitTopicMessage(t *testing.T, messages chan *TopicMessage) *TopicMessage {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wait topic message timeout")
+	}
+	return nil
+}
+
+func TestOWTPNode_PubSub(t *testing.T) {
+
+	const (
+		addr  = "127.0.0.1:8437"
+		topic = "newBlock:BTC"
+	)
+
+	host := RandomOWTPNode()
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	openEvents := make(chan PeerInfo, 10)
+	client := RandomOWTPNode()
+	client.SetOpenHandler(func(n *OWTPNode, peer PeerInfo) {
+		openEvents <- peer
+	})
+	defer client.Close()
+
+	_, err = client.Connect(host.NodeID(), ConnectConfig{
+		Address:              addr,
+		ConnectType:          Websocket,
+		EnableKeyAgreement:   true,
+		EnableReconnect:      true,
+		ReconnectMinInterval: 50,
+	})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+	waitPeerEvent(t, openEvents)
+
+	messages := make(chan *TopicMessage, 10)
+	failOnce := true
+	err = client.Subscribe(host.NodeID(), topic, true, func(msg *TopicMessage) error {
+		if msg.Seq == 2 && failOnce {
+			failOnce = false
+			return fmt.Errorf("handle message failed")
+		}
+		messages <- msg
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe unexpected error: %v", err)
+	}
+
+	if subs := host.TopicSubscribers(topic); len(subs) != 1 || subs[0] != client.NodeID() {
+		t.Fatalf("TopicSubscribers = %v", subs)
+	}
+
+	for i := 1; i <= 2; i++ {
+		host.Publish(topic, map[string]interface{}{"height": i})
+	}
+
+	msg := waitTopicMessage(t, messages)
+	if msg.Seq != 1 || msg.JsonData().Get("height").Int() != 1 {
+		t.Fatalf("message = %+v", msg)
+	}
+
+	//第2条处理失败，下一次发布时重发
+	time.Sleep(100 * time.Millisecond)
+	host.Publish(topic, map[string]interface{}{"height": 3})
+	for i := 2; i <= 3; i++ {
+		msg = waitTopicMessage(t, messages)
+		if msg.Seq != uint64(i) || msg.JsonData().Get("height").Int() != int64(i) {
+			t.Fatalf("message = %+v, want seq %d", msg, i)
+		}
+	}
+
+	//订阅方断线期间发布的消息，重连后补发
+	host.ClosePeer(client.NodeID())
+	time.Sleep(10 * time.Millisecond)
+	for i := 4; i <= 5; i++ {
+		host.Publish(topic, map[string]interface{}{"height": i})
+	}
+	waitPeerEvent(t, openEvents)
+
+	for i := 4; i <= 5; i++ {
+		msg = waitTopicMessage(t, messages)
+		if msg.Seq != uint64(i) {
+			t.Fatalf("replay message = %+v, want seq %d", msg, i)
+		}
+	}
+
+	//取消订阅后不再推送
+	err = client.Unsubscribe(host.NodeID(), topic)
+	if err != nil {
+		t.Fatalf("Unsubscribe unexpected error: %v", err)
+	}
+	if subs := host.TopicSubscribers(topic); len(subs) != 0 {
+		t.Fatalf("TopicSubscribers = %v after unsubscribe", subs)
+	}
+	host.Publish(topic, map[string]interface{}{"height": 6})
+	select {
+	case msg = <-messages:
+		t.Fatalf("unexpected message after unsubscribe: %+v", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestOWTPNode_SubscribeReplayBuffer(t *testing.T) {
+
+	const (
+		addr  = "127.0.0.1:8438"
+		topic = "recharge:account1"
+	)
+
+	host := RandomOWTPNode()
+	host.SetTopicBufferSize(2)
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	//订阅前发布的消息，只保留缓存中的最近2条
+	for i := 1; i <= 3; i++ {
+		host.Publish(topic, i)
+	}
+
+	client := RandomOWTPNode()
+	defer client.Close()
+	_, err = client.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	messages := make(chan *TopicMessage, 10)
+	err = client.Subscribe(host.NodeID(), topic, true, func(msg *TopicMessage) error {
+		messages <- msg
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Subscribe unexpected error: %v", err)
+	}
+
+	for i := 2; i <= 3; i++ {
+		msg := waitTopicMessage(t, messages)
+		if msg.Seq != uint64(i) {
+			t.Fatalf("replay message = %+v, want seq %d", msg, i)
+		}
+	}
+}
+
+func TestOWTPNode_SubscribeAuthorizer(t *testing.T) {
+
+	const (
+		addr = "127.0.0.1:8443"
+	)
+
+	host := RandomOWTPNode()
+	host.SetTopicAuthorizer(func(pid, topic string) bool {
+		return topic == "newBlock:BTC"
+	})
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	client := RandomOWTPNode()
+	defer client.Close()
+	_, err = client.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	handler := func(msg *TopicMessage) error {
+		return nil
+	}
+
+	err = client.Subscribe(host.NodeID(), "recharge:account1", false, handler)
+	if err == nil {
+		t.Fatalf("Subscribe unauthorized topic should fail")
+	}
+	if subscribers := host.TopicSubscribers("recharge:account1"); len(subscribers) != 0 {
+		t.Fatalf("unauthorized subscribers = %v", subscribers)
+	}
+
+	err = client.Subscribe(host.NodeID(), "newBlock:BTC", false, handler)
+	if err != nil {
+		t.Fatalf("Subscribe unexpected error: %v", err)
+	}
+	if subscribers := host.TopicSubscribers("newBlock:BTC"); len(subscribers) != 1 || subscribers[0] != client.NodeID() {
+		t.Fatalf("subscribers = %v, want %s", subscribers, client.NodeID())
+	}
+
+	//节点断开后删除订阅
+	client.ClosePeer(host.NodeID())
+	deadline := time.Now().Add(3 * time.Second)
+	for len(host.TopicSubscribers("newBlock:BTC")) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribers of left peer should be removed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestOWTPNode_SubscribeMaxTopics(t *testing.T) {
+
+	const (
+		addr = "127.0.0.1:8445"
+	)
+
+	host := RandomOWTPNode()
+	host.SetMaxTopicsPerPeer(2)
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	client := RandomOWTPNode()
+	defer client.Close()
+	_, err = client.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	handler := func(msg *TopicMessage) error {
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = client.Subscribe(host.NodeID(), fmt.Sprintf("topic%d", i), false, handler); err != nil {
+			t.Fatalf("Subscribe unexpected error: %v", err)
+		}
+	}
+	if err = client.Subscribe(host.NodeID(), "topic2", false, handler); err == nil {
+		t.Fatalf("Subscribe more than max topics should fail")
+	}
+
+	//重复订阅不计数
+	if err = client.Subscribe(host.NodeID(), "topic0", false, handler); err != nil {
+		t.Fatalf("Subscribe again unexpected error: %v", err)
+	}
+
+	//取消订阅后删除未发布过消息的主题
+	if err = client.Unsubscribe(host.NodeID(), "topic1"); err != nil {
+		t.Fatalf("Unsubscribe unexpected error: %v", err)
+	}
+	host.pubsubMu.Lock()
+	_, exist := host.topics["topic1"]
+	host.pubsubMu.Unlock()
+	if exist {
+		t.Fatalf("topic without subscribers and messages should be removed")
+	}
+	if err = client.Subscribe(host.NodeID(), "topic2", false, handler); err != nil {
+		t.Fatalf("Subscribe unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/blocktree/openwallet/v2/log"
+)
+
+const (
+	//默认首次重连的等待时间（毫秒）
+	DefaultReconnectMinInterval = 1000
+	//默认重连等待时间的上限（毫秒）
+	DefaultReconnectMaxInterval = 60000
+	//默认退避倍数
+	DefaultReconnectMultiplier = 2
+)
+
+//reconnectTask 断线重连任务
+type reconnectTask struct {
+	attempts int           //已尝试的次数
+	stop     chan struct{} //停止重连
+}
+
+//ReconnectBackoff 计算第attempt次重连前的等待时间，按指数退避，并加入随机抖动
+func ReconnectBackoff(config ConnectConfig, attempt int) time.Duration {
+
+	minInterval := config.ReconnectMinInterval
+	if minInterval <= 0 {
+		minInterval = DefaultReconnectMinInterval
+	}
+
+	maxInterval := config.ReconnectMaxInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultReconnectMaxInterval
+	}
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+
+	multiplier := config.ReconnectMultiplier
+	if multiplier < 1 {
+		multiplier = DefaultReconnectMultiplier
+	}
+
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	interval := float64(minInterval) * math.Pow(multiplier, float64(attempt-1))
+	if interval > float64(maxInterval) {
+		interval = float64(maxInterval)
+	}
+
+	//随机抖动，避免大量客户端同时重连
+	jitter := math.Min(math.Max(config.ReconnectJitter, 0), 1)
+	if jitter > 0 {
+		interval = interval * (1 + jitter*(rand.Float64()*2-1))
+	}
+
+	return time.Duration(interval) * time.Millisecond
+}
+
+//startReconnect 节点断开后，按连接配置开启断线重连，返回是否进行重连
+func (node *OWTPNode) startReconnect(peer Peer) bool {
+
+	pid := peer.PID()
+	config := peer.ConnectConfig()
+
+	node.reconnectMu.Lock()
+	defer node.reconnectMu.Unlock()
+
+	//我方主动关闭的节点不重连
+	if node.manualClosedPeers[pid] {
+		delete(node.manualClosedPeers, pid)
+		return false
+	}
+
+	if node.closed {
+		return false
+	}
+
+	//只对我方主动连接的长连接节点重连
+	if !peer.IsHost() || !config.EnableReconnect {
+		return false
+	}
+
+	if config.ConnectType != Websocket && config.ConnectType != MQ && config.ConnectType != Loopback {
+		return false
+	}
+
+	if node.reconnectTasks == nil {
+		node.reconnectTasks = make(map[string]*reconnectTask)
+	}
+
+	//已有重连任务进行中
+	if _, exist := node.reconnectTasks[pid]; exist {
+		return true
+	}
+
+	task := &reconnectTask{
+		stop: make(chan struct{}),
+	}
+	node.reconnectTasks[pid] = task
+
+	go node.runReconnect(pid, config, task)
+
+	return true
+}
+
+//runReconnect 执行断线重连，直到成功，达到最大次数或被停止
+func (node *OWTPNode) runReconnect(pid string, config ConnectConfig, task *reconnectTask) {
+
+	//断开前使用的协商密码类型，重连后需要重新协商
+	consultType := ""
+	if ka, ok := node.Peerstore().Get(pid, keyAgreementCipher).(*KeyAgreement); ok {
+		consultType = ka.EncryptType
+	}
+	if len(consultType) == 0 && config.EnableKeyAgreement {
+		suite, _ := cipherSuiteFromConfig(config)
+		consultType = suite.String()
+	}
+
+	for attempt := 1; config.ReconnectMaxAttempts <= 0 || attempt <= config.ReconnectMaxAttempts; attempt++ {
+
+		select {
+		case <-task.stop:
+			return
+		case <-time.After(ReconnectBackoff(config, attempt)):
+		}
+
+		node.reconnectMu.Lock()
+		if node.reconnectTasks[pid] != task {
+			//任务已被停止
+			node.reconnectMu.Unlock()
+			return
+		}
+		task.attempts = attempt
+		node.reconnectMu.Unlock()
+
+		err := node.reconnect(pid, config, consultType)
+		if err == nil {
+			log.Infof("peer[%s] reconnect successfully after %d attempts", pid, attempt)
+
+			node.reconnectMu.Lock()
+			if node.reconnectTasks[pid] == task {
+				delete(node.reconnectTasks, pid)
+			}
+			node.reconnectMu.Unlock()
+
+			//重新订阅主题，补发断线期间的消息
+			node.resubscribe(pid)
+
+			//重新协商密码后才通知连接成功
+			if node.connectHandler != nil {
+				peerInfo := node.Peerstore().PeerInfo(pid)
+				peerInfo.State = PeerStateConnected
+				peerInfo.ReconnectAttempts = attempt
+				go node.connectHandler(node, peerInfo)
+			}
+			return
+		}
+
+		log.Warningf("peer[%s] reconnect failed, attempts: %d, unexpected error: %v", pid, attempt, err)
+	}
+
+	node.reconnectMu.Lock()
+	if node.reconnectTasks[pid] != task {
+		node.reconnectMu.Unlock()
+		return
+	}
+	delete(node.reconnectTasks, pid)
+	node.reconnectMu.Unlock()
+
+	log.Errorf("peer[%s] reconnect failed after %d attempts, give up", pid, config.ReconnectMaxAttempts)
+
+	node.removePeerTopics(pid)
+
+	if node.disconnectHandler != nil {
+		peerInfo := node.Peerstore().PeerInfo(pid)
+		peerInfo.State = PeerStateReconnectFailed
+		peerInfo.ReconnectAttempts = config.ReconnectMaxAttempts
+		go node.disconnectHandler(node, peerInfo)
+	}
+}
+
+//reconnect 重新连接节点，并重新协商密码
+func (node *OWTPNode) reconnect(pid string, config ConnectConfig, consultType string) error {
+
+	peer, err := node.connect(pid, config)
+	if err != nil {
+		return err
+	}
+
+	if len(consultType) > 0 && peer.auth() != nil && !peer.auth().EnableKeyAgreement() {
+		err = node.startKeyAgreement(peer, consultType)
+		if err != nil {
+			//协商失败，关闭连接，由断开事件继续重连
+			peer.close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+//isReconnecting 节点是否正在断线重连
+func (node *OWTPNode) isReconnecting(pid string) bool {
+	node.reconnectMu.Lock()
+	defer node.reconnectMu.Unlock()
+	_, exist := node.reconnectTasks[pid]
+	return exist
+}
+
+//reconnectAttempts 节点断线重连已尝试的次数
+func (node *OWTPNode) reconnectAttempts(pid string) int {
+	node.reconnectMu.Lock()
+	defer node.reconnectMu.Unlock()
+	task, exist := node.reconnectTasks[pid]
+	if !exist {
+		return 0
+	}
+	return task.attempts
+}
+
+//stopReconnect 停止节点的断线重连
+func (node *OWTPNode) stopReconnect(pid string) {
+	node.reconnectMu.Lock()
+	defer node.reconnectMu.Unlock()
+	task, exist := node.reconnectTasks[pid]
+	if !exist {
+		return
+	}
+	close(task.stop)
+	delete(node.reconnectTasks, pid)
+}
+
+//stopAllReconnect 停止所有断线重连，节点关闭后不再重连
+func (node *OWTPNode) stopAllReconnect() {
+	node.reconnectMu.Lock()
+	defer node.reconnectMu.Unlock()
+	node.closed = true
+	for pid, task := range node.reconnectTasks {
+		close(task.stop)
+		delete(node.reconnectTasks, pid)
+	}
+}
+
+//markManualClosed 标记我方主动关闭的节点
+func (node *OWTPNode) markManualClosed(pid string) {
+	node.reconnectMu.Lock()
+	defer node.reconnectMu.Unlock()
+	if node.manualClosedPeers == nil {
+		node.manualClosedPeers = make(map[string]bool)
+	}
+	node.manualClosedPeers[pid] = true
+}
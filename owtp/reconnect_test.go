@@ -0,0 +1,183 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+
+	config := ConnectConfig{
+		ReconnectMinInterval: 100,
+		ReconnectMaxInterval: 1000,
+		ReconnectMultiplier:  2,
+	}
+
+	wants := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, want := range wants {
+		got := ReconnectBackoff(config, i+1)
+		if got != want*time.Millisecond {
+			t.Errorf("attempt %d backoff = %v, want %v", i+1, got, want*time.Millisecond)
+		}
+	}
+
+	//默认值
+	if got := ReconnectBackoff(ConnectConfig{}, 1); got != DefaultReconnectMinInterval*time.Millisecond {
+		t.Errorf("default backoff = %v", got)
+	}
+
+	//抖动范围
+	config.ReconnectJitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := ReconnectBackoff(config, 2)
+		if got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("jitter backoff = %v out of range", got)
+		}
+	}
+}
+
+func TestOWTPNode_Reconnect(t *testing.T) {
+
+	const addr = "127.0.0.1:8433"
+
+	host := RandomOWTPNode("aes")
+	host.HandleFunc("echo", func(ctx *Context) {
+		ctx.Response(map[string]interface{}{"name": ctx.Params().Get("name").String()}, StatusSuccess, "success")
+	})
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	openEvents := make(chan PeerInfo, 10)
+	closeEvents := make(chan PeerInfo, 10)
+
+	client := RandomOWTPNode()
+	client.SetOpenHandler(func(n *OWTPNode, peer PeerInfo) {
+		openEvents <- peer
+	})
+	client.SetCloseHandler(func(n *OWTPNode, peer PeerInfo) {
+		closeEvents <- peer
+	})
+	defer client.Close()
+
+	config := ConnectConfig{
+		Address:              addr,
+		ConnectType:          Websocket,
+		EnableKeyAgreement:   true,
+		EnableReconnect:      true,
+		ReconnectMinInterval: 50,
+		ReconnectMaxInterval: 200,
+	}
+
+	_, err = client.Connect(host.NodeID(), config)
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	if event := waitPeerEvent(t, openEvents); event.State != PeerStateConnected || event.ReconnectAttempts != 0 {
+		t.Fatalf("open event = %+v", event)
+	}
+
+	//服务端断开连接，客户端自动重连
+	host.ClosePeer(client.NodeID())
+
+	if event := waitPeerEvent(t, closeEvents); event.State != PeerStateReconnecting {
+		t.Fatalf("close event = %+v", event)
+	}
+
+	if event := waitPeerEvent(t, openEvents); event.State != PeerStateConnected || event.ReconnectAttempts != 1 {
+		t.Fatalf("reopen event = %+v", event)
+	}
+
+	resp, err := client.CallSync(host.NodeID(), "echo", map[string]interface{}{"name": "chance"})
+	if err != nil {
+		t.Fatalf("CallSync unexpected error: %v", err)
+	}
+	if resp.Status != StatusSuccess || resp.JsonData().Get("name").String() != "chance" {
+		t.Fatalf("response = %+v", resp)
+	}
+
+	//我方主动断开，不会重连
+	client.ClosePeer(host.NodeID())
+
+	if event := waitPeerEvent(t, closeEvents); event.State != PeerStateDisconnected {
+		t.Fatalf("close event = %+v", event)
+	}
+
+	select {
+	case event := <-openEvents:
+		t.Fatalf("unexpected open event after manual close: %+v", event)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestOWTPNode_ReconnectFailed(t *testing.T) {
+
+	const addr = "127.0.0.1:8434"
+
+	host := RandomOWTPNode()
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+
+	closeEvents := make(chan PeerInfo, 10)
+
+	client := RandomOWTPNode()
+	client.SetCloseHandler(func(n *OWTPNode, peer PeerInfo) {
+		closeEvents <- peer
+	})
+	defer client.Close()
+
+	config := ConnectConfig{
+		Address:              addr,
+		ConnectType:          Websocket,
+		EnableReconnect:      true,
+		ReconnectMaxAttempts: 2,
+		ReconnectMinInterval: 20,
+	}
+
+	_, err = client.Connect(host.NodeID(), config)
+	if err != nil {
+		t.Fatalf("Connect unexpected error: %v", err)
+	}
+
+	//服务端关闭，重连全部失败
+	host.Close()
+
+	if event := waitPeerEvent(t, closeEvents); event.State != PeerStateReconnecting {
+		t.Fatalf("close event = %+v", event)
+	}
+
+	if event := waitPeerEvent(t, closeEvents); event.State != PeerStateReconnectFailed || event.ReconnectAttempts != 2 {
+		t.Fatalf("reconnect failed event = %+v", event)
+	}
+}
+
+func waitPeerEvent(t *testing.T, events chan PeerInfo) PeerInfo {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wait peer event timeout")
+	}
+	return PeerInfo{}
+}
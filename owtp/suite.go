@@ -0,0 +1,540 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/v2/crypto"
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+//连接的签名曲线
+const (
+	CurveSM2       = "sm2"       //国密SM2，默认
+	CurveSecp256k1 = "secp256k1" //secp256k1 ECDSA
+	CurveEd25519   = "ed25519"   //Ed25519（RFC 8032），协商密码转换为X25519
+)
+
+//协商密码后的数据加密算法
+const (
+	CipherAES              = "aes"               //AES-CBC，默认，兼容旧版本
+	CipherAESGCM           = "aes-gcm"           //AES-256-GCM
+	CipherChaCha20Poly1305 = "chacha20-poly1305" //ChaCha20-Poly1305
+)
+
+//Curve 连接使用的曲线，负责节点公钥，数据包签名和协商密码的计算。
+//证书私钥为32字节，在不同曲线上得到不同的公钥和节点ID
+type Curve interface {
+	//Name 曲线名称，在握手头字段c和SecretData.EncryptType中传递
+	Name() string
+	//PublicKey 由私钥计算公钥
+	PublicKey(privateKey []byte) ([]byte, error)
+	//Sign 签名数据包的哈希
+	Sign(privateKey, publicKey, hash []byte) ([]byte, error)
+	//Verify 验证数据包哈希的签名
+	Verify(publicKey, hash, signature []byte) bool
+	//GenerateKey 生成协商密码的临时密钥对
+	GenerateKey() (privateKey, publicKey []byte, err error)
+	//SharedSecret 计算ECDH共享密钥
+	SharedSecret(privateKey, publicKey []byte) ([]byte, error)
+}
+
+//Cipher 协商密码后的数据加密算法，密钥为32字节
+type Cipher interface {
+	//Encrypt 加密
+	Encrypt(plainText, key []byte) ([]byte, error)
+	//Decrypt 解密，AEAD算法验证失败返回错误
+	Decrypt(cipherText, key []byte) ([]byte, error)
+}
+
+var (
+	curves = map[string]Curve{
+		CurveSM2:       sm2Curve{},
+		CurveSecp256k1: secp256k1Curve{},
+		CurveEd25519:   ed25519Curve{},
+	}
+	ciphers = map[string]Cipher{
+		CipherAES:              aesCBCCipher{},
+		CipherAESGCM:           aeadCipher{newAEAD: newAESGCM},
+		CipherChaCha20Poly1305: aeadCipher{newAEAD: chacha20poly1305.New},
+	}
+	suiteMu sync.RWMutex
+)
+
+//RegisterCurve 注册签名曲线，内置sm2，secp256k1，ed25519。
+//sm2使用owcrypt的协商密码，其他曲线使用基于SharedSecret的协商密码
+func RegisterCurve(curve Curve) {
+	suiteMu.Lock()
+	defer suiteMu.Unlock()
+	curves[curve.Name()] = curve
+}
+
+//RegisterCipher 注册加密算法，内置aes，aes-gcm，chacha20-poly1305
+func RegisterCipher(name string, c Cipher) {
+	suiteMu.Lock()
+	defer suiteMu.Unlock()
+	ciphers[name] = c
+}
+
+func getCurve(name string) (Curve, bool) {
+	suiteMu.RLock()
+	defer suiteMu.RUnlock()
+	c, ok := curves[name]
+	return c, ok
+}
+
+func getCipher(name string) (Cipher, bool) {
+	suiteMu.RLock()
+	defer suiteMu.RUnlock()
+	c, ok := ciphers[name]
+	return c, ok
+}
+
+//CipherSuite 连接使用的签名曲线和加密算法，零值为sm2/aes
+type CipherSuite struct {
+	Curve  string
+	Cipher string
+}
+
+//ParseCipherSuite 解析"曲线/加密算法"，只有加密算法时曲线为sm2，兼容旧版本的"aes"
+func ParseCipherSuite(s string) (CipherSuite, error) {
+
+	suite := CipherSuite{}
+	if i := strings.Index(s, "/"); i >= 0 {
+		suite.Curve, suite.Cipher = s[:i], s[i+1:]
+	} else {
+		suite.Cipher = s
+	}
+	suite = suite.normalize()
+
+	if _, ok := getCurve(suite.Curve); !ok {
+		return suite, fmt.Errorf("unsupported curve: %s", suite.Curve)
+	}
+	if _, ok := getCipher(suite.Cipher); !ok {
+		return suite, fmt.Errorf("unsupported cipher: %s", suite.Cipher)
+	}
+
+	return suite, nil
+}
+
+//cipherSuiteFromConfig 连接配置的签名曲线和加密算法
+func cipherSuiteFromConfig(config ConnectConfig) (CipherSuite, error) {
+	return ParseCipherSuite(config.Curve + "/" + config.Cipher)
+}
+
+//normalize 空值使用默认的sm2/aes
+func (suite CipherSuite) normalize() CipherSuite {
+	if len(suite.Curve) == 0 {
+		suite.Curve = CurveSM2
+	}
+	if len(suite.Cipher) == 0 {
+		suite.Cipher = CipherAES
+	}
+	return suite
+}
+
+//String 在SecretData.EncryptType中传递，sm2只传加密算法，与旧版本保持一致
+func (suite CipherSuite) String() string {
+	suite = suite.normalize()
+	if suite.Curve == CurveSM2 {
+		return suite.Cipher
+	}
+	return suite.Curve + "/" + suite.Cipher
+}
+
+//curve 已注册的曲线，未注册使用sm2
+func (suite CipherSuite) curve() Curve {
+	if c, ok := getCurve(suite.normalize().Curve); ok {
+		return c
+	}
+	return sm2Curve{}
+}
+
+//cipher 已注册的加密算法，未注册使用aes
+func (suite CipherSuite) cipher() Cipher {
+	if c, ok := getCipher(suite.normalize().Cipher); ok {
+		return c
+	}
+	return aesCBCCipher{}
+}
+
+//sm2Curve 国密SM2，签名的用户ID为节点ID
+type sm2Curve struct{}
+
+func (sm2Curve) Name() string {
+	return CurveSM2
+}
+
+func (sm2Curve) PublicKey(privateKey []byte) ([]byte, error) {
+	pub, ret := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_SM2_STANDARD)
+	if ret != owcrypt.SUCCESS {
+		return nil, fmt.Errorf("sm2 private key is invalid")
+	}
+	return pub, nil
+}
+
+func (sm2Curve) Sign(privateKey, publicKey, hash []byte) ([]byte, error) {
+	nodeID := owcrypt.Hash(publicKey, 0, owcrypt.HASH_ALG_SHA256)
+	signature, _, ret := owcrypt.Signature(privateKey, nodeID, hash, owcrypt.ECC_CURVE_SM2_STANDARD)
+	if ret != owcrypt.SUCCESS {
+		return nil, fmt.Errorf("sm2 signature failed")
+	}
+	return signature, nil
+}
+
+func (sm2Curve) Verify(publicKey, hash, signature []byte) bool {
+	nodeID := owcrypt.Hash(publicKey, 0, owcrypt.HASH_ALG_SHA256)
+	return owcrypt.Verify(publicKey, nodeID, hash, signature, owcrypt.ECC_CURVE_SM2_STANDARD) == owcrypt.SUCCESS
+}
+
+func (sm2Curve) GenerateKey() ([]byte, []byte, error) {
+	priv, pub := owcrypt.KeyAgreement_initiator_step1(owcrypt.ECC_CURVE_SM2_STANDARD)
+	return priv, pub, nil
+}
+
+func (sm2Curve) SharedSecret(privateKey, publicKey []byte) ([]byte, error) {
+	return nil, fmt.Errorf("sm2 uses the key agreement of owcrypt")
+}
+
+//secp256k1Curve secp256k1 ECDSA，公钥为64字节的X||Y
+type secp256k1Curve struct{}
+
+func (secp256k1Curve) Name() string {
+	return CurveSecp256k1
+}
+
+func (secp256k1Curve) PublicKey(privateKey []byte) ([]byte, error) {
+	pub, ret := owcrypt.GenPubkey(privateKey, owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		return nil, fmt.Errorf("secp256k1 private key is invalid")
+	}
+	return pub, nil
+}
+
+func (secp256k1Curve) Sign(privateKey, publicKey, hash []byte) ([]byte, error) {
+	signature, _, ret := owcrypt.Signature(privateKey, nil, hash, owcrypt.ECC_CURVE_SECP256K1)
+	if ret != owcrypt.SUCCESS {
+		return nil, fmt.Errorf("secp256k1 signature failed")
+	}
+	return signature, nil
+}
+
+func (secp256k1Curve) Verify(publicKey, hash, signature []byte) bool {
+	return owcrypt.Verify(publicKey, nil, hash, signature, owcrypt.ECC_CURVE_SECP256K1) == owcrypt.SUCCESS
+}
+
+func (c secp256k1Curve) GenerateKey() ([]byte, []byte, error) {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return nil, nil, err
+	}
+	priv := make([]byte, 32)
+	b := key.D.Bytes()
+	copy(priv[32-len(b):], b)
+	pub, err := c.PublicKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, pub, nil
+}
+
+func (secp256k1Curve) SharedSecret(privateKey, publicKey []byte) ([]byte, error) {
+	if len(publicKey) != 64 {
+		return nil, fmt.Errorf("secp256k1 public key is invalid")
+	}
+	pub, err := btcec.ParsePubKey(append([]byte{0x04}, publicKey...), btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), privateKey)
+	return btcec.GenerateSharedSecret(priv, pub), nil
+}
+
+//ed25519Curve Ed25519，私钥为32字节的种子
+type ed25519Curve struct{}
+
+func (ed25519Curve) Name() string {
+	return CurveEd25519
+}
+
+func (ed25519Curve) PublicKey(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, fmt.Errorf("ed25519 private key is invalid")
+	}
+	return ed25519.NewKeyFromSeed(privateKey).Public().(ed25519.PublicKey), nil
+}
+
+func (ed25519Curve) Sign(privateKey, publicKey, hash []byte) ([]byte, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, fmt.Errorf("ed25519 private key is invalid")
+	}
+	return ed25519.Sign(ed25519.NewKeyFromSeed(privateKey), hash), nil
+}
+
+func (ed25519Curve) Verify(publicKey, hash, signature []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(publicKey, hash, signature)
+}
+
+func (ed25519Curve) GenerateKey() ([]byte, []byte, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.Seed(), pub, nil
+}
+
+//SharedSecret 私钥和公钥转换为X25519后计算
+func (ed25519Curve) SharedSecret(privateKey, publicKey []byte) ([]byte, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, fmt.Errorf("ed25519 private key is invalid")
+	}
+	point, err := ed25519PublicKeyToX25519(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	h := sha512.Sum512(privateKey)
+	return curve25519.X25519(h[:32], point)
+}
+
+//ed25519PublicKeyToX25519 Edwards曲线的公钥转换为Montgomery曲线，u = (1 + y) / (1 - y)
+func ed25519PublicKeyToX25519(publicKey []byte) ([]byte, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("ed25519 public key is invalid")
+	}
+
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+	//小端编码，最高位为x的符号
+	b := make([]byte, 32)
+	for i := range publicKey {
+		b[31-i] = publicKey[i]
+	}
+	b[0] &= 0x7f
+	y := new(big.Int).SetBytes(b)
+	if y.Cmp(p) >= 0 {
+		return nil, fmt.Errorf("ed25519 public key is invalid")
+	}
+
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, p)
+	if den.Sign() == 0 {
+		return nil, fmt.Errorf("ed25519 public key is invalid")
+	}
+	u := new(big.Int).Add(big.NewInt(1), y)
+	u.Mul(u, den.ModInverse(den, p))
+	u.Mod(u, p)
+
+	out := make([]byte, 32)
+	ub := u.Bytes()
+	for i := range ub {
+		out[i] = ub[len(ub)-1-i]
+	}
+	return out, nil
+}
+
+//aesCBCCipher AES-CBC，与旧版本一致
+type aesCBCCipher struct{}
+
+func (aesCBCCipher) Encrypt(plainText, key []byte) ([]byte, error) {
+	return crypto.AESEncrypt(plainText, key)
+}
+
+func (aesCBCCipher) Decrypt(cipherText, key []byte) ([]byte, error) {
+	//密文必须是完整的分组
+	if len(cipherText) == 0 || len(cipherText)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext is not a multiple of the block size")
+	}
+	return crypto.AESDecrypt(cipherText, key)
+}
+
+//aeadCipher AEAD加密，密文前面附加随机nonce
+type aeadCipher struct {
+	newAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c aeadCipher) Encrypt(plainText, key []byte) ([]byte, error) {
+	aead, err := c.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plainText)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plainText, nil), nil
+}
+
+func (c aeadCipher) Decrypt(cipherText, key []byte) ([]byte, error) {
+	aead, err := c.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	nonce := cipherText[:aead.NonceSize()]
+	return aead.Open(nil, nonce, cipherText[aead.NonceSize():], nil)
+}
+
+/*
+	sm2以外的曲线使用基于ECDH的协商密码，数据包字段与sm2协商密码一致：
+
+	1. 发起方生成临时密钥对，发送公钥pk和临时公钥tpk。
+	2. 响应方生成临时密钥对，计算 Z = ECDH(tr, tpk) || ECDH(r, tpk) || ECDH(tr, pk)，
+	   由HKDF-SHA256派生密钥key和确认密钥，返回临时公钥tpo和确认值SB，保存期望的确认值S2。
+	   协商的"曲线/加密算法"计入派生密钥的transcript，加密算法被篡改时双方的确认值不一致。
+	3. 发起方计算相同的Z，验证SB后得到key，下一个请求带上确认值SA。
+	4. 响应方验证 SA == S2 后完成协商。
+*/
+
+const (
+	curveKeyAgreementInfo = "owtp key agreement"
+	curveKeyAgreementSB   = 0x02
+	curveKeyAgreementSA   = 0x03
+)
+
+//curveKeyAgreementResponder 响应方计算协商密码，返回密钥，临时公钥，S2和SB
+func curveKeyAgreementResponder(
+	suite CipherSuite,
+	pubkeyInitiator, tmpPubkeyInitiator []byte,
+	pubkeyResponder, privkeyResponder []byte) ([]byte, []byte, []byte, []byte, error) {
+
+	curve := suite.curve()
+	tmpPrivkeyResponder, tmpPubkeyResponder, err := curve.GenerateKey()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	z, err := curveSharedSecrets(curve,
+		[2][]byte{tmpPrivkeyResponder, tmpPubkeyInitiator},
+		[2][]byte{privkeyResponder, tmpPubkeyInitiator},
+		[2][]byte{tmpPrivkeyResponder, pubkeyInitiator})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	transcript := curveKeyAgreementTranscript(suite, pubkeyInitiator, pubkeyResponder, tmpPubkeyInitiator, tmpPubkeyResponder)
+	key, confirm, err := curveKeyAgreementKey(z, transcript)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	sb := curveKeyAgreementMAC(confirm, curveKeyAgreementSB, transcript)
+	s2 := curveKeyAgreementMAC(confirm, curveKeyAgreementSA, transcript)
+
+	return key, tmpPubkeyResponder, s2, sb, nil
+}
+
+//curveKeyAgreementInitiator 发起方验证SB，返回密钥和SA
+func curveKeyAgreementInitiator(
+	suite CipherSuite,
+	privkeyInitiator, pubkeyInitiator []byte,
+	pubkeyResponder []byte,
+	tmpPrivkeyInitiator, tmpPubkeyInitiator []byte,
+	tmpPubkeyResponder, sb []byte) ([]byte, []byte, error) {
+
+	z, err := curveSharedSecrets(suite.curve(),
+		[2][]byte{tmpPrivkeyInitiator, tmpPubkeyResponder},
+		[2][]byte{tmpPrivkeyInitiator, pubkeyResponder},
+		[2][]byte{privkeyInitiator, tmpPubkeyResponder})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transcript := curveKeyAgreementTranscript(suite, pubkeyInitiator, pubkeyResponder, tmpPubkeyInitiator, tmpPubkeyResponder)
+	key, confirm, err := curveKeyAgreementKey(z, transcript)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !hmac.Equal(sb, curveKeyAgreementMAC(confirm, curveKeyAgreementSB, transcript)) {
+		return nil, nil, fmt.Errorf("key agreement SB is invalid")
+	}
+
+	return key, curveKeyAgreementMAC(confirm, curveKeyAgreementSA, transcript), nil
+}
+
+//curveSharedSecrets 按顺序计算ECDH共享密钥并拼接
+func curveSharedSecrets(curve Curve, pairs ...[2][]byte) ([]byte, error) {
+	var z []byte
+	for _, pair := range pairs {
+		secret, err := curve.SharedSecret(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		z = append(z, secret...)
+	}
+	return z, nil
+}
+
+//curveKeyAgreementTranscript 协商的曲线和加密算法，双方节点ID和临时公钥
+func curveKeyAgreementTranscript(suite CipherSuite, pubkeyInitiator, pubkeyResponder, tmpPubkeyInitiator, tmpPubkeyResponder []byte) []byte {
+	name := suite.normalize().Curve + "/" + suite.normalize().Cipher
+	idInitiator := sha256.Sum256(pubkeyInitiator)
+	idResponder := sha256.Sum256(pubkeyResponder)
+	transcript := make([]byte, 0, 1+len(name)+64+len(tmpPubkeyInitiator)+len(tmpPubkeyResponder))
+	transcript = append(transcript, byte(len(name)))
+	transcript = append(transcript, name...)
+	transcript = append(transcript, idInitiator[:]...)
+	transcript = append(transcript, idResponder[:]...)
+	transcript = append(transcript, tmpPubkeyInitiator...)
+	transcript = append(transcript, tmpPubkeyResponder...)
+	return transcript
+}
+
+//curveKeyAgreementKey 派生32字节的密钥和确认密钥
+func curveKeyAgreementKey(z, transcript []byte) ([]byte, []byte, error) {
+	info := append([]byte(curveKeyAgreementInfo), transcript...)
+	okm := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, z, nil, info), okm); err != nil {
+		return nil, nil, err
+	}
+	return okm[:32], okm[32:], nil
+}
+
+func curveKeyAgreementMAC(key []byte, label byte, transcript []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte{label})
+	h.Write(transcript)
+	return h.Sum(nil)
+}
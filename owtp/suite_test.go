@@ -0,0 +1,241 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package owtp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestParseCipherSuite(t *testing.T) {
+
+	tests := []struct {
+		s      string
+		suite  CipherSuite
+		String string
+	}{
+		{"", CipherSuite{CurveSM2, CipherAES}, "aes"},
+		{"aes", CipherSuite{CurveSM2, CipherAES}, "aes"},
+		{"/", CipherSuite{CurveSM2, CipherAES}, "aes"},
+		{"aes-gcm", CipherSuite{CurveSM2, CipherAESGCM}, "aes-gcm"},
+		{"secp256k1/", CipherSuite{CurveSecp256k1, CipherAES}, "secp256k1/aes"},
+		{"ed25519/chacha20-poly1305", CipherSuite{CurveEd25519, CipherChaCha20Poly1305}, "ed25519/chacha20-poly1305"},
+	}
+
+	for _, test := range tests {
+		suite, err := ParseCipherSuite(test.s)
+		if err != nil {
+			t.Fatalf("ParseCipherSuite(%q) unexpected error: %v", test.s, err)
+		}
+		if suite != test.suite || suite.String() != test.String {
+			t.Errorf("ParseCipherSuite(%q) = %+v, %s", test.s, suite, suite.String())
+		}
+	}
+
+	for _, s := range []string{"p384/aes", "secp256k1/des"} {
+		if _, err := ParseCipherSuite(s); err == nil {
+			t.Errorf("ParseCipherSuite(%q) should fail", s)
+		}
+	}
+}
+
+func TestCurve_SignAndKeyAgreement(t *testing.T) {
+
+	cert := NewRandomCertificate()
+	hash := sha256.Sum256([]byte("hello owtp"))
+
+	for _, name := range []string{CurveSM2, CurveSecp256k1, CurveEd25519} {
+		curve, _ := getCurve(name)
+
+		pub, err := cert.PublicKeyWithCurve(name)
+		if err != nil {
+			t.Fatalf("%s: PublicKeyWithCurve unexpected error: %v", name, err)
+		}
+		signature, err := curve.Sign(cert.PrivateKeyBytes(), pub, hash[:])
+		if err != nil {
+			t.Fatalf("%s: Sign unexpected error: %v", name, err)
+		}
+		if !curve.Verify(pub, hash[:], signature) {
+			t.Errorf("%s: Verify failed", name)
+		}
+		other := sha256.Sum256([]byte("hello"))
+		if curve.Verify(pub, other[:], signature) {
+			t.Errorf("%s: Verify other hash should fail", name)
+		}
+
+		if name == CurveSM2 {
+			continue
+		}
+
+		//双方临时密钥计算的共享密钥一致
+		privA, pubA, _ := curve.GenerateKey()
+		privB, pubB, _ := curve.GenerateKey()
+		za, err := curve.SharedSecret(privA, pubB)
+		if err != nil {
+			t.Fatalf("%s: SharedSecret unexpected error: %v", name, err)
+		}
+		zb, _ := curve.SharedSecret(privB, pubA)
+		if !bytes.Equal(za, zb) {
+			t.Errorf("%s: shared secret mismatch", name)
+		}
+
+		//协商密码
+		responder := NewRandomCertificate()
+		responderPub, _ := responder.PublicKeyWithCurve(name)
+		tmpPriv, tmpPub, _ := curve.GenerateKey()
+		suite := CipherSuite{Curve: name, Cipher: CipherAESGCM}
+		key, tmpPubResponder, s2, sb, err := curveKeyAgreementResponder(suite, pub, tmpPub, responderPub, responder.PrivateKeyBytes())
+		if err != nil {
+			t.Fatalf("%s: curveKeyAgreementResponder unexpected error: %v", name, err)
+		}
+		keyA, sa, err := curveKeyAgreementInitiator(suite, cert.PrivateKeyBytes(), pub, responderPub, tmpPriv, tmpPub, tmpPubResponder, sb)
+		if err != nil {
+			t.Fatalf("%s: curveKeyAgreementInitiator unexpected error: %v", name, err)
+		}
+		if !bytes.Equal(key, keyA) || !bytes.Equal(sa, s2) || len(key) != 32 {
+			t.Errorf("%s: key agreement mismatch", name)
+		}
+
+		//响应方公钥被替换
+		fakeCert := NewRandomCertificate()
+		fake, _ := fakeCert.PublicKeyWithCurve(name)
+		if _, _, err := curveKeyAgreementInitiator(suite, cert.PrivateKeyBytes(), pub, fake, tmpPriv, tmpPub, tmpPubResponder, sb); err == nil {
+			t.Errorf("%s: key agreement with fake responder should fail", name)
+		}
+
+		//响应方的加密算法被降级
+		downgrade := CipherSuite{Curve: name, Cipher: CipherAES}
+		_, tmpPubResponder, _, sb, _ = curveKeyAgreementResponder(downgrade, pub, tmpPub, responderPub, responder.PrivateKeyBytes())
+		if _, _, err := curveKeyAgreementInitiator(suite, cert.PrivateKeyBytes(), pub, responderPub, tmpPriv, tmpPub, tmpPubResponder, sb); err == nil {
+			t.Errorf("%s: key agreement with downgraded cipher should fail", name)
+		}
+	}
+}
+
+func TestCipher_EncryptDecrypt(t *testing.T) {
+
+	key := sha256.Sum256([]byte("key"))
+	plainText := []byte(`{"address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}`)
+
+	for _, name := range []string{CipherAES, CipherAESGCM, CipherChaCha20Poly1305} {
+		c, _ := getCipher(name)
+		cipherText, err := c.Encrypt(plainText, key[:])
+		if err != nil {
+			t.Fatalf("%s: Encrypt unexpected error: %v", name, err)
+		}
+		got, err := c.Decrypt(cipherText, key[:])
+		if err != nil || !bytes.Equal(got, plainText) {
+			t.Errorf("%s: Decrypt = %s, err = %v", name, got, err)
+		}
+
+		if name == CipherAES {
+			continue
+		}
+
+		//AEAD验证密文
+		cipherText[len(cipherText)-1] ^= 1
+		if _, err := c.Decrypt(cipherText, key[:]); err == nil {
+			t.Errorf("%s: Decrypt tampered ciphertext should fail", name)
+		}
+	}
+}
+
+func TestOWTPNode_CipherSuite(t *testing.T) {
+
+	const addr = "127.0.0.1:8442"
+
+	host := RandomOWTPNode()
+	host.HandleFunc("getInfo", mqGetInfo)
+	err := host.Listen(ConnectConfig{Address: addr, ConnectType: Websocket, EnableSignature: true})
+	if err != nil {
+		t.Fatalf("Listen unexpected error: %v", err)
+	}
+	defer host.Close()
+
+	tests := []struct {
+		name   string
+		config ConnectConfig
+	}{
+		{"sm2 aes", ConnectConfig{}},
+		{"sm2 aes-gcm", ConnectConfig{Cipher: CipherAESGCM}},
+		{"secp256k1 chacha20-poly1305", ConnectConfig{Curve: CurveSecp256k1, Cipher: CipherChaCha20Poly1305}},
+		{"ed25519 aes-gcm v2", ConnectConfig{Curve: CurveEd25519, Cipher: CipherAESGCM, EnableBinaryPacket: true}},
+	}
+
+	for _, test := range tests {
+		config := test.config
+		config.Address = addr
+		config.ConnectType = Websocket
+		config.EnableSignature = true
+		config.EnableKeyAgreement = true
+
+		client := RandomOWTPNode()
+		_, err := client.Connect(host.NodeID(), config)
+		if err != nil {
+			t.Fatalf("%s: Connect unexpected error: %v", test.name, err)
+		}
+
+		resp, err := client.CallSync(host.NodeID(), "getInfo", map[string]interface{}{"name": "chance"})
+		if err != nil {
+			t.Fatalf("%s: CallSync unexpected error: %v", test.name, err)
+		}
+		if resp.Status != StatusSuccess || resp.JsonData().Get("name").String() != "chance" {
+			t.Errorf("%s: response status = %d, msg = %s", test.name, resp.Status, resp.Msg)
+		}
+
+		//服务端按客户端曲线的公钥计算节点ID，协商的加密算法一致
+		hostPeer := host.GetOnlinePeer(client.Certificate().IDWithCurve(config.Curve))
+		if hostPeer == nil {
+			t.Fatalf("%s: host peer is not found", test.name)
+		}
+		want, _ := cipherSuiteFromConfig(config)
+		if suite := hostPeer.auth().(*OWTPAuth).CipherSuite(); suite != want {
+			t.Errorf("%s: host cipher suite = %+v, want %+v", test.name, suite, want)
+		}
+
+		client.Close()
+	}
+
+	//不支持的曲线
+	client := RandomOWTPNode()
+	defer client.Close()
+	_, err = client.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: Websocket, Curve: "p384"})
+	if err == nil {
+		t.Errorf("Connect with unsupported curve should fail")
+	}
+
+	//服务端只允许AEAD加密算法，拒绝协商未认证的aes
+	host.SetAllowedCiphers(CipherAESGCM, CipherChaCha20Poly1305)
+	for _, config := range []ConnectConfig{{}, {Curve: CurveSecp256k1, Cipher: CipherAES}} {
+		config.Address = addr
+		config.ConnectType = Websocket
+		config.EnableSignature = true
+		config.EnableKeyAgreement = true
+		downgraded := RandomOWTPNode()
+		if _, err = downgraded.Connect(host.NodeID(), config); err == nil {
+			t.Errorf("key agreement with cipher not allowed should fail, config: %+v", config)
+		}
+		downgraded.Close()
+	}
+	allowed := RandomOWTPNode()
+	defer allowed.Close()
+	_, err = allowed.Connect(host.NodeID(), ConnectConfig{Address: addr, ConnectType: Websocket, EnableSignature: true,
+		EnableKeyAgreement: true, Curve: CurveSecp256k1, Cipher: CipherAESGCM})
+	if err != nil {
+		t.Errorf("key agreement with allowed cipher unexpected error: %v", err)
+	}
+}
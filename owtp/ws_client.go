@@ -16,14 +16,12 @@
 package owtp
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/v2/log"
 	"github.com/gorilla/websocket"
 	"github.com/mr-tron/base58/base58"
-	"github.com/tidwall/gjson"
 	"net"
 	"net/http"
 	"sync"
@@ -43,7 +41,7 @@ type WSClient struct {
 	_auth           Authorization
 	ws              *websocket.Conn
 	handler         PeerHandler
-	_send           chan []byte
+	_send           chan wsMessage
 	isHost          bool
 	ReadBufferSize  int
 	WriteBufferSize int
@@ -53,6 +51,14 @@ type WSClient struct {
 	closeOnce       sync.Once
 	done            func()
 	config          ConnectConfig //节点配置
+	version         int64         //连接协商的数据包版本
+	framer          packetFramer  //传输帧的分片与压缩
+}
+
+//wsMessage 待发送的消息
+type wsMessage struct {
+	messageType int
+	data        []byte
 }
 
 // Dial connects a client to the given URL.
@@ -86,7 +92,7 @@ func Dial(
 		}
 	}
 
-	ws, _, err := dialer.Dial(url, httpHeader)
+	ws, resp, err := dialer.Dial(url, httpHeader)
 	if err != nil {
 		return nil, err
 	}
@@ -96,6 +102,10 @@ func Dial(
 		return nil, err
 	}
 
+	//服务端返回协商的数据包版本，旧版本服务端不返回，使用v1
+	client.version = negotiatePacketVersion(resp.Header.Get(packetVersionHeader))
+	client.framer.setOptions(negotiateFrameOptions(resp.Header))
+
 	client.isConnect = true
 	client.isHost = true //我方主动连接
 	client.handler.OnPeerOpen(client)
@@ -114,6 +124,26 @@ func NewWSClientWithHeader(header http.Header, cert Certificate, conn *websocket
 		| s        | string | (websocket必填) | 组合[a+n+t]并sha256两次，使用钱包工具配置的本地私钥签名，最后base58编码         |
 	*/
 
+	auth, err := newOWTPAuthWithHeader(header, cert, enableSignature)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewWSClient(auth.RemotePID(), conn, handler, auth, done)
+	if err != nil {
+		return nil, err
+	}
+
+	//按客户端支持的最高版本协商数据包版本
+	client.version = negotiatePacketVersion(header.Get(packetVersionHeader))
+	client.framer.setOptions(negotiateFrameOptions(header))
+
+	return client, nil
+}
+
+//newOWTPAuthWithHeader 通过握手头字段创建授权，ws和loopback的服务端使用
+func newOWTPAuthWithHeader(header http.Header, cert Certificate, enableSignature bool) (*OWTPAuth, error) {
+
 	var (
 		//enableSig       bool
 		//isConsult       bool
@@ -150,16 +180,19 @@ func NewWSClientWithHeader(header http.Header, cert Certificate, conn *websocket
 	//	}
 	//}
 
-	auth := &OWTPAuth{
-		remotePublicKey: remotePublicKey,
-		enable:          enableSignature,
-		localPublicKey:  cert.PublicKeyBytes(),
-		localPrivateKey: cert.PrivateKeyBytes(),
+	//客户端使用的签名曲线，旧版本不带头字段为sm2
+	suite, err := ParseCipherSuite(header.Get("c"))
+	if err != nil {
+		return nil, err
 	}
 
-	client, err := NewWSClient(auth.RemotePID(), conn, handler, auth, done)
+	auth, err := NewOWTPAuthWithCipherSuite(cert, enableSignature, suite)
+	if err != nil {
+		return nil, err
+	}
+	auth.remotePublicKey = remotePublicKey
 
-	return client, nil
+	return auth, nil
 }
 
 func NewWSClient(pid string, conn *websocket.Conn, handler PeerHandler, auth Authorization, done func()) (*WSClient, error) {
@@ -171,7 +204,7 @@ func NewWSClient(pid string, conn *websocket.Conn, handler PeerHandler, auth Aut
 	client := &WSClient{
 		pid:   pid,
 		ws:    conn,
-		_send: make(chan []byte, MaxMessageSize),
+		_send: make(chan wsMessage, MaxMessageSize),
 		_auth: auth,
 		done:  done,
 		config: ConnectConfig{
@@ -216,6 +249,14 @@ func (c *WSClient) ConnectConfig() ConnectConfig {
 	return c.config
 }
 
+//packetVersion 连接协商的数据包版本
+func (c *WSClient) packetVersion() int64 {
+	if c.version < DataPacketVersionV1 {
+		return DataPacketVersionV1
+	}
+	return c.version
+}
+
 //Close 关闭连接
 func (c *WSClient) close() error {
 	var err error
@@ -262,11 +303,16 @@ func (c *WSClient) RemoteAddr() net.Addr {
 func (c *WSClient) send(data DataPacket) error {
 
 	//log.Emergency("Send DataPacket:", data)
-	respBytes, err := json.Marshal(data)
+	frames, err := c.framer.encode(data)
 	if err != nil {
 		return err
 	}
 
+	messageType := websocket.TextMessage
+	if data.Version >= DataPacketVersionV2 || isFrame(frames[0]) {
+		messageType = websocket.BinaryMessage
+	}
+
 	//if c.auth != nil && c.auth.EnableAuth() {
 	//	respBytes, err = c.auth.EncryptData(respBytes)
 	//	if err != nil {
@@ -275,7 +321,9 @@ func (c *WSClient) send(data DataPacket) error {
 	//}
 
 	//log.Printf("Send: %s\n", string(respBytes))
-	c._send <- respBytes
+	for _, frame := range frames {
+		c._send <- wsMessage{messageType: messageType, data: frame}
+	}
 	return nil
 }
 
@@ -313,9 +361,9 @@ func (c *WSClient) writePump() {
 				return
 			}
 			if Debug {
-				log.Debug("Send: ", string(message))
+				log.Debug("Send: ", string(message.data))
 			}
-			if err := c.write(websocket.TextMessage, message); err != nil {
+			if err := c.write(message.messageType, message.data); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -361,10 +409,15 @@ func (c *WSClient) readPump() {
 			log.Debug("Read: ", string(message))
 		}
 
-		packet := NewDataPacket(gjson.ParseBytes(message))
+		packets, err := c.framer.decode(message)
+		if err != nil {
+			log.Error("peer:", c.PID(), "decode data packet unexpected error: ", err)
+		}
 
-		//开一个goroutine处理消息
-		go c.handler.OnPeerNewDataPacketReceived(c, packet)
+		for _, packet := range packets {
+			//开一个goroutine处理消息
+			go c.handler.OnPeerNewDataPacketReceived(c, packet)
+		}
 
 	}
 }
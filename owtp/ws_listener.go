@@ -23,6 +23,7 @@ import (
 	"github.com/pkg/errors"
 	"net"
 	"net/http"
+	"strconv"
 )
 
 //Listener 监听接口定义
@@ -67,7 +68,15 @@ func (l *wsListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(context.Background())
 	httpCtx := r.Context()
 
-	c, err := upgrader.Upgrade(w, r, nil)
+	//客户端支持v2时，响应协商的数据包版本
+	responseHeader := http.Header{}
+	if version := negotiatePacketVersion(r.Header.Get(packetVersionHeader)); version >= DataPacketVersionV2 {
+		responseHeader.Set(packetVersionHeader, strconv.FormatInt(version, 10))
+	}
+	//响应协商的分片和压缩选项
+	negotiateFrameOptions(r.Header).setHeader(responseHeader)
+
+	c, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		http.Error(w, "Failed to upgrade websocket", 400)
 		return
@@ -210,6 +210,25 @@ func (rp *Provider) SessionRead(sid string) (session.Store, error) {
 	return rs, nil
 }
 
+// SessionClaim save redis session only if sid does not exist, using SET NX EX
+func (rp *Provider) SessionClaim(sid string, values map[interface{}]interface{}) (bool, error) {
+	b, err := session.EncodeGob(values)
+	if err != nil {
+		return false, err
+	}
+	c := rp.poollist.Get()
+	defer c.Close()
+
+	_, err = redis.String(c.Do("SET", sid, string(b), "EX", rp.maxlifetime, "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // SessionExist check redis session exist by sid
 func (rp *Provider) SessionExist(sid string) bool {
 	c := rp.poollist.Get()
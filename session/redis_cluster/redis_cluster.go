@@ -174,6 +174,15 @@ func (rp *Provider) SessionRead(sid string) (session.Store, error) {
 	return rs, nil
 }
 
+// SessionClaim save redis_cluster session only if sid does not exist, using SETNX
+func (rp *Provider) SessionClaim(sid string, values map[interface{}]interface{}) (bool, error) {
+	b, err := session.EncodeGob(values)
+	if err != nil {
+		return false, err
+	}
+	return rp.poollist.SetNX(sid, string(b), time.Duration(rp.maxlifetime)*time.Second).Result()
+}
+
 // SessionExist check redis_cluster session exist by sid
 func (rp *Provider) SessionExist(sid string) bool {
 	c := rp.poollist
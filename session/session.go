@@ -64,6 +64,13 @@ type Provider interface {
 	SessionGC()
 }
 
+// Claimer is an optional interface of Provider.
+// SessionClaim saves the values only if sid does not exist and reports whether it is saved,
+// the check and save are atomic even when the provider is shared by several processes.
+type Claimer interface {
+	SessionClaim(sid string, values map[interface{}]interface{}) (bool, error)
+}
+
 var provides = make(map[string]Provider)
 
 // SLogger a helpful variable to log information about session
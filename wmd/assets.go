@@ -51,6 +51,14 @@ type WalletManagerInterface interface {
 	RestoreWalletFlow() error
 }
 
+//MnemonicWalletManagerInterface 支持助记词的钱包管理器，可选实现
+type MnemonicWalletManagerInterface interface {
+	//创建钱包并生成助记词流程
+	CreateWalletWithMnemonicFlow() error
+	//通过助记词恢复钱包流程
+	RestoreWalletWithMnemonicFlow() error
+}
+
 // 节点管理接口
 type NodeManagerInterface interface {
 	// GetNodeStatus 节点状态